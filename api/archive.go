@@ -0,0 +1,41 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/libgo/errors"
+	"github.com/virtengine/vertice/api/context"
+	"github.com/virtengine/vertice/carton"
+)
+
+var openExport = carton.OpenExport
+
+//archiveDownload sends the archive a backup of the user was exported to, another
+//region imports it with this url in its archive_hosts.
+func archiveDownload(w http.ResponseWriter, r *http.Request) error {
+	token := context.GetAuthToken(r)
+	if token == nil {
+		return &errors.HTTP{Code: http.StatusUnauthorized, Message: "no token provided"}
+	}
+	user, err := token.User()
+	if err != nil {
+		return err
+	}
+	id := r.URL.Query().Get(":id")
+	f, err := openExport(id, user.Email)
+	if err != nil {
+		log.Debugf("%s of %s: %s", r.URL.Path, user.Email, err)
+		return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("archive of backup %s not found", id)}
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+".tar"))
+	http.ServeContent(w, r, id+".tar", fi.ModTime(), f)
+	return nil
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/virtengine/libgo/errors"
+	"github.com/virtengine/vertice/api/context"
+	"github.com/virtengine/vertice/carton"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestArchiveDownload(c *check.C) {
+	path := filepath.Join(c.MkDir(), "BAK1.tar")
+	c.Assert(ioutil.WriteFile(path, []byte("the archive"), 0600), check.IsNil)
+	defer func() { openExport = carton.OpenExport }()
+	openExport = func(id, account string) (*os.File, error) {
+		if id != "BAK1" || account != "info@megam.io" {
+			return nil, carton.Permanent(fmt.Errorf("backup %s is not of the account %s", id, account))
+		}
+		return os.Open(path)
+	}
+	t, err := Auth("info@megam.io", "aaaa")
+	c.Assert(err, check.IsNil)
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/backups/BAK1/archive?:id=BAK1", nil)
+	c.Assert(err, check.IsNil)
+	context.SetAuthToken(request, t)
+	defer context.Clear(request)
+	c.Assert(archiveDownload(recorder, request), check.IsNil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-tar")
+	c.Assert(recorder.Body.String(), check.Equals, "the archive")
+
+	request, err = http.NewRequest("GET", "/backups/BAK2/archive?:id=BAK2", nil)
+	c.Assert(err, check.IsNil)
+	context.SetAuthToken(request, t)
+	defer context.Clear(request)
+	err = archiveDownload(httptest.NewRecorder(), request)
+	c.Assert(err, check.FitsTypeOf, &errors.HTTP{})
+	c.Assert(err.(*errors.HTTP).Code, check.Equals, http.StatusNotFound)
+
+	request, err = http.NewRequest("GET", "/backups/BAK1/archive?:id=BAK1", nil)
+	c.Assert(err, check.IsNil)
+	err = archiveDownload(httptest.NewRecorder(), request)
+	c.Assert(err.(*errors.HTTP).Code, check.Equals, http.StatusUnauthorized)
+}
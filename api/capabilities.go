@@ -0,0 +1,14 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/virtengine/vertice/provision"
+)
+
+//capabilities lists the operations every provisioner runs, by its name.
+func capabilities(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(provision.CapabilityMatrix())
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/virtengine/vertice/provision"
+	"gopkg.in/check.v1"
+)
+
+type capableProvisioner struct {
+	provision.Provisioner
+}
+
+func (capableProvisioner) Capabilities() []provision.Capability {
+	return []provision.Capability{provision.CapStop, provision.CapStart}
+}
+
+func (s *S) TestCapabilities(c *check.C) {
+	provision.Register("capable", capableProvisioner{})
+	defer provision.Unregister("capable")
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/capabilities", nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(capabilities(recorder, request), check.IsNil)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+
+	var matrix map[string][]string
+	c.Assert(json.NewDecoder(recorder.Body).Decode(&matrix), check.IsNil)
+	c.Assert(matrix["capable"], check.DeepEquals, []string{"start", "stop"})
+}
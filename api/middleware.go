@@ -14,12 +14,32 @@ import (
 	"github.com/virtengine/vertice/auth"
 )
 
+//the account the token of a request belongs to.
+const emailHeader = "X-Megam-EMAIL"
+
+//the routes open to anyone, the others need a token.
+var publicPaths = map[string]bool{
+	"/ping":         true,
+	"/capabilities": true,
+}
+
 func validate(token string, r *http.Request) (auth.Token, error) {
-	t, err := Auth(token)
+	value, err := auth.ParseToken(token)
 	if err != nil {
 		return nil, err
 	}
-	return t, nil
+	return Auth(r.Header.Get(emailHeader), value)
+}
+
+//requestToken is the token of the Authorization header. A browser can't set the
+//headers of a websocket (the logs, the shell and the vnc), it sends the token and
+//its user in the query instead.
+func requestToken(r *http.Request) (auth.Token, error) {
+	if token := r.Header.Get("Authorization"); token != "" {
+		return validate(token, r)
+	}
+	q := r.URL.Query()
+	return Auth(q.Get("user"), q.Get("token"))
 }
 
 func contextClearerMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
@@ -56,19 +76,20 @@ func errorHandlingMiddleware(w http.ResponseWriter, r *http.Request, next http.H
 }
 
 func authTokenMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-	token := r.Header.Get("Authorization")
-	if token != "" {
-		t, err := validate(token, r)
-		if err != nil {
-			if err != auth.ErrInvalidToken {
-				context.AddRequestError(r, err)
-				return
-			}
-			log.Debugf("Ignored invalid token for %s: %s", r.URL.Path, err.Error())
-		} else {
-			context.SetAuthToken(r, t)
+	if publicPaths[r.URL.Path] {
+		next(w, r)
+		return
+	}
+	t, err := requestToken(r)
+	if err != nil {
+		if err == auth.ErrInvalidToken || err == auth.ErrUserNotFound {
+			log.Debugf("Refused invalid token of %s for %s", r.Header.Get(emailHeader), r.URL.Path)
+			err = &errors.HTTP{Code: http.StatusUnauthorized, Message: auth.ErrInvalidToken.Error()}
 		}
+		context.AddRequestError(r, err)
+		return
 	}
+	context.SetAuthToken(r, t)
 	next(w, r)
 }
 
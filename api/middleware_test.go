@@ -9,6 +9,7 @@ import (
 	"github.com/virtengine/libgo/errors"
 	"github.com/virtengine/libgo/io"
 	"github.com/virtengine/vertice/api/context"
+	"github.com/virtengine/vertice/auth"
 	"gopkg.in/check.v1"
 )
 
@@ -91,14 +92,41 @@ func (s *S) TestErrorHandlingMiddlewareWithHTTPError(c *check.C) {
 }
 
 func (s *S) TestAuthTokenMiddlewareWithoutToken(c *check.C) {
+	for _, path := range []string{"/", "/logs/", "/shell/info@megam.io/AMS1/ASM1"} {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest("GET", path, nil)
+		c.Assert(err, check.IsNil)
+		h, log := doHandler()
+		errorHandlingMiddleware(recorder, request, func(w http.ResponseWriter, r *http.Request) {
+			authTokenMiddleware(w, r, h)
+		})
+		c.Assert(log.called, check.Equals, false, check.Commentf("%s", path))
+		c.Assert(recorder.Code, check.Equals, http.StatusUnauthorized)
+	}
+}
+
+func (s *S) TestAuthTokenMiddlewareOnPublicPaths(c *check.C) {
+	for _, path := range []string{"/ping", "/capabilities"} {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest("GET", path, nil)
+		c.Assert(err, check.IsNil)
+		h, log := doHandler()
+		authTokenMiddleware(recorder, request, h)
+		c.Assert(log.called, check.Equals, true)
+		c.Assert(context.GetAuthToken(request), check.IsNil)
+	}
+}
+
+func (s *S) TestAuthTokenMiddlewareWithQueryToken(c *check.C) {
 	recorder := httptest.NewRecorder()
-	request, err := http.NewRequest("GET", "/", nil)
+	request, err := http.NewRequest("GET", "/logs/?EIO=3&transport=websocket&user=info@megam.io&token=aaaa", nil)
 	c.Assert(err, check.IsNil)
 	h, log := doHandler()
 	authTokenMiddleware(recorder, request, h)
 	c.Assert(log.called, check.Equals, true)
 	t := context.GetAuthToken(request)
-	c.Assert(t, check.IsNil)
+	c.Assert(t, check.NotNil)
+	c.Assert(t.GetUserName(), check.Equals, "info@megam.io")
 }
 
 func (s *S) TestAuthTokenMiddlewareWithToken(c *check.C) {
@@ -106,6 +134,7 @@ func (s *S) TestAuthTokenMiddlewareWithToken(c *check.C) {
 	request, err := http.NewRequest("GET", "/", nil)
 	c.Assert(err, check.IsNil)
 	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set(emailHeader, s.token.GetUserName())
 	h, log := doHandler()
 	authTokenMiddleware(recorder, request, h)
 	c.Assert(log.called, check.Equals, true)
@@ -113,6 +142,46 @@ func (s *S) TestAuthTokenMiddlewareWithToken(c *check.C) {
 	c.Assert(t, check.NotNil)
 	c.Assert(t.GetValue(), check.Equals, s.token.GetValue())
 	c.Assert(t.GetUserName(), check.Equals, s.token.GetUserName())
+	u, err := t.User()
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Email, check.Equals, "info@megam.io")
+}
+
+func (s *S) TestAuthTokenMiddlewareWithInvalidToken(c *check.C) {
+	for _, tc := range []struct{ email, token string }{
+		{"info@megam.io", "bearer bbbb"},
+		{"", "bearer aaaa"},
+		{"unknown@megam.io", "bearer aaaa"},
+		{"blocked@megam.io", "bearer aaaa"},
+		{"info@megam.io", "type ble ble"},
+	} {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest("GET", "/", nil)
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Authorization", tc.token)
+		request.Header.Set(emailHeader, tc.email)
+		h, log := doHandler()
+		errorHandlingMiddleware(recorder, request, func(w http.ResponseWriter, r *http.Request) {
+			authTokenMiddleware(w, r, h)
+		})
+		c.Assert(log.called, check.Equals, false)
+		c.Assert(recorder.Code, check.Equals, http.StatusUnauthorized, check.Commentf("%s %s", tc.email, tc.token))
+		c.Assert(context.GetAuthToken(request), check.IsNil)
+	}
+}
+
+func (s *S) TestAuthCachesTheValidTokens(c *check.C) {
+	for i := 0; i < 3; i++ {
+		t, err := Auth("info@megam.io", "aaaa")
+		c.Assert(err, check.IsNil)
+		c.Assert(t.GetUserName(), check.Equals, "info@megam.io")
+	}
+	c.Assert(s.lookup, check.Equals, 1)
+	_, err := Auth("info@megam.io", "bbbb")
+	c.Assert(err, check.Equals, auth.ErrInvalidToken)
+	_, err = Auth("info@megam.io", "bbbb")
+	c.Assert(err, check.Equals, auth.ErrInvalidToken)
+	c.Assert(s.lookup, check.Equals, 3)
 }
 
 func (s *S) TestRunDelayedHandlerWithoutHandler(c *check.C) {
@@ -51,13 +51,15 @@ func NewNegHandler() *negroni.Negroni {
 	m.Add("Post", "/logs/", socketServer)
 	m.Add("Get", "/logs/", socketServer)
 	m.Add("Get", "/ping", Handler(ping))
-	m.Add("Get", "/vnc/", Handler(vnc))
+	m.Add("Get", "/capabilities", Handler(capabilities))
+	m.Add("Get", "/backups/{id}/archive", Handler(archiveDownload))
 
 	socketHandler(socketServer)
 
 	// Shell also doesn't use {app} on purpose. Middlewares don't play well
 	// with websocket.
 	m.Add("Get", "/shell/{email}/{asmsid}/{id}", websocket.Handler(remoteShellHandler))
+	m.Add("Get", "/vnc/{email}/{asmsid}/{id}", http.HandlerFunc(vncProxy))
 
 	n := negroni.New()
 	n.Use(negroni.NewRecovery())
@@ -1,17 +1,41 @@
 package api
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
-	//"strconv"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/virtengine/libgo/errors"
-	//"github.com/virtengine/vertice/api/context"
+	"github.com/virtengine/vertice/api/context"
+	"github.com/virtengine/vertice/auth"
 	"github.com/virtengine/vertice/carton"
 	"github.com/virtengine/vertice/provision"
 	"golang.org/x/net/websocket"
 )
 
+const (
+	//the kinds of the messages of the client of a shell.
+	shellInput  = '0'
+	shellResize = '1'
+
+	defaultWidth  = 140
+	defaultHeight = 38
+	defaultTerm   = "xterm"
+	maxTermSize   = 1000
+)
+
+var (
+	getCarton = carton.NewCarton
+	userOrgs  = carton.UserOrgs
+
+	termRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._+-]{0,31}$`)
+)
+
 func remoteShellHandler(ws *websocket.Conn) {
 	var httpErr *errors.HTTP
 	defer func() {
@@ -28,67 +52,219 @@ func remoteShellHandler(ws *websocket.Conn) {
 		}
 	}()
 	r := ws.Request()
-	/*token := context.GetAuthToken(r)
-	if token == nil {
+	token, box, err := shellBox(r)
+	if err != nil {
+		if herr, ok := err.(*errors.HTTP); ok {
+			httpErr = herr
+		} else {
+			httpErr = &errors.HTTP{
+				Code:    http.StatusInternalServerError,
+				Message: err.Error(),
+			}
+		}
+		return
+	}
+	p, ok := carton.ProvisionerMap[box.Provider]
+	if !ok {
 		httpErr = &errors.HTTP{
-			Code:    http.StatusUnauthorized,
-			Message: "no token provided",
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("no provisioner %s for box %s", box.Provider, box.GetFullName()),
 		}
 		return
-	}*/
-	/*user, err := token.User()
+	}
+	width, height, term := termOf(r.URL.Query())
+	conn := newShellConn(ws)
+	opts := provision.ShellOptions{
+		Box:    box,
+		Conn:   conn,
+		Width:  width,
+		Height: height,
+		Unit:   box.Id,
+		Term:   term,
+		Resize: conn.resize,
+	}
+	audit := log.WithFields(log.Fields{
+		"user":     token.GetUserName(),
+		"account":  box.AccountId,
+		"assembly": box.CartonId,
+		"box":      box.GetFullName(),
+		"remote":   r.RemoteAddr,
+	})
+	audit.Info("shell session opened")
+	start := time.Now()
+	err = p.Shell(opts)
+	audit = audit.WithField("duration", time.Since(start).String())
 	if err != nil {
+		audit.WithField("error", err.Error()).Warn("shell session closed")
 		httpErr = &errors.HTTP{
 			Code:    http.StatusInternalServerError,
 			Message: err.Error(),
 		}
 		return
-	}*/
-	assembly_id := r.URL.Query().Get(":id") //send the assembly_id
-	asmsid := r.URL.Query().Get(":asmsid")
-	account_id := r.URL.Query().Get(":email")
-	car, err := getBox(asmsid, assembly_id, account_id)
+	}
+	audit.Info("shell session closed")
+}
+
+//shellToken is the token of the request. A browser can't set the headers of a
+//websocket, it sends the token and its user in the query instead.
+func shellToken(r *http.Request) (auth.Token, error) {
+	if t := context.GetAuthToken(r); t != nil {
+		return t, nil
+	}
+	q := r.URL.Query()
+	return Auth(q.Get("user"), q.Get("token"))
+}
+
+//shellCarton returns the assembly of the request, the user of the token owns
+//it or is a member of its organization.
+func shellCarton(r *http.Request) (auth.Token, *carton.Carton, error) {
+	token, err := shellToken(r)
+	if err == auth.ErrInvalidToken {
+		return nil, nil, &errors.HTTP{Code: http.StatusUnauthorized, Message: "no token provided"}
+	} else if err != nil {
+		return nil, nil, err
+	}
+	user, err := token.User()
 	if err != nil {
-		if herr, ok := err.(*errors.HTTP); ok {
-			httpErr = herr
-		} else {
-			httpErr = &errors.HTTP{
-				Code:    http.StatusInternalServerError,
-				Message: err.Error(),
-			}
+		return nil, nil, err
+	}
+	q := r.URL.Query()
+	id := q.Get(":id") //the assembly_id
+	c, err := getCarton(q.Get(":asmsid"), id, q.Get(":email"))
+	if err != nil {
+		log.Debugf("%s of %s on assembly %s: %s", r.URL.Path, user.Email, id, err)
+		return nil, nil, &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("assembly %s not found", id)}
+	}
+	if !member(user, c) {
+		log.Warnf("refused %s of %s on assembly %s of %s", r.URL.Path, user.Email, id, c.AccountId)
+		return nil, nil, &errors.HTTP{Code: http.StatusForbidden, Message: fmt.Sprintf("no access to assembly %s", id)}
+	}
+	return token, c, nil
+}
+
+//shellBox returns the box the user of the token opens a shell on.
+func shellBox(r *http.Request) (auth.Token, *provision.Box, error) {
+	token, c, err := shellCarton(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	box, err := pickBox(c, r.URL.Query().Get("unit"))
+	if err != nil {
+		return nil, nil, err
+	}
+	return token, box, nil
+}
+
+func member(user *auth.User, c *carton.Carton) bool {
+	if user.Email == c.AccountId {
+		return true
+	}
+	if c.OrgId == "" {
+		return false
+	}
+	orgs, err := userOrgs(user.Email)
+	if err != nil {
+		log.Debugf("organizations of %s: %s", user.Email, err)
+		return false
+	}
+	for _, o := range orgs {
+		if o.Id == c.OrgId {
+			return true
 		}
-		return
 	}
-	boxId := r.URL.Query().Get(":id")
-	//width, _ := strconv.Atoi(r.URL.Query().Get("width"))
-	//height, _ := strconv.Atoi(r.URL.Query().Get("height"))
-	//term := r.URL.Query().Get("term")
-	width := 140
-	height := 38
-	term := "xterm"
-	log.Debugf("%s %s %s %s", boxId, width, height, term)
-
-	for _, box := range *car.Boxes {
-		opts := provision.ShellOptions{
-			Box:    &box,
-			Conn:   ws,
-			Width:  width,
-			Height: height,
-			Unit:   boxId,
-			Term:   term,
+	return false
+}
+
+//pickBox returns the box of the unit, the only box of the carton when the
+//request names none.
+func pickBox(c *carton.Carton, unit string) (*provision.Box, error) {
+	var boxes []provision.Box
+	if c.Boxes != nil {
+		boxes = *c.Boxes
+	}
+	if unit == "" {
+		if len(boxes) == 1 {
+			return &boxes[0], nil
 		}
-		err = carton.ProvisionerMap[box.Provider].Shell(opts) //BUG: we need get the provisioner of the correct provider
-		if err != nil {
-			httpErr = &errors.HTTP{
-				Code:    http.StatusInternalServerError,
-				Message: err.Error(),
-			}
+		return nil, &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("assembly %s has %d boxes, pick one with unit", c.Name, len(boxes)),
 		}
 	}
+	for i := range boxes {
+		if boxes[i].Id == unit {
+			return &boxes[i], nil
+		}
+	}
+	return nil, &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("box %s not found in assembly %s", unit, c.Name)}
+}
+
+//termOf reads the size and the TERM of the terminal of the client, the
+//defaults stand for the ones it has not or odd ones.
+func termOf(q url.Values) (int, int, string) {
+	width, height, term := defaultWidth, defaultHeight, defaultTerm
+	if w, err := strconv.Atoi(q.Get("width")); err == nil && w > 0 && w <= maxTermSize {
+		width = w
+	}
+	if h, err := strconv.Atoi(q.Get("height")); err == nil && h > 0 && h <= maxTermSize {
+		height = h
+	}
+	if t := q.Get("term"); termRegexp.MatchString(t) {
+		term = t
+	}
+	return width, height, term
 }
 
-//Return the Box object ?  Get the carton, and make a Box
-func getBox(asmsid string, id string, account_id string) (*carton.Carton, error) {
-	c, err := carton.NewCarton(asmsid, id, account_id)
-	return c, err
+//shellConn is the websocket of a shell. A message of the client starts with its
+//kind, shellInput for what the user typed or shellResize for a new size of its
+//terminal as in 1{"width":80,"height":24}.
+type shellConn struct {
+	*websocket.Conn
+	resize chan provision.TermSize
+	input  []byte
+	closed bool
+}
+
+func newShellConn(ws *websocket.Conn) *shellConn {
+	return &shellConn{Conn: ws, resize: make(chan provision.TermSize, 1)}
+}
+
+//Read returns the input of the shell, the resizes go to the resize channel. It
+//is closed once the client goes away.
+func (c *shellConn) Read(b []byte) (int, error) {
+	for len(c.input) == 0 {
+		var msg []byte
+		if err := websocket.Message.Receive(c.Conn, &msg); err != nil {
+			if !c.closed {
+				c.closed = true
+				close(c.resize)
+			}
+			return 0, err
+		}
+		if len(msg) == 0 {
+			continue
+		}
+		switch msg[0] {
+		case shellInput:
+			c.input = msg[1:]
+		case shellResize:
+			var size provision.TermSize
+			err := json.Unmarshal(msg[1:], &size)
+			if err != nil || size.Width <= 0 || size.Height <= 0 || size.Width > maxTermSize || size.Height > maxTermSize {
+				log.Debugf("ignored the resize %q of a shell", msg[1:])
+				continue
+			}
+			//a shell late on its resizes only gets the last one.
+			select {
+			case <-c.resize:
+			default:
+			}
+			c.resize <- size
+		default:
+			log.Debugf("ignored a message of kind %q of a shell", msg[0])
+		}
+	}
+	n := copy(b, c.input)
+	c.input = c.input[n:]
+	return n, nil
 }
@@ -1,5 +1,143 @@
 package api
 
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/virtengine/libgo/errors"
+	"github.com/virtengine/vertice/api/context"
+	"github.com/virtengine/vertice/auth"
+	"github.com/virtengine/vertice/carton"
+	"github.com/virtengine/vertice/provision"
+	"golang.org/x/net/websocket"
+	"gopkg.in/check.v1"
+)
+
+//shellRequest is the request of a shell, as the router hands it over.
+func shellRequest(c *check.C, email, query string) *http.Request {
+	v, err := url.ParseQuery(query)
+	c.Assert(err, check.IsNil)
+	v.Set(":email", email)
+	v.Set(":asmsid", "AMS1")
+	v.Set(":id", "ASM1")
+	r, err := http.NewRequest("GET", "/shell/"+email+"/AMS1/ASM1?"+v.Encode(), nil)
+	c.Assert(err, check.IsNil)
+	return r
+}
+
+func (s *S) fakeCarton(boxes ...provision.Box) {
+	getCarton = func(asmsid, id, email string) (*carton.Carton, error) {
+		if email != "info@megam.io" || id != "ASM1" {
+			return nil, fmt.Errorf("no assembly %s", id)
+		}
+		return &carton.Carton{Id: id, CartonsId: asmsid, Name: "web1", AccountId: email, OrgId: "ORG1", Boxes: &boxes}, nil
+	}
+	userOrgs = func(email string) ([]carton.Organization, error) {
+		if email == "member@megam.io" {
+			return []carton.Organization{{Id: "ORG1"}}, nil
+		}
+		return []carton.Organization{{Id: "ORG2"}}, nil
+	}
+}
+
+func (s *S) shellErr(c *check.C, r *http.Request) int {
+	_, _, err := shellBox(r)
+	c.Assert(err, check.NotNil)
+	herr, ok := err.(*errors.HTTP)
+	c.Assert(ok, check.Equals, true, check.Commentf("%s", err))
+	return herr.Code
+}
+
+func (s *S) TestShellBox(c *check.C) {
+	s.fakeCarton(provision.Box{Id: "BOX1", CartonName: "web1", AccountId: "info@megam.io"})
+	r := shellRequest(c, "info@megam.io", "")
+	c.Assert(s.shellErr(c, r), check.Equals, http.StatusUnauthorized)
+
+	tok, err := Auth("info@megam.io", "aaaa")
+	c.Assert(err, check.IsNil)
+	context.SetAuthToken(r, tok)
+	t, box, err := shellBox(r)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.GetUserName(), check.Equals, "info@megam.io")
+	c.Assert(box.Id, check.Equals, "BOX1")
+
+	//a browser sends the token in the query.
+	_, box, err = shellBox(shellRequest(c, "info@megam.io", "user=info@megam.io&token=aaaa&unit=BOX1"))
+	c.Assert(err, check.IsNil)
+	c.Assert(box.Id, check.Equals, "BOX1")
+	r = shellRequest(c, "info@megam.io", "user=info@megam.io&token=bbbb")
+	c.Assert(s.shellErr(c, r), check.Equals, http.StatusUnauthorized)
+	r = shellRequest(c, "other@megam.io", "user=info@megam.io&token=aaaa")
+	c.Assert(s.shellErr(c, r), check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestShellBoxOfAnotherAccount(c *check.C) {
+	s.fakeCarton(provision.Box{Id: "BOX1"})
+	getUser = func(email string) (*auth.User, error) {
+		return &auth.User{Email: email, APIKey: "aaaa"}, nil
+	}
+	defer func() { getUser = s.gatewayUser }()
+	r := shellRequest(c, "info@megam.io", "user=thief@megam.io&token=aaaa")
+	c.Assert(s.shellErr(c, r), check.Equals, http.StatusForbidden)
+
+	//a member of the organization of the assembly.
+	_, box, err := shellBox(shellRequest(c, "info@megam.io", "user=member@megam.io&token=aaaa"))
+	c.Assert(err, check.IsNil)
+	c.Assert(box.Id, check.Equals, "BOX1")
+}
+
+func (s *S) TestShellBoxPicksTheUnit(c *check.C) {
+	s.fakeCarton(provision.Box{Id: "BOX1"}, provision.Box{Id: "BOX2"})
+	r := shellRequest(c, "info@megam.io", "user=info@megam.io&token=aaaa")
+	c.Assert(s.shellErr(c, r), check.Equals, http.StatusBadRequest)
+	_, box, err := shellBox(shellRequest(c, "info@megam.io", "user=info@megam.io&token=aaaa&unit=BOX2"))
+	c.Assert(err, check.IsNil)
+	c.Assert(box.Id, check.Equals, "BOX2")
+	r = shellRequest(c, "info@megam.io", "user=info@megam.io&token=aaaa&unit=BOX3")
+	c.Assert(s.shellErr(c, r), check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestTermOf(c *check.C) {
+	w, h, term := termOf(url.Values{})
+	c.Assert([]interface{}{w, h, term}, check.DeepEquals, []interface{}{140, 38, "xterm"})
+	q, _ := url.ParseQuery("width=80&height=24&term=xterm-256color")
+	w, h, term = termOf(q)
+	c.Assert([]interface{}{w, h, term}, check.DeepEquals, []interface{}{80, 24, "xterm-256color"})
+	q, _ = url.ParseQuery("width=-1&height=100000&term=xterm;rm+-rf")
+	w, h, term = termOf(q)
+	c.Assert([]interface{}{w, h, term}, check.DeepEquals, []interface{}{140, 38, "xterm"})
+}
+
+func (s *S) TestShellConn(c *check.C) {
+	type read struct {
+		input string
+		sizes []provision.TermSize
+	}
+	done := make(chan read, 1)
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		conn := newShellConn(ws)
+		in, _ := ioutil.ReadAll(conn)
+		var sizes []provision.TermSize
+		for size := range conn.resize {
+			sizes = append(sizes, size)
+		}
+		done <- read{string(in), sizes}
+	}))
+	defer server.Close()
+	ws, err := websocket.Dial("ws"+server.URL[len("http"):], "", "http://localhost/")
+	c.Assert(err, check.IsNil)
+	for _, msg := range []string{"0ls\n", `1{"width":80,"height":24}`, "1garbage", `1{"width":0,"height":24}`, "2what", "0pwd\n"} {
+		c.Assert(websocket.Message.Send(ws, msg), check.IsNil)
+	}
+	ws.Close()
+	r := <-done
+	c.Assert(r.input, check.Equals, "ls\npwd\n")
+	c.Assert(r.sizes, check.DeepEquals, []provision.TermSize{{Width: 80, Height: 24}})
+}
+
 /*
 func (s *S) TestAppShellSpecifyUnit(c *check.C) {
 	a := app.App{
@@ -3,13 +3,15 @@ package api
 import (
 	"testing"
 
+	"github.com/virtengine/vertice/auth"
 	"gopkg.in/check.v1"
 )
 
 func Test(t *testing.T) { check.TestingT(t) }
 
 type S struct {
-	token Token
+	token  Token
+	lookup int
 }
 
 var _ = check.Suite(&S{})
@@ -21,6 +23,24 @@ func resetHandlers() {
 func (s *S) SetUpSuite(c *check.C) {
 	s.token = getTok()
 	c.Assert(s.token.GetUserName(), check.Equals, "info@megam.io")
+	getUser = s.gatewayUser
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	tokens = auth.NewCache(tokenTTL)
+	s.lookup = 0
+}
+
+//gatewayUser is the account of the gateway, without a gateway.
+func (s *S) gatewayUser(email string) (*auth.User, error) {
+	s.lookup++
+	switch email {
+	case "info@megam.io":
+		return &auth.User{Email: email, APIKey: "aaaa"}, nil
+	case "blocked@megam.io":
+		return &auth.User{Email: email, APIKey: "aaaa", Blocked: true}, nil
+	}
+	return nil, auth.ErrUserNotFound
 }
 
 func getTok() Token {
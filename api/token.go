@@ -1,10 +1,24 @@
 package api
 
-import "github.com/virtengine/vertice/auth"
+import (
+	"crypto/subtle"
+	"time"
+
+	"github.com/virtengine/vertice/auth"
+)
+
+//how long a token the gateway validated is trusted without asking it again.
+const tokenTTL = 5 * time.Minute
+
+var (
+	tokens  = auth.NewCache(tokenTTL)
+	getUser = auth.GetUserByEmail
+)
 
 type Token struct {
 	Token     string
 	UserEmail string
+	user      *auth.User
 }
 
 func (t *Token) GetValue() string {
@@ -12,6 +26,9 @@ func (t *Token) GetValue() string {
 }
 
 func (t *Token) User() (*auth.User, error) {
+	if t.user != nil {
+		return t.user, nil
+	}
 	return auth.GetUserByEmail(t.UserEmail)
 }
 
@@ -19,10 +36,23 @@ func (t *Token) GetUserName() string {
 	return t.UserEmail
 }
 
-func Auth(t string) (auth.Token, error) {
-	tt := Token{
-		Token:     "aaaa",
-		UserEmail: "info@megam.io",
+// Auth validates the token of the user, the api key of the account on the gateway.
+func Auth(email, t string) (auth.Token, error) {
+	if email == "" || t == "" {
+		return nil, auth.ErrInvalidToken
+	}
+	if u := tokens.Get(email, t); u != nil {
+		return &Token{Token: t, UserEmail: email, user: u}, nil
+	}
+	u, err := getUser(email)
+	if err == auth.ErrUserNotFound {
+		return nil, auth.ErrInvalidToken
+	} else if err != nil {
+		return nil, err
+	}
+	if u.Blocked || u.APIKey == "" || subtle.ConstantTimeCompare([]byte(u.APIKey), []byte(t)) != 1 {
+		return nil, auth.ErrInvalidToken
 	}
-	return &tt, nil
+	tokens.Set(email, t, u)
+	return &Token{Token: t, UserEmail: email, user: u}, nil
 }
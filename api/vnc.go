@@ -1,12 +1,97 @@
 package api
 
 import (
-	//"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/libgo/errors"
+	"github.com/virtengine/vertice/auth"
+	"github.com/virtengine/vertice/carton"
+	"github.com/virtengine/vertice/govnc"
+	"golang.org/x/net/websocket"
+)
+
+var (
+	vncTimeouts = govnc.Timeouts{
+		Dial:    10 * time.Second,
+		Idle:    15 * time.Minute,
+		Session: 4 * time.Hour,
+	}
+
+	vncAddr = func(c *carton.Carton) (string, string, error) {
+		asm, err := carton.NewAssembly(c.Id, c.AccountId, c.OrgId)
+		if err != nil {
+			return "", "", err
+		}
+		host, port := asm.VncAddr()
+		return host, port, nil
+	}
 )
 
-func vnc(w http.ResponseWriter, r *http.Request) error {
+//vncProxy relays a noVNC in the browser to the vnc server of the vm, the
+//console of a vm whose network is broken. The caller is authorized before the
+//websocket opens, noVNC can only tell a refused upgrade.
+func vncProxy(w http.ResponseWriter, r *http.Request) {
+	token, vh, err := vncHost(r)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if herr, ok := err.(*errors.HTTP); ok {
+			code = herr.Code
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	audit := log.WithFields(log.Fields{
+		"user":     token.GetUserName(),
+		"assembly": r.URL.Query().Get(":id"),
+		"vnc":      vh.Addr(),
+		"remote":   r.RemoteAddr,
+	})
+	websocket.Server{
+		Handshake: vncHandshake,
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			ws.PayloadType = websocket.BinaryFrame
+			audit.Info("vnc session opened")
+			start := time.Now()
+			err := govnc.Connect(vh, ws, vncTimeouts)
+			audit = audit.WithField("duration", time.Since(start).String())
+			if err != nil {
+				audit.WithField("error", err.Error()).Warn("vnc session closed")
+				return
+			}
+			audit.Info("vnc session closed")
+		},
+	}.ServeHTTP(w, r)
+}
 
-	return nil
+func vncHost(r *http.Request) (auth.Token, *govnc.VncHost, error) {
+	token, c, err := shellCarton(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	host, port, err := vncAddr(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	if host == "" || port == "" {
+		return nil, nil, &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("assembly %s has no vnc console", c.Name)}
+	}
+	return token, &govnc.VncHost{IpAddress: host, Port: port}, nil
+}
 
+//noVNC asks for the binary subprotocol, or none at all.
+func vncHandshake(config *websocket.Config, r *http.Request) error {
+	if len(config.Protocol) == 0 {
+		return nil
+	}
+	for _, p := range config.Protocol {
+		if p == "binary" {
+			config.Protocol = []string{p}
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported vnc subprotocols %v", config.Protocol)
 }
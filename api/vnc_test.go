@@ -0,0 +1,82 @@
+package api
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/virtengine/vertice/carton"
+	"github.com/virtengine/vertice/provision"
+	"golang.org/x/net/websocket"
+	"gopkg.in/check.v1"
+)
+
+//vncServer is the vnc server of a vm, it echoes what it gets.
+func (s *S) vncServer(c *check.C) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	vncAddr = func(c *carton.Carton) (string, string, error) {
+		if c.Id != "ASM1" {
+			return "", "", nil
+		}
+		return host, port, nil
+	}
+	return l
+}
+
+func (s *S) TestVncProxy(c *check.C) {
+	s.fakeCarton(provision.Box{Id: "BOX1"})
+	l := s.vncServer(c)
+	defer l.Close()
+	server := httptest.NewServer(http.HandlerFunc(vncProxy))
+	defer server.Close()
+	r := shellRequest(c, "info@megam.io", "user=info@megam.io&token=aaaa")
+	cfg, err := websocket.NewConfig("ws"+server.URL[len("http"):]+r.URL.RequestURI(), "http://localhost/")
+	c.Assert(err, check.IsNil)
+	cfg.Protocol = []string{"base64", "binary"}
+	ws, err := websocket.DialConfig(cfg)
+	c.Assert(err, check.IsNil)
+	defer ws.Close()
+	c.Assert(websocket.Message.Send(ws, []byte("RFB 003.008\n")), check.IsNil)
+	var got []byte
+	c.Assert(websocket.Message.Receive(ws, &got), check.IsNil)
+	c.Assert(string(got), check.Equals, "RFB 003.008\n")
+
+	cfg.Protocol = []string{"base64"}
+	_, err = websocket.DialConfig(cfg)
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestVncProxyRefused(c *check.C) {
+	s.fakeCarton(provision.Box{Id: "BOX1"})
+	l := s.vncServer(c)
+	defer l.Close()
+	for _, query := range []string{"", "user=info@megam.io&token=bbbb", "user=blocked@megam.io&token=aaaa"} {
+		rec := httptest.NewRecorder()
+		vncProxy(rec, shellRequest(c, "info@megam.io", query))
+		c.Assert(rec.Code, check.Equals, http.StatusUnauthorized, check.Commentf("%s", query))
+	}
+	rec := httptest.NewRecorder()
+	vncProxy(rec, shellRequest(c, "other@megam.io", "user=info@megam.io&token=aaaa"))
+	c.Assert(rec.Code, check.Equals, http.StatusNotFound)
+
+	vncAddr = func(*carton.Carton) (string, string, error) { return "", "", nil }
+	rec = httptest.NewRecorder()
+	vncProxy(rec, shellRequest(c, "info@megam.io", "user=info@megam.io&token=aaaa"))
+	c.Assert(rec.Code, check.Equals, http.StatusNotFound)
+	c.Assert(rec.Body.String(), check.Equals, "assembly web1 has no vnc console\n")
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+//past that many tokens, a new one sweeps the expired ones.
+const sweepAt = 1024
+
+// Cache keeps the users of the tokens the gateway validated for a while, a
+// request doesn't cost a call to the gateway. A blocked user or a changed api
+// key is noticed once the entry expires.
+type Cache struct {
+	TTL time.Duration
+
+	mu    sync.Mutex
+	users map[string]cached
+	now   func() time.Time
+}
+
+type cached struct {
+	user    *User
+	expires time.Time
+}
+
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{TTL: ttl, users: make(map[string]cached), now: time.Now}
+}
+
+//the tokens are kept hashed, the cache holds no secret.
+func cacheKey(email, token string) string {
+	sum := sha256.Sum256([]byte(email + "\x00" + token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get returns the user of the token, nil when it isn't cached or expired.
+func (c *Cache) Get(email, token string) *User {
+	k := cacheKey(email, token)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.users[k]
+	if !ok {
+		return nil
+	}
+	if !c.now().Before(e.expires) {
+		delete(c.users, k)
+		return nil
+	}
+	return e.user
+}
+
+func (c *Cache) Set(email, token string, u *User) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if len(c.users) >= sweepAt {
+		for k, e := range c.users {
+			if !now.Before(e.expires) {
+				delete(c.users, k)
+			}
+		}
+	}
+	c.users[cacheKey(email, token)] = cached{user: u, expires: now.Add(c.TTL)}
+}
+
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.users)
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"strconv"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestCache(c *check.C) {
+	now := time.Now()
+	cache := NewCache(time.Minute)
+	cache.now = func() time.Time { return now }
+	u := &User{Email: "info@megam.io", APIKey: "aaaa"}
+	c.Assert(cache.Get("info@megam.io", "aaaa"), check.IsNil)
+	cache.Set("info@megam.io", "aaaa", u)
+	c.Assert(cache.Get("info@megam.io", "aaaa"), check.Equals, u)
+	c.Assert(cache.Get("info@megam.io", "bbbb"), check.IsNil)
+	c.Assert(cache.Get("other@megam.io", "aaaa"), check.IsNil)
+
+	now = now.Add(time.Minute)
+	c.Assert(cache.Get("info@megam.io", "aaaa"), check.IsNil)
+	c.Assert(cache.Len(), check.Equals, 0)
+}
+
+func (s *S) TestCacheSweepsExpired(c *check.C) {
+	now := time.Now()
+	cache := NewCache(time.Minute)
+	cache.now = func() time.Time { return now }
+	for i := 0; i < sweepAt; i++ {
+		cache.Set("info@megam.io", strconv.Itoa(i), &User{})
+	}
+	now = now.Add(2 * time.Minute)
+	cache.Set("info@megam.io", "aaaa", &User{})
+	c.Assert(cache.Len(), check.Equals, 1)
+}
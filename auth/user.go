@@ -1,20 +1,57 @@
 package auth
 
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	herrors "github.com/virtengine/libgo/errors"
+	"github.com/virtengine/vertice/carton"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+var getAccount = carton.NewAccounts
+
 type User struct {
-	Email    string
-	Password string
-	APIKey   string
+	Email   string
+	APIKey  string
+	Admin   bool
+	Blocked bool
 }
 
+// GetUserByEmail reads the account of the user on the gateway, with the master key.
 func GetUserByEmail(email string) (*User, error) {
-	/*
-		var u User
-		conn, err := db.Conn()
-		if err != nil {
-			return nil, err
-		}
-
-		return &u, nil
-	*/
-	return nil, nil
+	if email == "" {
+		return nil, ErrUserNotFound
+	}
+	a, err := getAccount(email)
+	if notFound(err) {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if a.Email == "" {
+		return nil, ErrUserNotFound
+	}
+	return userOf(a), nil
+}
+
+//notFound tells the gateway has no account for the email, it answers a 404.
+func notFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	if e, ok := err.(*herrors.HTTP); ok {
+		return e.Code == http.StatusNotFound
+	}
+	return strings.Contains(strings.ToLower(err.Error()), "not found")
+}
+
+func userOf(a *carton.Account) *User {
+	u := &User{Email: a.Email, APIKey: a.ApiKey, Admin: a.IsAdmin()}
+	if a.States != nil {
+		u.Blocked = a.States.Blocked == "true"
+	}
+	return u
 }
@@ -1,31 +1,41 @@
 package auth
 
-//	"gopkg.in/check.v1"
+import (
+	"errors"
+	"net/http"
 
-/*
-func (s *S) TestGetUserByEmail(c *check.C) {
-	u := User{Email: "wolverine@xmen.com", Password: "123456"}
-	err := u.Create()
-	c.Assert(err, check.IsNil)
-	defer u.Delete()
-	u2, err := GetUserByEmail(u.Email)
-	c.Assert(err, check.IsNil)
-	c.Check(u2.Email, check.Equals, u.Email)
-	c.Check(u2.Password, check.Equals, u.Password)
+	herrors "github.com/virtengine/libgo/errors"
+	"github.com/virtengine/vertice/carton"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestUserOf(c *check.C) {
+	u := userOf(&carton.Account{Email: "info@megam.io", ApiKey: "aaaa",
+		States: &carton.States{Authority: "admin", Blocked: "false"}})
+	c.Assert(u, check.DeepEquals, &User{Email: "info@megam.io", APIKey: "aaaa", Admin: true})
+	u = userOf(&carton.Account{Email: "info@megam.io", States: &carton.States{Blocked: "true"}})
+	c.Assert(u.Blocked, check.Equals, true)
+	c.Assert(userOf(&carton.Account{Email: "info@megam.io"}).Admin, check.Equals, false)
 }
 
-func (s *S) TestGetUserByEmailReturnsErrorWhenNoUserIsFound(c *check.C) {
-	u, err := GetUserByEmail("unknown@globo.com")
+func (s *S) TestGetUserByEmailWithoutEmail(c *check.C) {
+	u, err := GetUserByEmail("")
 	c.Assert(u, check.IsNil)
 	c.Assert(err, check.Equals, ErrUserNotFound)
 }
 
-func (s *S) TestGetUserByEmailWithInvalidEmail(c *check.C) {
-	u, err := GetUserByEmail("unknown")
-	c.Assert(u, check.IsNil)
-	c.Assert(err, check.NotNil)
-	e, ok := err.(*errors.ValidationError)
-	c.Assert(ok, check.Equals, true)
-	c.Assert(e.Message, check.Equals, "invalid email")
+func (s *S) TestGetUserByEmailUnknownToTheGateway(c *check.C) {
+	defer func(g func(string) (*carton.Account, error)) { getAccount = g }(getAccount)
+	for _, err := range []error{
+		&herrors.HTTP{Code: http.StatusNotFound, Message: "{}"},
+		errors.New("account unknown@megam.io not found"),
+	} {
+		getAccount = func(string) (*carton.Account, error) { return nil, err }
+		_, uerr := GetUserByEmail("unknown@megam.io")
+		c.Assert(uerr, check.Equals, ErrUserNotFound)
+	}
+	down := &herrors.HTTP{Code: http.StatusBadGateway, Message: "bad gateway"}
+	getAccount = func(string) (*carton.Account, error) { return nil, down }
+	_, err := GetUserByEmail("info@megam.io")
+	c.Assert(err, check.Equals, error(down))
 }
-*/
@@ -0,0 +1,499 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package carton
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/libgo/pairs"
+	constants "github.com/virtengine/libgo/utils"
+	"github.com/virtengine/vertice/meta"
+	"github.com/virtengine/vertice/provision"
+)
+
+const (
+	ARCHIVE_VERSION = 1
+
+	//the output of a backup with the path of its export, or the input of an
+	//assembly with the backup or the url of archive_hosts to import.
+	ARCHIVE = "archive"
+
+	archiveManifest = "manifest.json"
+	archiveImage    = "image"
+	archiveSums     = "SHA256SUMS"
+)
+
+var ErrArchiveChecksum = errors.New("the archive image doesn't match its checksum")
+
+var (
+	getBackup = GetBackup
+
+	backupIdRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+	//a stuck archive server can't hold an import forever.
+	archiveClient = &http.Client{
+		Timeout: 6 * time.Hour,
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: 30 * time.Second}).DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: time.Minute,
+		},
+		CheckRedirect: func(r *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("archive: too many redirects")
+			}
+			if !archiveHostAllowed(r.URL) {
+				return fmt.Errorf("archive redirected to %s, not in archive_hosts", r.URL.Host)
+			}
+			return nil
+		},
+	}
+)
+
+//the inputs of the archived assembly an import brings back, the rest belongs to the
+//region or the account the assembly lived in.
+var restoredInputs = []string{provision.CPU, provision.RAM, provision.HDD, FLAVOR_ID, IMAGE_VERSION, constants.STORAGE_TYPE}
+
+//the inputs, outputs and envs an archive leaves out, an archive travels between
+//regions and its manifest is readable by whoever holds it.
+var secretKeyRegexp = regexp.MustCompile(`(?i)pass|secret|key|token|cred|private|cert`)
+
+type ArchiveImage struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256,omitempty"`
+}
+
+// Manifest is the first entry of an archive, it describes the backup and the
+// assembly it was taken from. The image follows, then its checksum.
+type Manifest struct {
+	Version    int          `json:"version"`
+	ExportedAt time.Time    `json:"exported_at"`
+	Provider   string       `json:"provider"`
+	Region     string       `json:"region"`
+	Backup     *Backups     `json:"backup"`
+	Assembly   *Assembly    `json:"assembly,omitempty"`
+	Components []*Component `json:"components,omitempty"`
+	Image      ArchiveImage `json:"image"`
+}
+
+// WriteArchive writes the manifest, m.Image.Size bytes of img and their checksum as a tar.
+func WriteArchive(w io.Writer, m *Manifest, img io.Reader) error {
+	m.Version = ARCHIVE_VERSION
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	if err = writeEntry(tw, archiveManifest, b, m.ExportedAt); err != nil {
+		return err
+	}
+	if err = tw.WriteHeader(&tar.Header{Name: archiveImage, Mode: 0600, Size: m.Image.Size, ModTime: m.ExportedAt}); err != nil {
+		return err
+	}
+	h := sha256.New()
+	n, err := io.Copy(tw, io.TeeReader(img, h))
+	if err != nil {
+		return err
+	}
+	if n != m.Image.Size {
+		return fmt.Errorf("image %s: read %d bytes of %d", m.Image.Name, n, m.Image.Size)
+	}
+	m.Image.Sha256 = hex.EncodeToString(h.Sum(nil))
+	if err = writeEntry(tw, archiveSums, []byte(m.Image.Sha256+"  "+archiveImage+"\n"), m.ExportedAt); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func writeEntry(tw *tar.Writer, name string, b []byte, at time.Time) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(b)), ModTime: at}); err != nil {
+		return err
+	}
+	_, err := tw.Write(b)
+	return err
+}
+
+// ImageStore saves the image of an archive being read.
+type ImageStore func(m *Manifest, img io.Reader) error
+
+// ReadArchive reads an archive, handing its image to store. The image is checked
+// once stored, a mismatch returns ErrArchiveChecksum. A broken archive is a
+// permanent error, retrying won't fix it.
+func ReadArchive(r io.Reader, store ImageStore) (*Manifest, error) {
+	var (
+		m        *Manifest
+		h        = sha256.New()
+		stored   bool
+		verified bool
+	)
+	tr := tar.NewReader(r)
+	for {
+		hd, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return m, Permanent(err)
+		}
+		switch hd.Name {
+		case archiveManifest:
+			m = &Manifest{}
+			if err = json.NewDecoder(tr).Decode(m); err != nil {
+				return nil, Permanent(fmt.Errorf("archive manifest unreadable: %s", err))
+			}
+			if m.Version != ARCHIVE_VERSION {
+				return nil, Permanent(fmt.Errorf("archive version %d unsupported, expected %d", m.Version, ARCHIVE_VERSION))
+			}
+		case archiveImage:
+			if m == nil {
+				return nil, Permanent(errors.New("archive image found before its manifest"))
+			}
+			if err = store(m, io.TeeReader(tr, h)); err != nil {
+				return m, err
+			}
+			if _, err = io.Copy(h, tr); err != nil { //what the store didn't read.
+				return m, Permanent(err)
+			}
+			stored = true
+		case archiveSums:
+			b, err := ioutil.ReadAll(io.LimitReader(tr, 4096))
+			if err != nil {
+				return m, Permanent(err)
+			}
+			sum := strings.Fields(string(b))
+			if !stored || len(sum) == 0 || sum[0] != hex.EncodeToString(h.Sum(nil)) {
+				return m, Permanent(ErrArchiveChecksum)
+			}
+			verified = true
+		}
+	}
+	if m == nil || !stored || !verified {
+		return m, Permanent(errors.New("archive incomplete, it needs a manifest, an image and its checksum"))
+	}
+	return m, nil
+}
+
+// ExportBackup archives the backup image with the metadata of its assembly.
+func ExportBackup(bk *Backups, b *provision.Box, w io.Writer) (*Manifest, error) {
+	archiver, ok := ProvisionerMap[b.Provider].(provision.ImageArchiver)
+	if !ok {
+		return nil, Permanent(fmt.Errorf("provisioner %s can't export images", b.Provider))
+	}
+	m := &Manifest{ExportedAt: time.Now(), Provider: b.Provider, Region: b.Region, Backup: archivedBackup(bk)}
+	if len(strings.TrimSpace(bk.AssemblyId)) > 1 {
+		asm, err := NewAssembly(bk.AssemblyId, bk.AccountId, bk.OrgId)
+		if err != nil {
+			return nil, err
+		}
+		m.Assembly = archivedAssembly(asm)
+		for _, id := range asm.ComponentIds {
+			if len(strings.TrimSpace(id)) > 1 {
+				comp, err := NewComponent(id, bk.AccountId, bk.OrgId)
+				if err != nil {
+					return nil, err
+				}
+				m.Components = append(m.Components, archivedComponent(comp))
+			}
+		}
+	}
+	img, size, err := archiver.OpenImage(b, bk.Outputs.Match(constants.SOURCE_PATH))
+	if err != nil {
+		return nil, err
+	}
+	defer img.Close()
+	m.Image = ArchiveImage{Name: bk.imageName(), Size: size}
+	return m, WriteArchive(w, m, img)
+}
+
+//archivedBackup is what the manifest tells of the backup, without its secrets.
+func archivedBackup(bk *Backups) *Backups {
+	a := *bk
+	a.Inputs = withoutSecrets(bk.Inputs)
+	a.Outputs = withoutSecrets(bk.Outputs)
+	a.Labels = withoutSecrets(bk.Labels)
+	return &a
+}
+
+//archivedAssembly keeps the inputs an import restores, the outputs belong to the
+//running assembly and hold its vnc or root passwords.
+func archivedAssembly(asm *Assembly) *Assembly {
+	a := &Assembly{
+		Id:           asm.Id,
+		Name:         asm.Name,
+		JsonClaz:     asm.JsonClaz,
+		Tosca:        asm.Tosca,
+		CreatedAt:    asm.CreatedAt,
+		Policies:     asm.Policies,
+		ComponentIds: asm.ComponentIds,
+	}
+	inputs := make(map[string][]string)
+	for _, k := range restoredInputs {
+		if v := asm.Inputs.Match(k); v != "" {
+			inputs[k] = []string{v}
+		}
+	}
+	a.Inputs.NukeAndSet(inputs)
+	return a
+}
+
+//archivedComponent keeps the envs an import restores, the repo and the
+//artifacts are left out with their tokens.
+func archivedComponent(comp *Component) *Component {
+	return &Component{
+		Id:    comp.Id,
+		Name:  comp.Name,
+		Tosca: comp.Tosca,
+		Envs:  withoutSecrets(comp.Envs),
+	}
+}
+
+func withoutSecrets(p pairs.JsonPairs) pairs.JsonPairs {
+	kept := make(pairs.JsonPairs, 0, len(p))
+	for _, kv := range p {
+		if kv != nil && !secretKeyRegexp.MatchString(kv.K) {
+			kept = append(kept, kv)
+		}
+	}
+	return kept
+}
+
+//the archives exported are kept under the vertice dir.
+func archivePath(id string) string {
+	dir := os.TempDir()
+	if meta.MC != nil && meta.MC.Dir != "" {
+		dir = meta.MC.Dir
+	}
+	return filepath.Join(dir, "archives", id+".tar")
+}
+
+//exportBackup writes the archive aside and renames it, a failed export leaves no archive.
+func exportBackup(bk *Backups, b *provision.Box, out io.Writer) error {
+	path := archivePath(bk.Id)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), bk.Id)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	m, err := ExportBackup(bk, b, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "--- backup %s exported to %s (%d bytes, sha256 %s)\n", bk.Id, path, m.Image.Size, m.Image.Sha256)
+	bk.Outputs.NukeAndSet(map[string][]string{ARCHIVE: []string{path}})
+	return bk.UpdateBackup()
+}
+
+//archiveHostAllowed tells whether the archives of the host can be imported,
+//none can unless archive_hosts names it.
+func archiveHostAllowed(u *url.URL) bool {
+	if meta.MC == nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	for _, h := range meta.MC.ArchiveHosts {
+		if strings.EqualFold(u.Hostname(), h) {
+			return true
+		}
+	}
+	return false
+}
+
+//openArchive opens the export of a backup of the account, or downloads the
+//archive from one of the archive_hosts.
+func openArchive(src, account string) (io.ReadCloser, error) {
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		u, err := url.Parse(src)
+		if err != nil {
+			return nil, Permanent(err)
+		}
+		if !archiveHostAllowed(u) {
+			return nil, Permanent(fmt.Errorf("archive host %s is not in archive_hosts", u.Host))
+		}
+		res, err := archiveClient.Get(u.String())
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, fmt.Errorf("archive %s: %s", src, res.Status)
+		}
+		return res.Body, nil
+	}
+	if !backupIdRegexp.MatchString(src) {
+		return nil, Permanent(fmt.Errorf("archive %q is neither a backup nor an url", src))
+	}
+	return OpenExport(src, account)
+}
+
+// OpenExport opens the archive a backup of the account was exported to, the
+// archive_hosts of another region download it from the api.
+func OpenExport(id, account string) (*os.File, error) {
+	if !backupIdRegexp.MatchString(id) {
+		return nil, Permanent(fmt.Errorf("backup id %q is invalid", id))
+	}
+	bk, err := getBackup(id, account)
+	if err != nil {
+		return nil, err
+	}
+	if bk.AccountId != account || bk.Id != id {
+		return nil, Permanent(fmt.Errorf("backup %s is not of the account %s", id, account))
+	}
+	f, err := os.Open(archivePath(bk.Id))
+	if err != nil {
+		return nil, Permanent(fmt.Errorf("backup %s is not exported: %s", id, err))
+	}
+	return f, nil
+}
+
+//importArchive stores the image of the archive and brings back the metadata of the
+//archived assembly the target doesn't set. It returns the name of the stored image.
+func importArchive(src string, asm *Assembly, b *provision.Box, out io.Writer) (string, error) {
+	archiver, ok := ProvisionerMap[b.Provider].(provision.ImageArchiver)
+	if !ok {
+		return "", Permanent(fmt.Errorf("provisioner %s can't import images", b.Provider))
+	}
+	rc, err := openArchive(src, asm.AccountId)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	var name string
+	m, err := ReadArchive(rc, func(m *Manifest, img io.Reader) error {
+		var err error
+		name, err = archiver.StoreImage(b, asm.Name+"-"+m.Image.Name, img, out)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(out, "--- archive of %s (%s, %s) imported as image %s\n", m.Backup.Name, m.Provider, m.Region, name)
+	return name, restoreMetadata(asm, m, name)
+}
+
+func restoreMetadata(asm *Assembly, m *Manifest, image string) error {
+	inputs := make(map[string][]string)
+	if m.Assembly != nil {
+		for _, k := range restoredInputs {
+			if v := m.Assembly.Inputs.Match(k); v != "" && asm.Inputs.Match(k) == "" {
+				inputs[k] = []string{v}
+			}
+		}
+		if len(asm.Policies) == 0 {
+			asm.Policies = m.Assembly.Policies
+		}
+		if asm.Tosca == "" {
+			asm.Tosca = m.Assembly.Tosca
+		}
+	}
+	inputs[BACKUP] = []string{YES}
+	inputs[BACKUPNAME] = []string{image}
+	asm.Inputs.NukeAndSet(inputs)
+	if err := asm.update(); err != nil {
+		return err
+	}
+	//the components are matched in order, only the envs not set are brought back.
+	for i, id := range asm.ComponentIds {
+		if i >= len(m.Components) {
+			break
+		}
+		comp, err := NewComponent(id, asm.AccountId, asm.OrgId)
+		if err != nil {
+			return err
+		}
+		if len(comp.Envs) == 0 && len(m.Components[i].Envs) > 0 {
+			comp.Envs = m.Components[i].Envs
+			if err = comp.updateComponent(asm.AccountId, asm.OrgId); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ExportBackup a carton, which archives its backup with the metadata of its assembly.
+func (c *Carton) ExportBackup() ([]*BoxResult, error) {
+	if len(*c.Boxes) == 0 {
+		return nil, nil
+	}
+	bk, err := GetBackup(c.CartonsId, c.AccountId)
+	if err != nil {
+		return nil, err
+	}
+	return runInBoxes("export backup", (*c.Boxes)[:1], func(b *provision.Box, out io.Writer) error {
+		return exportBackup(bk, b, out)
+	})
+}
+
+// ImportBackup a carton, which deploys the assembly from the archive set in its inputs
+// using BackupDeploy.
+func (c *Carton) ImportBackup() ([]*BoxResult, error) {
+	if len(*c.Boxes) == 0 {
+		return nil, nil
+	}
+	asm, err := NewAssembly(c.Id, c.AccountId, c.OrgId)
+	if err != nil {
+		return nil, err
+	}
+	src := strings.TrimSpace(asm.Inputs.Match(ARCHIVE))
+	if src == "" {
+		return nil, Permanent(fmt.Errorf("assembly %s has no %s to import", c.Id, ARCHIVE))
+	}
+	return runInBoxes("import backup", (*c.Boxes)[:1], func(b *provision.Box, out io.Writer) error {
+		image, err := importArchive(src, asm, b, out)
+		if err != nil {
+			return err
+		}
+		fresh, err := mkCarton(c.CartonsId, c.Id, c.AccountId) //with the metadata restored.
+		if err != nil {
+			return err
+		}
+		fresh.toBox()
+		if len(*fresh.Boxes) == 0 {
+			return fmt.Errorf("assembly %s has no box to deploy", c.Id)
+		}
+		nb := (*fresh.Boxes)[0]
+		nb.Backup = true
+		nb.ImageName = image
+		log.Debugf("  deploying %s from the archive %s", nb.GetFullName(), src)
+		return Deploy(&DeployOpts{B: &nb, Out: out})
+	})
+}
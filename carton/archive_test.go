@@ -0,0 +1,174 @@
+package carton
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/virtengine/vertice/meta"
+	"github.com/virtengine/vertice/provision"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) newManifest(image string) *Manifest {
+	return &Manifest{
+		ExportedAt: time.Now(),
+		Provider:   "one",
+		Region:     "chennai",
+		Backup:     &Backups{Id: "BAK1", Name: "nightly"},
+		Assembly:   &Assembly{Id: "ASM1", Tosca: "tosca.torpedo.ubuntu"},
+		Image:      ArchiveImage{Name: "nightly", Size: int64(len(image))},
+	}
+}
+
+func (s *S) TestArchiveRoundTrip(c *check.C) {
+	var buf bytes.Buffer
+	m := s.newManifest("disk bytes")
+	c.Assert(WriteArchive(&buf, m, strings.NewReader("disk bytes")), check.IsNil)
+	c.Assert(m.Image.Sha256, check.HasLen, 64)
+
+	var stored string
+	read, err := ReadArchive(&buf, func(m *Manifest, img io.Reader) error {
+		b, err := ioutil.ReadAll(img)
+		stored = string(b)
+		return err
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(stored, check.Equals, "disk bytes")
+	c.Assert(read.Version, check.Equals, ARCHIVE_VERSION)
+	c.Assert(read.Assembly.Tosca, check.Equals, "tosca.torpedo.ubuntu")
+	c.Assert(read.Image.Size, check.Equals, int64(10))
+}
+
+func (s *S) TestWriteArchiveShortImage(c *check.C) {
+	m := s.newManifest("disk bytes")
+	c.Assert(WriteArchive(ioutil.Discard, m, strings.NewReader("disk")), check.NotNil)
+}
+
+func (s *S) TestReadArchiveChecksumMismatch(c *check.C) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	m := s.newManifest("disk bytes")
+	m.Version = ARCHIVE_VERSION
+	b, _ := json.Marshal(m)
+	writeEntry(tw, archiveManifest, b, m.ExportedAt)
+	writeEntry(tw, archiveImage, []byte("disk bytes"), m.ExportedAt)
+	writeEntry(tw, archiveSums, []byte("0000  image\n"), m.ExportedAt)
+	tw.Close()
+
+	_, err := ReadArchive(&buf, func(m *Manifest, img io.Reader) error {
+		_, err := io.Copy(ioutil.Discard, img)
+		return err
+	})
+	c.Assert(err, check.NotNil)
+	c.Assert(IsTransient(err), check.Equals, false)
+	c.Assert(strings.Contains(err.Error(), ErrArchiveChecksum.Error()), check.Equals, true)
+}
+
+func (s *S) TestReadArchiveStoreFails(c *check.C) {
+	var buf bytes.Buffer
+	c.Assert(WriteArchive(&buf, s.newManifest("disk bytes"), strings.NewReader("disk bytes")), check.IsNil)
+	_, err := ReadArchive(&buf, func(m *Manifest, img io.Reader) error {
+		return errors.New("datastore full")
+	})
+	c.Assert(err, check.ErrorMatches, "datastore full")
+}
+
+func (s *S) TestReadArchiveNeedsAManifest(c *check.C) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	writeEntry(tw, archiveImage, []byte("disk bytes"), time.Now())
+	tw.Close()
+	_, err := ReadArchive(&buf, func(m *Manifest, img io.Reader) error { return nil })
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestOpenArchive(c *check.C) {
+	old := meta.MC
+	defer func() { meta.MC = old; getBackup = GetBackup }()
+	meta.MC = &meta.Config{Dir: c.MkDir()}
+	getBackup = func(id, email string) (*Backups, error) {
+		return &Backups{Id: id, AccountId: "info@megam.io"}, nil
+	}
+	c.Assert(os.MkdirAll(filepath.Dir(archivePath("BAK1")), 0700), check.IsNil)
+	c.Assert(ioutil.WriteFile(archivePath("BAK1"), []byte("tar"), 0600), check.IsNil)
+
+	rc, err := openArchive("BAK1", "info@megam.io")
+	c.Assert(err, check.IsNil)
+	b, _ := ioutil.ReadAll(rc)
+	rc.Close()
+	c.Assert(string(b), check.Equals, "tar")
+
+	//the backups of another account, the files of the server.
+	for _, src := range []string{"BAK1", "/etc/passwd", "../archives/BAK1", "file:///etc/passwd"} {
+		_, err = openArchive(src, "thief@megam.io")
+		c.Assert(err, check.NotNil, check.Commentf("%s", src))
+		c.Assert(IsTransient(err), check.Equals, false)
+	}
+}
+
+func (s *S) TestOpenArchiveByUrl(c *check.C) {
+	old := meta.MC
+	defer func() { meta.MC = old }()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data", http.StatusFound)
+			return
+		}
+		w.Write([]byte("tar"))
+	}))
+	defer server.Close()
+	meta.MC = &meta.Config{}
+	_, err := openArchive(server.URL+"/BAK1.tar", "info@megam.io")
+	c.Assert(err, check.ErrorMatches, "archive host .* is not in archive_hosts")
+
+	meta.MC = &meta.Config{ArchiveHosts: []string{"127.0.0.1"}}
+	rc, err := openArchive(server.URL+"/BAK1.tar", "info@megam.io")
+	c.Assert(err, check.IsNil)
+	b, _ := ioutil.ReadAll(rc)
+	rc.Close()
+	c.Assert(string(b), check.Equals, "tar")
+	_, err = openArchive(server.URL+"/redirect", "info@megam.io")
+	c.Assert(err, check.ErrorMatches, ".*not in archive_hosts")
+}
+
+func (s *S) TestArchiveLeavesSecretsOut(c *check.C) {
+	bk := &Backups{Id: "BAK1", Name: "nightly"}
+	bk.Inputs.NukeAndSet(map[string][]string{"root_password": {"s3cret"}, "disk_id": {"0"}})
+	bk.Labels.NukeAndSet(map[string][]string{"api_token": {"t0ken"}})
+	asm := &Assembly{Id: "ASM1", Tosca: "tosca.torpedo.ubuntu", ComponentIds: []string{"COM1"}}
+	asm.Inputs.NukeAndSet(map[string][]string{provision.RAM: {"2 GB"}, "sshkey": {"info_key"}, "root_password": {"s3cret"}})
+	asm.Outputs.NukeAndSet(map[string][]string{"vncpasswd": {"s3cret"}, "publicipv4": {"10.0.0.1"}})
+	comp := &Component{Id: "COM1", Name: "web1"}
+	comp.Envs.NukeAndSet(map[string][]string{"DB_PASSWORD": {"s3cret"}, "PORT": {"8080"}})
+	comp.Inputs.NukeAndSet(map[string][]string{"token": {"t0ken"}})
+
+	b, err := json.Marshal(&Manifest{
+		Backup:     archivedBackup(bk),
+		Assembly:   archivedAssembly(asm),
+		Components: []*Component{archivedComponent(comp)},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(strings.Contains(string(b), "s3cret"), check.Equals, false)
+	c.Assert(strings.Contains(string(b), "t0ken"), check.Equals, false)
+	c.Assert(strings.Contains(string(b), "info_key"), check.Equals, false)
+	c.Assert(strings.Contains(string(b), "10.0.0.1"), check.Equals, false)
+
+	m := &Manifest{}
+	c.Assert(json.Unmarshal(b, m), check.IsNil)
+	c.Assert(m.Backup.Inputs.Match("disk_id"), check.Equals, "0")
+	c.Assert(m.Assembly.Inputs.Match(provision.RAM), check.Equals, "2 GB")
+	c.Assert(m.Assembly.ComponentIds, check.DeepEquals, []string{"COM1"})
+	c.Assert(m.Components[0].Envs.Match("PORT"), check.Equals, "8080")
+	//the backup saved with its export keeps its own inputs.
+	c.Assert(bk.Inputs.Match("root_password"), check.Equals, "s3cret")
+}
@@ -33,6 +33,15 @@ const (
 //bunch Assemblys
 type Cartons []*Carton
 
+//the assembly ids of the cartons.
+func (ca Cartons) ids() []string {
+	ids := make([]string, 0, len(ca))
+	for _, c := range ca {
+		ids = append(ids, c.Id)
+	}
+	return ids
+}
+
 type ApiAssemblies struct {
 	JsonClaz string       `json:"json_claz"`
 	Results  []Assemblies `json:"results"`
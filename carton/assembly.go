@@ -44,6 +44,8 @@ const (
 	SSHKEY                = "sshkey"
 	VNCPORT               = "vncport"
 	VNCHOST               = "vnchost"
+	VNCPASSWD             = "vncpasswd"
+	SSH_HOST_KEY          = "ssh_host_key"
 	INSTANCE_ID           = "instance_id"
 	INSTANCE_PORTS        = "instance_ports"
 	BACKUP                = "backup"
@@ -216,19 +218,16 @@ func mkCarton(aies, ay, email string) (*Carton, error) {
 		ImageName:    a.imageName(),
 		StorageType:  a.storageType(),
 		QuotaId:      a.quotaID(),
+		Retention:    a.retention(),
 		Boxes:        &b,
 		Status:       utils.Status(a.Status),
 		State:        utils.State(a.State),
 	}
-	if len(a.flavorId()) > 0 {
-		comp, err := a.newCompute()
-		if err != nil {
-			return nil, err
-		}
-		c.Compute = comp
-	} else {
-		c.Compute = a.compute()
+	comp, invalid, err := a.newCompute()
+	if err != nil {
+		return nil, err
 	}
+	c.Compute, c.invalidCompute = comp, invalid
 	return c, nil
 }
 
@@ -261,15 +260,11 @@ func (a *Assembly) mkBoxes(aies string, args api.ApiArgs) ([]provision.Box, erro
 					b.Repo.Hook.CartonId = a.Id //this is screwy, why do we need it.
 					b.Repo.Hook.BoxId = comp.Id
 				}
-				if len(a.flavorId()) > 0 {
-					c, err := a.newCompute()
-					if err != nil {
-						return nil, err
-					}
-					b.Compute = c
-				} else {
-					b.Compute = a.compute()
+				c, _, err := a.newCompute() //the carton keeps the size that doesn't parse.
+				if err != nil {
+					return nil, err
 				}
+				b.Compute = c
 				b.PolicyOps = a.policyOps()
 				b.SSH = a.newSSH()
 				b.Region = a.region()
@@ -405,6 +400,16 @@ func (a *Assembly) NukeAndSetOutputs(m map[string][]string) error {
 	return nil
 }
 
+//update inputs in scylla, nuke the matching keys available
+func (a *Assembly) NukeAndSetInputs(m map[string][]string) error {
+	if len(m) == 0 {
+		return provision.ErrNoOutputsFound
+	}
+	log.Debugf("nuke and set inputs in scylla [%s]", m)
+	a.Inputs.NukeAndSet(m)
+	return a.update()
+}
+
 func (a *Assembly) Delete(asmid string) error {
 	args := newArgs(a.AccountId, a.OrgId)
 	cl := api.NewClient(args, "/assembly/"+asmid)
@@ -504,22 +509,28 @@ func (a *Assembly) FlavorId() string {
 	return strings.TrimSpace(a.Inputs.Match(FLAVOR_ID))
 }
 
-func (a *Assembly) newCompute() (provision.BoxCompute, error) {
-	comp := provision.BoxCompute{}
+//newCompute is the size of the flavor of the assembly, or of its inputs when it has none.
+//A size that doesn't parse is returned as invalid rather than err, only the ops that
+//size the boxes refuse it, a carton is still loaded to be stopped or destroyed.
+func (a *Assembly) newCompute() (comp provision.BoxCompute, invalid error, err error) {
+	if len(a.flavorId()) == 0 {
+		comp, invalid = a.compute()
+		return comp, invalid, nil
+	}
 	f, err := GetFlavor(a.AccountId, a.flavorId())
 	if err != nil {
-		return comp, err
+		return comp, nil, err
 	}
-	return f.compute(), nil
+	comp, invalid = f.compute()
+	return comp, invalid, nil
 }
 
-func (a *Assembly) compute() provision.BoxCompute {
-	return provision.BoxCompute{
-		Cpushare: a.getCpushare(),
-		Memory:   a.getMemory(),
-		Swap:     a.getSwap(),
-		HDD:      a.getHDD(),
+func (a *Assembly) compute() (provision.BoxCompute, error) {
+	c, err := provision.ParseCompute(a.getCpushare(), a.getMemory(), a.getSwap(), a.getHDD())
+	if err != nil {
+		return c, Permanent(fmt.Errorf("assembly %s: %s", a.Id, err))
 	}
+	return c, nil
 }
 
 func (a *Assembly) newSSH() provision.BoxSSH {
@@ -539,19 +550,27 @@ func (a *Assembly) getCpushare() string {
 }
 
 func (a *Assembly) getMemory() string {
-	return a.Inputs.Match(provision.RAM)
+	return withUnit(a.Inputs.Match(provision.RAM))
 }
 
 func (a *Assembly) getSwap() string {
 	return ""
 }
 
-//The default HDD is 10. we should configure it in the vertice.conf
+//The default HDD is 10 GB. we should configure it in the vertice.conf
 func (a *Assembly) getHDD() string {
 	if len(strings.TrimSpace(a.Inputs.Match(provision.HDD))) <= 0 {
-		return "10"
+		return "10" + GB
 	}
-	return a.Inputs.Match(provision.HDD)
+	return withUnit(a.Inputs.Match(provision.HDD))
+}
+
+//withUnit gives a bare number the GB the flavors are sized in, as in "4".
+func withUnit(s string) string {
+	if _, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+		return strings.TrimSpace(s) + GB
+	}
+	return s
 }
 
 func (a *Assembly) GetVMCpuCost() string {
@@ -578,6 +597,29 @@ func (a *Assembly) HostName() string {
 	return a.Outputs.Match(VNCHOST)
 }
 
+//VncAddr is the host and the port of the vnc server of the vm, empty when it
+//has none.
+func (a *Assembly) VncAddr() (string, string) {
+	return a.vncHost(), a.vncPort()
+}
+
+//PrivateIp is the first private ipv4 of the vm, the outputs keep all of them
+//as "ip1, ip2".
+func (a *Assembly) PrivateIp() string {
+	return strings.TrimSpace(strings.Split(a.Outputs.Match(utils.PRIVATEIPV4), ",")[0])
+}
+
+//SshHostKey is the key the vm showed at its first ssh login, pinned for the
+//next ones.
+func (a *Assembly) SshHostKey() string {
+	return a.Outputs.Match(SSH_HOST_KEY)
+}
+
+//PinSshHostKey keeps the key the vm showed at its first ssh login.
+func (a *Assembly) PinSshHostKey(key string) error {
+	return a.NukeAndSetOutputs(map[string][]string{SSH_HOST_KEY: {key}})
+}
+
 func (a *Assembly) GetFullName() string {
 	domain := a.domain()
 	if len(strings.TrimSpace(domain)) > 0 {
@@ -690,7 +732,11 @@ func (a *Assembly) IsTopedo() bool {
 func (a *Assembly) Resources(flv *Flavor) map[string]string {
 	box := &provision.Box{}
 	if flv != nil {
-		box.Compute = flv.compute()
+		comp, err := flv.compute()
+		if err != nil { //nothing to bill for a flavor that deploys nothing.
+			log.Errorf("Unable to read the resources of %s : %s", a.Id, err)
+		}
+		box.Compute = comp
 		return a.billaleResource(map[string]string{
 			constants.CPU:         strconv.FormatInt(int64(box.GetCpushare()), 10),
 			constants.RAM:         strconv.FormatInt(int64(box.GetMemory()), 10),
@@ -704,7 +750,11 @@ func (a *Assembly) Resources(flv *Flavor) map[string]string {
 }
 
 func (a *Assembly) resources() map[string]string {
-	box := &provision.Box{Compute: a.compute()}
+	comp, err := a.compute()
+	if err != nil {
+		log.Errorf("Unable to read the resources of %s : %s", a.Id, err)
+	}
+	box := &provision.Box{Compute: comp}
 	r := map[string]string{
 		constants.CPU:     strconv.FormatInt(int64(box.GetCpushare()), 10),
 		constants.RAM:     strconv.FormatInt(int64(box.GetMemory()), 10),
@@ -65,7 +65,7 @@ func CreateImage(opts *DiskOpts) error {
 	logWriter := lw.LogWriter{Box: opts.B}
 	logWriter.Async()
 	defer logWriter.Close()
-	writer := io.MultiWriter(&outBuffer, &logWriter)
+	writer := io.MultiWriter(&outBuffer, &logWriter, boxOut(opts.Out))
 	err := ProvisionerMap[opts.B.Provider].SaveImage(opts.B, writer)
 	elapsed := time.Since(start)
 
@@ -87,7 +87,7 @@ func DeleteImage(opts *DiskOpts) error {
 	logWriter := lw.LogWriter{Box: opts.B}
 	logWriter.Async()
 	defer logWriter.Close()
-	writer := io.MultiWriter(&outBuffer, &logWriter)
+	writer := io.MultiWriter(&outBuffer, &logWriter, boxOut(opts.Out))
 	err := ProvisionerMap[opts.B.Provider].DeleteImage(opts.B, writer)
 	elapsed := time.Since(start)
 
@@ -1,7 +1,8 @@
 package carton
 
 import (
-	log "github.com/Sirupsen/logrus"
+	"io"
+
 	"github.com/virtengine/libgo/api"
 	"github.com/virtengine/libgo/utils"
 	"github.com/virtengine/vertice/provision"
@@ -23,6 +24,7 @@ type Carton struct {
 	AccountId    string
 	Authority    string
 	QuotaId      string
+	Retention    Retention
 	ApiArgs      api.ApiArgs
 	OrgId        string
 	Tosca        string
@@ -43,6 +45,8 @@ type Carton struct {
 	PolicyOps    *provision.PolicyOps
 	Status       utils.Status
 	State        utils.State
+
+	invalidCompute error //the size that didn't parse, CREATE and RESIZE refuse it.
 }
 
 //Global provisioners set by the subd daemons.
@@ -105,47 +109,41 @@ func (c *Carton) toBox() error { //assemblies id.
 }
 
 // Deploy carton, which basically deploys the boxes.
-func (c *Carton) Deploy() error {
-	for _, box := range *c.Boxes {
-		err := Deploy(&DeployOpts{B: &box})
-		if err != nil {
-			return err
-		}
+func (c *Carton) Deploy() ([]*BoxResult, error) {
+	if c.invalidCompute != nil {
+		return nil, c.invalidCompute
 	}
-	return nil
+	return runInBoxes("deploy", *c.Boxes, func(b *provision.Box, out io.Writer) error {
+		return Deploy(&DeployOpts{B: b, Out: out})
+	})
 }
 
-func (c *Carton) Running() error {
-	for _, box := range *c.Boxes {
-		err := Running(&DeployOpts{B: &box})
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+// Rollback carton, which redeploys the boxes with their previous image.
+func (c *Carton) Rollback() ([]*BoxResult, error) {
+	return runInBoxes("rollback", *c.Boxes, func(b *provision.Box, out io.Writer) error {
+		return Rollback(&DeployOpts{B: b, Out: out})
+	})
+}
+
+func (c *Carton) Running() ([]*BoxResult, error) {
+	return runInBoxes("running", *c.Boxes, func(b *provision.Box, out io.Writer) error {
+		return Running(&DeployOpts{B: b, Out: out})
+	})
 }
 
 // Destroys a carton, which deletes its boxes.
-func (c *Carton) Destroy() error {
-	for _, box := range *c.Boxes {
-		err := Destroy(&DestroyOpts{B: &box})
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+func (c *Carton) Destroy() ([]*BoxResult, error) {
+	return runInBoxes("destroy", *c.Boxes, func(b *provision.Box, out io.Writer) error {
+		return Destroy(&DestroyOpts{B: b, Out: out})
+	})
 }
 
 // moves the state to the desired state
 // changing the boxes state to StatusStateup.
-func (c *Carton) Stateup() error {
-	for _, box := range *c.Boxes {
-		err := ChangeState(&StateChangeOpts{B: &box, Changed: utils.StatusStateupped})
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+func (c *Carton) Stateup() ([]*BoxResult, error) {
+	return runInBoxes("stateup", *c.Boxes, func(b *provision.Box, out io.Writer) error {
+		return ChangeState(&StateChangeOpts{B: b, Changed: utils.StatusStateupped, Out: out})
+	})
 }
 
 // Available returns true if at least one of N boxes which is started
@@ -159,162 +157,110 @@ func (c *Carton) Available() bool {
 }
 
 //upgrade run thru all the ops.
-func (c *Carton) Upgrade() error {
-	for _, box := range *c.Boxes {
-		err := NewUpgradeable(&box).Upgrade()
-		if err != nil {
-			log.Errorf("Unable to upgrade box : %s", err)
-			return err
-		}
-	}
-	return nil
+func (c *Carton) Upgrade() ([]*BoxResult, error) {
+	return runInBoxes("upgrade", *c.Boxes, func(b *provision.Box, out io.Writer) error {
+		u := NewUpgradeable(b)
+		u.Out = out
+		return u.Upgrade()
+	})
 }
 
-func (c *Carton) NetworkUpdate() error {
-	for _, box := range *c.Boxes {
-		err := NetworkUpdate(&box)
-		if err != nil {
-			log.Errorf("Unable to upgrade box : %s", err)
-			return err
-		}
-	}
-	return nil
+func (c *Carton) NetworkUpdate() ([]*BoxResult, error) {
+	return runInBoxes("network update", *c.Boxes, func(b *provision.Box, out io.Writer) error {
+		return NetworkUpdate(b, out)
+	})
 }
 
 // starts box
-func (c *Carton) Start() error {
-	for _, box := range *c.Boxes {
-		err := Start(&LifecycleOpts{B: &box})
-		if err != nil {
-			log.Errorf("Unable to start the box  %s", err)
-			return err
-		}
-	}
-	return nil
+func (c *Carton) Start() ([]*BoxResult, error) {
+	return runInBoxes("start", *c.Boxes, func(b *provision.Box, out io.Writer) error {
+		return Start(&LifecycleOpts{B: b, Out: out})
+	})
 }
 
 // stops the box
-func (c *Carton) Stop(hard bool) error {
-	for _, box := range *c.Boxes {
-		err := Stop(&LifecycleOpts{B: &box, Hard: hard})
-		if err != nil {
-			log.Errorf("Unable to stop the box %s", err)
-			return err
-		}
-	}
-	return nil
+func (c *Carton) Stop(hard bool) ([]*BoxResult, error) {
+	return runInBoxes("stop", *c.Boxes, func(b *provision.Box, out io.Writer) error {
+		return Stop(&LifecycleOpts{B: b, Hard: hard, Out: out})
+	})
 }
 
 // suspends the box
-func (c *Carton) Suspend() error {
-	for _, box := range *c.Boxes {
-		err := SuspendBox(&LifecycleOpts{B: &box})
-		if err != nil {
-			log.Errorf("Unable to suspend the box %s", err)
-			return err
-		}
-	}
-	return nil
+func (c *Carton) Suspend() ([]*BoxResult, error) {
+	return runInBoxes("suspend", *c.Boxes, func(b *provision.Box, out io.Writer) error {
+		return SuspendBox(&LifecycleOpts{B: b, Out: out})
+	})
 }
 
 // restarts the box
-func (c *Carton) Restart(hard bool) error {
-	for _, box := range *c.Boxes {
-		err := Restart(&LifecycleOpts{B: &box, Hard: hard})
-		if err != nil {
-			log.Errorf("Unable to restart the box %s", err)
-			return err
-		}
-	}
-	return nil
+func (c *Carton) Restart(hard bool) ([]*BoxResult, error) {
+	return runInBoxes("restart", *c.Boxes, func(b *provision.Box, out io.Writer) error {
+		return Restart(&LifecycleOpts{B: b, Hard: hard, Out: out})
+	})
 }
 
 // Backup Create a carton, which creates an image by current state of its box.
 // Create new backup image from public url
-func (c *Carton) CreateImage() error {
-	for _, box := range *c.Boxes {
-		err := CreateImage(&DiskOpts{B: &box})
-		if err != nil {
-			log.Errorf("Unable to save image the box %s", err)
-			return err
-		}
-	}
-	return nil
+func (c *Carton) CreateImage() ([]*BoxResult, error) {
+	return runInBoxes("save image", *c.Boxes, func(b *provision.Box, out io.Writer) error {
+		return CreateImage(&DiskOpts{B: b, Out: out})
+	})
 }
 
 // SnapDelete a carton, which removes an existing image created from state of its box.
-func (c *Carton) DeleteImage() error {
-	for _, box := range *c.Boxes {
-		err := DeleteImage(&DiskOpts{B: &box})
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+func (c *Carton) DeleteImage() ([]*BoxResult, error) {
+	return runInBoxes("delete image", *c.Boxes, func(b *provision.Box, out io.Writer) error {
+		return DeleteImage(&DiskOpts{B: b, Out: out})
+	})
 }
 
 // SnapCreate a carton, which creates an image by current state of its box.
-func (c *Carton) CreateSnapshot() error {
-	for _, box := range *c.Boxes {
-		err := CreateSnapshot(&DiskOpts{B: &box})
-		if err != nil {
-			return err
-		}
+// It is refused when the quota is used up, and the snapshots the retention
+// of the assembly doesn't keep are deleted once it is taken.
+func (c *Carton) CreateSnapshot() ([]*BoxResult, error) {
+	if err := c.checkSnapQuota(); err != nil {
+		return nil, err
 	}
-	return nil
+	results, err := runInBoxes("create snapshot", *c.Boxes, func(b *provision.Box, out io.Writer) error {
+		return CreateSnapshot(&DiskOpts{B: b, Out: out})
+	})
+	if err != nil {
+		return results, err
+	}
+	return append(results, c.pruneSnapshots()...), nil
 }
 
 // SnapCreate a carton, which creates an image by current state of its box.
-func (c *Carton) SnapshotSaveAs() error {
-	for _, box := range *c.Boxes {
-		err := SnapshotSaveAs(&DiskOpts{B: &box})
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+func (c *Carton) SnapshotSaveAs() ([]*BoxResult, error) {
+	return runInBoxes("save snapshot", *c.Boxes, func(b *provision.Box, out io.Writer) error {
+		return SnapshotSaveAs(&DiskOpts{B: b, Out: out})
+	})
 }
 
 // SnapDelete a carton, which removes an existing image created from state of its box.
-func (c *Carton) DeleteSnapshot() error {
-	for _, box := range *c.Boxes {
-		err := DeleteSnapshot(&DiskOpts{B: &box})
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+func (c *Carton) DeleteSnapshot() ([]*BoxResult, error) {
+	return runInBoxes("delete snapshot", *c.Boxes, func(b *provision.Box, out io.Writer) error {
+		return DeleteSnapshot(&DiskOpts{B: b, Out: out})
+	})
 }
 
 // SnapDelete a carton, which removes an existing image created from state of its box.
-func (c *Carton) RestoreSnapshot() error {
-	for _, box := range *c.Boxes {
-		err := RestoreSnapshot(&DiskOpts{B: &box})
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+func (c *Carton) RestoreSnapshot() ([]*BoxResult, error) {
+	return runInBoxes("restore snapshot", *c.Boxes, func(b *provision.Box, out io.Writer) error {
+		return RestoreSnapshot(&DiskOpts{B: b, Out: out})
+	})
 }
 
 // AttachDisk a carton, which creates a disk storage by current state of its box.
-func (c *Carton) AttachDisk() error {
-	for _, box := range *c.Boxes {
-		err := AttachDisk(&DiskOpts{B: &box})
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+func (c *Carton) AttachDisk() ([]*BoxResult, error) {
+	return runInBoxes("attach disk", *c.Boxes, func(b *provision.Box, out io.Writer) error {
+		return AttachDisk(&DiskOpts{B: b, Out: out})
+	})
 }
 
 // DetachDisk a carton, which removes an existing disk storage by current state of its box.
-func (c *Carton) DetachDisk() error {
-	for _, box := range *c.Boxes {
-		err := DetachDisk(&DiskOpts{B: &box})
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+func (c *Carton) DetachDisk() ([]*BoxResult, error) {
+	return runInBoxes("detach disk", *c.Boxes, func(b *provision.Box, out io.Writer) error {
+		return DetachDisk(&DiskOpts{B: b, Out: out})
+	})
 }
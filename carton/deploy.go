@@ -18,36 +18,76 @@ package carton
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"sort"
 	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/libgo/api"
 	"github.com/virtengine/libgo/cmd"
 	"github.com/virtengine/libgo/events/alerts"
 	constants "github.com/virtengine/libgo/utils"
 	lw "github.com/virtengine/libgo/writer"
 	"github.com/virtengine/vertice/provision"
 	"github.com/virtengine/vertice/repository"
+	"gopkg.in/yaml.v2"
 )
 
-const DOCKER_TYPE = "dockercontainer"
+const (
+	DOCKER_TYPE     = "dockercontainer"
+	DEPLOYS         = "/deploys/"
+	DEPLOYS_NEW     = "/deploys/content"
+	ORIGIN_GIT      = "git"
+	ORIGIN_IMAGE    = "image"
+	ORIGIN_BACKUP   = "backup"
+	ORIGIN_ROLLBACK = "rollback"
+)
+
+var ErrNoRollbackImage = errors.New("no previous deploy to rollback to")
+
+type ApiDeploys struct {
+	JsonClaz string       `json:"json_claz" cql:"json_claz"`
+	Results  []DeployData `json:"results" cql:"results"`
+}
 
+// DeployData is the record of a single deploy of a box, stored per box in the gateway.
 type DeployData struct {
-	BoxName     string
-	HookId      string
-	PrivateIp   string
-	PublicIp    string
-	Timestamp   time.Time
-	Duration    time.Duration
-	Commit      string
-	Image       string
-	Origin      string
-	CanRollback bool
+	Id          string        `json:"id" cql:"id"`
+	BoxId       string        `json:"box_id" cql:"box_id"`
+	AssemblyId  string        `json:"asm_id" cql:"asm_id"`
+	AccountId   string        `json:"account_id" cql:"account_id"`
+	OrgId       string        `json:"org_id" cql:"org_id"`
+	BoxName     string        `json:"box_name" cql:"box_name"`
+	HookId      string        `json:"hook_id" cql:"hook_id"`
+	PrivateIp   string        `json:"private_ip" cql:"private_ip"`
+	PublicIp    string        `json:"public_ip" cql:"public_ip"`
+	Timestamp   time.Time     `json:"timestamp" cql:"timestamp"`
+	Duration    time.Duration `json:"duration" cql:"duration"`
+	Commit      string        `json:"commit" cql:"commit"`
+	Image       string        `json:"image" cql:"image"`
+	Origin      string        `json:"origin" cql:"origin"`
+	CanRollback bool          `json:"can_rollback" cql:"can_rollback"`
+	Log         string        `json:"log" cql:"log"`
+	Error       string        `json:"error" cql:"error"`
+	JsonClaz    string        `json:"json_claz" cql:"json_claz"`
+}
+
+func (d *DeployData) String() string {
+	if out, err := yaml.Marshal(d); err != nil {
+		return err.Error()
+	} else {
+		return string(out)
+	}
 }
 
 type DeployOpts struct {
-	B *provision.Box
+	B     *provision.Box
+	Image string    //a previously deployed image, set when we rollback.
+	Out   io.Writer //gets a copy of the box log, may be nil.
 }
 
 // Deploy runs a deployment of an application. It will first try to run an
@@ -58,7 +98,7 @@ func Deploy(opts *DeployOpts) error {
 	logWriter := lw.LogWriter{Box: opts.B}
 	logWriter.Async()
 	defer logWriter.Close()
-	writer := io.MultiWriter(&outBuffer, &logWriter)
+	writer := io.MultiWriter(&outBuffer, &logWriter, boxOut(opts.Out))
 	imageId, err := deployToProvisioner(opts, writer)
 	elapsed := time.Since(start)
 	saveErr := saveDeployData(opts, imageId, outBuffer.String(), elapsed, err)
@@ -72,6 +112,16 @@ func Deploy(opts *DeployOpts) error {
 }
 
 func deployToProvisioner(opts *DeployOpts, writer io.Writer) (string, error) {
+	if len(opts.Image) > 0 {
+		//a rollback, the box keeps running until the previous image is up.
+		if deployer, ok := ProvisionerMap[opts.B.Provider].(provision.ImageDeployer); ok {
+			return replaceBox(opts.B, writer, func() (string, error) {
+				return deployer.ImageDeploy(opts.B, opts.Image, writer)
+			})
+		}
+		return "", fmt.Errorf("provisioner %s can't deploy the image %s", opts.B.Provider, opts.Image)
+	}
+
 	if opts.B.Backup {
 		if deployer, ok := ProvisionerMap[opts.B.Provider].(provision.ImageDeployer); ok {
 			return deployer.BackupDeploy(opts.B, opts.B.ImageName, writer)
@@ -109,35 +159,113 @@ func saveDeployData(opts *DeployOpts, imageId, dlog string, duration time.Durati
 		cmd.Colorfy(opts.B.GetFullName(), "cyan", "", "bold"),
 		cmd.Colorfy(duration.String(), "green", "", "bold"),
 		cmd.Colorfy(dlog, "yellow", "", ""))
-	//if there are deployments to track as follows in outputs: {} then do it here.
-	//Scylla: code to save the status of a deploy (created.)
-	// deploy :
-	//     name:
-	//     status:
-
-	/*deploy := DeployData {
-		App:       opts.App.Name,
-		Timestamp: time.Now(),
-		Duration:  duration,
-		Commit:    opts.Commit,
-		Image:     imageId,
-		Log:       log,
-	}
-	if opts.Commit != "" {
-		deploy.Origin = "git"
-	} else if opts.Image != "" {
-		deploy.Origin = "rollback"
-	} else {
-		deploy.Origin = "app-deploy"
+	return newDeployData(opts, imageId, dlog, duration, deployError).create()
+}
+
+func newDeployData(opts *DeployOpts, imageId, dlog string, duration time.Duration, deployError error) *DeployData {
+	d := &DeployData{
+		BoxId:      opts.B.Id,
+		AssemblyId: opts.B.CartonId,
+		AccountId:  opts.B.AccountId,
+		OrgId:      opts.B.OrgId,
+		BoxName:    opts.B.GetFullName(),
+		PublicIp:   opts.B.PublicIp,
+		PrivateIp:  opts.B.Vnets[constants.PRIVATEIPV4],
+		Timestamp:  time.Now(),
+		Duration:   duration,
+		Commit:     opts.B.Commit,
+		Image:      imageId,
+		Origin:     deployOrigin(opts),
+		Log:        dlog,
 	}
 	if deployError != nil {
-		deploy.Error = deployError.Error()
+		d.Error = deployError.Error()
+	}
+	//only a deploy that succeeded with a known image is worth going back to.
+	d.CanRollback = deployError == nil && len(strings.TrimSpace(imageId)) > 0
+	return d
+}
+
+// deployOrigin tells where the deployed image came from.
+func deployOrigin(opts *DeployOpts) string {
+	b := opts.B
+	switch {
+	case len(opts.Image) > 0:
+		return ORIGIN_ROLLBACK
+	case b.Backup:
+		return ORIGIN_BACKUP
+	case b.Repo == nil || b.Repo.Type == repository.IMAGE || b.Repo.OneClick:
+		return ORIGIN_IMAGE
+	default:
+		return ORIGIN_GIT
+	}
+}
+
+func (d *DeployData) create() error {
+	cl := api.NewClient(newArgs(d.AccountId, d.OrgId), DEPLOYS_NEW)
+	if _, err := cl.Post(d); err != nil {
+		return err
 	}
-	return db.Store(compid or assmid, &struct)
-	*/
 	return nil
 }
 
+// GetDeploys lists the deploy history of a box, as recorded by every Deploy.
+func GetDeploys(boxId, email string) ([]DeployData, error) {
+	cl := api.NewClient(newArgs(email, ""), DEPLOYS+boxId)
+	response, err := cl.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ApiDeploys{}
+	err = json.Unmarshal(response, res)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Deploys of box %s %v", boxId, res.Results)
+	return res.Results, nil
+}
+
+// Rollback deploys the box with the image of its previous successful deploy.
+// The running machine or container is swapped for it once it is up, a failed
+// rollback leaves it running. On docker and rancher the box is destroyed
+// before, see replaceBox.
+func Rollback(opts *DeployOpts) error {
+	deploys, err := GetDeploys(opts.B.Id, opts.B.AccountId)
+	if err != nil {
+		return err
+	}
+	img, err := rollbackImage(deploys)
+	if err != nil {
+		return err
+	}
+	log.Debugf("  rollback box (%s, image:%s)", opts.B.GetFullName(), img)
+	opts.Image = img
+	return Deploy(opts)
+}
+
+// rollbackImage picks the image deployed before the current one, skipping the
+// deploys that failed and the ones that carry the current image.
+func rollbackImage(deploys []DeployData) (string, error) {
+	sort.Slice(deploys, func(i, j int) bool {
+		return deploys[i].Timestamp.After(deploys[j].Timestamp)
+	})
+	current := ""
+	for _, d := range deploys {
+		if !d.CanRollback {
+			continue
+		}
+		if current == "" {
+			current = d.Image
+			continue
+		}
+		if d.Image != current {
+			return d.Image, nil
+		}
+	}
+	return "", ErrNoRollbackImage
+}
+
 // Deploy runs a deployment of an application. It will first try to run an
 // image based deploy, and then fallback to the Git based deployment.
 func Running(opts *DeployOpts) error {
@@ -146,7 +274,7 @@ func Running(opts *DeployOpts) error {
 	logWriter := lw.LogWriter{Box: opts.B}
 	logWriter.Async()
 	defer logWriter.Close()
-	writer := io.MultiWriter(&outBuffer, &logWriter)
+	writer := io.MultiWriter(&outBuffer, &logWriter, boxOut(opts.Out))
 	if deployer, ok := ProvisionerMap[opts.B.Provider].(provision.StateChanger); ok {
 		if strings.Contains(opts.B.Tosca, "windows") {
 			err = deployer.SetRunning(opts.B, writer)
@@ -15,11 +15,18 @@
  */
 package carton
 
-/**
 import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/virtengine/vertice/provision"
+	"github.com/virtengine/vertice/repository"
 	"gopkg.in/check.v1"
 )
 
+/**
 func (s *S) TestDeployToProvisioner(c *check.C) {
 	carton := provisiontest.NewFakeCarton("myapp", "tosca.torpedo.ubuntu", provision.BoxNone, 1)
 	defer s.provisioner.Destroy(&box)
@@ -42,3 +49,116 @@ func (s *S) TestDeployToProvisionerImage(c *check.C) {
 	c.Assert(logs, check.Equals, "Image deploy called")
 }
 */
+
+func (s *S) TestDeployOrigin(c *check.C) {
+	opts := &DeployOpts{B: &provision.Box{}}
+	c.Assert(deployOrigin(opts), check.Equals, ORIGIN_IMAGE)
+	opts.B.Repo = &repository.Repo{Type: "source", Source: "github"}
+	c.Assert(deployOrigin(opts), check.Equals, ORIGIN_GIT)
+	opts.B.Backup = true
+	c.Assert(deployOrigin(opts), check.Equals, ORIGIN_BACKUP)
+	opts.Image = "ubuntu"
+	c.Assert(deployOrigin(opts), check.Equals, ORIGIN_ROLLBACK)
+}
+
+func (s *S) TestNewDeployData(c *check.C) {
+	b := &provision.Box{Id: "COM001", CartonId: "ASM001", CartonName: "tom", AccountId: "info@megam.io"}
+	d := newDeployData(&DeployOpts{B: b}, "ubuntu", "deployed", time.Second, nil)
+	c.Assert(d.BoxId, check.Equals, "COM001")
+	c.Assert(d.AssemblyId, check.Equals, "ASM001")
+	c.Assert(d.Image, check.Equals, "ubuntu")
+	c.Assert(d.Log, check.Equals, "deployed")
+	c.Assert(d.Error, check.Equals, "")
+	c.Assert(d.CanRollback, check.Equals, true)
+	d = newDeployData(&DeployOpts{B: b}, "", "failed", time.Second, errors.New("vm boom"))
+	c.Assert(d.Error, check.Equals, "vm boom")
+	c.Assert(d.CanRollback, check.Equals, false)
+}
+
+func (s *S) TestRollbackImage(c *check.C) {
+	now := time.Now()
+	deploys := []DeployData{
+		{Image: "app:v1", CanRollback: true, Timestamp: now.Add(-3 * time.Hour)},
+		{Image: "app:v3", CanRollback: true, Timestamp: now},
+		{Image: "app:v2", CanRollback: false, Timestamp: now.Add(-time.Hour)},
+		{Image: "app:v3", CanRollback: true, Timestamp: now.Add(-2 * time.Hour)},
+	}
+	img, err := rollbackImage(deploys)
+	c.Assert(err, check.IsNil)
+	c.Assert(img, check.Equals, "app:v1")
+}
+
+func (s *S) TestRollbackImageWithoutHistory(c *check.C) {
+	_, err := rollbackImage([]DeployData{{Image: "app:v1", CanRollback: true}})
+	c.Assert(err, check.Equals, ErrNoRollbackImage)
+}
+
+//imageReplacingProvisioner starts a vm of the image it deploys.
+type imageReplacingProvisioner struct {
+	*replacingProvisioner
+	deployErr error
+}
+
+func (p imageReplacingProvisioner) ImageDeploy(b *provision.Box, image string, w io.Writer) (string, error) {
+	if p.deployErr != nil {
+		return "", p.deployErr
+	}
+	p.running = append(p.running, "vm2")
+	return image, nil
+}
+
+func (p imageReplacingProvisioner) BackupDeploy(b *provision.Box, image string, w io.Writer) (string, error) {
+	return p.ImageDeploy(b, image, w)
+}
+
+func (s *S) TestDeployToProvisionerRollback(c *check.C) {
+	p, b, restore := s.replacing(c)
+	defer restore()
+	ProvisionerMap["replacing"] = imageReplacingProvisioner{replacingProvisioner: p}
+	img, err := deployToProvisioner(&DeployOpts{B: b, Image: "app:v1"}, ioutil.Discard)
+	c.Assert(err, check.IsNil)
+	c.Assert(img, check.Equals, "app:v1")
+	c.Assert(p.running, check.DeepEquals, []string{"vm2"})
+}
+
+func (s *S) TestDeployToProvisionerRollbackFailure(c *check.C) {
+	p, b, restore := s.replacing(c)
+	defer restore()
+	ProvisionerMap["replacing"] = imageReplacingProvisioner{replacingProvisioner: p, deployErr: errors.New("image app:v1 is gone")}
+	_, err := deployToProvisioner(&DeployOpts{B: b, Image: "app:v1"}, ioutil.Discard)
+	c.Assert(err, check.ErrorMatches, "image app:v1 is gone")
+	c.Assert(p.running, check.DeepEquals, []string{"vm1"})
+	c.Assert(b.InstanceId, check.Equals, "vm1")
+}
+
+//imageRedeployingProvisioner starts a container of the image it deploys, one per box like docker.
+type imageRedeployingProvisioner struct {
+	*redeployingProvisioner
+}
+
+func (p imageRedeployingProvisioner) ImageDeploy(b *provision.Box, image string, w io.Writer) (string, error) {
+	p.running = append(p.running, image)
+	return image, nil
+}
+
+func (p imageRedeployingProvisioner) BackupDeploy(b *provision.Box, image string, w io.Writer) (string, error) {
+	return p.ImageDeploy(b, image, w)
+}
+
+func (s *S) TestDeployToProvisionerRollbackOnDocker(c *check.C) {
+	old, registered := ProvisionerMap["docker"]
+	defer func() {
+		if registered {
+			ProvisionerMap["docker"] = old
+		} else {
+			delete(ProvisionerMap, "docker")
+		}
+	}()
+	p := &redeployingProvisioner{running: []string{"app:v2"}}
+	ProvisionerMap["docker"] = imageRedeployingProvisioner{p}
+	b := &provision.Box{CartonName: "web1", DomainName: "megam.io", Provider: "docker", InstanceId: "c1"}
+	img, err := deployToProvisioner(&DeployOpts{B: b, Image: "app:v1"}, ioutil.Discard)
+	c.Assert(err, check.IsNil)
+	c.Assert(img, check.Equals, "app:v1")
+	c.Assert(p.running, check.DeepEquals, []string{"app:v1"})
+}
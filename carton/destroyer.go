@@ -12,7 +12,8 @@ import (
 )
 
 type DestroyOpts struct {
-	B *provision.Box
+	B   *provision.Box
+	Out io.Writer
 }
 
 // ChangeState runs a state increment of a machine or a container.
@@ -22,7 +23,7 @@ func Destroy(opts *DestroyOpts) error {
 	logWriter := lw.LogWriter{Box: opts.B}
 	logWriter.Async()
 	defer logWriter.Close()
-	writer := io.MultiWriter(&outBuffer, &logWriter)
+	writer := io.MultiWriter(&outBuffer, &logWriter, boxOut(opts.Out))
 	err := ProvisionerMap[opts.B.Provider].Destroy(opts.B, writer)
 	if err != nil {
 		return err
@@ -17,7 +17,8 @@ import (
 )
 
 type DiskOpts struct {
-	B *provision.Box
+	B   *provision.Box
+	Out io.Writer
 }
 
 type ApiDisks struct {
@@ -53,7 +54,7 @@ func AttachDisk(opts *DiskOpts) error {
 	logWriter := lw.LogWriter{Box: opts.B}
 	logWriter.Async()
 	defer logWriter.Close()
-	writer := io.MultiWriter(&outBuffer, &logWriter)
+	writer := io.MultiWriter(&outBuffer, &logWriter, boxOut(opts.Out))
 	err := ProvisionerMap[opts.B.Provider].AttachDisk(opts.B, writer)
 	elapsed := time.Since(start)
 
@@ -75,7 +76,7 @@ func DetachDisk(opts *DiskOpts) error {
 	logWriter := lw.LogWriter{Box: opts.B}
 	logWriter.Async()
 	defer logWriter.Close()
-	writer := io.MultiWriter(&outBuffer, &logWriter)
+	writer := io.MultiWriter(&outBuffer, &logWriter, boxOut(opts.Out))
 	err := ProvisionerMap[opts.B.Provider].DetachDisk(opts.B, writer)
 	elapsed := time.Since(start)
 	if err != nil {
@@ -2,6 +2,7 @@ package carton
 
 import (
 	"encoding/json"
+	"fmt"
 	"strings"
 
 	"github.com/virtengine/libgo/api"
@@ -106,11 +107,11 @@ func (f *Flavor) GetHDDCost() string {
 	return f.Price.Match(constants.DISK_COST_HOUR)
 }
 
-func (f *Flavor) compute() provision.BoxCompute {
-	return provision.BoxCompute{
-		Cpushare: f.getCpushare(),
-		Memory:   f.getMemory(),
-		Swap:     f.getSwap(),
-		HDD:      f.getHDD(),
+//compute refuses a flavor with no cpu or memory, it would deploy an empty box.
+func (f *Flavor) compute() (provision.BoxCompute, error) {
+	c, err := provision.ParseCompute(f.getCpushare(), f.getMemory(), f.getSwap(), f.getHDD())
+	if err != nil {
+		return c, Permanent(fmt.Errorf("flavor %s: %s", f.Id, err))
 	}
+	return c, nil
 }
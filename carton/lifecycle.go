@@ -31,6 +31,7 @@ type LifecycleOpts struct {
 	B         *provision.Box
 	start     time.Time
 	Hard      bool
+	Out       io.Writer
 	logWriter lw.LogWriter
 	writer    io.Writer
 }
@@ -38,7 +39,7 @@ type LifecycleOpts struct {
 func (cy *LifecycleOpts) setLogger() {
 	cy.start = time.Now()
 	cy.logWriter = lw.NewLogWriter(cy.B)
-	cy.writer = io.MultiWriter(&cy.logWriter)
+	cy.writer = io.MultiWriter(&cy.logWriter, boxOut(cy.Out))
 }
 
 //if the state is in running, started, stopped, restarted then allow it to be lcycled.
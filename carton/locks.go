@@ -0,0 +1,181 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package carton
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+//Global lock manager shared by the subd daemons, an assembly is operated by one request at a time.
+var Locks = NewOpLocks()
+
+// OpRejectedError is returned when an operation can't be queued behind
+// the ones pending on the assembly.
+type OpRejectedError struct {
+	Id      string
+	Action  string
+	Pending string
+}
+
+func (e *OpRejectedError) Error() string {
+	if e.Pending == DESTROY {
+		return fmt.Sprintf("%s rejected on %s: the assembly is being destroyed", e.Action, e.Id)
+	}
+	return fmt.Sprintf("%s rejected on %s: a %s is already pending", e.Action, e.Id, e.Pending)
+}
+
+//the actions that make no sense to run twice in a row.
+var onceActions = map[string]bool{
+	CREATE:       true,
+	DESTROY:      true,
+	START:        true,
+	STOP:         true,
+	HARD_STOP:    true,
+	RESTART:      true,
+	HARD_RESTART: true,
+	SUSPEND:      true,
+	UPGRADE:      true,
+	ROLLBACK:     true,
+	IMAGEIMPORT:  true,
+	MIGRATE:      true,
+	RESIZE:       true,
+}
+
+// admit decides if the action can wait behind the pending ones.
+// Nothing waits behind a destroy, and a repeat of a pending lifecycle action is dropped.
+func admit(id, action string, pending []string) error {
+	for _, p := range pending {
+		if p == DESTROY || (p == action && onceActions[action]) {
+			return &OpRejectedError{Id: id, Action: action, Pending: p}
+		}
+	}
+	return nil
+}
+
+// OpLocks serializes the operations on an assembly, keyed by the assembly id.
+// Operations get the lock in the order they asked for it.
+type OpLocks struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	locks map[string]*opLock
+}
+
+type opLock struct {
+	next    uint64 //ticket handed to the next operation.
+	serving uint64 //ticket of the operation holding the lock.
+	pending []string
+}
+
+func NewOpLocks() *OpLocks {
+	l := &OpLocks{locks: make(map[string]*opLock)}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// OpLock is held by an operation on a set of assemblies.
+type OpLock struct {
+	l   *OpLocks
+	ids []string
+	// Waited is true when an other operation ran before this one got the lock.
+	Waited bool
+}
+
+// Acquire waits for the assemblies to be free. The ids are locked in order, so
+// two requests on the same assemblies can't deadlock.
+func (l *OpLocks) Acquire(ids []string, action string) (*OpLock, error) {
+	ids = uniq(ids)
+	lk := &OpLock{l: l}
+	for _, id := range ids {
+		waited, err := l.acquire(id, action)
+		if err != nil {
+			lk.Release()
+			return nil, err
+		}
+		lk.ids = append(lk.ids, id)
+		lk.Waited = lk.Waited || waited
+	}
+	return lk, nil
+}
+
+func (l *OpLocks) acquire(id, action string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ol, ok := l.locks[id]
+	if !ok {
+		ol = &opLock{}
+		l.locks[id] = ol
+	}
+	if err := admit(id, action, ol.pending); err != nil {
+		return false, err
+	}
+	ticket := ol.next
+	ol.next++
+	ol.pending = append(ol.pending, action)
+	waited := false
+	for ol.serving != ticket {
+		waited = true
+		l.cond.Wait()
+	}
+	return waited, nil
+}
+
+// Pending returns the actions holding or waiting for the assembly.
+func (l *OpLocks) Pending(id string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ol, ok := l.locks[id]; ok {
+		return append([]string{}, ol.pending...)
+	}
+	return nil
+}
+
+func (l *OpLocks) release(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ol, ok := l.locks[id]
+	if !ok {
+		return
+	}
+	ol.serving++
+	ol.pending = ol.pending[1:]
+	if len(ol.pending) == 0 {
+		delete(l.locks, id)
+	}
+	l.cond.Broadcast()
+}
+
+// Release frees the assemblies for the next operations.
+func (lk *OpLock) Release() {
+	for i := len(lk.ids) - 1; i >= 0; i-- {
+		lk.l.release(lk.ids[i])
+	}
+	lk.ids = nil
+}
+
+func uniq(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	u := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			u = append(u, id)
+		}
+	}
+	sort.Strings(u)
+	return u
+}
@@ -0,0 +1,81 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package carton
+
+import (
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestOpLocksQueuesInOrder(c *check.C) {
+	l := NewOpLocks()
+	first, err := l.Acquire([]string{"ASM1"}, STOP)
+	c.Assert(err, check.IsNil)
+	c.Assert(first.Waited, check.Equals, false)
+
+	got := make(chan string, 2)
+	for i, action := range []string{START, SNAPCREATE} {
+		go func(action string) {
+			lk, err := l.Acquire([]string{"ASM1"}, action)
+			c.Check(err, check.IsNil)
+			c.Check(lk.Waited, check.Equals, true)
+			got <- action
+			lk.Release()
+		}(action)
+		waitPending(l, "ASM1", i+2)
+	}
+	c.Assert(l.Pending("ASM1"), check.DeepEquals, []string{STOP, START, SNAPCREATE})
+	first.Release()
+	c.Assert(<-got, check.Equals, START)
+	c.Assert(<-got, check.Equals, SNAPCREATE)
+}
+
+func (s *S) TestOpLocksRejectsBehindDestroy(c *check.C) {
+	l := NewOpLocks()
+	lk, err := l.Acquire([]string{"ASM1"}, DESTROY)
+	c.Assert(err, check.IsNil)
+	defer lk.Release()
+	_, err = l.Acquire([]string{"ASM1"}, STOP)
+	c.Assert(err, check.FitsTypeOf, &OpRejectedError{})
+	c.Assert(err, check.ErrorMatches, "stop rejected on ASM1: the assembly is being destroyed")
+}
+
+func (s *S) TestOpLocksRejectsRepeatedAction(c *check.C) {
+	l := NewOpLocks()
+	lk, err := l.Acquire([]string{"ASM1"}, START)
+	c.Assert(err, check.IsNil)
+	defer lk.Release()
+	_, err = l.Acquire([]string{"ASM1"}, START)
+	c.Assert(err, check.ErrorMatches, "start rejected on ASM1: a start is already pending")
+}
+
+func (s *S) TestOpLocksReleasesOnReject(c *check.C) {
+	l := NewOpLocks()
+	lk, err := l.Acquire([]string{"ASM2"}, DESTROY)
+	c.Assert(err, check.IsNil)
+	_, err = l.Acquire([]string{"ASM1", "ASM2"}, STOP)
+	c.Assert(err, check.NotNil)
+	c.Assert(l.Pending("ASM1"), check.IsNil)
+	lk.Release()
+	c.Assert(l.locks, check.HasLen, 0)
+}
+
+func waitPending(l *OpLocks, id string, n int) {
+	for len(l.Pending(id)) < n {
+		time.Sleep(time.Millisecond)
+	}
+}
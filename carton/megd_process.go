@@ -32,13 +32,10 @@ func (s CreateProcess) String() string {
 	return buf.String()
 }
 
-func (s CreateProcess) Process(ca Cartons) error {
-	for _, c := range ca {
-		if err := c.Deploy(); err != nil {
-			return err
-		}
-	}
-	return nil
+func (s CreateProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.Deploy()
+	})
 }
 
 // DeleteProcs represents a command for delete cartons.
@@ -53,13 +50,10 @@ func (s DestroyProcess) String() string {
 	return buf.String()
 }
 
-func (s DestroyProcess) Process(ca Cartons) error {
-	for _, c := range ca {
-		if err := c.Destroy(); err != nil {
-			return err
-		}
-	}
-	return nil
+func (s DestroyProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.Destroy()
+	})
 }
 
 // StartProcs represents a command for starting  cartons.
@@ -74,13 +68,10 @@ func (s StartProcess) String() string {
 	return buf.String()
 }
 
-func (s StartProcess) Process(ca Cartons) error {
-	for _, c := range ca {
-		if err := c.Start(); err != nil {
-			return err
-		}
-	}
-	return nil
+func (s StartProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.Start()
+	})
 }
 
 // StopProcs represents a command for stoping  cartons.
@@ -96,13 +87,10 @@ func (s StopProcess) String() string {
 	return buf.String()
 }
 
-func (s StopProcess) Process(ca Cartons) error {
-	for _, c := range ca {
-		if err := c.Stop(s.Hard); err != nil {
-			return err
-		}
-	}
-	return nil
+func (s StopProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.Stop(s.Hard)
+	})
 }
 
 // SuspendProcess represents a command for suspend  cartons.
@@ -117,13 +105,10 @@ func (s SuspendProcess) String() string {
 	return buf.String()
 }
 
-func (s SuspendProcess) Process(ca Cartons) error {
-	for _, c := range ca {
-		if err := c.Suspend(); err != nil {
-			return err
-		}
-	}
-	return nil
+func (s SuspendProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.Suspend()
+	})
 }
 
 // RestartProcs represents a command for restarting  cartons.
@@ -139,13 +124,10 @@ func (s RestartProcess) String() string {
 	return buf.String()
 }
 
-func (s RestartProcess) Process(ca Cartons) error {
-	for _, c := range ca {
-		if err := c.Restart(s.Hard); err != nil {
-			return err
-		}
-	}
-	return nil
+func (s RestartProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.Restart(s.Hard)
+	})
 }
 
 // UpgradeProcs represents a command for starting  cartons.
@@ -160,13 +142,28 @@ func (s UpgradeProcess) String() string {
 	return buf.String()
 }
 
-func (s UpgradeProcess) Process(ca Cartons) error {
-	for _, c := range ca {
-		if err := c.Upgrade(); err != nil {
-			return err
-		}
-	}
-	return nil
+func (s UpgradeProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.Upgrade()
+	})
+}
+
+// RollbackProcess represents a command for redeploying the previous image of cartons.
+type RollbackProcess struct {
+	Name string
+}
+
+func (s RollbackProcess) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("ROLLBACK CARTON ")
+	_, _ = buf.WriteString(s.Name)
+	return buf.String()
+}
+
+func (s RollbackProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.Rollback()
+	})
 }
 
 // StateupProcess represents a command for restarting  cartons.
@@ -181,13 +178,10 @@ func (s StateupProcess) String() string {
 	return buf.String()
 }
 
-func (s StateupProcess) Process(ca Cartons) error {
-	for _, c := range ca {
-		if err := c.Stateup(); err != nil {
-			return err
-		}
-	}
-	return nil
+func (s StateupProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.Stateup()
+	})
 }
 
 // SnapCreateProcess represents a command for delete cartons.
@@ -202,13 +196,10 @@ func (s SnapCreateProcess) String() string {
 	return buf.String()
 }
 
-func (s SnapCreateProcess) Process(ca Cartons) error {
-	for _, c := range ca {
-		if err := c.CreateSnapshot(); err != nil {
-			return err
-		}
-	}
-	return nil
+func (s SnapCreateProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.CreateSnapshot()
+	})
 }
 
 // DiskSaveProcs represents a command for delete cartons.
@@ -223,13 +214,10 @@ func (s SnapDestroyProcess) String() string {
 	return buf.String()
 }
 
-func (s SnapDestroyProcess) Process(ca Cartons) error {
-	for _, c := range ca {
-		if err := c.DeleteSnapshot(); err != nil {
-			return err
-		}
-	}
-	return nil
+func (s SnapDestroyProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.DeleteSnapshot()
+	})
 }
 
 // DiskSaveProcs represents a command for delete cartons.
@@ -244,13 +232,10 @@ func (s SnapRestoreProcess) String() string {
 	return buf.String()
 }
 
-func (s SnapRestoreProcess) Process(ca Cartons) error {
-	for _, c := range ca {
-		if err := c.RestoreSnapshot(); err != nil {
-			return err
-		}
-	}
-	return nil
+func (s SnapRestoreProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.RestoreSnapshot()
+	})
 }
 
 // SnapCreateProcess represents a command for delete cartons.
@@ -265,13 +250,10 @@ func (s SnapSaveAsProcess) String() string {
 	return buf.String()
 }
 
-func (s SnapSaveAsProcess) Process(ca Cartons) error {
-	for _, c := range ca {
-		if err := c.SnapshotSaveAs(); err != nil {
-			return err
-		}
-	}
-	return nil
+func (s SnapSaveAsProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.SnapshotSaveAs()
+	})
 }
 
 // ImageCreateProcess represents a command for create backup box.
@@ -286,13 +268,10 @@ func (s ImageCreateProcess) String() string {
 	return buf.String()
 }
 
-func (s ImageCreateProcess) Process(ca Cartons) error {
-	for _, c := range ca {
-		if err := c.CreateImage(); err != nil {
-			return err
-		}
-	}
-	return nil
+func (s ImageCreateProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.CreateImage()
+	})
 }
 
 // DiskSaveProcs represents a command for delete cartons.
@@ -307,13 +286,82 @@ func (s ImageDestroyProcess) String() string {
 	return buf.String()
 }
 
-func (s ImageDestroyProcess) Process(ca Cartons) error {
-	for _, c := range ca {
-		if err := c.DeleteImage(); err != nil {
-			return err
-		}
-	}
-	return nil
+func (s ImageDestroyProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.DeleteImage()
+	})
+}
+
+// ImageExportProcess represents a command for archive a backup.
+type ImageExportProcess struct {
+	Name string
+}
+
+func (s ImageExportProcess) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("BACKUP EXPORT CARTON ")
+	_, _ = buf.WriteString(s.Name)
+	return buf.String()
+}
+
+func (s ImageExportProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.ExportBackup()
+	})
+}
+
+// ImageImportProcess represents a command for deploy cartons from an archived backup.
+type ImageImportProcess struct {
+	Name string
+}
+
+func (s ImageImportProcess) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("BACKUP IMPORT CARTON ")
+	_, _ = buf.WriteString(s.Name)
+	return buf.String()
+}
+
+func (s ImageImportProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.ImportBackup()
+	})
+}
+
+// MigrateProcess represents a command for moving cartons to another region.
+type MigrateProcess struct {
+	Name string
+}
+
+func (s MigrateProcess) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("MIGRATE CARTON ")
+	_, _ = buf.WriteString(s.Name)
+	return buf.String()
+}
+
+func (s MigrateProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.Migrate()
+	})
+}
+
+// ResizeProcess represents a command for changing the flavor of cartons.
+type ResizeProcess struct {
+	Name string
+}
+
+func (s ResizeProcess) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("RESIZE CARTON ")
+	_, _ = buf.WriteString(s.Name)
+	return buf.String()
+}
+
+func (s ResizeProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.Resize()
+	})
 }
 
 // DiskAttachProcess represents a command for delete cartons.
@@ -328,13 +376,10 @@ func (s DiskAttachProcess) String() string {
 	return buf.String()
 }
 
-func (s DiskAttachProcess) Process(ca Cartons) error {
-	for _, c := range ca {
-		if err := c.AttachDisk(); err != nil {
-			return err
-		}
-	}
-	return nil
+func (s DiskAttachProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.AttachDisk()
+	})
 }
 
 // DiskDetachProcess represents a command for delete cartons.
@@ -349,13 +394,10 @@ func (s DiskDetachProcess) String() string {
 	return buf.String()
 }
 
-func (s DiskDetachProcess) Process(ca Cartons) error {
-	for _, c := range ca {
-		if err := c.DetachDisk(); err != nil {
-			return err
-		}
-	}
-	return nil
+func (s DiskDetachProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.DetachDisk()
+	})
 }
 
 // UpdateProcess represents a command for update operations based on poliecs cartons.
@@ -370,13 +412,10 @@ func (s UpdateNetworkProcess) String() string {
 	return buf.String()
 }
 
-func (s UpdateNetworkProcess) Process(ca Cartons) error {
-	for _, c := range ca {
-		if err := c.NetworkUpdate(); err != nil {
-			return err
-		}
-	}
-	return nil
+func (s UpdateNetworkProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.NetworkUpdate()
+	})
 }
 
 // UpgradeProcs represents a command for starting  cartons.
@@ -392,13 +431,10 @@ func (s RunningProcess) String() string {
 	return buf.String()
 }
 
-func (s RunningProcess) Process(ca Cartons) error {
-	for _, c := range ca {
-		if err := c.Running(); err != nil {
-			return err
-		}
-	}
-	return nil
+func (s RunningProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return ca.each(func(c *Carton) ([]*BoxResult, error) {
+		return c.Running()
+	})
 }
 
 // UpgradeProcs represents a command for starting  cartons.
@@ -413,6 +449,6 @@ func (s FailureProcess) String() string {
 	return buf.String()
 }
 
-func (s FailureProcess) Process(ca Cartons) error {
-	return nil
+func (s FailureProcess) Process(ca Cartons) ([]*BoxResult, error) {
+	return nil, nil
 }
@@ -0,0 +1,91 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package carton
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/libgo/cmd"
+	lw "github.com/virtengine/libgo/writer"
+	"github.com/virtengine/vertice/provision"
+)
+
+//the region an assembly moves to, set in its inputs before the migrate request.
+const MIGRATE_REGION = "migrate_region"
+
+type MigrateOpts struct {
+	B      *provision.Box
+	Region string
+	Out    io.Writer
+}
+
+//migrationTarget returns the region the assembly moves to from the current one.
+func migrationTarget(asm *Assembly, current string) (string, error) {
+	to := strings.TrimSpace(asm.Inputs.Match(MIGRATE_REGION))
+	switch {
+	case to == "":
+		return "", Permanent(fmt.Errorf("assembly %s has no %s to migrate to", asm.Id, MIGRATE_REGION))
+	case to == current:
+		return "", Permanent(fmt.Errorf("assembly %s already runs in %s", asm.Id, to))
+	}
+	return to, nil
+}
+
+// Migrate moves the box to the region of the opts, the box keeps its name.
+func Migrate(opts *MigrateOpts) error {
+	migrator, ok := ProvisionerMap[opts.B.Provider].(provision.Migrator)
+	if !ok {
+		return Permanent(fmt.Errorf("provisioner %s can't migrate boxes", opts.B.Provider))
+	}
+	var outBuffer bytes.Buffer
+	start := time.Now()
+	logWriter := lw.LogWriter{Box: opts.B}
+	logWriter.Async()
+	defer logWriter.Close()
+	writer := io.MultiWriter(&outBuffer, &logWriter, boxOut(opts.Out))
+	err := migrator.Migrate(opts.B, opts.Region, writer)
+	elapsed := time.Since(start)
+
+	if err != nil {
+		return err
+	}
+	slog := outBuffer.String()
+	log.Debugf("%s in (%s)\n%s",
+		cmd.Colorfy(opts.B.GetFullName()+" -> "+opts.Region, "cyan", "", "bold"),
+		cmd.Colorfy(elapsed.String(), "green", "", "bold"),
+		cmd.Colorfy(slog, "yellow", "", ""))
+	return nil
+}
+
+// Migrate a carton, which moves its boxes to the region set in its inputs.
+func (c *Carton) Migrate() ([]*BoxResult, error) {
+	asm, err := NewAssembly(c.Id, c.AccountId, c.OrgId)
+	if err != nil {
+		return nil, err
+	}
+	to, err := migrationTarget(asm, c.Region)
+	if err != nil {
+		return nil, err
+	}
+	return runInBoxes("migrate", *c.Boxes, func(b *provision.Box, out io.Writer) error {
+		return Migrate(&MigrateOpts{B: b, Region: to, Out: out})
+	})
+}
@@ -0,0 +1,26 @@
+package carton
+
+import (
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestMigrationTarget(c *check.C) {
+	asm := &Assembly{Id: "ASM1"}
+	_, err := migrationTarget(asm, "chennai")
+	c.Assert(err, check.NotNil)
+	c.Assert(IsTransient(err), check.Equals, false)
+
+	asm.Inputs.NukeAndSet(map[string][]string{MIGRATE_REGION: {" mumbai "}})
+	to, err := migrationTarget(asm, "chennai")
+	c.Assert(err, check.IsNil)
+	c.Assert(to, check.Equals, "mumbai")
+
+	_, err = migrationTarget(asm, "mumbai")
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestParseMigrate(c *check.C) {
+	p, err := NewReqParser("ASM1").parseOperations(MIGRATE)
+	c.Assert(err, check.IsNil)
+	c.Assert(p, check.FitsTypeOf, MigrateProcess{})
+}
@@ -35,6 +35,11 @@ func NewOrg(email, id string) (*Organization, error) {
 	return new(Organization).get(newArgs(email, id))
 }
 
+// UserOrgs returns the organizations the user is a member of.
+func UserOrgs(email string) ([]Organization, error) {
+	return new(Organization).gets(newArgs(email, ""))
+}
+
 func OrgBox() ([]Organization, error) {
 	return new(Organization).adminGets(newArgs(meta.MC.MasterUser, ""))
 }
@@ -0,0 +1,138 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package carton
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/vertice/meta"
+	"github.com/virtengine/vertice/provision"
+)
+
+// BoxErrors is the error of an operation that failed on some boxes of a carton.
+// The boxes missing from Errors were operated successfully.
+type BoxErrors struct {
+	Op     string
+	Total  int
+	Errors map[string]error
+}
+
+func (e *BoxErrors) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, 0, len(names))
+	for _, name := range names {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", name, e.Errors[name]))
+	}
+	return fmt.Sprintf("%s failed on %d of %d boxes: %s", e.Op, len(e.Errors), e.Total, strings.Join(msgs, "; "))
+}
+
+// Succeeded returns the number of boxes operated successfully.
+func (e *BoxErrors) Succeeded() int {
+	return e.Total - len(e.Errors)
+}
+
+//the number of boxes operated at once, as set in vertice.conf.
+func parallelism() int {
+	if meta.MC != nil && meta.MC.BoxParallelism > 0 {
+		return meta.MC.BoxParallelism
+	}
+	return meta.DefaultBoxParallelism
+}
+
+// runInBoxes runs the operation on every box using a bounded pool of workers.
+// A failing box doesn't stop the others, all the failures are returned as BoxErrors.
+// The results are in the order of the boxes, each with the tail of what the box logged.
+func runInBoxes(op string, boxes []provision.Box, fn func(b *provision.Box, out io.Writer) error) ([]*BoxResult, error) {
+	if len(boxes) == 0 {
+		return nil, nil
+	}
+	workers := parallelism()
+	if workers > len(boxes) {
+		workers = len(boxes)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		errs    = make(map[string]error)
+		results = make([]*BoxResult, len(boxes))
+		jobs    = make(chan int)
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				b := &boxes[i]
+				out := newLogExcerpt(MaxLogExcerpt)
+				start := time.Now()
+				err := fn(b, out)
+				results[i] = newBoxResult(op, b, time.Since(start), out.String(), err)
+				if err != nil {
+					log.Errorf("Unable to %s the box %s: %s", op, b.GetFullName(), err)
+					mu.Lock()
+					errs[boxKey(b)] = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range boxes {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return results, nil
+	}
+	be := &BoxErrors{Op: op, Total: len(boxes), Errors: errs}
+	log.Warnf("  %s ok on %d of %d boxes", op, be.Succeeded(), be.Total)
+	return results, be
+}
+
+// each runs the operation carton by carton, collecting the box results.
+// It stops at the first carton that fails, the failure is permanent when the
+// cartons before went fine: a retry would operate them again.
+func (ca Cartons) each(fn func(c *Carton) ([]*BoxResult, error)) ([]*BoxResult, error) {
+	var all []*BoxResult
+	for i, c := range ca {
+		results, err := fn(c)
+		all = append(all, results...)
+		if err != nil {
+			if i > 0 {
+				return all, Permanent(err)
+			}
+			return all, err
+		}
+	}
+	return all, nil
+}
+
+//boxes of a carton share the carton name, so the id keeps them apart.
+func boxKey(b *provision.Box) string {
+	return b.GetFullName() + "(" + b.Id + ")"
+}
@@ -0,0 +1,132 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package carton
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/virtengine/vertice/meta"
+	"github.com/virtengine/vertice/provision"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestRunInBoxesOperatesEveryBox(c *check.C) {
+	boxes := []provision.Box{{Id: "1"}, {Id: "2"}, {Id: "3"}}
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	_, err := runInBoxes("start", boxes, func(b *provision.Box, out io.Writer) error {
+		mu.Lock()
+		seen[b.Id] = true
+		mu.Unlock()
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(seen, check.DeepEquals, map[string]bool{"1": true, "2": true, "3": true})
+}
+
+func (s *S) TestRunInBoxesCollectsErrors(c *check.C) {
+	boxes := []provision.Box{{Id: "1", CartonName: "a"}, {Id: "2", CartonName: "a"}, {Id: "3", CartonName: "a"}}
+	var ran int32
+	_, err := runInBoxes("stop", boxes, func(b *provision.Box, out io.Writer) error {
+		atomic.AddInt32(&ran, 1)
+		if b.Id == "2" {
+			return errors.New("machine gone")
+		}
+		return nil
+	})
+	c.Assert(atomic.LoadInt32(&ran), check.Equals, int32(3))
+	be, ok := err.(*BoxErrors)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(be.Total, check.Equals, 3)
+	c.Assert(be.Succeeded(), check.Equals, 2)
+	c.Assert(be.Error(), check.Equals, "stop failed on 1 of 3 boxes: a(2): machine gone")
+}
+
+func (s *S) TestRunInBoxesResults(c *check.C) {
+	boxes := []provision.Box{{Id: "1", CartonId: "asm1"}, {Id: "2", CartonId: "asm1"}}
+	results, err := runInBoxes("stop", boxes, func(b *provision.Box, out io.Writer) error {
+		fmt.Fprintf(out, "stopping %s", b.Id)
+		if b.Id == "2" {
+			return errors.New("machine gone")
+		}
+		return nil
+	})
+	c.Assert(err, check.NotNil)
+	c.Assert(results, check.HasLen, 2)
+	c.Assert(results[0].BoxId, check.Equals, "1")
+	c.Assert(results[0].CartonId, check.Equals, "asm1")
+	c.Assert(results[0].Op, check.Equals, "stop")
+	c.Assert(results[0].Status, check.Equals, RESULT_OK)
+	c.Assert(results[0].Log, check.Equals, "stopping 1")
+	c.Assert(results[1].Failed(), check.Equals, true)
+	c.Assert(results[1].Error, check.Equals, "machine gone")
+	c.Assert(results[1].Log, check.Equals, "stopping 2")
+}
+
+func (s *S) TestLogExcerptKeepsTheTail(c *check.C) {
+	l := newLogExcerpt(5)
+	fmt.Fprint(l, "abc")
+	fmt.Fprint(l, "defgh")
+	c.Assert(l.String(), check.Equals, "defgh")
+}
+
+func (s *S) TestRunInBoxesIsBounded(c *check.C) {
+	old := meta.MC
+	defer func() { meta.MC = old }()
+	meta.MC = &meta.Config{BoxParallelism: 2}
+	boxes := make([]provision.Box, 6)
+	var running, max int32
+	_, err := runInBoxes("deploy", boxes, func(b *provision.Box, out io.Writer) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(atomic.LoadInt32(&max) <= 2, check.Equals, true)
+}
+
+func (s *S) TestEachStopsAtTheFirstFailure(c *check.C) {
+	var ran []string
+	fail := errors.New("read tcp: connection reset by peer")
+	op := func(c *Carton) ([]*BoxResult, error) {
+		ran = append(ran, c.Id)
+		if c.Id == "asm2" {
+			return nil, fail
+		}
+		return []*BoxResult{{CartonId: c.Id}}, nil
+	}
+	results, err := Cartons{{Id: "asm1"}, {Id: "asm2"}, {Id: "asm3"}}.each(op)
+	c.Assert(ran, check.DeepEquals, []string{"asm1", "asm2"})
+	c.Assert(results, check.HasLen, 1)
+	c.Assert(IsTransient(err), check.Equals, false)
+
+	ran = nil
+	_, err = Cartons{{Id: "asm2"}, {Id: "asm3"}}.each(op)
+	c.Assert(err, check.Equals, fail)
+	c.Assert(IsTransient(err), check.Equals, true)
+}
@@ -47,6 +47,16 @@ func NewPayload(b []byte) (*Payload, error) {
 	return p, err
 }
 
+// NewRequests reads the request carried by a queue message. A message that
+// isn't a payload is a permanent failure.
+func NewRequests(b []byte) (*Requests, error) {
+	p, err := NewPayload(b)
+	if err != nil {
+		return nil, Permanent(err)
+	}
+	return p.Convert()
+}
+
 /**
 **fetch the request json from riak and parse the json to struct
 **/
@@ -65,13 +65,13 @@ func newOperations(typ string) *Operations {
 	}
 }
 
-func NetworkUpdate(box *provision.Box) error {
+func NetworkUpdate(box *provision.Box, out io.Writer) error {
 	var outBuffer bytes.Buffer
 	start := time.Now()
 	logWriter := lw.LogWriter{Box: box}
 	logWriter.Async()
 	defer logWriter.Close()
-	writer := io.MultiWriter(&outBuffer, &logWriter)
+	writer := io.MultiWriter(&outBuffer, &logWriter, boxOut(out))
 
 	err := newOperations(NETWORK).network(box, writer)
 	elapsed := time.Since(start)
@@ -0,0 +1,79 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package carton
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/libgo/cmd"
+	lw "github.com/virtengine/libgo/writer"
+	"github.com/virtengine/vertice/provision/journal"
+)
+
+// DefaultResumeWindow is how old an unfinished pipeline can be and still be resumed,
+// older ones are rolled back.
+const DefaultResumeWindow = 30 * time.Minute
+
+// Reconcile picks up the pipelines of the provider left unfinished by the last run
+// of vertice. A recent pipeline is resumed, one that was rolling back or is too old
+// is rolled back.
+func Reconcile(provider string, store journal.Store, window time.Duration) error {
+	journals, err := store.Unfinished()
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, j := range journals {
+		if j.Provider != provider || j.Box == nil {
+			continue
+		}
+		if err := reconcile(j, window); err != nil {
+			log.Errorf("Unable to reconcile %s of box %s: %s", j.Op, j.Box.GetFullName(), err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d unfinished pipelines of %s not reconciled", failed, provider)
+	}
+	return nil
+}
+
+func reconcile(j *journal.Journal, window time.Duration) error {
+	r, ok := ProvisionerMap[j.Provider].(journal.Resumer)
+	if !ok {
+		return fmt.Errorf("provisioner %s can't resume pipelines", j.Provider)
+	}
+	lk, err := Locks.Acquire([]string{j.Box.CartonId}, j.Op)
+	if err != nil {
+		return err
+	}
+	defer lk.Release()
+
+	logWriter := lw.LogWriter{Box: j.Box}
+	logWriter.Async()
+	defer logWriter.Close()
+	var w io.Writer = &logWriter
+
+	if j.Status == journal.RUNNING && time.Since(j.UpdatedAt) < window {
+		log.Infof("%s %s of box %s", cmd.Colorfy("  resume", "green", "", "bold"), j.Op, j.Box.GetFullName())
+		return r.Resume(j, w)
+	}
+	log.Infof("%s %s of box %s", cmd.Colorfy("  rewind", "yellow", "", "bold"), j.Op, j.Box.GetFullName())
+	return r.Rewind(j, w)
+}
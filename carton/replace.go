@@ -0,0 +1,87 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package carton
+
+import (
+	"fmt"
+	"io"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/vertice/provision"
+)
+
+//instanceOf is the unit the assembly of the box runs, as its last deploy left it.
+var instanceOf = func(b *provision.Box) (string, error) {
+	asm, err := NewAssembly(b.CartonId, b.AccountId, b.OrgId)
+	if err != nil {
+		return "", err
+	}
+	return asm.instanceId(), nil
+}
+
+// replaceBox runs deploy for a new unit of the running box, the old units keep
+// serving until it is up and are removed after. A deploy that fails leaves the
+// box as it was. The provisioners that can't run two units of a box destroy it
+// before the deploy instead.
+func replaceBox(b *provision.Box, w io.Writer, deploy func() (string, error)) (string, error) {
+	r, ok := ProvisionerMap[b.Provider].(provision.UnitReplacer)
+	if !ok {
+		return redeployBox(b, w, deploy)
+	}
+	old, err := r.Units(b)
+	if err != nil {
+		return "", err
+	}
+	imageId, err := deploy()
+	if err != nil {
+		return "", err
+	}
+	//the box runs the new unit, a retry would deploy it once more: the errors
+	//from here on are permanent.
+	id, err := instanceOf(b)
+	if err != nil {
+		return imageId, Permanent(fmt.Errorf("box %s runs its new deploy, but its old units %v are left: %s", b.GetFullName(), old, err))
+	}
+	b.InstanceId = id //what comes next operates the new unit.
+	if old = without(old, id); len(old) == 0 {
+		return imageId, nil
+	}
+	log.Debugf("  remove the units %v replaced in box %s", old, b.GetFullName())
+	if err = r.RemoveUnits(b, old, w); err != nil {
+		return imageId, Permanent(fmt.Errorf("box %s runs its new deploy, but its old units %v are left: %s", b.GetFullName(), old, err))
+	}
+	return imageId, nil
+}
+
+//redeployBox destroys the box and runs deploy, the box is down until the
+//deploy is up.
+func redeployBox(b *provision.Box, w io.Writer, deploy func() (string, error)) (string, error) {
+	log.Debugf("  provisioner %s can't replace the units of box %s, destroying it first", b.Provider, b.GetFullName())
+	if err := ProvisionerMap[b.Provider].Destroy(b, w); err != nil {
+		return "", err
+	}
+	return deploy()
+}
+
+func without(units []string, unit string) []string {
+	var left []string
+	for _, u := range units {
+		if u != unit {
+			left = append(left, u)
+		}
+	}
+	return left
+}
@@ -0,0 +1,124 @@
+package carton
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/virtengine/vertice/provision"
+	"gopkg.in/check.v1"
+)
+
+//replacingProvisioner runs the vms of the boxes, by id.
+type replacingProvisioner struct {
+	provision.Provisioner
+	running   []string
+	removeErr error
+}
+
+func (p *replacingProvisioner) Units(b *provision.Box) ([]string, error) {
+	return []string{b.InstanceId}, nil
+}
+
+func (p *replacingProvisioner) RemoveUnits(b *provision.Box, units []string, w io.Writer) error {
+	if p.removeErr != nil {
+		return p.removeErr
+	}
+	p.running = without(p.running, units[0])
+	return nil
+}
+
+//replacing registers a replacingProvisioner, the instance of the box is the
+//vm it started last.
+func (s *S) replacing(c *check.C) (*replacingProvisioner, *provision.Box, func()) {
+	p := &replacingProvisioner{running: []string{"vm1"}}
+	ProvisionerMap["replacing"] = p
+	old := instanceOf
+	instanceOf = func(b *provision.Box) (string, error) {
+		return p.running[len(p.running)-1], nil
+	}
+	restore := func() {
+		delete(ProvisionerMap, "replacing")
+		instanceOf = old
+	}
+	return p, &provision.Box{CartonName: "web1", DomainName: "megam.io", Provider: "replacing", InstanceId: "vm1"}, restore
+}
+
+func (s *S) TestReplaceBox(c *check.C) {
+	p, b, restore := s.replacing(c)
+	defer restore()
+	img, err := replaceBox(b, ioutil.Discard, func() (string, error) {
+		p.running = append(p.running, "vm2")
+		return "ubuntu", nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(img, check.Equals, "ubuntu")
+	c.Assert(p.running, check.DeepEquals, []string{"vm2"})
+	c.Assert(b.InstanceId, check.Equals, "vm2")
+}
+
+func (s *S) TestReplaceBoxKeepsTheBoxWhenTheDeployFails(c *check.C) {
+	p, b, restore := s.replacing(c)
+	defer restore()
+	_, err := replaceBox(b, ioutil.Discard, func() (string, error) {
+		return "", errors.New("build failed")
+	})
+	c.Assert(err, check.ErrorMatches, "build failed")
+	c.Assert(p.running, check.DeepEquals, []string{"vm1"})
+	c.Assert(b.InstanceId, check.Equals, "vm1")
+}
+
+func (s *S) TestReplaceBoxLeavesTheOldUnits(c *check.C) {
+	p, b, restore := s.replacing(c)
+	defer restore()
+	p.removeErr = errors.New("vm busy")
+	_, err := replaceBox(b, ioutil.Discard, func() (string, error) {
+		p.running = append(p.running, "vm2")
+		return "ubuntu", nil
+	})
+	c.Assert(err, check.ErrorMatches, `box web1.megam.io runs its new deploy, but its old units \[vm1\] are left: vm busy`)
+	c.Assert(IsTransient(err), check.Equals, false)
+	c.Assert(b.InstanceId, check.Equals, "vm2")
+}
+
+//redeployingProvisioner runs one container per box, like docker.
+type redeployingProvisioner struct {
+	provision.Provisioner
+	running    []string
+	destroyErr error
+}
+
+func (p *redeployingProvisioner) Destroy(b *provision.Box, w io.Writer) error {
+	if p.destroyErr != nil {
+		return p.destroyErr
+	}
+	p.running = nil
+	return nil
+}
+
+func (s *S) TestReplaceBoxRedeploys(c *check.C) {
+	p := &redeployingProvisioner{running: []string{"c1"}}
+	ProvisionerMap["redeploying"] = p
+	defer delete(ProvisionerMap, "redeploying")
+	img, err := replaceBox(&provision.Box{CartonName: "web1", Provider: "redeploying"}, ioutil.Discard, func() (string, error) {
+		p.running = append(p.running, "c2")
+		return "app:v1", nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(img, check.Equals, "app:v1")
+	c.Assert(p.running, check.DeepEquals, []string{"c2"})
+}
+
+func (s *S) TestReplaceBoxRedeployDestroyFails(c *check.C) {
+	p := &redeployingProvisioner{running: []string{"c1"}, destroyErr: errors.New("docker is down")}
+	ProvisionerMap["redeploying"] = p
+	defer delete(ProvisionerMap, "redeploying")
+	deployed := false
+	_, err := replaceBox(&provision.Box{CartonName: "web1", Provider: "redeploying"}, ioutil.Discard, func() (string, error) {
+		deployed = true
+		return "", nil
+	})
+	c.Assert(err, check.ErrorMatches, "docker is down")
+	c.Assert(deployed, check.Equals, false)
+	c.Assert(p.running, check.DeepEquals, []string{"c1"})
+}
@@ -34,10 +34,23 @@ func NewReqOperator(r *Requests) *ReqOperator {
 	return &ReqOperator{CartonsId: r.CatId, Category: r.Category, Action: r.Action, AccountId: r.AccountId}
 }
 
-func (p *ReqOperator) Accept(r *MegdProcessor) error {
+// Accept runs the processor on the cartons of the request, returning
+// the result of every box operated. The assemblies are locked for the
+// time of the operation, see OpLocks.
+func (p *ReqOperator) Accept(r *MegdProcessor) ([]*BoxResult, error) {
 	c, err := p.Get()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	lk, err := Locks.Acquire(c.ids(), p.Action)
+	if err != nil {
+		return nil, err
+	}
+	defer lk.Release()
+	if lk.Waited { //an other operation changed the assembly while we waited, refetch it.
+		if c, err = p.Get(); err != nil {
+			return nil, err
+		}
 	}
 	md := *r
 	log.Debugf(cmd.Colorfy(md.String(), "cyan", "", "bold"))
@@ -93,6 +106,6 @@ func (p *ReqOperator) Get() (Cartons, error) {
 
 // MegdProcessor represents a single operation in vertice.
 type MegdProcessor interface {
-	Process(c Cartons) error
+	Process(c Cartons) ([]*BoxResult, error)
 	String() string
 }
@@ -20,6 +20,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/virtengine/vertice/provision"
 	"gopkg.in/yaml.v2"
 )
 
@@ -46,9 +47,12 @@ var (
 	HARD_STOP    = "hard-stop"
 	SUSPEND      = "suspend"
 
-	//the operation actions is just one called upgrade
+	//the operation actions are upgrade and rollback
 	OPERATIONS = "operations"
 	UPGRADE    = "upgrade"
+	ROLLBACK   = "rollback"
+	MIGRATE    = "migrate"
+	RESIZE     = "resize"
 
 	//snapshot actions
 	SNAPSHOT    = "snapshot"
@@ -61,6 +65,8 @@ var (
 	BACKUPS      = "backup"
 	IMAGECREATE  = "backupcreate"
 	IMAGEDESTROY = "backupremove"
+	IMAGEEXPORT  = "backupexport"
+	IMAGEIMPORT  = "backupimport"
 
 	NETWORK_UPDATE = "assembly.network.update"
 
@@ -70,8 +76,48 @@ var (
 	DETACHDISK = "detachdisk"
 )
 
+//the capability the provisioner needs for an action, the ones missing run on any.
+var actionCapabilities = map[string]map[string]provision.Capability{
+	STATE: {
+		CREATE:  provision.CapDeploy,
+		DESTROY: provision.CapDestroy,
+	},
+	CONTROL: {
+		START:        provision.CapStart,
+		STOP:         provision.CapStop,
+		HARD_STOP:    provision.CapStop,
+		RESTART:      provision.CapRestart,
+		HARD_RESTART: provision.CapRestart,
+		SUSPEND:      provision.CapSuspend,
+	},
+	OPERATIONS: {
+		UPGRADE:        provision.CapUpgrade,
+		ROLLBACK:       provision.CapUpgrade, //the previous image replaces the box, like an upgrade.
+		NETWORK_UPDATE: provision.CapNetwork,
+		IMAGEIMPORT:    provision.CapArchive,
+		MIGRATE:        provision.CapMigrate,
+		RESIZE:         provision.CapResize,
+	},
+	BACKUPS: {
+		IMAGECREATE:  provision.CapBackup,
+		IMAGEDESTROY: provision.CapBackup,
+		IMAGEEXPORT:  provision.CapArchive,
+	},
+	SNAPSHOT: {
+		SNAPCREATE:  provision.CapSnapshot,
+		SNAPRESTORE: provision.CapSnapshot,
+		SNAPDELETE:  provision.CapSnapshot,
+		SNAPSAVE:    provision.CapSnapshot,
+	},
+	DISKS: {
+		ATTACHDISK: provision.CapDisk,
+		DETACHDISK: provision.CapDisk,
+	},
+}
+
 type ReqParser struct {
-	name string
+	name     string
+	provider string
 }
 
 // NewParser returns a new instance of Parser.
@@ -79,6 +125,13 @@ func NewReqParser(n string) *ReqParser {
 	return &ReqParser{name: n}
 }
 
+// For makes the parser refuse the actions the provisioner doesn't run,
+// see provision.Capable.
+func (p *ReqParser) For(provider string) *ReqParser {
+	p.provider = provider
+	return p
+}
+
 // ParseRequest parses a request string and returns its MegdProcess representation.
 // eg: (state, create) => CreateProcess{}
 // After figuring out the process, we operate on it.
@@ -86,7 +139,16 @@ func ParseRequest(r *Requests) (MegdProcessor, error) {
 	return NewReqParser(r.CatId).ParseRequest(r.Category, r.Action)
 }
 
+// ParseRequestFor parses a request for the provisioner named provider, refusing
+// the actions it doesn't run up front.
+func ParseRequestFor(r *Requests, provider string) (MegdProcessor, error) {
+	return NewReqParser(r.CatId).For(provider).ParseRequest(r.Category, r.Action)
+}
+
 func (p *ReqParser) ParseRequest(category string, action string) (MegdProcessor, error) {
+	if err := p.supports(category, action); err != nil {
+		return nil, err
+	}
 	switch category {
 	case STATE:
 		return p.parseState(action)
@@ -171,12 +233,28 @@ func (p *ReqParser) parseOperations(action string) (MegdProcessor, error) {
 		return UpgradeProcess{
 			Name: p.name,
 		}, nil
+	case ROLLBACK:
+		return RollbackProcess{
+			Name: p.name,
+		}, nil
 	case NETWORK_UPDATE:
 		return UpdateNetworkProcess{
 			Name: p.name,
 		}, nil
+	case IMAGEIMPORT:
+		return ImageImportProcess{
+			Name: p.name,
+		}, nil
+	case MIGRATE:
+		return MigrateProcess{
+			Name: p.name,
+		}, nil
+	case RESIZE:
+		return ResizeProcess{
+			Name: p.name,
+		}, nil
 	default:
-		return nil, newParseError([]string{OPERATIONS, action}, []string{UPGRADE})
+		return nil, newParseError([]string{OPERATIONS, action}, []string{UPGRADE, ROLLBACK, IMAGEIMPORT, MIGRATE, RESIZE})
 	}
 }
 
@@ -205,8 +283,12 @@ func (p *ReqParser) parseBackups(action string) (MegdProcessor, error) {
 		return ImageDestroyProcess{
 			Name: p.name,
 		}, nil
+	case IMAGEEXPORT:
+		return ImageExportProcess{
+			Name: p.name,
+		}, nil
 	default:
-		return nil, newParseError([]string{BACKUPS, action}, []string{IMAGECREATE, IMAGEDESTROY})
+		return nil, newParseError([]string{BACKUPS, action}, []string{IMAGECREATE, IMAGEDESTROY, IMAGEEXPORT})
 	}
 }
 
@@ -248,6 +330,32 @@ func (p *ReqParser) parseDisks(action string) (MegdProcessor, error) {
 	}
 }
 
+//supports refuses an action the provisioner can't run, an unknown provisioner
+//is left to the process.
+func (p *ReqParser) supports(category, action string) error {
+	prov, ok := ProvisionerMap[p.provider]
+	if !ok {
+		return nil
+	}
+	c, ok := actionCapabilities[category][action]
+	if !ok || provision.Supports(prov, c) {
+		return nil
+	}
+	return &UnsupportedError{Provider: p.provider, Category: category, Action: action, Capability: c}
+}
+
+// UnsupportedError is an action the provisioner of the carton doesn't run.
+type UnsupportedError struct {
+	Provider   string
+	Category   string
+	Action     string
+	Capability provision.Capability
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s,%s is not supported by the provisioner %s, it has no %s capability", e.Category, e.Action, e.Provider, e.Capability)
+}
+
 // ParseError represents an error that occurred during parsing.
 type ParseError struct {
 	Found    string
@@ -0,0 +1,38 @@
+package carton
+
+import (
+	"github.com/virtengine/vertice/provision"
+	"gopkg.in/check.v1"
+)
+
+type stoppingProvisioner struct {
+	provision.Provisioner
+}
+
+func (stoppingProvisioner) Capabilities() []provision.Capability {
+	return []provision.Capability{provision.CapStart, provision.CapStop}
+}
+
+func (s *S) TestParseRequestUnsupported(c *check.C) {
+	ProvisionerMap["stopping"] = stoppingProvisioner{}
+	defer delete(ProvisionerMap, "stopping")
+
+	p, err := NewReqParser("ASM1").For("stopping").ParseRequest(CONTROL, HARD_STOP)
+	c.Assert(err, check.IsNil)
+	c.Assert(p, check.FitsTypeOf, StopProcess{})
+
+	_, err = NewReqParser("ASM1").For("stopping").ParseRequest(SNAPSHOT, SNAPCREATE)
+	c.Assert(err, check.FitsTypeOf, &UnsupportedError{})
+	c.Assert(err.(*UnsupportedError).Capability, check.Equals, provision.CapSnapshot)
+	c.Assert(IsTransient(err), check.Equals, false)
+
+	_, err = NewReqParser("ASM1").For("stopping").ParseRequest(OPERATIONS, ROLLBACK)
+	c.Assert(err, check.FitsTypeOf, &UnsupportedError{})
+	c.Assert(err.(*UnsupportedError).Capability, check.Equals, provision.CapUpgrade)
+
+	//the actions with no capability and the unknown provisioners aren't checked.
+	_, err = NewReqParser("ASM1").For("stopping").ParseRequest(DONE, RUNNING)
+	c.Assert(err, check.IsNil)
+	_, err = NewReqParser("ASM1").For("unknown").ParseRequest(SNAPSHOT, SNAPCREATE)
+	c.Assert(err, check.IsNil)
+}
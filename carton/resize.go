@@ -0,0 +1,190 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package carton
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/libgo/cmd"
+	lw "github.com/virtengine/libgo/writer"
+	"github.com/virtengine/vertice/provision"
+)
+
+const (
+	//the flavor an assembly is resized to, set in its inputs before the resize request.
+	RESIZE_FLAVOR = "resize_flavor_id"
+
+	//set to yes in the inputs, the resize may power the running boxes off.
+	RESIZE_OFFLINE = "resize_offline"
+)
+
+type ResizeOpts struct {
+	B   *provision.Box
+	To  provision.BoxCompute
+	Out io.Writer
+}
+
+//resizeTarget returns the flavor id the assembly is resized to.
+func resizeTarget(asm *Assembly) (string, error) {
+	to := strings.TrimSpace(asm.Inputs.Match(RESIZE_FLAVOR))
+	switch {
+	case to == "":
+		return "", Permanent(fmt.Errorf("assembly %s has no %s to resize to", asm.Id, RESIZE_FLAVOR))
+	case to == asm.flavorId():
+		return "", Permanent(fmt.Errorf("assembly %s already has the flavor %s", asm.Id, to))
+	}
+	return to, nil
+}
+
+//checkResize refuses a smaller disk, disks don't shrink.
+func checkResize(from, to provision.BoxCompute) error {
+	if to.HDD < from.HDD {
+		return Permanent(fmt.Errorf("disks don't shrink, %s is less than %s", to.HDD, from.HDD))
+	}
+	return nil
+}
+
+//checkOffline refuses to power a running box off for the resize, unless the
+//assembly accepts the downtime.
+func checkOffline(asm *Assembly, boxes []provision.Box) error {
+	if strings.TrimSpace(asm.Inputs.Match(RESIZE_OFFLINE)) == YES {
+		return nil
+	}
+	for i := range boxes {
+		b := &boxes[i]
+		if o, ok := ProvisionerMap[b.Provider].(provision.OfflineResizer); ok && o.ResizesOffline(b) {
+			return Permanent(fmt.Errorf("box %s runs and %s powers it off to resize it, set %s to %s to accept the downtime", b.GetFullName(), b.Provider, RESIZE_OFFLINE, YES))
+		}
+	}
+	return nil
+}
+
+// Resize changes the box to the compute of the opts.
+func Resize(opts *ResizeOpts) error {
+	resizer, ok := ProvisionerMap[opts.B.Provider].(provision.Resizer)
+	if !ok {
+		return Permanent(fmt.Errorf("provisioner %s can't resize boxes", opts.B.Provider))
+	}
+	var outBuffer bytes.Buffer
+	start := time.Now()
+	logWriter := lw.LogWriter{Box: opts.B}
+	logWriter.Async()
+	defer logWriter.Close()
+	writer := io.MultiWriter(&outBuffer, &logWriter, boxOut(opts.Out))
+	err := resizer.Resize(opts.B, opts.To, writer)
+	elapsed := time.Since(start)
+
+	if err != nil {
+		return err
+	}
+	slog := outBuffer.String()
+	log.Debugf("%s in (%s)\n%s",
+		cmd.Colorfy(opts.B.GetFullName()+" -> "+opts.To.String(), "cyan", "", "bold"),
+		cmd.Colorfy(elapsed.String(), "green", "", "bold"),
+		cmd.Colorfy(slog, "yellow", "", ""))
+	return nil
+}
+
+// Resize a carton, which changes its boxes to the flavor set in its inputs.
+// A provisioner that powers a running box off to resize it needs the assembly
+// to accept the downtime, see RESIZE_OFFLINE.
+// The assembly takes the flavor first, the bills and the provisioner read the
+// costs from it. When a box fails the assembly gets the old flavor back and the
+// boxes that took the new one are resized back, the results tell the boxes
+// left at the new size.
+func (c *Carton) Resize() ([]*BoxResult, error) {
+	if c.invalidCompute != nil {
+		return nil, c.invalidCompute
+	}
+	asm, err := NewAssembly(c.Id, c.AccountId, c.OrgId)
+	if err != nil {
+		return nil, err
+	}
+	id, err := resizeTarget(asm)
+	if err != nil {
+		return nil, err
+	}
+	flv, err := GetFlavor(c.AccountId, id)
+	if err != nil {
+		return nil, err
+	}
+	to, err := flv.compute()
+	if err != nil {
+		return nil, err
+	}
+	if err = checkResize(c.Compute, to); err != nil {
+		return nil, err
+	}
+	if err = checkOffline(asm, *c.Boxes); err != nil {
+		return nil, err
+	}
+
+	old := asm.flavorId()
+	if err = asm.NukeAndSetInputs(map[string][]string{FLAVOR_ID: {id}}); err != nil {
+		return nil, err
+	}
+	results, err := runInBoxes("resize", *c.Boxes, func(b *provision.Box, out io.Writer) error {
+		return Resize(&ResizeOpts{B: b, To: to, Out: out})
+	})
+	if err != nil {
+		if rerr := asm.NukeAndSetInputs(map[string][]string{FLAVOR_ID: {old}}); rerr != nil {
+			log.Errorf("Unable to set back the flavor %s of %s : %s", old, c.Id, rerr)
+		}
+		return append(results, resizeBack(resized(*c.Boxes, err), to)...), err
+	}
+	for _, k := range []string{RESIZE_FLAVOR, RESIZE_OFFLINE} {
+		if asm.Inputs.Match(k) == "" {
+			continue
+		}
+		if err = asm.NukeKeysInputs(k); err != nil {
+			log.Errorf("Unable to clear the %s of %s : %s", k, c.Id, err)
+		}
+	}
+	return results, nil
+}
+
+//resized are the boxes the resize went fine on.
+func resized(boxes []provision.Box, err error) []provision.Box {
+	be, ok := err.(*BoxErrors)
+	if !ok {
+		return nil
+	}
+	var done []provision.Box
+	for i := range boxes {
+		if _, failed := be.Errors[boxKey(&boxes[i])]; !failed {
+			done = append(done, boxes[i])
+		}
+	}
+	return done
+}
+
+//resizeBack gives the boxes that have the compute from back their own one.
+func resizeBack(boxes []provision.Box, from provision.BoxCompute) []*BoxResult {
+	results, err := runInBoxes("resize back", boxes, func(b *provision.Box, out io.Writer) error {
+		nb := *b
+		nb.Compute = from
+		return Resize(&ResizeOpts{B: &nb, To: b.Compute, Out: out})
+	})
+	if err != nil {
+		log.Errorf("Unable to resize back the boxes : %s", err)
+	}
+	return results
+}
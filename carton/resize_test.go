@@ -0,0 +1,108 @@
+package carton
+
+import (
+	"errors"
+	"io"
+
+	constants "github.com/virtengine/libgo/utils"
+	"github.com/virtengine/vertice/provision"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestResizeTarget(c *check.C) {
+	asm := &Assembly{Id: "ASM1"}
+	_, err := resizeTarget(asm)
+	c.Assert(err, check.NotNil)
+
+	asm.Inputs.NukeAndSet(map[string][]string{FLAVOR_ID: {"FLV1"}, RESIZE_FLAVOR: {"FLV2"}})
+	to, err := resizeTarget(asm)
+	c.Assert(err, check.IsNil)
+	c.Assert(to, check.Equals, "FLV2")
+
+	asm.Inputs.NukeAndSet(map[string][]string{RESIZE_FLAVOR: {"FLV1"}})
+	_, err = resizeTarget(asm)
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestCheckResize(c *check.C) {
+	small := provision.BoxCompute{Cpushare: 1, Memory: provision.GB, HDD: 20 * provision.GB}
+	big := provision.BoxCompute{Cpushare: 4, Memory: 8 * provision.GB, HDD: 40 * provision.GB}
+	c.Assert(checkResize(small, big), check.IsNil)
+
+	err := checkResize(big, small)
+	c.Assert(err, check.NotNil)
+	c.Assert(IsTransient(err), check.Equals, false)
+}
+
+func (s *S) TestResized(c *check.C) {
+	boxes := []provision.Box{
+		{Id: "BOX1", CartonName: "web1", DomainName: "megam.io"},
+		{Id: "BOX2", CartonName: "web1", DomainName: "megam.io"},
+	}
+	be := &BoxErrors{Op: "resize", Total: 2, Errors: map[string]error{
+		boxKey(&boxes[1]): errors.New("no room on the host"),
+	}}
+	c.Assert(resized(boxes, be), check.DeepEquals, boxes[:1])
+	c.Assert(resized(boxes, errors.New("no flavor")), check.HasLen, 0)
+}
+
+type offlineResizer struct {
+	provision.Provisioner
+}
+
+func (offlineResizer) Resize(b *provision.Box, to provision.BoxCompute, w io.Writer) error {
+	return nil
+}
+
+func (offlineResizer) ResizesOffline(b *provision.Box) bool {
+	return b.CanCycleStop()
+}
+
+func (s *S) TestCheckOffline(c *check.C) {
+	ProvisionerMap["offline"] = offlineResizer{}
+	defer delete(ProvisionerMap, "offline")
+	stopped := provision.Box{CartonName: "web1", DomainName: "megam.io", Provider: "offline", State: constants.StateStopped}
+	running := provision.Box{CartonName: "web2", DomainName: "megam.io", Provider: "offline", State: constants.StateRunning}
+	asm := &Assembly{Id: "ASM1"}
+	c.Assert(checkOffline(asm, []provision.Box{stopped}), check.IsNil)
+
+	err := checkOffline(asm, []provision.Box{stopped, running})
+	c.Assert(err, check.ErrorMatches, ".*web2.megam.io.*resize_offline.*")
+	c.Assert(IsTransient(err), check.Equals, false)
+
+	asm.Inputs.NukeAndSet(map[string][]string{RESIZE_OFFLINE: {YES}})
+	c.Assert(checkOffline(asm, []provision.Box{stopped, running}), check.IsNil)
+}
+
+func (s *S) TestFlavorComputeRejectsEmpty(c *check.C) {
+	_, err := (&Flavor{Id: "FLV1", Cpu: "2", Ram: "4", Disk: "40"}).compute()
+	c.Assert(err, check.IsNil)
+	_, err = (&Flavor{Id: "FLV2", Cpu: "", Ram: "4"}).compute()
+	c.Assert(err, check.NotNil)
+	c.Assert(IsTransient(err), check.Equals, false)
+}
+
+func (s *S) TestAssemblyComputeDefaultsToGB(c *check.C) {
+	a := &Assembly{Id: "ASM1"}
+	a.Inputs.NukeAndSet(map[string][]string{provision.CPU: {"2"}, provision.RAM: {"4"}, provision.HDD: {"40"}})
+	comp, err := a.compute()
+	c.Assert(err, check.IsNil)
+	c.Assert(comp.Memory, check.Equals, 4*provision.GB)
+	c.Assert(comp.HDD, check.Equals, 40*provision.GB)
+}
+
+func (s *S) TestInvalidComputeRefusedOnCreateAndResize(c *check.C) {
+	ca := &Carton{Id: "ASM1", Boxes: &[]provision.Box{}, invalidCompute: Permanent(errors.New("invalid ram"))}
+	_, err := ca.Deploy()
+	c.Assert(err, check.ErrorMatches, "invalid ram")
+	_, err = ca.Resize()
+	c.Assert(err, check.ErrorMatches, "invalid ram")
+	_, err = ca.Destroy()
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestParseResize(c *check.C) {
+	p, err := NewReqParser("ASM1").parseOperations(RESIZE)
+	c.Assert(err, check.IsNil)
+	c.Assert(p, check.FitsTypeOf, ResizeProcess{})
+}
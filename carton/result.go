@@ -0,0 +1,151 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package carton
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/virtengine/libgo/events"
+	"github.com/virtengine/libgo/events/alerts"
+	constants "github.com/virtengine/libgo/utils"
+	"github.com/virtengine/vertice/provision"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	RESULT_OK     = "ok"
+	RESULT_FAILED = "failed"
+
+	//the tail of the box log kept in a result.
+	MaxLogExcerpt = 2048
+)
+
+// BoxResult is the outcome of an operation on a single box.
+type BoxResult struct {
+	BoxId      string        `json:"box_id"`
+	BoxName    string        `json:"box_name"`
+	CartonId   string        `json:"carton_id"`
+	CartonName string        `json:"carton_name"`
+	Op         string        `json:"op"`
+	Duration   time.Duration `json:"duration"`
+	Status     string        `json:"status"`
+	Error      string        `json:"error"`
+	Log        string        `json:"log"`
+}
+
+func newBoxResult(op string, b *provision.Box, duration time.Duration, blog string, err error) *BoxResult {
+	r := &BoxResult{
+		BoxId:      b.Id,
+		BoxName:    b.GetFullName(),
+		CartonId:   b.CartonId,
+		CartonName: b.CartonName,
+		Op:         op,
+		Duration:   duration,
+		Status:     RESULT_OK,
+		Log:        blog,
+	}
+	if err != nil {
+		r.Status = RESULT_FAILED
+		r.Error = err.Error()
+	}
+	return r
+}
+
+func (r *BoxResult) Failed() bool {
+	return r.Status == RESULT_FAILED
+}
+
+func (r *BoxResult) String() string {
+	if d, err := yaml.Marshal(r); err != nil {
+		return err.Error()
+	} else {
+		return string(d)
+	}
+}
+
+// OutcomeEvent is the machine event for the results of a request, every box result
+// goes as a json line in the event data.
+func OutcomeEvent(r *Requests, results []*BoxResult, err error) *events.Event {
+	mi := make(map[string]string)
+	mi[constants.ASSEMBLY_ID] = r.CatId
+	mi[constants.ACCOUNT_ID] = r.AccountId
+	mi["request_id"] = r.Id
+	mi["category"] = r.Category
+	mi["action"] = r.Action
+	mi["status"] = RESULT_OK
+
+	action := alerts.STATUS
+	if err != nil {
+		action = alerts.FAILURE
+		mi["status"] = RESULT_FAILED
+		mi["error"] = err.Error()
+	}
+
+	d := make([]string, 0, len(results))
+	for _, res := range results {
+		if js, jerr := json.Marshal(res); jerr == nil {
+			d = append(d, string(js))
+		}
+	}
+
+	return &events.Event{
+		AccountsId:  r.AccountId,
+		EventAction: action,
+		EventType:   constants.EventMachine,
+		EventData:   alerts.EventData{M: mi, D: d},
+		Timestamp:   time.Now().Local(),
+	}
+}
+
+//logExcerpt keeps the last bytes written to it. The provisioners can write
+//from their own goroutines, hence the lock.
+type logExcerpt struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func newLogExcerpt(max int) *logExcerpt {
+	return &logExcerpt{max: max}
+}
+
+func (l *logExcerpt) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf = append(l.buf, p...)
+	if over := len(l.buf) - l.max; over > 0 {
+		l.buf = append(l.buf[:0], l.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func (l *logExcerpt) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return string(l.buf)
+}
+
+//boxOut is where an operation copies the box log when asked to.
+func boxOut(w io.Writer) io.Writer {
+	if w == nil {
+		return ioutil.Discard
+	}
+	return w
+}
@@ -0,0 +1,193 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package carton
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/vertice/provision"
+)
+
+const (
+	//the retention rules of the snapshots, set in the inputs of the assembly.
+	SNAP_KEEP_LAST  = "snapshot_keep_last"
+	SNAP_KEEP_DAILY = "snapshot_keep_daily"
+)
+
+//the layouts the gateway dates come in.
+var snapTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 -0700 MST",
+	"2006-01-02 15:04:05",
+}
+
+// Retention tells which snapshots of an assembly are kept. A snapshot is kept
+// when any rule keeps it, no rule means every snapshot is kept.
+type Retention struct {
+	//KeepLast keeps the newest snapshots.
+	KeepLast int
+	//KeepDaily keeps the newest snapshot of each of the last days.
+	KeepDaily int
+}
+
+func (r Retention) IsZero() bool {
+	return r.KeepLast <= 0 && r.KeepDaily <= 0
+}
+
+func (r Retention) String() string {
+	return fmt.Sprintf("keep last %d, daily for %d days", r.KeepLast, r.KeepDaily)
+}
+
+func (a *Assembly) retention() Retention {
+	last, _ := strconv.Atoi(strings.TrimSpace(a.Inputs.Match(SNAP_KEEP_LAST)))
+	daily, _ := strconv.Atoi(strings.TrimSpace(a.Inputs.Match(SNAP_KEEP_DAILY)))
+	return Retention{KeepLast: last, KeepDaily: daily}
+}
+
+// SnapQuotaError is returned when the quota of the assembly has no snapshot left.
+type SnapQuotaError struct {
+	QuotaId string
+	Allowed string
+}
+
+func (e *SnapQuotaError) Error() string {
+	return fmt.Sprintf("snapshot refused: quota %s allows %s more snapshots, remove some or raise the quota", e.QuotaId, e.Allowed)
+}
+
+//checkSnapQuota refuses a snapshot when the quota is used up. The quota counts
+//down the snapshots left, see UpdateSnapQuotas of the provisioner.
+func (c *Carton) checkSnapQuota() error {
+	if len(c.QuotaId) == 0 {
+		return nil
+	}
+	q, err := NewQuota(c.AccountId, c.QuotaId)
+	if err != nil {
+		return err
+	}
+	left, err := strconv.Atoi(strings.TrimSpace(q.AllowedSnaps()))
+	if err != nil { //no limit set.
+		return nil
+	}
+	if left <= 0 {
+		return Permanent(&SnapQuotaError{QuotaId: c.QuotaId, Allowed: q.AllowedSnaps()})
+	}
+	return nil
+}
+
+// Prune returns the snapshots the rules don't keep, oldest first. Only the
+// alive snapshots with a readable date are considered, keep is never pruned.
+func (r Retention) Prune(snaps []Snaps, keep string, now time.Time) []Snaps {
+	if r.IsZero() {
+		return nil
+	}
+	type dated struct {
+		s Snaps
+		t time.Time
+	}
+	alive := make([]dated, 0, len(snaps))
+	for _, s := range snaps {
+		t, ok := snapTime(s.CreatedAt)
+		if !ok || !s.IsAlive() {
+			continue
+		}
+		alive = append(alive, dated{s, t})
+	}
+	sort.SliceStable(alive, func(i, j int) bool { return alive[i].t.After(alive[j].t) })
+
+	kept := make(map[string]bool, len(alive))
+	days := make(map[string]bool, r.KeepDaily)
+	since := now.AddDate(0, 0, -r.KeepDaily)
+	for i, d := range alive {
+		if d.s.Id == keep || i < r.KeepLast {
+			kept[d.s.Id] = true
+		}
+		day := d.t.In(now.Location()).Format("2006-01-02")
+		if r.KeepDaily > 0 && d.t.After(since) && !days[day] { //newest of the day
+			days[day] = true
+			kept[d.s.Id] = true
+		}
+	}
+
+	prune := make([]Snaps, 0)
+	for i := len(alive) - 1; i >= 0; i-- {
+		if !kept[alive[i].s.Id] {
+			prune = append(prune, alive[i].s)
+		}
+	}
+	return prune
+}
+
+func snapTime(s string) (time.Time, bool) {
+	for _, l := range snapTimeLayouts {
+		if t, err := time.Parse(l, strings.TrimSpace(s)); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+//pruneSnapshots deletes the snapshots of the assembly its retention doesn't
+//keep, the one just taken aside. A failed prune doesn't fail the snapshot.
+func (c *Carton) pruneSnapshots() []*BoxResult {
+	if c.Retention.IsZero() || c.Boxes == nil || len(*c.Boxes) == 0 {
+		return nil
+	}
+	snaps, err := GetAsmSnaps(c.Id, c.AccountId)
+	if err != nil {
+		log.Errorf("Unable to list the snapshots of %s to prune : %s", c.Id, err)
+		return nil
+	}
+	prune := c.Retention.Prune(snaps, c.CartonsId, time.Now())
+	if len(prune) == 0 {
+		return nil
+	}
+	log.Infof("  pruning %d snapshots of %s (%s)", len(prune), c.Name, c.Retention)
+	results := make([]*BoxResult, 0, len(prune))
+	for _, s := range prune { //one at a time, they are snapshots of the same disks.
+		b, err := snapBox(&s)
+		if err != nil {
+			log.Errorf("Unable to prune the snapshot %s of %s : %s", s.Id, c.Id, err)
+			continue
+		}
+		out := newLogExcerpt(MaxLogExcerpt)
+		start := time.Now()
+		err = DeleteSnapshot(&DiskOpts{B: b, Out: out})
+		if err != nil {
+			log.Errorf("Unable to prune the snapshot %s of %s : %s", s.Id, c.Id, err)
+		}
+		results = append(results, newBoxResult("prune snapshot", b, time.Since(start), out.String(), err))
+	}
+	return results
+}
+
+//snapBox is the box the snapshot was taken of, its CartonsId is the snapshot
+//deleted, see DeleteSnapshot of the provisioner.
+func snapBox(s *Snaps) (*provision.Box, error) {
+	cs, err := s.MkCartons()
+	if err != nil {
+		return nil, err
+	}
+	if len(cs) == 0 || cs[0].Boxes == nil || len(*cs[0].Boxes) == 0 {
+		return nil, fmt.Errorf("snapshot %s has no box", s.Id)
+	}
+	return &(*cs[0].Boxes)[0], nil
+}
@@ -0,0 +1,66 @@
+package carton
+
+import (
+	"time"
+
+	constants "github.com/virtengine/libgo/utils"
+	"github.com/virtengine/vertice/provision"
+	"gopkg.in/check.v1"
+)
+
+func snap(id, created string) Snaps {
+	return Snaps{Id: id, CreatedAt: created, Status: constants.ACTIVESNAP}
+}
+
+func ids(snaps []Snaps) []string {
+	r := make([]string, len(snaps))
+	for i, s := range snaps {
+		r[i] = s.Id
+	}
+	return r
+}
+
+func (s *S) TestRetentionNoRuleKeepsAll(c *check.C) {
+	snaps := []Snaps{snap("S1", "2017-03-01T10:00:00Z"), snap("S2", "2017-03-02T10:00:00Z")}
+	c.Assert(Retention{}.Prune(snaps, "", time.Now()), check.HasLen, 0)
+}
+
+func (s *S) TestPruneSnapshotsWithoutBoxes(c *check.C) {
+	ca := &Carton{Id: "ASM1", Retention: Retention{KeepLast: 1}}
+	c.Assert(ca.pruneSnapshots(), check.HasLen, 0)
+	ca.Boxes = &[]provision.Box{}
+	c.Assert(ca.pruneSnapshots(), check.HasLen, 0)
+}
+
+func (s *S) TestRetentionKeepLast(c *check.C) {
+	snaps := []Snaps{
+		snap("S3", "2017-03-03T10:00:00Z"),
+		snap("S1", "2017-03-01T10:00:00Z"),
+		snap("S4", "2017-03-04T10:00:00Z"),
+		snap("S2", "2017-03-02 10:00:00 +0000"),
+		snap("SX", "yesterday"), //unreadable dates are kept
+	}
+	now, _ := time.Parse(time.RFC3339, "2017-03-05T10:00:00Z")
+	c.Assert(ids(Retention{KeepLast: 2}.Prune(snaps, "S4", now)), check.DeepEquals, []string{"S1", "S2"})
+	c.Assert(ids(Retention{KeepLast: 1}.Prune(snaps, "S1", now)), check.DeepEquals, []string{"S2", "S3"})
+}
+
+func (s *S) TestRetentionKeepDaily(c *check.C) {
+	snaps := []Snaps{
+		snap("S1", "2017-02-20T10:00:00Z"), //too old
+		snap("S2", "2017-03-03T08:00:00Z"),
+		snap("S3", "2017-03-03T20:00:00Z"), //newest of the 3rd
+		snap("S4", "2017-03-04T10:00:00Z"),
+		snap("S5", "2017-03-05T09:00:00Z"),
+	}
+	now, _ := time.Parse(time.RFC3339, "2017-03-05T10:00:00Z")
+	c.Assert(ids(Retention{KeepDaily: 7}.Prune(snaps, "S5", now)), check.DeepEquals, []string{"S1", "S2"})
+	c.Assert(ids(Retention{KeepDaily: 7, KeepLast: 5}.Prune(snaps, "S5", now)), check.HasLen, 0)
+}
+
+func (s *S) TestRetentionSkipsSnapsNotAlive(c *check.C) {
+	busy := snap("S1", "2017-03-01T10:00:00Z")
+	busy.Status = "snapshot_creating"
+	snaps := []Snaps{busy, snap("S2", "2017-03-02T10:00:00Z")}
+	c.Assert(Retention{KeepLast: 1}.Prune(snaps, "", time.Now()), check.HasLen, 0)
+}
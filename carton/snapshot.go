@@ -60,7 +60,7 @@ func CreateSnapshot(opts *DiskOpts) error {
 	logWriter := lw.LogWriter{Box: opts.B}
 	logWriter.Async()
 	defer logWriter.Close()
-	writer := io.MultiWriter(&outBuffer, &logWriter)
+	writer := io.MultiWriter(&outBuffer, &logWriter, boxOut(opts.Out))
 	err := ProvisionerMap[opts.B.Provider].CreateSnapshot(opts.B, writer)
 	elapsed := time.Since(start)
 
@@ -82,7 +82,7 @@ func RestoreSnapshot(opts *DiskOpts) error {
 	logWriter := lw.LogWriter{Box: opts.B}
 	logWriter.Async()
 	defer logWriter.Close()
-	writer := io.MultiWriter(&outBuffer, &logWriter)
+	writer := io.MultiWriter(&outBuffer, &logWriter, boxOut(opts.Out))
 	err := ProvisionerMap[opts.B.Provider].RestoreSnapshot(opts.B, writer)
 	elapsed := time.Since(start)
 
@@ -104,7 +104,7 @@ func SnapshotSaveAs(opts *DiskOpts) error {
 	logWriter := lw.LogWriter{Box: opts.B}
 	logWriter.Async()
 	defer logWriter.Close()
-	writer := io.MultiWriter(&outBuffer, &logWriter)
+	writer := io.MultiWriter(&outBuffer, &logWriter, boxOut(opts.Out))
 	err := ProvisionerMap[opts.B.Provider].CreateSnapshot(opts.B, writer)
 	elapsed := time.Since(start)
 
@@ -126,7 +126,7 @@ func DeleteSnapshot(opts *DiskOpts) error {
 	logWriter := lw.LogWriter{Box: opts.B}
 	logWriter.Async()
 	defer logWriter.Close()
-	writer := io.MultiWriter(&outBuffer, &logWriter)
+	writer := io.MultiWriter(&outBuffer, &logWriter, boxOut(opts.Out))
 	err := ProvisionerMap[opts.B.Provider].DeleteSnapshot(opts.B, writer)
 	elapsed := time.Since(start)
 
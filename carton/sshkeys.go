@@ -0,0 +1,48 @@
+package carton
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/virtengine/libgo/api"
+)
+
+//the ssh keys of the accounts, a box names its key with BoxSSH.Prefix.
+type SshKey struct {
+	Id         string `json:"id" cql:"id"`
+	OrgId      string `json:"org_id" cql:"org_id"`
+	Name       string `json:"name" cql:"name"`
+	AccountId  string `json:"account_id" cql:"account_id"`
+	PrivateKey string `json:"privatekey" cql:"privatekey"`
+	PublicKey  string `json:"publickey" cql:"publickey"`
+	JsonClaz   string `json:"json_claz" cql:"json_claz"`
+	CreatedAt  string `json:"created_at" cql:"created_at"`
+}
+
+type ApiSshKeys struct {
+	JsonClaz string   `json:"json_claz"`
+	Results  []SshKey `json:"results"`
+}
+
+// NewSshKey returns the ssh key of the account by its name.
+func NewSshKey(email, org, name string) (*SshKey, error) {
+	s := &SshKey{Name: name}
+	return s.get(newArgs(email, org))
+}
+
+func (s *SshKey) get(args api.ApiArgs) (*SshKey, error) {
+	cl := api.NewClient(args, "/sshkeys/"+s.Name)
+	response, err := cl.Get()
+	if err != nil {
+		return nil, err
+	}
+	ac := &ApiSshKeys{}
+	err = json.Unmarshal(response, ac)
+	if err != nil {
+		return nil, err
+	}
+	if len(ac.Results) == 0 {
+		return nil, fmt.Errorf("ssh key %s not found", s.Name)
+	}
+	return &ac.Results[0], nil
+}
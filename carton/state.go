@@ -18,6 +18,7 @@ import (
 type StateChangeOpts struct {
 	B       *provision.Box
 	Changed utils.Status
+	Out     io.Writer
 }
 
 // ChangeState runs a state increment of a machine or a container.
@@ -27,7 +28,7 @@ func ChangeState(opts *StateChangeOpts) error {
 	logWriter := lw.LogWriter{Box: opts.B}
 	logWriter.Async()
 	defer logWriter.Close()
-	writer := io.MultiWriter(&outBuffer, &logWriter)
+	writer := io.MultiWriter(&outBuffer, &logWriter, boxOut(opts.Out))
 	err := moveState(opts, writer)
 	elapsed := time.Since(start)
 	saveErr := saveStateData(opts, outBuffer.String(), elapsed, err)
@@ -0,0 +1,91 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package carton
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+)
+
+// PermanentError marks an error that won't go away by retrying the request.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+//what the providers (OpenNebula xml-rpc, docker, rancher) and the gateway say when they are
+//busy or away for a moment.
+var transientMessages = []string{
+	"timeout",
+	"timed out",
+	"connection refused",
+	"connection reset",
+	"broken pipe",
+	"no such host",
+	"eof",
+	"temporarily unavailable",
+	"service unavailable",
+	"bad gateway",
+	"too many requests",
+	" 502",
+	" 503",
+	" 504",
+}
+
+// IsTransient tells if the request that failed with err is worth retrying.
+// Errors are permanent unless they look like a network or a provider hiccup.
+func IsTransient(err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return false
+	case *PermanentError, *ParseError, *UnsupportedError, *OpRejectedError, *json.SyntaxError, *json.UnmarshalTypeError:
+		return false
+	case *BoxErrors:
+		//a retry runs the operation on all the boxes again, the ones it went
+		//fine on would be deployed, and billed, twice.
+		if e.Succeeded() > 0 {
+			return false
+		}
+		for _, be := range e.Errors {
+			if IsTransient(be) {
+				return true
+			}
+		}
+		return false
+	case net.Error:
+		if e.Timeout() || e.Temporary() {
+			return true
+		}
+	}
+	msg := strings.ToLower(err.Error())
+	for _, t := range transientMessages {
+		if strings.Contains(msg, t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package carton
+
+import (
+	"errors"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestIsTransient(c *check.C) {
+	c.Assert(IsTransient(nil), check.Equals, false)
+	c.Assert(IsTransient(errors.New("Post http://one:2633/RPC2: net/http: request canceled (Client.Timeout exceeded)")), check.Equals, true)
+	c.Assert(IsTransient(errors.New("HTTP 503 Service Unavailable")), check.Equals, true)
+	c.Assert(IsTransient(errors.New("[VirtualMachineAllocate] Error allocating a new virtual machine template")), check.Equals, false)
+	c.Assert(IsTransient(Permanent(errors.New("i/o timeout"))), check.Equals, false)
+	c.Assert(IsTransient(&OpRejectedError{Id: "ASM1", Action: STOP, Pending: DESTROY}), check.Equals, false)
+	c.Assert(IsTransient(newParseError([]string{"state", "bogus"}, []string{CREATE})), check.Equals, false)
+}
+
+func (s *S) TestIsTransientBoxErrors(c *check.C) {
+	be := &BoxErrors{Op: "deploy", Total: 2, Errors: map[string]error{
+		"a(1)": errors.New("quota exceeded"),
+		"a(2)": errors.New("read tcp: connection reset by peer"),
+	}}
+	c.Assert(IsTransient(be), check.Equals, true)
+	delete(be.Errors, "a(2)")
+	c.Assert(IsTransient(be), check.Equals, false)
+
+	//a box went fine, a retry would operate it again.
+	be = &BoxErrors{Op: "deploy", Total: 2, Errors: map[string]error{
+		"a(2)": errors.New("read tcp: connection reset by peer"),
+	}}
+	c.Assert(IsTransient(be), check.Equals, false)
+}
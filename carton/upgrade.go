@@ -1,10 +1,13 @@
 package carton
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	constants "github.com/virtengine/libgo/utils"
 	lw "github.com/virtengine/libgo/writer"
 	"github.com/virtengine/vertice/provision"
 )
@@ -12,7 +15,9 @@ import (
 type Upgradeable struct {
 	B             *provision.Box
 	w             io.Writer
+	outBuffer     bytes.Buffer
 	ShouldRestart bool
+	Out           io.Writer
 }
 
 func NewUpgradeable(box *provision.Box) *Upgradeable {
@@ -26,11 +31,11 @@ func NewUpgradeable(box *provision.Box) *Upgradeable {
 
 func (u *Upgradeable) register() {}
 
-// this is for CI/BIND for docker only
+// this is for CI/BIND, triggered by the git hooks of the box repository.
 func (u *Upgradeable) Upgrade() error {
 	logWriter := lw.NewLogWriter(u.B)
 	defer logWriter.Close()
-	writer := io.MultiWriter(&logWriter)
+	writer := io.MultiWriter(&u.outBuffer, &logWriter, boxOut(u.Out))
 	err := u.operateBox(writer)
 	if err != nil {
 		return err
@@ -38,33 +43,40 @@ func (u *Upgradeable) Upgrade() error {
 	return nil
 }
 
+// operateBox rebuilds the box from the latest commit of its repository.
+// The running machine or container is swapped for the new build once it is
+// up, a failed build leaves it running. The provisioners that run one
+// container per box, docker and rancher, destroy it before the build.
 func (u *Upgradeable) operateBox(writer io.Writer) error {
 	u.w = writer
 	start := time.Now()
-	/*opsRan, err := upgrade.Run(upgrade.RunArgs{
-		Name:   u.B.GetFullName(),
-		O:      u.B.Operations,
-		Writer: writer,
-		Force:  false,
-	})
-	if err != nil {
-		return err
-	}*/
+	p := ProvisionerMap[u.B.Provider]
+	deployer, ok := p.(provision.GitDeployer)
+	if !ok {
+		return fmt.Errorf("provisioner %s can't upgrade the box %s from git", u.B.Provider, u.B.GetFullName())
+	}
 
+	imageId, err := replaceBox(u.B, writer, func() (string, error) {
+		return deployer.GitDeploy(u.B, writer)
+	})
 	elapsed := time.Since(start)
 
-	if err := u.saveData(elapsed); err != nil {
+	if saveErr := u.saveData(imageId, elapsed, err); saveErr != nil {
 		log.Errorf("WARNING: couldn't save ops data, ops opts: %#v", u)
+	}
+
+	if err != nil {
 		return err
 	}
 
+	//the new build comes up launched, stop it when we were told not to restart.
 	if !u.ShouldRestart {
-		return nil
+		return p.Stop(u.B, constants.STOP, writer)
 	}
 
 	return nil
 }
 
-func (u *Upgradeable) saveData(duration time.Duration) error {
-	return nil
+func (u *Upgradeable) saveData(imageId string, duration time.Duration, upgradeError error) error {
+	return saveDeployData(&DeployOpts{B: u.B}, imageId, u.outBuffer.String(), duration, upgradeError)
 }
@@ -10,9 +10,13 @@ import (
 	"github.com/virtengine/vertice/subd/docker"
 	"github.com/virtengine/vertice/subd/eventsd"
 	"github.com/virtengine/vertice/subd/httpd"
+	"github.com/virtengine/vertice/subd/kubernetesd"
+	"github.com/virtengine/vertice/subd/libvirtd"
 	"github.com/virtengine/vertice/subd/marketplacesd"
 	"github.com/virtengine/vertice/subd/metricsd"
+	"github.com/virtengine/vertice/subd/plugind"
 	"github.com/virtengine/vertice/subd/rancher"
+	"github.com/virtengine/vertice/subd/schedulerd"
 )
 
 type Config struct {
@@ -26,6 +30,10 @@ type Config struct {
 	Storage      *storage.Config       `toml:"storage"`
 	Rancher      *rancher.Config       `toml:"rancher"`
 	MarketPlaces *marketplacesd.Config `toml:"marketplaces"`
+	Scheduler    *schedulerd.Config    `toml:"scheduler"`
+	Plugins      *plugind.Config       `toml:"plugins"`
+	Libvirtd     *libvirtd.Config      `toml:"libvirtd"`
+	Kubernetesd  *kubernetesd.Config   `toml:"kubernetesd"`
 }
 
 func (c Config) String() string {
@@ -39,6 +47,10 @@ func (c Config) String() string {
 		c.Events.String() + "\n" +
 		c.Storage.String() + "\n" +
 		c.MarketPlaces.String() + "\n" +
+		c.Scheduler.String() + "\n" +
+		c.Plugins.String() + "\n" +
+		c.Libvirtd.String() + "\n" +
+		c.Kubernetesd.String() + "\n" +
 		c.Rancher.String())
 
 }
@@ -56,6 +68,10 @@ func NewConfig() *Config {
 	c.Storage = storage.NewConfig()
 	c.Rancher = rancher.NewConfig()
 	c.MarketPlaces = marketplacesd.NewConfig()
+	c.Scheduler = schedulerd.NewConfig()
+	c.Plugins = plugind.NewConfig()
+	c.Libvirtd = libvirtd.NewConfig()
+	c.Kubernetesd = kubernetesd.NewConfig()
 	return c
 }
 
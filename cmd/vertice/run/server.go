@@ -5,6 +5,7 @@ import (
 	"os"
 	"runtime"
 	"runtime/pprof"
+	"sync"
 
 	log "github.com/Sirupsen/logrus"
 	pp "github.com/virtengine/libgo/cmd"
@@ -14,9 +15,13 @@ import (
 	"github.com/virtengine/vertice/subd/docker"
 	"github.com/virtengine/vertice/subd/eventsd"
 	"github.com/virtengine/vertice/subd/httpd"
+	"github.com/virtengine/vertice/subd/kubernetesd"
+	"github.com/virtengine/vertice/subd/libvirtd"
 	"github.com/virtengine/vertice/subd/marketplacesd"
 	"github.com/virtengine/vertice/subd/metricsd"
+	"github.com/virtengine/vertice/subd/plugind"
 	"github.com/virtengine/vertice/subd/rancher"
+	"github.com/virtengine/vertice/subd/schedulerd"
 )
 
 // Server represents a container for the metadata and storage data and services.
@@ -49,6 +54,10 @@ func NewServer(c *Config, version string) (*Server, error) {
 	s.appendEventsdService(c.Meta, c.Events, c.Deployd)
 	s.appendRancherService(c.Meta, c.Rancher)
 	s.appendMarketplacesService(c.Meta, c.MarketPlaces, c.Deployd)
+	s.appendSchedulerService(c.Meta, c.Scheduler)
+	s.appendPlugindService(c.Meta, c.Plugins)
+	s.appendLibvirtdService(c.Meta, c.Libvirtd)
+	s.appendKubernetesdService(c.Meta, c.Kubernetesd)
 	s.selfieDNS(c.DNS)
 	c.Meta.MkGlobal() //a setter for global meta config
 	return s, nil
@@ -122,6 +131,42 @@ func (s *Server) appendRancherService(c *meta.Config, d *rancher.Config) {
 	s.Services = append(s.Services, srv)
 }
 
+func (s *Server) appendSchedulerService(c *meta.Config, d *schedulerd.Config) {
+	if !d.Enabled {
+		log.Warn("skip schedulerd service.")
+		return
+	}
+	srv := schedulerd.NewService(c, d)
+	s.Services = append(s.Services, srv)
+}
+
+func (s *Server) appendPlugindService(c *meta.Config, d *plugind.Config) {
+	if !d.Enabled || len(d.Plugins) == 0 {
+		log.Warn("skip plugind service.")
+		return
+	}
+	srv := plugind.NewService(c, d)
+	s.Services = append(s.Services, srv)
+}
+
+func (s *Server) appendLibvirtdService(c *meta.Config, d *libvirtd.Config) {
+	if !d.Libvirt.Enabled {
+		log.Warn("skip libvirtd service.")
+		return
+	}
+	srv := libvirtd.NewService(c, d)
+	s.Services = append(s.Services, srv)
+}
+
+func (s *Server) appendKubernetesdService(c *meta.Config, d *kubernetesd.Config) {
+	if !d.Kubernetes.Enabled {
+		log.Warn("skip kubernetesd service.")
+		return
+	}
+	srv := kubernetesd.NewService(c, d)
+	s.Services = append(s.Services, srv)
+}
+
 //we are just making the DNS config global
 func (s *Server) selfieDNS(c *dns.Config) {
 	c.MkGlobal()
@@ -156,9 +201,18 @@ func (s *Server) Open() error {
 func (s *Server) Close() error {
 	stopProfile()
 
+	//the daemons drain their requests in flight at the same time, so the drain timeout holds for all.
+	var wg sync.WaitGroup
 	for _, service := range s.Services {
-		service.Close()
+		wg.Add(1)
+		go func(service Service) {
+			defer wg.Done()
+			if err := service.Close(); err != nil {
+				log.Errorf("close service: %s", err)
+			}
+		}(service)
 	}
+	wg.Wait()
 
 	if s.closing != nil {
 		close(s.closing)
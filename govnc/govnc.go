@@ -1,17 +1,19 @@
 package govnc
 
 import (
-	//"net"
-	//"time"
-	//"log"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
 	log "github.com/Sirupsen/logrus"
-	vnc "github.com/kward/go-vnc"
-	//"golang.org/x/net/context"
 )
 
-type VncListener struct {
-	B <-chan vnc.ServerMessage
-}
+var (
+	ErrIdle    = errors.New("vnc session idle for too long")
+	ErrExpired = errors.New("vnc session expired")
+)
 
 type VncHost struct {
 	IpAddress string
@@ -19,6 +21,97 @@ type VncHost struct {
 	Password  string
 }
 
-func Connect(vh *VncHost) {
-	log.Debugf("%v", vh)
+func (vh *VncHost) Addr() string {
+	return net.JoinHostPort(vh.IpAddress, vh.Port)
+}
+
+// Timeouts of a session, a zero one never fires.
+type Timeouts struct {
+	Dial    time.Duration
+	Idle    time.Duration //with no traffic either way
+	Session time.Duration
+}
+
+// Connect relays the RFB traffic between the client, the websocket of a noVNC
+// in the browser, and the vnc server of the vm till either side closes or a
+// timeout fires. The client does the RFB handshake and the auth itself.
+func Connect(vh *VncHost, client net.Conn, t Timeouts) error {
+	server, err := net.DialTimeout("tcp", vh.Addr(), t.Dial)
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+	log.Debugf("  vnc relay %s <-> %s", client.RemoteAddr(), vh.Addr())
+	var end time.Time
+	if t.Session > 0 {
+		end = time.Now().Add(t.Session)
+	}
+	lastRead := newActivity()
+	errs := make(chan error, 2)
+	go func() { errs <- relay(server, client, t.Idle, end, lastRead) }()
+	go func() { errs <- relay(client, server, t.Idle, end, lastRead) }()
+	err = <-errs
+	//unblocks the other way.
+	client.Close()
+	server.Close()
+	<-errs
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+//relay copies src to dst. A read times out after idle, unless the other way
+//had traffic meanwhile.
+func relay(dst, src net.Conn, idle time.Duration, end time.Time, last *activity) error {
+	buf := make([]byte, 32*1024)
+	for {
+		deadline := end
+		if idle > 0 {
+			if d := last.get().Add(idle); deadline.IsZero() || d.Before(deadline) {
+				deadline = d
+			}
+		}
+		src.SetReadDeadline(deadline)
+		n, err := src.Read(buf)
+		if n > 0 {
+			last.touch()
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			now := time.Now()
+			if !end.IsZero() && !now.Before(end) {
+				return ErrExpired
+			}
+			if idle > 0 && now.Sub(last.get()) >= idle {
+				return ErrIdle
+			}
+			continue //the other way was busy.
+		}
+		return err
+	}
+}
+
+//activity is when the session last had traffic, either way.
+type activity struct {
+	nanos int64
+}
+
+func newActivity() *activity {
+	a := &activity{}
+	a.touch()
+	return a
+}
+
+func (a *activity) touch() {
+	atomic.StoreInt64(&a.nanos, time.Now().UnixNano())
+}
+
+func (a *activity) get() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&a.nanos))
 }
@@ -0,0 +1,86 @@
+package govnc
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct {
+	l net.Listener
+}
+
+var _ = check.Suite(&S{})
+
+//the vnc server of the vm echoes what it gets.
+func (s *S) SetUpTest(c *check.C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	s.l = l
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	s.l.Close()
+}
+
+func (s *S) host() *VncHost {
+	host, port, _ := net.SplitHostPort(s.l.Addr().String())
+	return &VncHost{IpAddress: host, Port: port}
+}
+
+func (s *S) connect(t Timeouts) (net.Conn, chan error) {
+	browser, client := net.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- Connect(s.host(), client, t) }()
+	return browser, done
+}
+
+func (s *S) TestConnect(c *check.C) {
+	browser, done := s.connect(Timeouts{Dial: time.Second, Idle: time.Minute, Session: time.Hour})
+	_, err := browser.Write([]byte("RFB 003.008\n"))
+	c.Assert(err, check.IsNil)
+	got := make([]byte, 12)
+	_, err = io.ReadFull(browser, got)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(got), check.Equals, "RFB 003.008\n")
+	browser.Close()
+	c.Assert(<-done, check.IsNil)
+}
+
+func (s *S) TestConnectIdle(c *check.C) {
+	browser, done := s.connect(Timeouts{Idle: 50 * time.Millisecond})
+	defer browser.Close()
+	c.Assert(<-done, check.Equals, ErrIdle)
+}
+
+func (s *S) TestConnectExpired(c *check.C) {
+	browser, done := s.connect(Timeouts{Idle: time.Minute, Session: 50 * time.Millisecond})
+	defer browser.Close()
+	c.Assert(<-done, check.Equals, ErrExpired)
+}
+
+func (s *S) TestConnectWithoutServer(c *check.C) {
+	vh := s.host()
+	s.l.Close()
+	_, client := net.Pipe()
+	c.Assert(Connect(vh, client, Timeouts{Dial: time.Second}), check.NotNil)
+}
@@ -269,6 +269,10 @@ func (m *Marketplaces) saveImage() error {
 }
 
 func (m *Marketplaces) mkBox() (*provision.Box, error) {
+	comp, err := m.newCompute()
+	if err != nil {
+		return nil, err
+	}
 	box := &provision.Box{
 		CartonId:    m.Id,
 		AccountId:   m.AccountId,
@@ -277,7 +281,7 @@ func (m *Marketplaces) mkBox() (*provision.Box, error) {
 		Region:      m.Region(),
 		Provider:    m.provider(),
 		InstanceId:  m.instanceId(),
-		Compute:     m.newCompute(),
+		Compute:     comp,
 		StorageType: m.storageType(),
 	}
 	return box, nil
@@ -329,13 +333,12 @@ func (m *Marketplaces) GetVMHDDCost() string {
 	return ""
 }
 
-func (m *Marketplaces) newCompute() provision.BoxCompute {
-	return provision.BoxCompute{
-		Cpushare: m.getCpushare(),
-		Memory:   m.getMemory(),
-		Swap:     m.getSwap(),
-		HDD:      m.getHDD(),
+func (m *Marketplaces) newCompute() (provision.BoxCompute, error) {
+	c, err := provision.ParseCompute(m.getCpushare(), m.getMemory(), m.getSwap(), m.getHDD())
+	if err != nil {
+		return c, fmt.Errorf("marketplace %s: %s", m.Id, err)
 	}
+	return c, nil
 }
 
 func (m *Marketplaces) getCpushare() string {
@@ -350,10 +353,10 @@ func (m *Marketplaces) getSwap() string {
 	return ""
 }
 
-//The default HDD is 10. we should configure it in the vertice.conf
+//The default HDD is 10 GB. we should configure it in the vertice.conf
 func (m *Marketplaces) getHDD() string {
 	if len(strings.TrimSpace(m.Inputs.Match(provision.HDD))) <= 0 {
-		return "10"
+		return "10 GB"
 	}
 	return m.Inputs.Match(provision.HDD)
 }
@@ -6,11 +6,14 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/virtengine/libgo/api"
 	"github.com/virtengine/libgo/cmd"
+	"github.com/virtengine/vertice/toml"
 )
 
 const (
@@ -36,18 +39,27 @@ const (
 	//default user
 	DefaultUser = "megam"
 
+	// DefaultBoxParallelism is the number of boxes of a carton operated at once.
+	DefaultBoxParallelism = 4
+
+	// DefaultDrainTimeout is how long a daemon waits for the requests in flight when it shuts down.
+	DefaultDrainTimeout = 2 * time.Minute
+
 	MEGAM_HOME = "MEGAM_HOME"
 )
 
 // Config represents the meta configuration.
 type Config struct {
-	Home       string   `toml:"home"`
-	Dir        string   `toml:"dir"`
-	NSQd       []string `toml:"nsqd"`
-	Api        string   `toml:"api"`
-	MasterKey  string   `toml:"master_key"`
-	MasterUser string   `toml:"master_user"`
-	User       string   `toml:"user"`
+	Home           string        `toml:"home"`
+	Dir            string        `toml:"dir"`
+	NSQd           []string      `toml:"nsqd"`
+	Api            string        `toml:"api"`
+	MasterKey      string        `toml:"master_key"`
+	MasterUser     string        `toml:"master_user"`
+	User           string        `toml:"user"`
+	BoxParallelism int           `toml:"box_parallelism"`
+	DrainTimeout   toml.Duration `toml:"drain_timeout"`
+	ArchiveHosts   []string      `toml:"archive_hosts"`
 }
 
 var MC *Config
@@ -64,6 +76,9 @@ func (c Config) String() string {
 	b.Write([]byte("Master User        " + "\t" + c.MasterUser + "\n"))
 	b.Write([]byte("Master Key       " + "\t" + c.MasterUser + "\n"))
 	b.Write([]byte("NSQd      " + "\t" + strings.Join(c.NSQd, ",") + "\n"))
+	b.Write([]byte("Box Parallelism" + "\t" + strconv.Itoa(c.BoxParallelism) + "\n"))
+	b.Write([]byte("Drain Timeout" + "\t" + c.DrainTimeout.String() + "\n"))
+	b.Write([]byte("Archive Hosts" + "\t" + strings.Join(c.ArchiveHosts, ",") + "\n"))
 	b.Write([]byte("---\n"))
 	fmt.Fprintln(w)
 	w.Flush()
@@ -85,12 +100,14 @@ func NewConfig() *Config {
 
 	// Config represents the configuration format for the vertice.
 	return &Config{
-		Home:      homeDir,
-		Dir:       defaultDir,
-		User:      DefaultUser,
-		Api:       DefaultApi,
-		MasterKey: DefaultMasterKey,
-		NSQd:      []string{DefaultNSQd},
+		Home:           homeDir,
+		Dir:            defaultDir,
+		User:           DefaultUser,
+		Api:            DefaultApi,
+		MasterKey:      DefaultMasterKey,
+		NSQd:           []string{DefaultNSQd},
+		BoxParallelism: DefaultBoxParallelism,
+		DrainTimeout:   toml.Duration(DefaultDrainTimeout),
 	}
 }
 
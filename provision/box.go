@@ -164,24 +164,33 @@ func (b *Box) String() string {
 	}
 }
 
+//GetMemory is the memory of the box in MB.
 func (b *Box) GetMemory() uint64 {
-	return b.Compute.numMemory()
+	return b.Compute.Memory.MB()
 }
 
+//ConGetMemory is the memory of the box in bytes, as docker takes it.
 func (b *Box) ConGetMemory() uint64 {
-	return b.Compute.ConnumMemory()
+	return uint64(b.Compute.Memory)
 }
 
+//GetSwap is the swap of the box in MB.
 func (b *Box) GetSwap() uint64 {
-	return b.Compute.numSwap()
+	return b.Compute.Swap.MB()
+}
+
+//ConGetSwap is the swap of the box in bytes, as docker takes it.
+func (b *Box) ConGetSwap() uint64 {
+	return uint64(b.Compute.Swap)
 }
 
 func (b *Box) GetCpushare() uint64 {
-	return b.Compute.numCpushare()
+	return b.Compute.Cpushare
 }
 
+//GetHDD is the disk of the box in MB.
 func (b *Box) GetHDD() uint64 {
-	return b.Compute.numHDD()
+	return b.Compute.HDD.MB()
 }
 
 func (b *Box) IsPolicyOk() bool {
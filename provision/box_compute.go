@@ -16,91 +16,160 @@
 package provision
 
 import (
+	"errors"
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
+)
+
+// Bytes is a size in bytes, the units are powers of 1024.
+type Bytes uint64
 
-	"code.cloudfoundry.org/bytefmt"
+const (
+	KB Bytes = 1 << (10 * (iota + 1))
+	MB
+	GB
+	TB
 )
 
-type BoxCompute struct {
-	Cpushare string
-	Memory   string
-	Swap     string
-	HDD      string
+var units = map[string]Bytes{"B": 1, "K": KB, "M": MB, "G": GB, "T": TB}
+
+// MB is the size in whole megabytes, the unit the provisioners take.
+func (b Bytes) MB() uint64 {
+	return uint64(b / MB)
 }
 
-func (bc *BoxCompute) trimCore() string {
-	coreRegex := regexp.MustCompile("[Cc][Oo][Rr][Ee].*")
-	return strings.TrimSpace(coreRegex.ReplaceAllString(bc.Cpushare, ""))
+func (b Bytes) String() string {
+	for _, u := range []struct {
+		size Bytes
+		name string
+	}{{TB, "TB"}, {GB, "GB"}, {MB, "MB"}, {KB, "KB"}} {
+		if b >= u.size && b%u.size == 0 {
+			return strconv.FormatUint(uint64(b/u.size), 10) + " " + u.name
+		}
+	}
+	return strconv.FormatUint(uint64(b), 10) + " B"
+}
+
+// DiskClass is the kind of storage a disk is on, none means any.
+type DiskClass string
+
+const (
+	SSD  DiskClass = "SSD"
+	SATA DiskClass = "SATA"
+)
+
+var (
+	cpuRegex   = regexp.MustCompile(`^(?i)(\d+)\s*(cores?)?$`)
+	bytesRegex = regexp.MustCompile(`^(?i)(\d+(?:\.\d+)?)\s*([BKMGT])(?:i?B)?$`)
+	diskRegex  = regexp.MustCompile(`(?i)\b(ssd|sata)\b`)
+
+	errNoUnit = errors.New("needs a unit as in 4 GB")
+)
+
+// ComputeError is a cpu, ram, swap or hdd that doesn't parse or is out of range.
+type ComputeError struct {
+	Field string
+	Value string
+	Err   error
 }
 
-func (bc *BoxCompute) trimMemory() string {
-	coreRegex := regexp.MustCompile("[Bb].*")
-	s := strings.TrimSpace(coreRegex.ReplaceAllString(bc.Memory, ""))
-	c := strings.Replace(s, " ", "", -1)
-	return c[:len(c)-1]
+func (e *ComputeError) Error() string {
+	return fmt.Sprintf("invalid %s %q: %s", e.Field, e.Value, e.Err)
 }
 
-func (bc *BoxCompute) numCpushare() uint64 {
-	if cs, err := strconv.ParseUint(bc.trimCore(), 10, 64); err != nil {
-		return 0
-	} else {
-		return cs
-	}
+// BoxCompute is the size of a box, parsed and validated by ParseCompute.
+type BoxCompute struct {
+	Cpushare  uint64
+	Memory    Bytes
+	Swap      Bytes
+	HDD       Bytes
+	DiskClass DiskClass
 }
 
-func (bc *BoxCompute) ConnumMemory() uint64 {
-	if cp, err := bytefmt.ToMegabytes(strings.Replace(bc.Memory, " ", "", -1)); err != nil {
-		return 0
-	} else {
-		return cp * 1024 * 1024
+// ParseCompute reads the size of a box as the flavors and the inputs write it,
+// "2 Cores", "4 GB", "40 GB SSD". The cpu, ram and hdd are mandatory, the swap
+// can be empty.
+func ParseCompute(cpu, ram, swap, hdd string) (BoxCompute, error) {
+	var (
+		c   BoxCompute
+		err error
+	)
+	if c.Cpushare, err = ParseCpushare(cpu); err != nil {
+		return c, &ComputeError{Field: CPU, Value: cpu, Err: err}
+	}
+	if c.Memory, err = ParseBytes(ram); err != nil {
+		return c, &ComputeError{Field: RAM, Value: ram, Err: err}
+	}
+	if strings.TrimSpace(swap) != "" {
+		if c.Swap, err = ParseBytes(swap); err != nil {
+			return c, &ComputeError{Field: "swap", Value: swap, Err: err}
+		}
 	}
+	if c.HDD, c.DiskClass, err = ParseDisk(hdd); err != nil {
+		return c, &ComputeError{Field: HDD, Value: hdd, Err: err}
+	}
+	return c, c.Validate()
 }
 
-func (bc *BoxCompute) numMemory() uint64 {
-	if cp, err := bytefmt.ToMegabytes(strings.Replace(bc.Memory, " ", "", -1)); err != nil {
-		return 0
-	} else {
-		return cp
+// Validate refuses a box with no cpu, memory or disk.
+func (bc BoxCompute) Validate() error {
+	switch {
+	case bc.Cpushare == 0:
+		return &ComputeError{Field: CPU, Value: "0", Err: errors.New("needs at least one core")}
+	case bc.Memory.MB() == 0:
+		return &ComputeError{Field: RAM, Value: bc.Memory.String(), Err: errors.New("needs at least 1 MB")}
+	case bc.HDD.MB() == 0:
+		return &ComputeError{Field: HDD, Value: bc.HDD.String(), Err: errors.New("needs at least 1 MB")}
 	}
+	return nil
 }
 
-func (bc *BoxCompute) numSwap() uint64 {
-	if cs, err := bytefmt.ToMegabytes(bc.Swap); err != nil {
-		return 0
-	} else {
-		return cs
+// ParseCpushare reads a number of cores, "2" or "2 Cores".
+func ParseCpushare(s string) (uint64, error) {
+	m := cpuRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, errors.New("expected a whole number of cores")
 	}
+	return strconv.ParseUint(m[1], 10, 64)
 }
 
-func (bc *BoxCompute) trimHDD() string {
-	sataRegex := regexp.MustCompile("[Ss][aA][Tt][aA].*")
-	ssdRegex := regexp.MustCompile("[Ss][sS][dD].*")
-
-	var hddTrim = ""
-	if len(sataRegex.FindStringSubmatch(bc.HDD)) > 0 {
-		hddTrim = strings.TrimSpace(sataRegex.ReplaceAllString(bc.HDD, ""))
+// ParseBytes reads a size with its unit, "512 MB", "4GB" or "1.5 GiB".
+func ParseBytes(s string) (Bytes, error) {
+	s = strings.TrimSpace(s)
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return 0, errNoUnit
 	}
-
-	if len(ssdRegex.FindStringSubmatch(bc.HDD)) > 0 {
-		hddTrim = strings.TrimSpace(ssdRegex.ReplaceAllString(bc.HDD, ""))
+	m := bytesRegex.FindStringSubmatch(s)
+	if m == nil {
+		return 0, errors.New("expected a size as in 4 GB")
 	}
-	return strings.Replace(hddTrim, " ", "", -1)
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	return Bytes(n * float64(units[strings.ToUpper(m[2])])), nil
 }
 
-func (bc *BoxCompute) numHDD() uint64 {
-	if cp, err := bytefmt.ToMegabytes(strings.Replace(bc.HDD, " ", "", -1)); err != nil {
-		return 10240
-	} else {
-		return cp
+// ParseDisk reads a disk size with its class anywhere, "40 GB SSD" or "SATA 1 TB".
+func ParseDisk(s string) (Bytes, DiskClass, error) {
+	var class DiskClass
+	if m := diskRegex.FindString(s); m != "" {
+		class = DiskClass(strings.ToUpper(m))
 	}
+	size, err := ParseBytes(diskRegex.ReplaceAllString(s, ""))
+	return size, class, err
 }
 
-func (bc *BoxCompute) String() string {
+func (bc BoxCompute) String() string {
+	hdd := bc.HDD.String()
+	if bc.DiskClass != "" {
+		hdd += " " + string(bc.DiskClass)
+	}
 	return "(" + strings.Join([]string{
-		CPU + ":" + strconv.FormatInt(int64(bc.numCpushare()), 10),
-		RAM + ":" + strconv.FormatInt(int64(bc.numMemory()), 10),
-		HDD + ":" + strconv.FormatInt(int64(bc.numHDD()), 10)},
-		",") + " )"
+		CPU + ":" + strconv.FormatUint(bc.Cpushare, 10),
+		RAM + ":" + bc.Memory.String(),
+		HDD + ":" + hdd},
+		", ") + ")"
 }
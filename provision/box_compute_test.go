@@ -0,0 +1,49 @@
+package provision
+
+import (
+	"testing"
+
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type ComputeSuite struct{}
+
+var _ = check.Suite(ComputeSuite{})
+
+func (ComputeSuite) TestParseCompute(c *check.C) {
+	bc, err := ParseCompute("2 Cores", "4 GB", "", "40GB ssd")
+	c.Assert(err, check.IsNil)
+	c.Assert(bc, check.DeepEquals, BoxCompute{Cpushare: 2, Memory: 4 * GB, HDD: 40 * GB, DiskClass: SSD})
+	c.Assert(bc.String(), check.Equals, "(cpu:2, ram:4 GB, hdd:40 GB SSD)")
+
+	box := Box{Compute: bc}
+	c.Assert(box.GetMemory(), check.Equals, uint64(4096))
+	c.Assert(box.GetHDD(), check.Equals, uint64(40960))
+	c.Assert(box.ConGetMemory(), check.Equals, uint64(4*1024*1024*1024))
+
+	bc, err = ParseCompute("1", "1.5 GiB", "512MB", "SATA 1 TB")
+	c.Assert(err, check.IsNil)
+	c.Assert(bc.Memory, check.Equals, 1536*MB)
+	c.Assert(bc.Swap, check.Equals, 512*MB)
+	c.Assert(bc.DiskClass, check.Equals, SATA)
+}
+
+func (ComputeSuite) TestParseComputeErrors(c *check.C) {
+	for _, t := range []struct{ cpu, ram, hdd, field string }{
+		{"", "4 GB", "40 GB", CPU},
+		{"0.2", "4 GB", "40 GB", CPU},
+		{"0", "4 GB", "40 GB", CPU},
+		{"2", "512", "40 GB", RAM},
+		{"2", "G", "40 GB", RAM},
+		{"2", "4 GB", "", HDD},
+		{"2", "4 GB", "0 GB", HDD},
+	} {
+		_, err := ParseCompute(t.cpu, t.ram, "", t.hdd)
+		c.Assert(err, check.FitsTypeOf, &ComputeError{}, check.Commentf("%+v", t))
+		c.Assert(err.(*ComputeError).Field, check.Equals, t.field, check.Commentf("%+v", t))
+	}
+}
@@ -0,0 +1,116 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package provision
+
+import "sort"
+
+// Capability is an operation a provisioner runs on the boxes.
+type Capability string
+
+const (
+	CapDeploy   Capability = "deploy"
+	CapUpgrade  Capability = "upgrade"
+	CapDestroy  Capability = "destroy"
+	CapStart    Capability = "start"
+	CapStop     Capability = "stop"
+	CapRestart  Capability = "restart"
+	CapSuspend  Capability = "suspend"
+	CapSnapshot Capability = "snapshot"
+	CapBackup   Capability = "backup"
+	CapArchive  Capability = "archive"
+	CapDisk     Capability = "disk"
+	CapNetwork  Capability = "network"
+	CapMigrate  Capability = "migrate"
+	CapResize   Capability = "resize"
+	CapShell    Capability = "shell"
+)
+
+// Capable is a provisioner that tells the operations it runs, the others are
+// refused before they reach it instead of being a silent no-op.
+type Capable interface {
+	Capabilities() []Capability
+}
+
+//the operations of the base interface, a provisioner that isn't Capable is
+//trusted with all of them.
+var baseCapabilities = []Capability{
+	CapDestroy, CapStart, CapStop, CapRestart, CapSuspend,
+	CapSnapshot, CapBackup, CapDisk, CapShell,
+}
+
+//implements tells if p has the optional interface a capability needs.
+func implements(p Provisioner, c Capability) bool {
+	var ok bool
+	switch c {
+	case CapDeploy:
+		_, ok = p.(ImageDeployer)
+		if !ok {
+			_, ok = p.(GitDeployer)
+		}
+	case CapUpgrade:
+		_, ok = p.(GitDeployer)
+	case CapArchive:
+		_, ok = p.(ImageArchiver)
+	case CapNetwork:
+		_, ok = p.(Network)
+	case CapMigrate:
+		_, ok = p.(Migrator)
+	case CapResize:
+		_, ok = p.(Resizer)
+	default:
+		ok = true
+	}
+	return ok
+}
+
+// Capabilities lists the operations p runs, sorted. The ones of an optional
+// interface are only listed when p implements it.
+func Capabilities(p Provisioner) []Capability {
+	declared := baseCapabilities
+	if cp, ok := p.(Capable); ok {
+		declared = cp.Capabilities()
+	} else {
+		declared = append(append([]Capability{}, declared...),
+			CapDeploy, CapUpgrade, CapArchive, CapNetwork, CapMigrate, CapResize)
+	}
+	caps := make([]Capability, 0, len(declared))
+	for _, c := range declared {
+		if implements(p, c) {
+			caps = append(caps, c)
+		}
+	}
+	sort.Slice(caps, func(i, j int) bool { return caps[i] < caps[j] })
+	return caps
+}
+
+// Supports tells if p runs the operation c.
+func Supports(p Provisioner, c Capability) bool {
+	for _, pc := range Capabilities(p) {
+		if pc == c {
+			return true
+		}
+	}
+	return false
+}
+
+// CapabilityMatrix returns the capabilities of the registered provisioners by name.
+func CapabilityMatrix() map[string][]Capability {
+	matrix := make(map[string][]Capability, len(provisioners))
+	for name, p := range provisioners {
+		matrix[name] = Capabilities(p)
+	}
+	return matrix
+}
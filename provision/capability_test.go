@@ -0,0 +1,53 @@
+package provision
+
+import (
+	"io"
+
+	"gopkg.in/check.v1"
+)
+
+type CapabilitySuite struct{}
+
+var _ = check.Suite(CapabilitySuite{})
+
+//a provisioner with only the base interface.
+type baseProvisioner struct {
+	Provisioner
+}
+
+//a provisioner that declares a resize it can't run.
+type capableProvisioner struct {
+	Provisioner
+}
+
+func (capableProvisioner) Capabilities() []Capability {
+	return []Capability{CapStop, CapStart, CapResize}
+}
+
+type resizingProvisioner struct {
+	capableProvisioner
+}
+
+func (resizingProvisioner) Resize(b *Box, to BoxCompute, w io.Writer) error {
+	return nil
+}
+
+func (CapabilitySuite) TestCapabilitiesOfBase(c *check.C) {
+	caps := Capabilities(baseProvisioner{})
+	c.Assert(caps, check.HasLen, len(baseCapabilities))
+	c.Assert(Supports(baseProvisioner{}, CapSnapshot), check.Equals, true)
+	c.Assert(Supports(baseProvisioner{}, CapDeploy), check.Equals, false)
+	c.Assert(Supports(baseProvisioner{}, CapMigrate), check.Equals, false)
+}
+
+func (CapabilitySuite) TestCapabilitiesDeclared(c *check.C) {
+	c.Assert(Capabilities(capableProvisioner{}), check.DeepEquals, []Capability{CapStart, CapStop})
+	c.Assert(Supports(capableProvisioner{}, CapSnapshot), check.Equals, false)
+	c.Assert(Supports(resizingProvisioner{}, CapResize), check.Equals, true)
+}
+
+func (CapabilitySuite) TestCapabilityMatrix(c *check.C) {
+	Register("capable-test", capableProvisioner{})
+	defer Unregister("capable-test")
+	c.Assert(CapabilityMatrix()["capable-test"], check.DeepEquals, []Capability{CapStart, CapStop})
+}
@@ -88,7 +88,7 @@ func (c *Container) Create(args *CreateArgs) error {
 		AttachStdout: false,
 		AttachStderr: false,
 		Memory:       int64(args.Box.ConGetMemory()),
-		MemorySwap:   int64(args.Box.ConGetMemory() + args.Box.GetSwap()),
+		MemorySwap:   int64(args.Box.ConGetMemory() + args.Box.ConGetSwap()),
 		CPUShares:    int64(args.Box.GetCpushare()),
 		Labels: map[string]string{utils.ASSEMBLY_ID: args.Box.CartonId, utils.ASSEMBLY_NAME: c.BoxName,
 			utils.ASSEMBLIES_ID: args.Box.CartonsId, utils.ACCOUNT_ID: args.Box.AccountId, utils.QUOTA_ID: args.Box.QuotaId},
@@ -244,7 +244,7 @@ func (c *Container) Start(args *StartArgs) error {
 
 	hostConfig := docker.HostConfig{
 		Memory:     int64(args.Box.ConGetMemory()),
-		MemorySwap: int64(args.Box.ConGetMemory() + args.Box.GetSwap()),
+		MemorySwap: int64(args.Box.ConGetMemory() + args.Box.ConGetSwap()),
 		CPUShares:  int64(args.Box.GetCpushare()),
 	}
 
@@ -275,6 +275,20 @@ func (c *Container) Stop(p DockerProvisioner) error {
 	return nil
 }
 
+//Resize sets the memory and cpu limits of the running container to the box.
+func (c *Container) Resize(p DockerProvisioner, b *provision.Box) error {
+	err := p.Cluster().UpdateContainer(c.Id, docker.UpdateContainerOptions{
+		Memory:     int(b.ConGetMemory()),
+		MemorySwap: int(b.ConGetMemory() + b.ConGetSwap()),
+		CPUShares:  int(b.GetCpushare()),
+	})
+	if err != nil {
+		log.Errorf("error on resize container %s: %s", c.Id, err)
+		return err
+	}
+	return nil
+}
+
 type waitResult struct {
 	status int
 	err    error
@@ -344,10 +358,15 @@ type Pty struct {
 	Width  int
 	Height int
 	Term   string
+	Resize <-chan provision.TermSize
 }
 
 func (c *Container) Shell(p DockerProvisioner, stdin io.Reader, stdout, stderr io.Writer, pty Pty) error {
-	cmds := []string{"/usr/bin/env", "/bin/sh", "-c", "TERM=xterm-256color; export TERM; [ -x /bin/bash ] && ([ -x /usr/bin/script ] && /usr/bin/script -q -c '/bin/bash' /dev/null || exec /bin/bash) || exec /bin/sh"}
+	term := pty.Term
+	if term == "" {
+		term = "xterm-256color"
+	}
+	cmds := []string{"/usr/bin/env", "TERM=" + term, "/bin/sh", "-c", "[ -x /bin/bash ] && ([ -x /usr/bin/script ] && /usr/bin/script -q -c '/bin/bash' /dev/null || exec /bin/bash) || exec /bin/sh"}
 	execCreateOpts := docker.CreateExecOptions{
 		AttachStdin:  true,
 		AttachStdout: true,
@@ -388,7 +407,21 @@ func (c *Container) Shell(p DockerProvisioner, stdin io.Reader, stdout, stderr i
 		return err
 	}
 	p.Cluster().ResizeExecTTY(exec.ID, c.Id, pty.Height, pty.Width, c.Region)
-	return <-errs
+	resize := pty.Resize
+	for {
+		select {
+		case err = <-errs:
+			return err
+		case size, ok := <-resize:
+			if !ok {
+				resize = nil //the client is gone, wait for the exec to end.
+				continue
+			}
+			if err = p.Cluster().ResizeExecTTY(exec.ID, c.Id, size.Height, size.Width, c.Region); err != nil {
+				log.Debugf("resize shell of container %s: %s", c.Id, err)
+			}
+		}
+	}
 }
 
 type execErr struct {
@@ -0,0 +1,49 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/virtengine/libgo/action"
+	"github.com/virtengine/vertice/provision/docker/container"
+	"github.com/virtengine/vertice/provision/journal"
+)
+
+//the journaled pipelines, and what they need to be built again.
+const (
+	deployOp = "deploy"
+	argImage = "image"
+)
+
+//the steps of the container pipelines hand a container to each other.
+func decodeContainer(raw json.RawMessage) (action.Result, error) {
+	var c container.Container
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Resume carries on with a deploy cut by a restart.
+func (p *dockerProvisioner) Resume(j *journal.Journal, w io.Writer) error {
+	switch j.Op {
+	case deployOp:
+		_, err := p.runDeploy(j, w)
+		return err
+	default:
+		return fmt.Errorf("can't resume %s of box %s", j.Op, j.Box.GetFullName())
+	}
+}
+
+// Rewind rolls back what a deploy cut by a restart has done.
+func (p *dockerProvisioner) Rewind(j *journal.Journal, w io.Writer) error {
+	defer j.Close()
+	switch j.Op {
+	case deployOp:
+		j.Rewind(p.deployActions(), decodeContainer, p.deployArgs(j, w))
+		return nil
+	default:
+		return fmt.Errorf("can't rewind %s of box %s", j.Op, j.Box.GetFullName())
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/virtengine/vertice/provision"
 	"github.com/virtengine/vertice/provision/docker/cluster"
 	"github.com/virtengine/vertice/provision/docker/container"
+	"github.com/virtengine/vertice/provision/journal"
 	"github.com/virtengine/vertice/repository"
 	"github.com/virtengine/vertice/router"
 	_ "github.com/virtengine/vertice/router/route53"
@@ -66,6 +67,14 @@ func (p *dockerProvisioner) String() string {
 	return "ready"
 }
 
+//the containers have no snapshots, backups, disks or suspend, and restart is a no-op.
+func (p *dockerProvisioner) Capabilities() []provision.Capability {
+	return []provision.Capability{
+		provision.CapDeploy, provision.CapUpgrade, provision.CapDestroy,
+		provision.CapStart, provision.CapStop, provision.CapResize, provision.CapShell,
+	}
+}
+
 func (p *dockerProvisioner) Initialize(m interface{}) error {
 	return p.initDockerCluster(m)
 }
@@ -158,8 +167,12 @@ func (p *dockerProvisioner) ImageDeploy(box *provision.Box, imageId string, w io
 }
 
 func (p *dockerProvisioner) deployPipeline(box *provision.Box, imageId string, w io.Writer) (string, error) {
-	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- deploy box (%s, image:%s)", box.GetFullName(), imageId)))
-	actions := []*action.Action{
+	j := journal.New(journal.DefaultStore(), deployOp, box, map[string]string{argImage: imageId})
+	return p.runDeploy(j, w)
+}
+
+func (p *dockerProvisioner) deployActions() []*action.Action {
+	return []*action.Action{
 		&updateStatusInScylla,
 		&createContainer,
 		&updateContainerIdInScylla,
@@ -174,20 +187,30 @@ func (p *dockerProvisioner) deployPipeline(box *provision.Box, imageId string, w
 		&MileStoneUpdate,
 		&updateStatusInScylla,
 	}
-	p.Cluster().Region = box.Region
-	pipeline := action.NewPipeline(actions...)
+}
 
-	args := runContainerActionsArgs{
-		box:             box,
-		imageId:         imageId,
+func (p *dockerProvisioner) deployArgs(j *journal.Journal, w io.Writer) runContainerActionsArgs {
+	return runContainerActionsArgs{
+		box:             j.Box,
+		imageId:         j.Args[argImage],
 		writer:          w,
 		isDeploy:        true,
-		buildingImage:   imageId,
+		buildingImage:   j.Args[argImage],
 		containerState:  constants.StateInitializing,
 		containerStatus: constants.StatusContainerLaunching,
 		provisioner:     p,
 	}
-	err := pipeline.Execute(args)
+}
+
+//runs the deploy pipeline of the journal, the steps done by an earlier run are skipped.
+func (p *dockerProvisioner) runDeploy(j *journal.Journal, w io.Writer) (string, error) {
+	box, imageId := j.Box, j.Args[argImage]
+	defer j.Close()
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- deploy box (%s, image:%s)", box.GetFullName(), imageId)))
+	p.Cluster().Region = box.Region
+	pipeline := action.NewPipeline(j.Wrap(p.deployActions(), decodeContainer)...)
+
+	err := pipeline.Execute(p.deployArgs(j, w))
 	if err != nil {
 
 		fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.ERROR, fmt.Sprintf("deploy pipeline for box (%s) --> %s", box.GetFullName(), err)))
@@ -386,6 +409,22 @@ func (p *dockerProvisioner) RestoreSnapshot(b *provision.Box, io io.Writer) erro
 	return nil
 }
 
+//Resize updates the limits of the containers of the box, they keep running.
+func (p *dockerProvisioner) Resize(box *provision.Box, to provision.BoxCompute, w io.Writer) error {
+	containers, err := p.listContainersByBox(box)
+	if err != nil {
+		fmt.Fprintf(w, lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("Failed to list box containers (%s) --> %s", box.GetFullName(), err)))
+		return err
+	}
+	nb := *box
+	nb.Compute = to
+	p.Cluster().Region = box.Region
+	fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("--- resize box (%s, %s -> %s)", box.GetFullName(), box.Compute.String(), to.String())))
+	return runInContainers(containers, func(c *container.Container, _ chan *container.Container) error {
+		return c.Resize(p, &nb)
+	}, nil, true)
+}
+
 func (p *dockerProvisioner) Shell(opts provision.ShellOptions) error {
 	var (
 		c   *container.Container
@@ -396,7 +435,7 @@ func (p *dockerProvisioner) Shell(opts provision.ShellOptions) error {
 	if err != nil {
 		return err
 	}
-	return c.Shell(p, opts.Conn, opts.Conn, opts.Conn, container.Pty{Width: opts.Width, Height: opts.Height, Term: opts.Term})
+	return c.Shell(p, opts.Conn, opts.Conn, opts.Conn, container.Pty{Width: opts.Width, Height: opts.Height, Term: opts.Term, Resize: opts.Resize})
 }
 
 func (p *dockerProvisioner) ExecuteCommandOnce(stdout, stderr io.Writer, box *provision.Box, cmd string, args ...string) error {
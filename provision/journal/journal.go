@@ -0,0 +1,194 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+
+// Package journal keeps the progress of the provisioner pipelines on disk, so
+// that a pipeline cut by a restart can be resumed or rolled back.
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/libgo/action"
+	"github.com/virtengine/vertice/provision"
+)
+
+const (
+	RUNNING     = "running"
+	ROLLINGBACK = "rollingback"
+)
+
+var ErrInterrupted = errors.New("pipeline interrupted by a restart of vertice")
+
+// Step is an action of the journaled pipeline.
+type Step struct {
+	Name   string          `json:"name"`
+	Done   bool            `json:"done"`
+	Undone bool            `json:"undone"`
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// Journal is the progress of a pipeline run on a box.
+type Journal struct {
+	Id        string            `json:"id"`
+	Op        string            `json:"op"`
+	Provider  string            `json:"provider"`
+	Box       *provision.Box    `json:"box"`
+	Args      map[string]string `json:"args"`
+	Steps     []Step            `json:"steps"`
+	Status    string            `json:"status"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	store     Store
+}
+
+// Decoder turns a saved step result back into what the next action expects.
+type Decoder func(raw json.RawMessage) (action.Result, error)
+
+// New starts the journal of an operation on the box, args are what the
+// provisioner needs to build the pipeline again.
+func New(store Store, op string, box *provision.Box, args map[string]string) *Journal {
+	now := time.Now()
+	return &Journal{
+		Id:        box.Id + "-" + op,
+		Op:        op,
+		Provider:  box.Provider,
+		Box:       box,
+		Args:      args,
+		Status:    RUNNING,
+		CreatedAt: now,
+		UpdatedAt: now,
+		store:     store,
+	}
+}
+
+// Wrap journals the completion of every action. The actions already done by an
+// earlier run aren't run again, their saved result is handed to the next action.
+func (j *Journal) Wrap(actions []*action.Action, decode Decoder) []*action.Action {
+	if len(j.Steps) != len(actions) { //a fresh journal, or a pipeline that changed since.
+		j.Steps = make([]Step, len(actions))
+		for i, a := range actions {
+			j.Steps[i] = Step{Name: a.Name}
+		}
+	}
+	j.save()
+	wrapped := make([]*action.Action, len(actions))
+	for i, a := range actions {
+		wrapped[i] = j.wrap(i, a, decode)
+	}
+	return wrapped
+}
+
+func (j *Journal) wrap(i int, a *action.Action, decode Decoder) *action.Action {
+	return &action.Action{
+		Name: a.Name,
+		Forward: func(ctx action.FWContext) (action.Result, error) {
+			if s := j.Steps[i]; s.Done && decode != nil {
+				if r, err := decode(s.Result); err == nil {
+					log.Debugf("  journal %s skip step %d %s", j.Id, i, s.Name)
+					return r, nil
+				}
+			}
+			r, err := a.Forward(ctx)
+			if err == nil {
+				j.done(i, r)
+			}
+			return r, err
+		},
+		Backward: func(ctx action.BWContext) {
+			j.rollingBack()
+			if a.Backward != nil {
+				a.Backward(ctx)
+			}
+			j.undone(i)
+		},
+		OnError:   a.OnError,
+		MinParams: a.MinParams,
+	}
+}
+
+// Rewind runs the backward of the steps done, last one first. It is used when a
+// pipeline is given up after a restart.
+func (j *Journal) Rewind(actions []*action.Action, decode Decoder, params ...interface{}) {
+	j.rollingBack()
+	for i := len(j.Steps) - 1; i >= 0; i-- {
+		s := j.Steps[i]
+		if !s.Done || s.Undone || i >= len(actions) {
+			continue
+		}
+		r, err := decode(s.Result)
+		if err != nil {
+			log.Errorf("  journal %s can't rewind step %d %s: %s", j.Id, i, s.Name, err)
+			continue
+		}
+		if actions[i].Backward != nil {
+			actions[i].Backward(action.BWContext{CauseOf: ErrInterrupted, FWResult: r, Params: params})
+		}
+		j.undone(i)
+	}
+}
+
+// Close ends the journal. The pipeline finished, either way.
+func (j *Journal) Close() {
+	if j.store == nil {
+		return
+	}
+	if err := j.store.Remove(j.Id); err != nil {
+		log.Errorf("  journal %s not removed: %s", j.Id, err)
+	}
+}
+
+func (j *Journal) done(i int, r action.Result) {
+	j.Steps[i].Done = true
+	if b, err := json.Marshal(r); err == nil {
+		j.Steps[i].Result = b
+	}
+	j.save()
+}
+
+func (j *Journal) undone(i int) {
+	j.Steps[i].Undone = true
+	j.save()
+}
+
+func (j *Journal) rollingBack() {
+	if j.Status != ROLLINGBACK {
+		j.Status = ROLLINGBACK
+		j.save()
+	}
+}
+
+func (j *Journal) save() {
+	if j.store == nil {
+		return
+	}
+	j.UpdatedAt = time.Now()
+	if err := j.store.Save(j); err != nil {
+		log.Errorf("  journal %s not saved: %s", j.Id, err)
+	}
+}
+
+// Resumer is a provisioner journaling its pipelines.
+type Resumer interface {
+	// Resume runs the pipeline of the journal again, the steps done are skipped.
+	Resume(j *Journal, w io.Writer) error
+
+	// Rewind rolls back the steps done.
+	Rewind(j *Journal, w io.Writer) error
+}
@@ -0,0 +1,127 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/virtengine/libgo/action"
+	"github.com/virtengine/vertice/provision"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct {
+	store *FileStore
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpTest(c *check.C) {
+	s.store = NewFileStore(c.MkDir())
+}
+
+//a step appending its name to the result of the previous one.
+func step(name string, ran *[]string, fail bool) *action.Action {
+	return &action.Action{
+		Name: name,
+		Forward: func(ctx action.FWContext) (action.Result, error) {
+			*ran = append(*ran, name)
+			if fail {
+				return nil, errors.New(name + " failed")
+			}
+			prev, _ := ctx.Previous.(string)
+			return prev + name, nil
+		},
+		Backward: func(ctx action.BWContext) {
+			*ran = append(*ran, "-"+name)
+		},
+	}
+}
+
+func decodeString(raw json.RawMessage) (action.Result, error) {
+	var r string
+	err := json.Unmarshal(raw, &r)
+	return r, err
+}
+
+func (s *S) newJournal() *Journal {
+	return New(s.store, "deploy", &provision.Box{Id: "BOX1", Provider: "one"}, map[string]string{"image": "megam"})
+}
+
+func (s *S) TestWrapJournalsSteps(c *check.C) {
+	var ran []string
+	j := s.newJournal()
+	actions := j.Wrap([]*action.Action{step("a", &ran, false), step("b", &ran, false)}, decodeString)
+	c.Assert(action.NewPipeline(actions...).Execute("args"), check.IsNil)
+
+	left, err := s.store.Unfinished()
+	c.Assert(err, check.IsNil)
+	c.Assert(left, check.HasLen, 1)
+	c.Assert(left[0].Id, check.Equals, "BOX1-deploy")
+	c.Assert(left[0].Steps[1].Done, check.Equals, true)
+	c.Assert(string(left[0].Steps[1].Result), check.Equals, `"ab"`)
+
+	j.Close()
+	left, err = s.store.Unfinished()
+	c.Assert(err, check.IsNil)
+	c.Assert(left, check.HasLen, 0)
+}
+
+func (s *S) TestResumeSkipsDoneSteps(c *check.C) {
+	var ran []string
+	j := s.newJournal()
+	j.Wrap([]*action.Action{step("a", &ran, false), step("b", &ran, false), step("c", &ran, false)}, decodeString)
+	j.done(0, "a")
+	j.done(1, "ab")
+
+	left, _ := s.store.Unfinished()
+	c.Assert(left, check.HasLen, 1)
+	resumed := left[0]
+	actions := resumed.Wrap([]*action.Action{step("a", &ran, false), step("b", &ran, false), step("c", &ran, false)}, decodeString)
+	pipeline := action.NewPipeline(actions...)
+	c.Assert(pipeline.Execute("args"), check.IsNil)
+	c.Assert(ran, check.DeepEquals, []string{"c"})
+	c.Assert(pipeline.Result(), check.Equals, "abc")
+}
+
+func (s *S) TestFailureRollsBackAndMarksTheJournal(c *check.C) {
+	var ran []string
+	j := s.newJournal()
+	actions := j.Wrap([]*action.Action{step("a", &ran, false), step("b", &ran, true)}, decodeString)
+	c.Assert(action.NewPipeline(actions...).Execute("args"), check.NotNil)
+	c.Assert(ran, check.DeepEquals, []string{"a", "b", "-a"})
+	c.Assert(j.Status, check.Equals, ROLLINGBACK)
+	c.Assert(j.Steps[0].Undone, check.Equals, true)
+}
+
+func (s *S) TestRewind(c *check.C) {
+	var ran []string
+	actions := []*action.Action{step("a", &ran, false), step("b", &ran, false), step("c", &ran, false)}
+	j := s.newJournal()
+	j.Wrap(actions, decodeString)
+	j.done(0, "a")
+	j.done(1, "ab")
+	j.Steps[1].Undone = true //rolled back before the restart.
+	j.Rewind(actions, decodeString, "args")
+	c.Assert(ran, check.DeepEquals, []string{"-a"})
+	c.Assert(j.Status, check.Equals, ROLLINGBACK)
+}
@@ -0,0 +1,120 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package journal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/vertice/meta"
+)
+
+const ext = ".json"
+
+// Store keeps the journals of the pipelines that haven't finished.
+type Store interface {
+	Save(j *Journal) error
+	Remove(id string) error
+	// Unfinished returns the journals left behind by an earlier run.
+	Unfinished() ([]*Journal, error)
+}
+
+// FileStore keeps a journal per file in a directory.
+type FileStore struct {
+	Dir string
+}
+
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{Dir: dir}
+}
+
+func (f *FileStore) path(id string) string {
+	return filepath.Join(f.Dir, id+ext)
+}
+
+// Save writes the journal aside and renames it over the old one, a crash
+// can't leave a half written journal behind.
+func (f *FileStore) Save(j *Journal) error {
+	if err := os.MkdirAll(f.Dir, 0700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	tmp := f.path(j.Id) + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path(j.Id))
+}
+
+func (f *FileStore) Remove(id string) error {
+	if err := os.Remove(f.path(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (f *FileStore) Unfinished() ([]*Journal, error) {
+	files, err := ioutil.ReadDir(f.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	journals := make([]*Journal, 0, len(files))
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ext) {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(f.Dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		j := &Journal{}
+		if err = json.Unmarshal(b, j); err != nil {
+			log.Errorf("  journal %s unreadable, skipped: %s", fi.Name(), err)
+			continue
+		}
+		j.store = f
+		journals = append(journals, j)
+	}
+	return journals, nil
+}
+
+var (
+	defaultStore Store
+	defaultOnce  sync.Once
+)
+
+// DefaultStore keeps the journals under the vertice dir.
+func DefaultStore() Store {
+	defaultOnce.Do(func() {
+		dir := os.TempDir()
+		if meta.MC != nil && meta.MC.Dir != "" {
+			dir = meta.MC.Dir
+		}
+		defaultStore = NewFileStore(filepath.Join(dir, "journal"))
+	})
+	return defaultStore
+}
@@ -0,0 +1,346 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package kubernetes
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/libgo/action"
+	"github.com/virtengine/libgo/events/alerts"
+	"github.com/virtengine/libgo/utils"
+	constants "github.com/virtengine/libgo/utils"
+	lw "github.com/virtengine/libgo/writer"
+	"github.com/virtengine/vertice/carton"
+	lb "github.com/virtengine/vertice/logbox"
+	"github.com/virtengine/vertice/provision"
+	"github.com/virtengine/vertice/provision/kubernetes/cluster"
+)
+
+var (
+	statusResizing = constants.Status("resizing")
+	statusResized  = constants.Status("resized")
+)
+
+type runAppActionsArgs struct {
+	box       *provision.Box
+	writer    io.Writer
+	imageId   string
+	isDeploy  bool
+	appStatus utils.Status
+	appState  utils.State
+	compute   provision.BoxCompute
+	cluster   *cluster.Cluster
+}
+
+func (a runAppActionsArgs) w() io.Writer {
+	if a.writer == nil {
+		return ioutil.Discard
+	}
+	return a.writer
+}
+
+var appCreating = action.Action{
+	Name: "app-struct-creating",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(runAppActionsArgs)
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" creating struct app (%s, %s)", args.box.GetFullName(), args.appStatus.String())))
+		app := App{
+			Name:      objectName(args.box.Id),
+			BoxName:   args.box.GetFullName(),
+			Id:        args.box.Id,
+			CartonId:  args.box.CartonId,
+			CartonsId: args.box.CartonsId,
+			AccountId: args.box.AccountId,
+			Level:     args.box.Level,
+			Image:     args.imageId,
+			Compute:   args.box.Compute,
+			Envs:      args.box.Envs,
+			Status:    args.appStatus,
+			State:     args.appState,
+		}
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" creating struct app (%s, %s)OK", args.box.GetFullName(), args.appStatus.String())))
+		return app, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+}
+
+var updateStatusInScylla = action.Action{
+	Name: "update-status-scylla",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(runAppActionsArgs)
+		app := ctx.Previous.(App)
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" update status for app (%s, %s)", args.box.GetFullName(), app.Status.String())))
+		if err := app.SetStatus(app.Status); err != nil {
+			fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.ERROR, fmt.Sprintf(" fails to update status for app (%s, %s) %v", args.box.GetFullName(), app.Status.String(), err)))
+		} else {
+			fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" update status for app (%s, %s)OK", args.box.GetFullName(), app.Status.String())))
+		}
+		return app, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		c := ctx.FWResult.(App)
+		args := ctx.Params[0].(runAppActionsArgs)
+		status := constants.StatusContainerError
+		if args.isDeploy {
+			_ = carton.DoneNotify(args.box, args.w(), alerts.FAILURE, ctx.CauseOf.Error())
+		}
+		c.SetStatusErr(status, ctx.CauseOf)
+	},
+}
+
+var mileStoneUpdate = action.Action{
+	Name: "change-milestone-state",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		app := ctx.Previous.(App)
+		args := ctx.Params[0].(runAppActionsArgs)
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" update milestone state for app (%s, %s)", args.box.GetFullName(), app.State.String())))
+		if err := app.SetMileStone(app.State); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" update milestone state for app (%s, %s)OK", args.box.GetFullName(), app.State.String())))
+		return app, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		c := ctx.FWResult.(App)
+		args := ctx.Params[0].(runAppActionsArgs)
+		if args.isDeploy {
+			if err := c.SetMileStone(constants.StatePreError); err != nil {
+				log.Errorf("---- [state-change:Backward]\n     %s", err.Error())
+			}
+		}
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var rollbackNotice = func(ctx action.FWContext, err error) {
+	args := ctx.Params[0].(runAppActionsArgs)
+	fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.ERROR, fmt.Sprintf("==> ROLLBACK     %s", err)))
+}
+
+var createDeployment = action.Action{
+	Name: "create-deployment",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		app := ctx.Previous.(App)
+		args := ctx.Params[0].(runAppActionsArgs)
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" create deployment for box (%s, image:%s)/%s", args.box.GetFullName(), app.Image, app.Compute)))
+		if err := app.Apply(args.cluster); err != nil {
+			return nil, err
+		}
+		app.Status = constants.StatusContainerLaunched
+		app.State = constants.StateInitialized
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" create deployment for box (%s) in %s OK", args.box.GetFullName(), args.cluster.Namespace)))
+		return app, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		c := ctx.FWResult.(App)
+		args := ctx.Params[0].(runAppActionsArgs)
+		//a deploy over a running box gets its former pod back.
+		if err := c.Revert(args.cluster); err != nil {
+			fmt.Fprintf(args.w(), lb.W(lb.DESTORYING, lb.ERROR, fmt.Sprintf("  reverting err deployment %s", err.Error())))
+		}
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var exposeApp = action.Action{
+	Name: "expose-app",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		app := ctx.Previous.(App)
+		args := ctx.Params[0].(runAppActionsArgs)
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" create service for box (%s, %s)", args.box.GetFullName(), args.cluster.ServiceType)))
+		if err := app.Expose(args.cluster); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" create service for box (%s)OK", args.box.GetFullName())))
+		return app, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		c := ctx.FWResult.(App)
+		args := ctx.Params[0].(runAppActionsArgs)
+		if err := c.RevertExpose(args.cluster); err != nil {
+			fmt.Fprintf(args.w(), lb.W(lb.DESTORYING, lb.ERROR, fmt.Sprintf("  removing err service %s", err.Error())))
+		}
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var waitAvailable = action.Action{
+	Name: "wait-available",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		app := ctx.Previous.(App)
+		args := ctx.Params[0].(runAppActionsArgs)
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" wait for the pod of box (%s)", args.box.GetFullName())))
+		if err := app.WaitAvailable(args.cluster); err != nil {
+			return nil, err
+		}
+		app.State = constants.StateRunning
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" wait for the pod of box (%s)OK", args.box.GetFullName())))
+		return app, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var setNetworkInfo = action.Action{
+	Name: "set-network-info",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		app := ctx.Previous.(App)
+		args := ctx.Params[0].(runAppActionsArgs)
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" set the addresses of box (%s)", args.box.GetFullName())))
+		if err := app.Network(args.cluster); err != nil {
+			return nil, err
+		}
+		if err := app.SetOutputs(); err != nil {
+			app.Status = constants.StatusContainerNetworkFailure
+			return nil, err
+		}
+		app.Status = constants.StatusContainerNetworkSuccess
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" set the addresses of box (%s, %s %v)OK", args.box.GetFullName(), app.ClusterIP, app.PublicIps)))
+		return app, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+//followLogs copies the log of the pod in the log of the box, until the pod ends.
+var followLogs = action.Action{
+	Name: "follow-logs",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		app := ctx.Previous.(App)
+		args := ctx.Params[0].(runAppActionsArgs)
+		go func(box *provision.Box, c *cluster.Cluster) {
+			logWriter := lw.LogWriter{Box: box}
+			logWriter.Async()
+			defer logWriter.Close()
+			if err := app.Logs(c, &logWriter, true); err != nil {
+				log.Errorf("---- follow logs for box %s\n     %s", box.GetFullName(), err)
+			}
+		}(args.box, args.cluster)
+		app.Status = constants.StatusContainerRunning
+		app.State = constants.StateRunning
+		return app, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+	MinParams: 1,
+}
+
+var destroyOldApp = action.Action{
+	Name: "destroy-old-app",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		app := ctx.Previous.(App)
+		args := ctx.Params[0].(runAppActionsArgs)
+		fmt.Fprintf(args.w(), lb.W(lb.DESTORYING, lb.INFO, fmt.Sprintf("  destroying old app %s ----", app.Name)))
+		if err := app.Remove(args.cluster); err != nil {
+			fmt.Fprintf(args.w(), lb.W(lb.DESTORYING, lb.ERROR, fmt.Sprintf("  destroying old app (%s)--> %s", app.Name, err)))
+			return nil, err
+		}
+		app.Status = constants.StatusDestroyed
+		app.State = constants.StateDestroyed
+		fmt.Fprintf(args.w(), lb.W(lb.DESTORYING, lb.INFO, fmt.Sprintf("  destroyed old app (%s, %s)OK", app.Id, app.Name)))
+		return app, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+//lifecycle runs op on the app, and sets the status and state it ends in.
+func lifecycle(name, kind string, op func(*App, *cluster.Cluster) error, status utils.Status, state utils.State) action.Action {
+	return action.Action{
+		Name: name,
+		Forward: func(ctx action.FWContext) (action.Result, error) {
+			app := ctx.Previous.(App)
+			args := ctx.Params[0].(runAppActionsArgs)
+			fmt.Fprintf(args.w(), lb.W(kind, lb.INFO, fmt.Sprintf("  %s %s", name, app.Name)))
+			if err := op(&app, args.cluster); err != nil {
+				fmt.Fprintf(args.w(), lb.W(kind, lb.ERROR, fmt.Sprintf("  error %s ( %s)", name, args.box.GetFullName())))
+				return nil, err
+			}
+			app.Status = status
+			app.State = state
+			fmt.Fprintf(args.w(), lb.W(kind, lb.INFO, fmt.Sprintf("  %s (%s, %s) OK", name, app.Id, app.Name)))
+			return app, nil
+		},
+		Backward: func(ctx action.BWContext) {
+		},
+		OnError:   rollbackNotice,
+		MinParams: 1,
+	}
+}
+
+func (a *App) start(c *cluster.Cluster) error {
+	if err := a.Scale(c, 1); err != nil {
+		return err
+	}
+	return a.WaitAvailable(c)
+}
+
+func (a *App) stop(c *cluster.Cluster) error {
+	return a.Scale(c, 0)
+}
+
+func (a *App) restart(c *cluster.Cluster) error {
+	if err := a.Restart(c); err != nil {
+		return err
+	}
+	return a.WaitAvailable(c)
+}
+
+var (
+	startApp   = lifecycle("start-app", lb.STARTING, (*App).start, constants.StatusContainerStarted, constants.StateRunning)
+	stopApp    = lifecycle("stop-app", lb.STOPPING, (*App).stop, constants.StatusContainerStopped, constants.StateStopped)
+	restartApp = lifecycle("restart-app", lb.RESTARTING, (*App).restart, constants.StatusContainerStarted, constants.StateRunning)
+)
+
+var resizeApp = action.Action{
+	Name: "resize-app",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		app := ctx.Previous.(App)
+		args := ctx.Params[0].(runAppActionsArgs)
+		fmt.Fprintf(args.w(), lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  resizing app (%s, %s)", app.Name, args.compute.String())))
+		if err := app.Resize(args.cluster, args.compute); err != nil {
+			fmt.Fprintf(args.w(), lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("  resizing app (%s) error   %s", app.Name, err)))
+			return nil, err
+		}
+		//a stopped box has no pod to wait for, it gets the resources once started.
+		if args.box.CanCycleStop() {
+			if err := app.WaitAvailable(args.cluster); err != nil {
+				return nil, err
+			}
+		}
+		app.Compute = args.compute
+		app.Status = statusResized
+		fmt.Fprintf(args.w(), lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  resizing app (%s)OK", app.Name)))
+		return app, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
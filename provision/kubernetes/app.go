@@ -0,0 +1,606 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package kubernetes
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/libgo/safe"
+	"github.com/virtengine/libgo/utils"
+	"github.com/virtengine/vertice/carton"
+	"github.com/virtengine/vertice/carton/bind"
+	"github.com/virtengine/vertice/provision"
+	"github.com/virtengine/vertice/provision/kubernetes/cluster"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var (
+	waitTimeout  = 10 * time.Minute
+	waitInterval = 3 * time.Second
+)
+
+const (
+	containerName = "box"
+
+	labelBox          = "vertice.io/box"
+	labelCarton       = "vertice.io/carton"
+	labelCartons      = "vertice.io/cartons"
+	annotationAccount = "vertice.io/account"
+	annotationRestart = "vertice.io/restarted-at"
+
+	// PORT is the env of the box that lists the ports its service exposes.
+	PORT        = "PORT"
+	defaultPort = 80
+)
+
+//the reasons a container waits for ever, a deploy fails on them instead of timing out.
+var stuckReasons = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CrashLoopBackOff":           true,
+	"CreateContainerConfigError": true,
+}
+
+// App is a box as the cluster runs it, a deployment of one pod behind a service
+// of the same name.
+type App struct {
+	Name      string
+	BoxName   string
+	Id        string
+	CartonId  string
+	CartonsId string
+	AccountId string
+	Level     provision.BoxLevel
+	Image     string
+	Compute   provision.BoxCompute
+	Envs      []bind.EnvVar
+	ClusterIP string
+	PublicIps []string
+	Status    utils.Status
+	State     utils.State
+
+	//what Apply and Expose updated, a deploy that fails puts it back.
+	replaced *appsv1.Deployment
+	exposed  *corev1.Service
+}
+
+//objectName turns the id of the box into a dns label, as the names of the
+//services must be. The name the user gave the box isn't used, two accounts
+//may pick the same one in the shared namespace.
+func objectName(s string) string {
+	b := make([]byte, 0, len(s))
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b = append(b, byte(r))
+		case len(b) > 0 && b[len(b)-1] != '-':
+			b = append(b, '-')
+		}
+	}
+	n := strings.Trim(string(b), "-")
+	if n == "" {
+		n = "box"
+	} else if n[0] >= '0' && n[0] <= '9' {
+		n = "box-" + n
+	}
+	if len(n) > 63 {
+		n = strings.TrimRight(n[:63], "-")
+	}
+	return n
+}
+
+//imageOf is the image of the repo of the box, at the version of the box when
+//the url has no tag.
+func imageOf(box *provision.Box) string {
+	if box.Repo == nil {
+		return ""
+	}
+	url := box.Repo.Gitr()
+	if box.ImageVersion != "" && !strings.Contains(url[strings.LastIndex(url, "/")+1:], ":") {
+		url += ":" + box.ImageVersion
+	}
+	return url
+}
+
+//owned refuses an object of the name of the app that another box, or another
+//account, has in the namespace.
+func (a *App) owned(kind string, o metav1.Object) error {
+	if o.GetLabels()[labelBox] != a.Id || o.GetAnnotations()[annotationAccount] != a.AccountId {
+		return fmt.Errorf("%s %s is not the one of box %s", kind, o.GetName(), a.BoxName)
+	}
+	return nil
+}
+
+func (a *App) selector() map[string]string {
+	return map[string]string{labelBox: a.Id}
+}
+
+func (a *App) labels() map[string]string {
+	return map[string]string{labelBox: a.Id, labelCarton: a.CartonId, labelCartons: a.CartonsId}
+}
+
+//resources asks as much as it limits, the box gets the compute it is billed for.
+func resources(c provision.BoxCompute) corev1.ResourceRequirements {
+	rl := corev1.ResourceList{}
+	if c.Cpushare > 0 {
+		rl[corev1.ResourceCPU] = *resource.NewQuantity(int64(c.Cpushare), resource.DecimalSI)
+	}
+	if c.Memory > 0 {
+		rl[corev1.ResourceMemory] = *resource.NewQuantity(int64(c.Memory), resource.BinarySI)
+	}
+	if c.HDD > 0 {
+		rl[corev1.ResourceEphemeralStorage] = *resource.NewQuantity(int64(c.HDD), resource.BinarySI)
+	}
+	return corev1.ResourceRequirements{Requests: rl, Limits: rl.DeepCopy()}
+}
+
+func (a *App) env() []corev1.EnvVar {
+	envs := make([]corev1.EnvVar, 0, len(a.Envs))
+	for _, e := range a.Envs {
+		if e.Name != "" {
+			envs = append(envs, corev1.EnvVar{Name: e.Name, Value: e.Value})
+		}
+	}
+	return envs
+}
+
+//ports are the ones of the PORT env, comma separated, 80 when it has none.
+func (a *App) ports() ([]int32, error) {
+	for _, e := range a.Envs {
+		if e.Name != PORT || strings.TrimSpace(e.Value) == "" {
+			continue
+		}
+		var ports []int32
+		for _, p := range strings.Split(e.Value, ",") {
+			n, err := strconv.ParseUint(strings.TrimSpace(p), 10, 16)
+			if err != nil || n == 0 {
+				return nil, fmt.Errorf("invalid %s %q of box %s", PORT, e.Value, a.BoxName)
+			}
+			ports = append(ports, int32(n))
+		}
+		return ports, nil
+	}
+	return []int32{defaultPort}, nil
+}
+
+func (a *App) deployment() (*appsv1.Deployment, error) {
+	ports, err := a.ports()
+	if err != nil {
+		return nil, err
+	}
+	cports := make([]corev1.ContainerPort, len(ports))
+	for i, p := range ports {
+		cports[i] = corev1.ContainerPort{ContainerPort: p, Protocol: corev1.ProtocolTCP}
+	}
+	replicas := int32(1)
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        a.Name,
+			Labels:      a.labels(),
+			Annotations: map[string]string{annotationAccount: a.AccountId},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: a.selector()},
+			//one pod at a time, the old one goes before the new one comes.
+			Strategy: appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: a.labels()},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:      containerName,
+						Image:     a.Image,
+						Env:       a.env(),
+						Ports:     cports,
+						Resources: resources(a.Compute),
+					}},
+				},
+			},
+		},
+	}, nil
+}
+
+func (a *App) service(r cluster.Region) (*corev1.Service, error) {
+	ports, err := a.ports()
+	if err != nil {
+		return nil, err
+	}
+	sports := make([]corev1.ServicePort, len(ports))
+	for i, p := range ports {
+		sports[i] = corev1.ServicePort{
+			Name:       "tcp-" + strconv.Itoa(int(p)),
+			Port:       p,
+			TargetPort: intstr.FromInt(int(p)),
+			Protocol:   corev1.ProtocolTCP,
+		}
+	}
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        a.Name,
+			Labels:      a.labels(),
+			Annotations: map[string]string{annotationAccount: a.AccountId},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceType(r.ServiceType),
+			Selector: a.selector(),
+			Ports:    sports,
+		},
+	}, nil
+}
+
+//Apply creates the deployment of the box, or updates the one a former deploy left.
+func (a *App) Apply(c *cluster.Cluster) error {
+	d, err := a.deployment()
+	if err != nil {
+		return err
+	}
+	deployments := c.Client.AppsV1().Deployments(c.Namespace)
+	old, err := deployments.Get(a.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = deployments.Create(d)
+		return err
+	} else if err != nil {
+		return err
+	}
+	if err = a.owned("deployment", old); err != nil {
+		return err
+	}
+	a.replaced = old.DeepCopy()
+	old.Labels, old.Annotations = d.Labels, d.Annotations
+	old.Spec.Replicas = d.Spec.Replicas
+	old.Spec.Template = d.Spec.Template
+	_, err = deployments.Update(old)
+	return err
+}
+
+//Expose creates the service of the box, an update keeps its cluster ip.
+func (a *App) Expose(c *cluster.Cluster) error {
+	s, err := a.service(c.Region)
+	if err != nil {
+		return err
+	}
+	services := c.Client.CoreV1().Services(c.Namespace)
+	old, err := services.Get(a.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = services.Create(s)
+		return err
+	} else if err != nil {
+		return err
+	}
+	if err = a.owned("service", old); err != nil {
+		return err
+	}
+	a.exposed = old.DeepCopy()
+	old.Labels, old.Annotations = s.Labels, s.Annotations
+	old.Spec.Type, old.Spec.Selector, old.Spec.Ports = s.Spec.Type, s.Spec.Selector, s.Spec.Ports
+	_, err = services.Update(old)
+	return err
+}
+
+//Revert undoes Apply, it puts back the deployment it updated or removes the
+//one it created.
+func (a *App) Revert(c *cluster.Cluster) error {
+	prev := a.replaced
+	if prev == nil {
+		return a.Remove(c)
+	}
+	return a.update(c, func(d *appsv1.Deployment) {
+		d.Labels, d.Annotations = prev.Labels, prev.Annotations
+		d.Spec.Replicas, d.Spec.Template = prev.Spec.Replicas, prev.Spec.Template
+	})
+}
+
+//RevertExpose undoes Expose, as Revert does Apply.
+func (a *App) RevertExpose(c *cluster.Cluster) error {
+	prev := a.exposed
+	if prev == nil {
+		return a.Unexpose(c)
+	}
+	services := c.Client.CoreV1().Services(c.Namespace)
+	s, err := services.Get(a.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if err = a.owned("service", s); err != nil {
+		return err
+	}
+	s.Labels, s.Annotations = prev.Labels, prev.Annotations
+	s.Spec.Type, s.Spec.Selector, s.Spec.Ports = prev.Spec.Type, prev.Spec.Selector, prev.Spec.Ports
+	_, err = services.Update(s)
+	return err
+}
+
+func (a *App) Unexpose(c *cluster.Cluster) error {
+	services := c.Client.CoreV1().Services(c.Namespace)
+	old, err := services.Get(a.Name, metav1.GetOptions{})
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+	if err = a.owned("service", old); err != nil {
+		return err
+	}
+	return ignoreNotFound(services.Delete(a.Name, &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &old.UID}}))
+}
+
+//Remove deletes the service and the deployment, its pods go with it.
+func (a *App) Remove(c *cluster.Cluster) error {
+	if err := a.Unexpose(c); err != nil {
+		return err
+	}
+	deployments := c.Client.AppsV1().Deployments(c.Namespace)
+	old, err := deployments.Get(a.Name, metav1.GetOptions{})
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+	if err = a.owned("deployment", old); err != nil {
+		return err
+	}
+	policy := metav1.DeletePropagationBackground
+	return ignoreNotFound(deployments.Delete(a.Name, &metav1.DeleteOptions{
+		PropagationPolicy: &policy,
+		Preconditions:     &metav1.Preconditions{UID: &old.UID},
+	}))
+}
+
+//update changes the deployment of the box with fn.
+func (a *App) update(c *cluster.Cluster, fn func(*appsv1.Deployment)) error {
+	deployments := c.Client.AppsV1().Deployments(c.Namespace)
+	d, err := deployments.Get(a.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if err = a.owned("deployment", d); err != nil {
+		return err
+	}
+	fn(d)
+	_, err = deployments.Update(d)
+	return err
+}
+
+//Scale runs the box with that many pods, a box with none is stopped.
+func (a *App) Scale(c *cluster.Cluster, replicas int32) error {
+	return a.update(c, func(d *appsv1.Deployment) {
+		d.Spec.Replicas = &replicas
+	})
+}
+
+//Restart rolls the pod over, as a change of its template does.
+func (a *App) Restart(c *cluster.Cluster) error {
+	return a.update(c, func(d *appsv1.Deployment) {
+		if d.Spec.Template.Annotations == nil {
+			d.Spec.Template.Annotations = make(map[string]string)
+		}
+		d.Spec.Template.Annotations[annotationRestart] = time.Now().UTC().Format(time.RFC3339)
+	})
+}
+
+//Resize changes the resources of the pod, it is rolled over with them.
+func (a *App) Resize(c *cluster.Cluster, to provision.BoxCompute) error {
+	return a.update(c, func(d *appsv1.Deployment) {
+		for i := range d.Spec.Template.Spec.Containers {
+			if d.Spec.Template.Spec.Containers[i].Name == containerName {
+				d.Spec.Template.Spec.Containers[i].Resources = resources(to)
+			}
+		}
+	})
+}
+
+func (a *App) pods(c *cluster.Cluster) ([]corev1.Pod, error) {
+	l, err := c.Client.CoreV1().Pods(c.Namespace).List(metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(a.selector()).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(l.Items, func(i, j int) bool { return l.Items[i].Name < l.Items[j].Name })
+	return l.Items, nil
+}
+
+//stuck returns why a container of the pods won't ever start.
+func (a *App) stuck(pods []corev1.Pod) error {
+	for _, p := range pods {
+		for _, s := range p.Status.ContainerStatuses {
+			if w := s.State.Waiting; w != nil && stuckReasons[w.Reason] {
+				return fmt.Errorf("box %s: %s %s", a.BoxName, w.Reason, w.Message)
+			}
+		}
+	}
+	return nil
+}
+
+//WaitAvailable waits for the pod of the box to be ready.
+func (a *App) WaitAvailable(c *cluster.Cluster) error {
+	return safe.WaitCondition(waitTimeout, waitInterval, func() (bool, error) {
+		d, err := c.Client.AppsV1().Deployments(c.Namespace).Get(a.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if d.Status.AvailableReplicas > 0 {
+			return true, nil
+		}
+		pods, err := a.pods(c)
+		if err != nil {
+			return false, err
+		}
+		return false, a.stuck(pods)
+	})
+}
+
+//Network reads the addresses of the service, the public ones are those of a
+//load balancer when the region has them.
+func (a *App) Network(c *cluster.Cluster) error {
+	s, err := c.Client.CoreV1().Services(c.Namespace).Get(a.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if err = a.owned("service", s); err != nil {
+		return err
+	}
+	a.ClusterIP = s.Spec.ClusterIP
+	a.PublicIps = append([]string{}, s.Spec.ExternalIPs...)
+	for _, in := range s.Status.LoadBalancer.Ingress {
+		if in.IP != "" {
+			a.PublicIps = append(a.PublicIps, in.IP)
+		} else if in.Hostname != "" {
+			a.PublicIps = append(a.PublicIps, in.Hostname)
+		}
+	}
+	return nil
+}
+
+//Pod returns the running pod of the box.
+func (a *App) Pod(c *cluster.Cluster) (*corev1.Pod, error) {
+	pods, err := a.pods(c)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pods {
+		if pods[i].Status.Phase == corev1.PodRunning && pods[i].DeletionTimestamp == nil {
+			return &pods[i], nil
+		}
+	}
+	return nil, provision.ErrBoxNotFound
+}
+
+//Exec runs the command in the container of the box.
+func (a *App) Exec(c *cluster.Cluster, opts cluster.ExecOptions) error {
+	p, err := a.Pod(c)
+	if err != nil {
+		return err
+	}
+	opts.Container = containerName
+	return c.Streams.Exec(c.Namespace, p.Name, opts)
+}
+
+//Logs copies the log of the container to w, until the pod ends when it follows.
+func (a *App) Logs(c *cluster.Cluster, w io.Writer, follow bool) error {
+	p, err := a.Pod(c)
+	if err != nil {
+		return err
+	}
+	r, err := c.Streams.Logs(c.Namespace, p.Name, containerName, follow)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func ignoreNotFound(err error) error {
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+//Outputs are the instance, addresses and ports of the service, as the
+//assembly keeps them.
+func (a *App) Outputs() map[string][]string {
+	var ports string
+	if ps, err := a.ports(); err == nil {
+		for _, p := range ps {
+			ports += strconv.Itoa(int(p)) + "/tcp,"
+		}
+	}
+	out := map[string][]string{
+		carton.INSTANCE_ID:    {a.Name},
+		carton.INSTANCE_PORTS: {ports},
+		utils.PUBLICIPV4:      a.PublicIps,
+	}
+	if a.ClusterIP != "" && a.ClusterIP != corev1.ClusterIPNone {
+		out[utils.PRIVATEIPV4] = []string{a.ClusterIP}
+	}
+	return out
+}
+
+func (a *App) SetOutputs() error {
+	asm, err := carton.NewAssembly(a.CartonId, a.AccountId, "")
+	if err != nil {
+		return err
+	}
+	return asm.NukeAndSetOutputs(a.Outputs())
+}
+
+func (a *App) SetStatus(status utils.Status) error {
+	log.Debugf("  set status[%s] of app (%s, %s)", a.Id, a.BoxName, status.String())
+
+	if asm, err := carton.NewAssembly(a.CartonId, a.AccountId, ""); err != nil {
+		return err
+	} else if err = asm.SetStatus(status); err != nil {
+		return err
+	}
+
+	if a.Level == provision.BoxSome {
+		if comp, err := carton.NewComponent(a.Id, a.AccountId, ""); err != nil {
+			return err
+		} else if err = comp.SetStatus(status, a.AccountId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *App) SetStatusErr(status utils.Status, causeof error) error {
+	log.Debugf("  set status[%s] of app (%s, %s)", a.Id, a.BoxName, status.String())
+
+	if asm, err := carton.NewAssembly(a.CartonId, a.AccountId, ""); err != nil {
+		return err
+	} else if err = asm.SetStatusErr(status, causeof); err != nil {
+		return err
+	}
+
+	if a.Level == provision.BoxSome {
+		if comp, err := carton.NewComponent(a.Id, a.AccountId, ""); err != nil {
+			return err
+		} else if err = comp.SetStatus(status, a.AccountId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *App) SetMileStone(state utils.State) error {
+	log.Debugf("  set state[%s] of app (%s, %s)", a.Id, a.BoxName, state.String())
+
+	if asm, err := carton.NewAssembly(a.CartonId, a.AccountId, ""); err != nil {
+		return err
+	} else if err = asm.SetState(state); err != nil {
+		return err
+	}
+
+	if a.Level == provision.BoxSome {
+		if comp, err := carton.NewComponent(a.Id, a.AccountId, ""); err != nil {
+			return err
+		} else if err = comp.SetState(state, a.AccountId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,331 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/virtengine/libgo/action"
+	constants "github.com/virtengine/libgo/utils"
+	"github.com/virtengine/vertice/carton"
+	"github.com/virtengine/vertice/carton/bind"
+	"github.com/virtengine/vertice/provision"
+	"github.com/virtengine/vertice/provision/kubernetes/cluster"
+	"github.com/virtengine/vertice/provision/kubernetes/kubetest"
+	"github.com/virtengine/vertice/repository"
+	"gopkg.in/check.v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct {
+	client  *fake.Clientset
+	streams *kubetest.FakeStreams
+	cluster *cluster.Cluster
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpSuite(c *check.C) {
+	waitInterval = time.Millisecond
+	waitTimeout = 50 * time.Millisecond
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	s.client = fake.NewSimpleClientset()
+	s.streams = kubetest.NewFakeStreams()
+	s.cluster = &cluster.Cluster{
+		Region:  cluster.Region{Zone: "k8s1", Namespace: "boxes", ServiceType: "ClusterIP"},
+		Client:  s.client,
+		Streams: s.streams,
+	}
+}
+
+func (s *S) box() *provision.Box {
+	return &provision.Box{Id: "BOX1", CartonId: "ASM1", CartonsId: "ASMS1", AccountId: "info@megam.io",
+		CartonName: "web1", DomainName: "megam.io", Region: "k8s1", ImageVersion: "1.13",
+		Repo:    &repository.Repo{URL: "nginx"},
+		Envs:    []bind.EnvVar{{Name: "PORT", Value: "8080, 8443"}, {Name: "RAILS_ENV", Value: "production"}},
+		Compute: provision.BoxCompute{Cpushare: 2, Memory: provision.GB, HDD: 10 * provision.GB},
+		State:   constants.StateRunning}
+}
+
+func (s *S) args() runAppActionsArgs {
+	return runAppActionsArgs{box: s.box(), imageId: "nginx:1.13", cluster: s.cluster, appStatus: constants.StatusContainerLaunching}
+}
+
+//forward runs the actions as a pipeline would, each on the result of the previous.
+func (s *S) forward(c *check.C, actions ...*action.Action) App {
+	var prev action.Result
+	for _, a := range actions {
+		r, err := a.Forward(action.FWContext{Previous: prev, Params: []interface{}{s.args()}})
+		c.Assert(err, check.IsNil, check.Commentf("action %s", a.Name))
+		prev = r
+	}
+	return prev.(App)
+}
+
+//available runs the pod of the deployment, as the kubelet would.
+func (s *S) available(c *check.C, phase corev1.PodPhase, waiting string) {
+	d, err := s.client.AppsV1().Deployments("boxes").Get("box1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	if phase == corev1.PodRunning && waiting == "" {
+		d.Status.AvailableReplicas = 1
+		_, err = s.client.AppsV1().Deployments("boxes").UpdateStatus(d)
+		c.Assert(err, check.IsNil)
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "box1-5d8f", Labels: d.Spec.Template.Labels},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+	if waiting != "" {
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name:  containerName,
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: waiting, Message: "no such image"}},
+		}}
+	}
+	_, err = s.client.CoreV1().Pods("boxes").Create(pod)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestObjectName(c *check.C) {
+	c.Assert(objectName("BOX1"), check.Equals, "box1")
+	c.Assert(objectName("web1.megam.io"), check.Equals, "web1-megam-io")
+	c.Assert(objectName("1_Box..A"), check.Equals, "box-1-box-a")
+	c.Assert(objectName("..."), check.Equals, "box")
+	n := objectName(strings.Repeat("a", 62) + ".b")
+	c.Assert(n, check.HasLen, 62)
+}
+
+func (s *S) TestImageOf(c *check.C) {
+	box := s.box()
+	c.Assert(imageOf(box), check.Equals, "nginx:1.13")
+	box.Repo.URL = "registry.megam.io:5000/megam/nginx:latest"
+	c.Assert(imageOf(box), check.Equals, "registry.megam.io:5000/megam/nginx:latest")
+	box.Repo.URL = "registry.megam.io:5000/megam/nginx"
+	c.Assert(imageOf(box), check.Equals, "registry.megam.io:5000/megam/nginx:1.13")
+	box.Repo = nil
+	c.Assert(imageOf(box), check.Equals, "")
+}
+
+func (s *S) TestApplyCreatesTheDeployment(c *check.C) {
+	s.forward(c, &appCreating, &createDeployment)
+	d, err := s.client.AppsV1().Deployments("boxes").Get("box1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(*d.Spec.Replicas, check.Equals, int32(1))
+	c.Assert(d.Spec.Selector.MatchLabels, check.DeepEquals, map[string]string{labelBox: "BOX1"})
+	c.Assert(d.Spec.Template.Labels[labelCarton], check.Equals, "ASM1")
+	c.Assert(d.Annotations[annotationAccount], check.Equals, "info@megam.io")
+
+	ct := d.Spec.Template.Spec.Containers[0]
+	c.Assert(ct.Image, check.Equals, "nginx:1.13")
+	c.Assert(ct.Env, check.DeepEquals, []corev1.EnvVar{{Name: "PORT", Value: "8080, 8443"}, {Name: "RAILS_ENV", Value: "production"}})
+	c.Assert(ct.Ports, check.HasLen, 2)
+	c.Assert(ct.Ports[1].ContainerPort, check.Equals, int32(8443))
+	limits := ct.Resources.Limits
+	c.Assert(limits.Cpu().Cmp(resource.MustParse("2")), check.Equals, 0)
+	c.Assert(limits.Memory().Cmp(resource.MustParse("1Gi")), check.Equals, 0)
+	c.Assert(limits.StorageEphemeral().Cmp(resource.MustParse("10Gi")), check.Equals, 0)
+	c.Assert(ct.Resources.Requests, check.DeepEquals, limits)
+}
+
+func (s *S) TestApplyUpdatesTheDeployment(c *check.C) {
+	app := s.forward(c, &appCreating, &createDeployment)
+	c.Assert(app.Scale(s.cluster, 0), check.IsNil)
+	app.Image = "nginx:1.14"
+	c.Assert(app.Apply(s.cluster), check.IsNil)
+	l, err := s.client.AppsV1().Deployments("boxes").List(metav1.ListOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(l.Items, check.HasLen, 1)
+	c.Assert(l.Items[0].Spec.Template.Spec.Containers[0].Image, check.Equals, "nginx:1.14")
+	c.Assert(*l.Items[0].Spec.Replicas, check.Equals, int32(1))
+}
+
+func (s *S) TestInvalidPort(c *check.C) {
+	app := s.forward(c, &appCreating)
+	app.Envs = []bind.EnvVar{{Name: PORT, Value: "http"}}
+	c.Assert(app.Apply(s.cluster), check.ErrorMatches, `invalid PORT "http" of box web1.megam.io`)
+	app.Envs = nil
+	ports, err := app.ports()
+	c.Assert(err, check.IsNil)
+	c.Assert(ports, check.DeepEquals, []int32{80})
+}
+
+func (s *S) TestExposeKeepsTheClusterIP(c *check.C) {
+	s.forward(c, &appCreating, &createDeployment, &exposeApp)
+	svc, err := s.client.CoreV1().Services("boxes").Get("box1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(svc.Spec.Type, check.Equals, corev1.ServiceTypeClusterIP)
+	c.Assert(svc.Spec.Selector, check.DeepEquals, map[string]string{labelBox: "BOX1"})
+	c.Assert(svc.Spec.Ports, check.HasLen, 2)
+	c.Assert(svc.Spec.Ports[0].TargetPort.IntValue(), check.Equals, 8080)
+
+	svc.Spec.ClusterIP = "10.96.0.12"
+	_, err = s.client.CoreV1().Services("boxes").Update(svc)
+	c.Assert(err, check.IsNil)
+	s.forward(c, &appCreating, &exposeApp)
+	svc, err = s.client.CoreV1().Services("boxes").Get("box1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(svc.Spec.ClusterIP, check.Equals, "10.96.0.12")
+}
+
+func (s *S) TestCreateDeploymentBackward(c *check.C) {
+	app := s.forward(c, &appCreating, &createDeployment, &exposeApp)
+	createDeployment.Backward(action.BWContext{FWResult: app, Params: []interface{}{s.args()}})
+	_, err := s.client.CoreV1().Services("boxes").Get("box1", metav1.GetOptions{})
+	c.Assert(err, check.NotNil)
+	_, err = s.client.AppsV1().Deployments("boxes").Get("box1", metav1.GetOptions{})
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestBackwardRevertsARunningBox(c *check.C) {
+	s.forward(c, &appCreating, &createDeployment, &exposeApp)
+	args := s.args()
+	args.imageId = "nginx:broken"
+	app, err := appCreating.Forward(action.FWContext{Params: []interface{}{args}})
+	c.Assert(err, check.IsNil)
+	deployed, err := createDeployment.Forward(action.FWContext{Previous: app, Params: []interface{}{args}})
+	c.Assert(err, check.IsNil)
+	exposed, err := exposeApp.Forward(action.FWContext{Previous: deployed, Params: []interface{}{args}})
+	c.Assert(err, check.IsNil)
+	d, err := s.client.AppsV1().Deployments("boxes").Get("box1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(d.Spec.Template.Spec.Containers[0].Image, check.Equals, "nginx:broken")
+
+	exposeApp.Backward(action.BWContext{FWResult: exposed, Params: []interface{}{args}})
+	createDeployment.Backward(action.BWContext{FWResult: deployed, Params: []interface{}{args}})
+	d, err = s.client.AppsV1().Deployments("boxes").Get("box1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(d.Spec.Template.Spec.Containers[0].Image, check.Equals, "nginx:1.13")
+	_, err = s.client.CoreV1().Services("boxes").Get("box1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestWaitAvailable(c *check.C) {
+	s.forward(c, &appCreating, &createDeployment)
+	s.available(c, corev1.PodRunning, "")
+	app := s.forward(c, &appCreating, &waitAvailable)
+	c.Assert(app.State, check.Equals, constants.StateRunning)
+}
+
+func (s *S) TestWaitAvailableFailsOnAStuckPod(c *check.C) {
+	app := s.forward(c, &appCreating, &createDeployment)
+	s.available(c, corev1.PodPending, "ImagePullBackOff")
+	err := app.WaitAvailable(s.cluster)
+	c.Assert(err, check.ErrorMatches, "box web1.megam.io: ImagePullBackOff no such image")
+}
+
+func (s *S) TestWaitAvailableTimesOut(c *check.C) {
+	app := s.forward(c, &appCreating, &createDeployment)
+	c.Assert(app.WaitAvailable(s.cluster), check.NotNil)
+}
+
+func (s *S) TestLifecycle(c *check.C) {
+	s.forward(c, &appCreating, &createDeployment)
+	s.available(c, corev1.PodRunning, "")
+	replicas := func() int32 {
+		d, err := s.client.AppsV1().Deployments("boxes").Get("box1", metav1.GetOptions{})
+		c.Assert(err, check.IsNil)
+		return *d.Spec.Replicas
+	}
+
+	app := s.forward(c, &appCreating, &stopApp)
+	c.Assert(app.Status, check.Equals, constants.StatusContainerStopped)
+	c.Assert(app.State, check.Equals, constants.StateStopped)
+	c.Assert(replicas(), check.Equals, int32(0))
+
+	app = s.forward(c, &appCreating, &startApp)
+	c.Assert(app.Status, check.Equals, constants.StatusContainerStarted)
+	c.Assert(replicas(), check.Equals, int32(1))
+
+	app = s.forward(c, &appCreating, &restartApp)
+	c.Assert(app.State, check.Equals, constants.StateRunning)
+	d, err := s.client.AppsV1().Deployments("boxes").Get("box1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(d.Spec.Template.Annotations[annotationRestart], check.Not(check.Equals), "")
+}
+
+func (s *S) TestResize(c *check.C) {
+	s.forward(c, &appCreating, &createDeployment)
+	args := s.args()
+	args.box.State = constants.StateStopped
+	args.compute = provision.BoxCompute{Cpushare: 4, Memory: 2 * provision.GB}
+	r, err := resizeApp.Forward(action.FWContext{Previous: s.forward(c, &appCreating), Params: []interface{}{args}})
+	c.Assert(err, check.IsNil)
+	c.Assert(r.(App).Status, check.Equals, statusResized)
+	d, err := s.client.AppsV1().Deployments("boxes").Get("box1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	limits := d.Spec.Template.Spec.Containers[0].Resources.Limits
+	c.Assert(limits.Cpu().Cmp(resource.MustParse("4")), check.Equals, 0)
+	c.Assert(limits.Memory().Cmp(resource.MustParse("2Gi")), check.Equals, 0)
+	_, ok := limits[corev1.ResourceEphemeralStorage]
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestDestroy(c *check.C) {
+	s.forward(c, &appCreating, &createDeployment, &exposeApp)
+	app := s.forward(c, &appCreating, &destroyOldApp)
+	c.Assert(app.Status, check.Equals, constants.StatusDestroyed)
+	l, err := s.client.AppsV1().Deployments("boxes").List(metav1.ListOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(l.Items, check.HasLen, 0)
+	sl, err := s.client.CoreV1().Services("boxes").List(metav1.ListOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(sl.Items, check.HasLen, 0)
+
+	//once more, nothing left to remove.
+	s.forward(c, &appCreating, &destroyOldApp)
+}
+
+func (s *S) TestObjectsOfAnotherAccount(c *check.C) {
+	s.forward(c, &appCreating, &createDeployment, &exposeApp)
+	app := s.forward(c, &appCreating)
+	app.AccountId = "other@megam.io"
+	c.Assert(app.Apply(s.cluster), check.ErrorMatches, "deployment box1 is not the one of box web1.megam.io")
+	c.Assert(app.Expose(s.cluster), check.ErrorMatches, "service box1 is not the one of box web1.megam.io")
+	c.Assert(app.Scale(s.cluster, 0), check.NotNil)
+	c.Assert(app.Remove(s.cluster), check.NotNil)
+
+	app.AccountId, app.Id = "info@megam.io", "BOX2"
+	c.Assert(app.Remove(s.cluster), check.NotNil)
+	_, err := s.client.CoreV1().Services("boxes").Get("box1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	d, err := s.client.AppsV1().Deployments("boxes").Get("box1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(*d.Spec.Replicas, check.Equals, int32(1))
+}
+
+func (s *S) TestNetworkAndOutputs(c *check.C) {
+	s.forward(c, &appCreating, &createDeployment, &exposeApp)
+	svc, err := s.client.CoreV1().Services("boxes").Get("box1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	svc.Spec.ClusterIP = "10.96.0.12"
+	svc.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "203.0.113.7"}}
+	_, err = s.client.CoreV1().Services("boxes").Update(svc)
+	c.Assert(err, check.IsNil)
+
+	app := s.forward(c, &appCreating)
+	c.Assert(app.Network(s.cluster), check.IsNil)
+	c.Assert(app.Outputs(), check.DeepEquals, map[string][]string{
+		carton.INSTANCE_ID:    {"box1"},
+		carton.INSTANCE_PORTS: {"8080/tcp,8443/tcp,"},
+		constants.PRIVATEIPV4: {"10.96.0.12"},
+		constants.PUBLICIPV4:  {"203.0.113.7"},
+	})
+}
+
+func (s *S) TestLogs(c *check.C) {
+	app := s.forward(c, &appCreating, &createDeployment)
+	var out strings.Builder
+	c.Assert(app.Logs(s.cluster, &out, false), check.Equals, provision.ErrBoxNotFound)
+	s.available(c, corev1.PodRunning, "")
+	s.streams.PodLogs["box1-5d8f"] = "listening on 8080\n"
+	c.Assert(app.Logs(s.cluster, &out, false), check.IsNil)
+	c.Assert(out.String(), check.Equals, "listening on 8080\n")
+}
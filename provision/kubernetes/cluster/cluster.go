@@ -0,0 +1,172 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+
+// Package cluster connects to the kubernetes clusters, one per region.
+package cluster
+
+import (
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+const (
+	DefaultNamespace   = "default"
+	DefaultServiceType = corev1.ServiceTypeClusterIP
+)
+
+// Region is a kubernetes cluster, the region its boxes are deployed to.
+// With no kubeconfig and no master vertice runs in the cluster.
+type Region struct {
+	Zone        string `json:"zone" toml:"zone"`
+	Master      string `json:"master" toml:"master"`
+	Kubeconfig  string `json:"kubeconfig" toml:"kubeconfig"`
+	Namespace   string `json:"namespace" toml:"namespace"`
+	ServiceType string `json:"service_type" toml:"service_type"`
+}
+
+// Size is the size of a terminal.
+type Size struct {
+	Width  uint16
+	Height uint16
+}
+
+// ExecOptions is a command to run in a container of a pod.
+type ExecOptions struct {
+	Container string
+	Command   []string
+	Stdin     io.Reader
+	Stdout    io.Writer
+	Stderr    io.Writer
+	Tty       bool
+	Size      Size
+	//Resize has the new sizes of the tty, until it closes.
+	Resize <-chan Size
+}
+
+// Streams are the calls that upgrade the connection to the apiserver, the
+// fake clientset has no server to run them.
+type Streams interface {
+	Exec(namespace, pod string, opts ExecOptions) error
+	Logs(namespace, pod, container string, follow bool) (io.ReadCloser, error)
+}
+
+// Cluster is the clientset of a region and its streams.
+type Cluster struct {
+	Region
+	Client  kubernetes.Interface
+	Streams Streams
+}
+
+// Connect builds the clientset of the region, nothing is asked to the apiserver yet.
+func Connect(r Region) (*Cluster, error) {
+	var (
+		config *rest.Config
+		err    error
+	)
+	if r.Master == "" && r.Kubeconfig == "" {
+		config, err = rest.InClusterConfig()
+	} else {
+		config, err = clientcmd.BuildConfigFromFlags(r.Master, r.Kubeconfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Cluster{Region: r, Client: client, Streams: &restStreams{config: config, client: client}}, nil
+}
+
+type restStreams struct {
+	config *rest.Config
+	client kubernetes.Interface
+}
+
+func (s *restStreams) Exec(namespace, pod string, opts ExecOptions) error {
+	req := s.client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: opts.Container,
+			Command:   opts.Command,
+			Stdin:     opts.Stdin != nil,
+			Stdout:    opts.Stdout != nil,
+			Stderr:    opts.Stderr != nil && !opts.Tty,
+			TTY:       opts.Tty,
+		}, scheme.ParameterCodec)
+	exec, err := remotecommand.NewSPDYExecutor(s.config, "POST", req.URL())
+	if err != nil {
+		return err
+	}
+	so := remotecommand.StreamOptions{
+		Stdin:  opts.Stdin,
+		Stdout: opts.Stdout,
+		Tty:    opts.Tty,
+	}
+	if !opts.Tty {
+		so.Stderr = opts.Stderr
+	}
+	if opts.Tty {
+		done := make(chan struct{})
+		defer close(done)
+		q := &sizeQueue{resize: opts.Resize, done: done}
+		if opts.Size.Width > 0 && opts.Size.Height > 0 {
+			q.first = &opts.Size
+		}
+		so.TerminalSizeQueue = q
+	}
+	return exec.Stream(so)
+}
+
+func (s *restStreams) Logs(namespace, pod, container string, follow bool) (io.ReadCloser, error) {
+	return s.client.CoreV1().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{
+		Container: container,
+		Follow:    follow,
+	}).Stream()
+}
+
+//sizeQueue hands the size the tty starts with, then the ones of resize until
+//it closes or the exec ends.
+type sizeQueue struct {
+	first  *Size
+	resize <-chan Size
+	done   <-chan struct{}
+}
+
+func (q *sizeQueue) Next() *remotecommand.TerminalSize {
+	if s := q.first; s != nil {
+		q.first = nil
+		return &remotecommand.TerminalSize{Width: s.Width, Height: s.Height}
+	}
+	select {
+	case s, ok := <-q.resize:
+		if !ok {
+			return nil
+		}
+		return &remotecommand.TerminalSize{Width: s.Width, Height: s.Height}
+	case <-q.done:
+		return nil
+	}
+}
@@ -0,0 +1,77 @@
+// Package kubetest has the streams of a fake cluster, for the tests of the
+// kubernetes provisioner along with the fake clientset.
+package kubetest
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/virtengine/vertice/provision/kubernetes/cluster"
+)
+
+// Exec is a command the fake ran.
+type Exec struct {
+	Namespace string
+	Pod       string
+	Opts      cluster.ExecOptions
+	Input     string
+	Sizes     []cluster.Size
+}
+
+// FakeStreams implements cluster.Streams, the commands print Output and
+// the pods log what PodLogs has for them.
+type FakeStreams struct {
+	Output  string
+	PodLogs map[string]string
+	Err     error
+
+	mu    sync.Mutex
+	execs []Exec
+}
+
+var _ cluster.Streams = &FakeStreams{}
+
+func NewFakeStreams() *FakeStreams {
+	return &FakeStreams{PodLogs: make(map[string]string)}
+}
+
+// Execs returns the commands run, in order.
+func (f *FakeStreams) Execs() []Exec {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Exec{}, f.execs...)
+}
+
+//the input and the resizes are read until they close, as a shell does.
+func (f *FakeStreams) Exec(namespace, pod string, opts cluster.ExecOptions) error {
+	e := Exec{Namespace: namespace, Pod: pod, Opts: opts}
+	if opts.Stdin != nil {
+		in, _ := ioutil.ReadAll(opts.Stdin)
+		e.Input = string(in)
+	}
+	if opts.Resize != nil {
+		for s := range opts.Resize {
+			e.Sizes = append(e.Sizes, s)
+		}
+	}
+	f.mu.Lock()
+	f.execs = append(f.execs, e)
+	f.mu.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	if opts.Stdout != nil {
+		_, err := io.WriteString(opts.Stdout, f.Output)
+		return err
+	}
+	return nil
+}
+
+func (f *FakeStreams) Logs(namespace, pod, container string, follow bool) (io.ReadCloser, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	return ioutil.NopCloser(strings.NewReader(f.PodLogs[pod])), nil
+}
@@ -0,0 +1,420 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+
+// Package kubernetes is a provisioner that runs the container boxes as a
+// deployment of one pod behind a service, one cluster per region.
+package kubernetes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/libgo/action"
+	"github.com/virtengine/libgo/cmd"
+	"github.com/virtengine/libgo/events/alerts"
+	"github.com/virtengine/libgo/utils"
+	constants "github.com/virtengine/libgo/utils"
+	"github.com/virtengine/vertice/carton"
+	lb "github.com/virtengine/vertice/logbox"
+	"github.com/virtengine/vertice/provision"
+	"github.com/virtengine/vertice/provision/kubernetes/cluster"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Provider is the name the kubernetes provisioner registers with.
+const Provider = "kubernetes"
+
+func init() {
+	provision.Register(Provider, &kubernetesProvisioner{connect: cluster.Connect})
+}
+
+type kubernetesProvisioner struct {
+	clusters map[string]*cluster.Cluster
+	connect  func(cluster.Region) (*cluster.Cluster, error)
+}
+
+type Kubernetes struct {
+	Enabled bool             `json:"enabled" toml:"enabled"`
+	Regions []cluster.Region `json:"region" toml:"region"`
+}
+
+func (p *kubernetesProvisioner) String() string {
+	if len(p.clusters) == 0 {
+		return "✗ kubernetes clusters"
+	}
+	return "ready"
+}
+
+//no snapshots, backups or disks, the pods keep nothing.
+func (p *kubernetesProvisioner) Capabilities() []provision.Capability {
+	return []provision.Capability{
+		provision.CapDeploy, provision.CapUpgrade, provision.CapDestroy,
+		provision.CapStart, provision.CapStop, provision.CapRestart,
+		provision.CapResize, provision.CapShell,
+	}
+}
+
+func (p *kubernetesProvisioner) Initialize(m interface{}) error {
+	k, ok := m.(Kubernetes)
+	if !ok {
+		return errors.New("kubernetes provisioner needs its kubernetes config")
+	}
+	if p.connect == nil {
+		p.connect = cluster.Connect
+	}
+	p.clusters = make(map[string]*cluster.Cluster, len(k.Regions))
+	for _, r := range k.Regions {
+		if r.Zone == "" {
+			return errors.New("kubernetes region needs a zone")
+		}
+		if r.Namespace == "" {
+			r.Namespace = cluster.DefaultNamespace
+		}
+		if r.ServiceType == "" {
+			r.ServiceType = string(cluster.DefaultServiceType)
+		}
+		c, err := p.connect(r)
+		if err != nil {
+			return fmt.Errorf("kubernetes region %q: %s", r.Zone, err)
+		}
+		p.clusters[r.Zone] = c
+	}
+	return nil
+}
+
+func (p *kubernetesProvisioner) StartupMessage() (string, error) {
+	w := new(tabwriter.Writer)
+	var b bytes.Buffer
+	w.Init(&b, 0, 8, 0, '\t', 0)
+	b.Write([]byte(cmd.Colorfy("  > kubernetes ", "white", "", "bold") + "\t" +
+		cmd.Colorfy(p.String(), "cyan", "", "")))
+	for _, c := range p.clusters {
+		b.Write([]byte("\n    " + c.Zone + "\t" + c.Namespace))
+	}
+	fmt.Fprintln(w)
+	w.Flush()
+	return strings.TrimSpace(b.String()), nil
+}
+
+//cluster returns the cluster of the region of the box, the only one when the box has none.
+func (p *kubernetesProvisioner) cluster(box *provision.Box) (*cluster.Cluster, error) {
+	if c, ok := p.clusters[box.Region]; ok {
+		return c, nil
+	}
+	if box.Region == "" && len(p.clusters) == 1 {
+		for _, c := range p.clusters {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("no kubernetes cluster for the region %q of box %s", box.Region, box.GetFullName())
+}
+
+//run executes the actions on the cluster of the box.
+func (p *kubernetesProvisioner) run(args runAppActionsArgs, actions ...*action.Action) error {
+	c, err := p.cluster(args.box)
+	if err != nil {
+		return err
+	}
+	args.cluster = c
+	return action.NewPipeline(actions...).Execute(args)
+}
+
+//app is the app of a deployed box, for the calls outside a pipeline.
+func (p *kubernetesProvisioner) app(box *provision.Box) (App, *cluster.Cluster, error) {
+	c, err := p.cluster(box)
+	if err != nil {
+		return App{}, nil, err
+	}
+	return App{Name: objectName(box.Id), BoxName: box.GetFullName(), Id: box.Id, AccountId: box.AccountId}, c, nil
+}
+
+func (p *kubernetesProvisioner) GitDeploy(box *provision.Box, w io.Writer) (string, error) {
+	return p.deployPipeline(box, imageOf(box), w)
+}
+
+func (p *kubernetesProvisioner) ImageDeploy(box *provision.Box, imageId string, w io.Writer) (string, error) {
+	if imageId == "" {
+		imageId = imageOf(box)
+	}
+	return p.deployPipeline(box, imageId, w)
+}
+
+func (p *kubernetesProvisioner) BackupDeploy(box *provision.Box, imageId string, w io.Writer) (string, error) {
+	return "", provision.ErrNotImplemented
+}
+
+//1. &updateStatus in Scylla - Launching..
+//2. &create the deployment and its service.
+//3. &wait for the pod, set the outputs and follow its log, then it is running.
+func (p *kubernetesProvisioner) deployPipeline(box *provision.Box, imageId string, w io.Writer) (string, error) {
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- deploy box (%s, image:%s)", box.GetFullName(), imageId)))
+	if imageId == "" {
+		return "", fmt.Errorf("no image to deploy box %s", box.GetFullName())
+	}
+	args := runAppActionsArgs{
+		box:       box,
+		imageId:   imageId,
+		writer:    w,
+		isDeploy:  true,
+		appStatus: constants.StatusContainerLaunching,
+		appState:  constants.StateInitializing,
+	}
+	err := p.run(args, &appCreating, &updateStatusInScylla, &mileStoneUpdate, &createDeployment, &exposeApp,
+		&updateStatusInScylla, &mileStoneUpdate, &waitAvailable, &setNetworkInfo, &updateStatusInScylla,
+		&followLogs, &updateStatusInScylla, &mileStoneUpdate)
+	if err != nil {
+		fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.ERROR, fmt.Sprintf("--- deploy pipeline for box (%s, image:%s)\n --> %s", box.GetFullName(), imageId, err)))
+		return "", err
+	}
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- deploy box (%s, image:%s)OK", box.GetFullName(), imageId)))
+	return imageId, carton.DoneNotify(box, w, alerts.RUNNING, "")
+}
+
+//Units are none, a deploy updates the deployment of the box in place.
+func (p *kubernetesProvisioner) Units(box *provision.Box) ([]string, error) {
+	return nil, nil
+}
+
+func (p *kubernetesProvisioner) RemoveUnits(box *provision.Box, units []string, w io.Writer) error {
+	return nil
+}
+
+func (p *kubernetesProvisioner) Destroy(box *provision.Box, w io.Writer) error {
+	fmt.Fprintf(w, lb.W(lb.DESTORYING, lb.INFO, fmt.Sprintf("--- destroying box (%s)", box.GetFullName())))
+	args := runAppActionsArgs{
+		box:       box,
+		writer:    w,
+		appStatus: constants.StatusDestroying,
+		appState:  constants.StateDestroying,
+	}
+	err := p.run(args, &appCreating, &updateStatusInScylla, &mileStoneUpdate, &destroyOldApp, &mileStoneUpdate, &updateStatusInScylla)
+	if err != nil {
+		fmt.Fprintf(w, lb.W(lb.DESTORYING, lb.ERROR, fmt.Sprintf("--- destroying box (%s)--> %s", box.GetFullName(), err)))
+		return err
+	}
+	fmt.Fprintf(w, lb.W(lb.DESTORYING, lb.INFO, fmt.Sprintf("--- destroying box (%s)OK", box.GetFullName())))
+	return carton.DoneNotify(box, w, alerts.DESTROYED, "")
+}
+
+func (p *kubernetesProvisioner) SetRunning(box *provision.Box, w io.Writer) error {
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- set state running box (%s)", box.GetFullName())))
+	args := runAppActionsArgs{
+		box:       box,
+		writer:    w,
+		appStatus: constants.StatusContainerRunning,
+		appState:  constants.StateRunning,
+	}
+	err := p.run(args, &appCreating, &updateStatusInScylla, &mileStoneUpdate)
+	if err != nil {
+		fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.ERROR, fmt.Sprintf("--- set state running pipeline for box (%s)\n --> %s", box.GetFullName(), err)))
+		return err
+	}
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- set state running box (%s)OK", box.GetFullName())))
+	return carton.DoneNotify(box, w, alerts.RUNNING, "")
+}
+
+func (p *kubernetesProvisioner) SetState(box *provision.Box, w io.Writer, changeto utils.Status) error {
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- stateto %s", box.GetFullName())))
+	if err := p.SetBoxStatus(box, w, changeto); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- stateto %s OK", box.GetFullName())))
+	return carton.DoneNotify(box, w, alerts.LAUNCHED, "")
+}
+
+func (p *kubernetesProvisioner) SetBoxStatus(box *provision.Box, w io.Writer, status utils.Status) error {
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- status %s box %s", box.GetFullName(), status.String())))
+	app := App{BoxName: box.GetFullName(), Id: box.Id, CartonId: box.CartonId, AccountId: box.AccountId, Level: box.Level}
+	if err := app.SetStatus(status); err != nil {
+		log.Errorf("error on set status for box %s - %s", box.GetFullName(), err)
+		return err
+	}
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- status %s box %s OK", box.GetFullName(), status.String())))
+	return nil
+}
+
+//op runs the lifecycle action, between the statuses of the request.
+func (p *kubernetesProvisioner) op(box *provision.Box, w io.Writer, kind, desc string, status utils.Status, act *action.Action) error {
+	fmt.Fprintf(w, lb.W(kind, lb.INFO, fmt.Sprintf("--- %s box (%s)", desc, box.GetFullName())))
+	args := runAppActionsArgs{
+		box:       box,
+		writer:    w,
+		appStatus: status,
+	}
+	if err := p.run(args, &appCreating, &updateStatusInScylla, act, &mileStoneUpdate, &updateStatusInScylla); err != nil {
+		fmt.Fprintf(w, lb.W(kind, lb.ERROR, fmt.Sprintf("--- %s box (%s)--> %s", desc, box.GetFullName(), err)))
+		return err
+	}
+	fmt.Fprintf(w, lb.W(kind, lb.INFO, fmt.Sprintf("--- %s box (%s)OK", desc, box.GetFullName())))
+	return nil
+}
+
+func (p *kubernetesProvisioner) Start(box *provision.Box, process string, w io.Writer) error {
+	return p.op(box, w, lb.STARTING, "starting", constants.StatusContainerStarting, &startApp)
+}
+
+func (p *kubernetesProvisioner) Stop(box *provision.Box, process string, w io.Writer) error {
+	return p.op(box, w, lb.STOPPING, "stopping", constants.StatusContainerStopping, &stopApp)
+}
+
+func (p *kubernetesProvisioner) Restart(box *provision.Box, process string, w io.Writer) error {
+	return p.op(box, w, lb.RESTARTING, "restarting", constants.StatusContainerStarting, &restartApp)
+}
+
+func (p *kubernetesProvisioner) Suspend(box *provision.Box, process string, w io.Writer) error {
+	return provision.ErrNotImplemented
+}
+
+//Resize changes the resources of the pod, a running box is rolled over with them.
+func (p *kubernetesProvisioner) Resize(box *provision.Box, to provision.BoxCompute, w io.Writer) error {
+	fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("--- resize box (%s, %s -> %s)", box.GetFullName(), box.Compute.String(), to.String())))
+	args := runAppActionsArgs{
+		box:       box,
+		writer:    w,
+		appStatus: statusResizing,
+		compute:   to,
+	}
+	if err := p.run(args, &appCreating, &updateStatusInScylla, &resizeApp, &updateStatusInScylla); err != nil {
+		fmt.Fprintf(w, lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("--- resize box (%s)--> %s", box.GetFullName(), err)))
+		return err
+	}
+	fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("--- resize box (%s)OK", box.GetFullName())))
+	return nil
+}
+
+func (p *kubernetesProvisioner) CreateSnapshot(box *provision.Box, w io.Writer) error {
+	return provision.ErrNotImplemented
+}
+
+func (p *kubernetesProvisioner) DeleteSnapshot(box *provision.Box, w io.Writer) error {
+	return provision.ErrNotImplemented
+}
+
+func (p *kubernetesProvisioner) RestoreSnapshot(box *provision.Box, w io.Writer) error {
+	return provision.ErrNotImplemented
+}
+
+func (p *kubernetesProvisioner) AttachDisk(box *provision.Box, w io.Writer) error {
+	return provision.ErrNotImplemented
+}
+
+func (p *kubernetesProvisioner) DetachDisk(box *provision.Box, w io.Writer) error {
+	return provision.ErrNotImplemented
+}
+
+func (p *kubernetesProvisioner) SaveImage(box *provision.Box, w io.Writer) error {
+	return provision.ErrNotImplemented
+}
+
+func (p *kubernetesProvisioner) DeleteImage(box *provision.Box, w io.Writer) error {
+	return provision.ErrNotImplemented
+}
+
+//Shell runs bash, or sh when the image has none, in the pod of the box.
+func (p *kubernetesProvisioner) Shell(opts provision.ShellOptions) error {
+	app, c, err := p.app(opts.Box)
+	if err != nil {
+		return err
+	}
+	term := opts.Term
+	if term == "" {
+		term = "xterm"
+	}
+	done := make(chan struct{})
+	defer close(done)
+	return app.Exec(c, cluster.ExecOptions{
+		Command: []string{"/usr/bin/env", "TERM=" + term, "/bin/sh", "-c", "[ -x /bin/bash ] && exec /bin/bash || exec /bin/sh"},
+		Stdin:   opts.Conn,
+		Stdout:  opts.Conn,
+		Stderr:  opts.Conn,
+		Tty:     true,
+		Size:    cluster.Size{Width: uint16(opts.Width), Height: uint16(opts.Height)},
+		Resize:  sizes(opts.Resize, done),
+	})
+}
+
+//sizes hands the sizes of the terminal of the client over to the tty, until
+//the client or the shell ends.
+func sizes(in <-chan provision.TermSize, done <-chan struct{}) <-chan cluster.Size {
+	if in == nil {
+		return nil
+	}
+	out := make(chan cluster.Size)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case s, ok := <-in:
+				if !ok {
+					return
+				}
+				select {
+				case out <- cluster.Size{Width: uint16(s.Width), Height: uint16(s.Height)}:
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func (p *kubernetesProvisioner) ExecuteCommandOnce(stdout, stderr io.Writer, box *provision.Box, cmd string, args ...string) error {
+	app, c, err := p.app(box)
+	if err != nil {
+		return err
+	}
+	return app.Exec(c, cluster.ExecOptions{Command: append([]string{cmd}, args...), Stdout: stdout, Stderr: stderr})
+}
+
+//Logs copies the log of the pod of the box to w, until the pod ends when it follows.
+func (p *kubernetesProvisioner) Logs(box *provision.Box, w io.Writer, follow bool) error {
+	app, c, err := p.app(box)
+	if err != nil {
+		return err
+	}
+	return app.Logs(c, w, follow)
+}
+
+//Addr is the cluster ip of the service of the box.
+func (p *kubernetesProvisioner) Addr(box *provision.Box) (string, error) {
+	app, c, err := p.app(box)
+	if err != nil {
+		return "", err
+	}
+	if err = app.Network(c); err != nil {
+		return "", err
+	}
+	if app.ClusterIP == "" || app.ClusterIP == corev1.ClusterIPNone {
+		return "", provision.ErrBoxNotFound
+	}
+	return app.ClusterIP, nil
+}
+
+func (p *kubernetesProvisioner) MetricEnvs(start int64, end int64, region string, w io.Writer) ([]interface{}, error) {
+	return nil, nil
+}
+
+func (p *kubernetesProvisioner) TriggerBills(account_id, cat_id, name string) error {
+	return nil
+}
@@ -0,0 +1,145 @@
+package kubernetes
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/virtengine/vertice/provision"
+	"github.com/virtengine/vertice/provision/kubernetes/cluster"
+	"gopkg.in/check.v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func (s *S) provisioner(c *check.C, regions ...cluster.Region) *kubernetesProvisioner {
+	p := &kubernetesProvisioner{connect: func(r cluster.Region) (*cluster.Cluster, error) {
+		return &cluster.Cluster{Region: r, Client: s.client, Streams: s.streams}, nil
+	}}
+	c.Assert(p.Initialize(Kubernetes{Enabled: true, Regions: regions}), check.IsNil)
+	return p
+}
+
+//conn is the websocket of a shell, it reads what the user typed.
+type conn struct {
+	io.Reader
+	bytes.Buffer
+}
+
+func (c *conn) Read(b []byte) (int, error) { return c.Reader.Read(b) }
+func (c *conn) Close() error               { return nil }
+
+func (s *S) TestInitialize(c *check.C) {
+	p := s.provisioner(c, cluster.Region{Zone: "k8s1"})
+	c.Assert(p.String(), check.Equals, "ready")
+	c.Assert(p.clusters["k8s1"].Namespace, check.Equals, "default")
+	c.Assert(p.clusters["k8s1"].ServiceType, check.Equals, "ClusterIP")
+
+	c.Assert((&kubernetesProvisioner{}).Initialize("kubernetes"), check.NotNil)
+	err := (&kubernetesProvisioner{}).Initialize(Kubernetes{Regions: []cluster.Region{{Master: "https://10.0.0.2:6443"}}})
+	c.Assert(err, check.ErrorMatches, "kubernetes region needs a zone")
+	p = &kubernetesProvisioner{connect: func(r cluster.Region) (*cluster.Cluster, error) {
+		return nil, errors.New("no kubeconfig")
+	}}
+	err = p.Initialize(Kubernetes{Regions: []cluster.Region{{Zone: "k8s1"}}})
+	c.Assert(err, check.ErrorMatches, `kubernetes region "k8s1": no kubeconfig`)
+}
+
+func (s *S) TestCluster(c *check.C) {
+	p := s.provisioner(c, s.cluster.Region)
+	box := s.box()
+	cl, err := p.cluster(box)
+	c.Assert(err, check.IsNil)
+	c.Assert(cl.Namespace, check.Equals, "boxes")
+	box.Region = ""
+	_, err = p.cluster(box)
+	c.Assert(err, check.IsNil)
+	box.Region = "k8s2"
+	_, err = p.cluster(box)
+	c.Assert(err, check.ErrorMatches, `no kubernetes cluster for the region "k8s2" of box web1.megam.io`)
+
+	p = s.provisioner(c, s.cluster.Region, cluster.Region{Zone: "k8s2"})
+	box.Region = ""
+	_, err = p.cluster(box)
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestCapabilities(c *check.C) {
+	p := s.provisioner(c, s.cluster.Region)
+	c.Assert(provision.Capabilities(p), check.DeepEquals, []provision.Capability{
+		provision.CapDeploy, provision.CapDestroy, provision.CapResize, provision.CapRestart,
+		provision.CapShell, provision.CapStart, provision.CapStop, provision.CapUpgrade})
+	c.Assert(provision.Supports(p, provision.CapSnapshot), check.Equals, false)
+}
+
+func (s *S) TestDeployWithoutImage(c *check.C) {
+	p := s.provisioner(c, s.cluster.Region)
+	box := s.box()
+	box.Repo = nil
+	_, err := p.ImageDeploy(box, "", ioutil.Discard)
+	c.Assert(err, check.ErrorMatches, "no image to deploy box web1.megam.io")
+}
+
+func (s *S) TestShell(c *check.C) {
+	p := s.provisioner(c, s.cluster.Region)
+	opts := provision.ShellOptions{Box: s.box(), Conn: &conn{Reader: strings.NewReader("ls\n")}, Width: 140, Height: 38}
+	c.Assert(p.Shell(opts), check.Equals, provision.ErrBoxNotFound)
+
+	s.forward(c, &appCreating, &createDeployment)
+	s.available(c, corev1.PodRunning, "")
+	s.streams.Output = "$ "
+	resize := make(chan provision.TermSize, 2)
+	resize <- provision.TermSize{Width: 80, Height: 24}
+	resize <- provision.TermSize{Width: 200, Height: 50}
+	close(resize)
+	opts.Resize = resize
+	opts.Term = "xterm-256color"
+	c.Assert(p.Shell(opts), check.IsNil)
+	execs := s.streams.Execs()
+	c.Assert(execs, check.HasLen, 1)
+	c.Assert(execs[0].Namespace, check.Equals, "boxes")
+	c.Assert(execs[0].Pod, check.Equals, "box1-5d8f")
+	c.Assert(execs[0].Input, check.Equals, "ls\n")
+	c.Assert(execs[0].Opts.Container, check.Equals, containerName)
+	c.Assert(execs[0].Opts.Command[:2], check.DeepEquals, []string{"/usr/bin/env", "TERM=xterm-256color"})
+	c.Assert(execs[0].Opts.Tty, check.Equals, true)
+	c.Assert(execs[0].Opts.Size, check.Equals, cluster.Size{Width: 140, Height: 38})
+	c.Assert(execs[0].Sizes, check.DeepEquals, []cluster.Size{{Width: 80, Height: 24}, {Width: 200, Height: 50}})
+	c.Assert(opts.Conn.(*conn).String(), check.Equals, "$ ")
+}
+
+func (s *S) TestExecuteCommandOnce(c *check.C) {
+	p := s.provisioner(c, s.cluster.Region)
+	s.forward(c, &appCreating, &createDeployment)
+	s.available(c, corev1.PodRunning, "")
+	s.streams.Output = "Linux\n"
+	var stdout, stderr bytes.Buffer
+	c.Assert(p.ExecuteCommandOnce(&stdout, &stderr, s.box(), "uname", "-s"), check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "Linux\n")
+	execs := s.streams.Execs()
+	c.Assert(execs[0].Opts.Command, check.DeepEquals, []string{"uname", "-s"})
+	c.Assert(execs[0].Opts.Tty, check.Equals, false)
+}
+
+func (s *S) TestAddr(c *check.C) {
+	p := s.provisioner(c, s.cluster.Region)
+	s.forward(c, &appCreating, &createDeployment, &exposeApp)
+	_, err := p.Addr(s.box())
+	c.Assert(err, check.Equals, provision.ErrBoxNotFound)
+	svc, err := s.client.CoreV1().Services("boxes").Get("box1", metav1.GetOptions{})
+	c.Assert(err, check.IsNil)
+	svc.Spec.ClusterIP = "10.96.0.12"
+	_, err = s.client.CoreV1().Services("boxes").Update(svc)
+	c.Assert(err, check.IsNil)
+	addr, err := p.Addr(s.box())
+	c.Assert(err, check.IsNil)
+	c.Assert(addr, check.Equals, "10.96.0.12")
+}
+
+func (s *S) TestNotImplemented(c *check.C) {
+	p := s.provisioner(c, s.cluster.Region)
+	c.Assert(p.CreateSnapshot(s.box(), nil), check.Equals, provision.ErrNotImplemented)
+	c.Assert(p.Suspend(s.box(), "", nil), check.Equals, provision.ErrNotImplemented)
+}
@@ -0,0 +1,377 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package libvirt
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/libgo/action"
+	"github.com/virtengine/libgo/events/alerts"
+	"github.com/virtengine/libgo/utils"
+	constants "github.com/virtengine/libgo/utils"
+	"github.com/virtengine/vertice/carton"
+	lb "github.com/virtengine/vertice/logbox"
+	"github.com/virtengine/vertice/provision"
+	"github.com/virtengine/vertice/provision/libvirt/virt"
+)
+
+type runMachineActionsArgs struct {
+	box           *provision.Box
+	writer        io.Writer
+	imageId       string
+	isDeploy      bool
+	machineStatus utils.Status
+	machineState  utils.State
+	conn          virt.Conn
+	host          Host
+}
+
+func (a runMachineActionsArgs) w() io.Writer {
+	if a.writer == nil {
+		return ioutil.Discard
+	}
+	return a.writer
+}
+
+var machCreating = action.Action{
+	Name: "machine-struct-creating",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(runMachineActionsArgs)
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" creating struct machine (%s, %s)", args.box.GetFullName(), args.machineStatus.String())))
+		mach := Machine{
+			Name:      args.box.GetFullName(),
+			Id:        args.box.Id,
+			CartonId:  args.box.CartonId,
+			CartonsId: args.box.CartonsId,
+			AccountId: args.box.AccountId,
+			Region:    args.host.Zone,
+			Level:     args.box.Level,
+			Image:     args.imageId,
+			Compute:   args.box.Compute,
+			Status:    args.machineStatus,
+			State:     args.machineState,
+		}
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" creating struct machine (%s, %s)OK", args.box.GetFullName(), args.machineStatus.String())))
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+}
+
+var updateStatusInScylla = action.Action{
+	Name: "update-status-scylla",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(runMachineActionsArgs)
+		mach := ctx.Previous.(Machine)
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" update status for machine (%s, %s)", args.box.GetFullName(), mach.Status.String())))
+		if err := mach.SetStatus(mach.Status); err != nil {
+			fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.ERROR, fmt.Sprintf(" fails to update status for machine (%s, %s) %v", args.box.GetFullName(), mach.Status.String(), err)))
+		} else {
+			fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" update status for machine (%s, %s)OK", args.box.GetFullName(), mach.Status.String())))
+		}
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		c := ctx.FWResult.(Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		status := constants.StatusError
+		if args.isDeploy {
+			status = constants.StatusPreError
+			_ = carton.DoneNotify(args.box, args.w(), alerts.FAILURE, ctx.CauseOf.Error())
+		}
+		c.SetStatusErr(status, ctx.CauseOf)
+	},
+}
+
+var mileStoneUpdate = action.Action{
+	Name: "change-milestone-state",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" update milestone state for machine (%s, %s)", args.box.GetFullName(), mach.State.String())))
+		if err := mach.SetMileStone(mach.State); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" update milestone state for machine (%s, %s)OK", args.box.GetFullName(), mach.State.String())))
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		c := ctx.FWResult.(Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		if args.isDeploy {
+			if err := c.SetMileStone(constants.StatePreError); err != nil {
+				log.Errorf("---- [state-change:Backward]\n     %s", err.Error())
+			}
+		}
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var rollbackNotice = func(ctx action.FWContext, err error) {
+	args := ctx.Params[0].(runMachineActionsArgs)
+	fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.ERROR, fmt.Sprintf("==> ROLLBACK     %s", err)))
+}
+
+var createRootDisk = action.Action{
+	Name: "create-root-disk",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" create root disk for box (%s, image:%s)/%s", args.box.GetFullName(), mach.Image, mach.Compute)))
+		if err := mach.CreateRoot(args.conn, args.host); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" create root disk for box (%s, %s)OK", args.box.GetFullName(), mach.Disk)))
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		c := ctx.FWResult.(Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		if err := c.RemoveRoot(args.conn, args.host); err != nil {
+			fmt.Fprintf(args.w(), lb.W(lb.DESTORYING, lb.ERROR, fmt.Sprintf("  removing root disk %s", err.Error())))
+		}
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var defineMachine = action.Action{
+	Name: "define-machine",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" define machine for box (%s) on %s", args.box.GetFullName(), args.host.Zone)))
+		if err := mach.Define(args.conn, args.host); err != nil {
+			return nil, err
+		}
+		mach.State = constants.StateInitialized
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" define machine for box (%s) on %s OK", args.box.GetFullName(), args.host.Zone)))
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		c := ctx.FWResult.(Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		if err := c.Remove(args.conn, args.host); err != nil {
+			fmt.Fprintf(args.w(), lb.W(lb.DESTORYING, lb.ERROR, fmt.Sprintf("  removing err machine %s", err.Error())))
+		}
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var bootMachine = action.Action{
+	Name: "boot-machine",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" boot machine (%s)", mach.Name)))
+		if err := mach.Start(args.conn); err != nil {
+			return nil, err
+		}
+		mach.Status = constants.StatusLaunched
+		mach.State = constants.StateRunning
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" boot machine (%s)OK", mach.Name)))
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var updateNetworkIps = action.Action{
+	Name: "update-vm-assigned-ips",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" wait for the address of machine (%s)", mach.Name)))
+		if err := mach.WaitAddrs(args.conn, args.host); err != nil {
+			return nil, err
+		}
+		if err := mach.SetOutputs(args.host); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(args.w(), lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf(" wait for the address of machine (%s, %v)OK", mach.Name, mach.Addrs)))
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var destroyOldMachine = action.Action{
+	Name: "destroy-old-machine",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		fmt.Fprintf(args.w(), lb.W(lb.DESTORYING, lb.INFO, fmt.Sprintf("  destroying old machine %s ----", mach.Name)))
+		if err := mach.Remove(args.conn, args.host); err != nil {
+			fmt.Fprintf(args.w(), lb.W(lb.DESTORYING, lb.ERROR, fmt.Sprintf("  destroying old machine (%s)--> %s", mach.Name, err)))
+			return nil, err
+		}
+		mach.Status = constants.StatusDestroyed
+		mach.State = constants.StateDestroyed
+		fmt.Fprintf(args.w(), lb.W(lb.DESTORYING, lb.INFO, fmt.Sprintf("  destroyed old machine (%s, %s)OK", mach.Id, mach.Name)))
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+//lifecycle runs op on the machine, and sets the status and state it ends in.
+func lifecycle(name, kind string, op func(*Machine, virt.Conn) error, status utils.Status, state utils.State) action.Action {
+	return action.Action{
+		Name: name,
+		Forward: func(ctx action.FWContext) (action.Result, error) {
+			mach := ctx.Previous.(Machine)
+			args := ctx.Params[0].(runMachineActionsArgs)
+			fmt.Fprintf(args.w(), lb.W(kind, lb.INFO, fmt.Sprintf("  %s %s", name, mach.Name)))
+			if err := op(&mach, args.conn); err != nil {
+				fmt.Fprintf(args.w(), lb.W(kind, lb.ERROR, fmt.Sprintf("  error %s ( %s)", name, args.box.GetFullName())))
+				return nil, err
+			}
+			mach.Status = status
+			if state != "" {
+				mach.State = state
+			}
+			fmt.Fprintf(args.w(), lb.W(kind, lb.INFO, fmt.Sprintf("  %s (%s, %s) OK", name, mach.Id, mach.Name)))
+			return mach, nil
+		},
+		Backward: func(ctx action.BWContext) {
+		},
+		OnError:   rollbackNotice,
+		MinParams: 1,
+	}
+}
+
+var (
+	startMachine   = lifecycle("start-machine", lb.STARTING, (*Machine).Start, constants.StatusStarted, constants.StateRunning)
+	stopMachine    = lifecycle("stop-machine", lb.STOPPING, (*Machine).Stop, constants.StatusStopped, constants.StateStopped)
+	restartMachine = lifecycle("restart-machine", lb.RESTARTING, (*Machine).Restart, constants.StatusStarted, constants.StateRunning)
+	suspendMachine = lifecycle("suspend-machine", lb.STOPPING, (*Machine).Suspend, constants.StatusSuspended, "")
+
+	createSnapshot  = lifecycle("create-snapshot", lb.UPDATING, (*Machine).CreateSnapshot, constants.StatusSnapCreated, "")
+	restoreSnapshot = lifecycle("restore-snapshot", lb.UPDATING, (*Machine).RestoreSnapshot, constants.StatusSnapRestored, "")
+	removeSnapshot  = lifecycle("remove-snapshot", lb.UPDATING, (*Machine).RemoveSnapshot, constants.StatusSnapDeleted, "")
+)
+
+var updateSnapStatus = action.Action{
+	Name: "update-snap-status",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		fmt.Fprintf(args.w(), lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf(" update snapshot status for machine (%s, %s)", args.box.GetFullName(), mach.Status)))
+		if err := mach.UpdateSnapStatus(mach.Status); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(args.w(), lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf(" update snapshot status for machine (%s, %s)OK", args.box.GetFullName(), mach.Status)))
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var updateIdInSnapTable = action.Action{
+	Name: "update-snap-table",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		if err := mach.UpdateSnap(); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(args.w(), lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf(" update snapshot %s for machine (%s)OK", mach.CartonsId, args.box.GetFullName())))
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		c := ctx.FWResult.(Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		if err := c.RemoveSnapshot(args.conn); err != nil {
+			fmt.Fprintf(args.w(), lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("  snapshot remove failure error (%s)   %s", c.Name, err.Error())))
+		}
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var removeSnapInScylla = action.Action{
+	Name: "remove-snap-scylla",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(Machine)
+		if err := mach.RemoveSnap(); err != nil {
+			return nil, err
+		}
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var addNewStorage = action.Action{
+	Name: "add-new-storage",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		fmt.Fprintf(args.w(), lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  attaching new disk to machine %s ----", mach.Name)))
+		size, err := mach.DiskSize()
+		if err != nil {
+			return nil, err
+		}
+		dev, err := mach.AttachDisk(args.conn, args.host, size)
+		if err != nil {
+			return nil, err
+		}
+		if err = mach.UpdateDisk(dev); err != nil {
+			return nil, err
+		}
+		mach.Status = constants.StatusRunning
+		fmt.Fprintf(args.w(), lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  attaching new disk to machine (%s, %s) OK", mach.Name, dev)))
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var removeDiskStorage = action.Action{
+	Name: "remove-disk-storage",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		fmt.Fprintf(args.w(), lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf(" remove disk from machine (%s)", args.box.GetFullName())))
+		if err := mach.DetachDisk(args.conn, args.host); err != nil {
+			return nil, err
+		}
+		mach.Status = constants.StatusDiskDetached
+		fmt.Fprintf(args.w(), lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf(" remove disk from machine (%s)OK", args.box.GetFullName())))
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
@@ -0,0 +1,427 @@
+// Package libvirttest is an in memory libvirtd, for the tests of the libvirt
+// provisioner.
+package libvirttest
+
+import (
+	"fmt"
+	"path"
+	"sync"
+
+	"github.com/virtengine/vertice/provision/libvirt/virt"
+)
+
+const poolDir = "/var/lib/libvirt/images"
+
+// FakeDomain is a domain the fake defined.
+type FakeDomain struct {
+	Domain    virt.Domain
+	State     virt.State
+	Snapshots []string
+	Addrs     []string
+}
+
+// FakeConn implements virt.Conn, the volumes of a pool are files under
+// /var/lib/libvirt/images/<pool>.
+type FakeConn struct {
+	// Addrs are the addresses a domain gets once started.
+	Addrs []string
+	// IgnoreShutdown makes the guests ignore the power button.
+	IgnoreShutdown bool
+
+	mu       sync.Mutex
+	domains  map[string]*FakeDomain
+	volumes  map[string]virt.Volume
+	calls    []string
+	failures map[string]error
+	closed   bool
+}
+
+var _ virt.Conn = &FakeConn{}
+
+func NewFakeConn() *FakeConn {
+	return &FakeConn{
+		Addrs:    []string{"192.168.122.10"},
+		domains:  make(map[string]*FakeDomain),
+		volumes:  make(map[string]virt.Volume),
+		failures: make(map[string]error),
+	}
+}
+
+// AddVolume puts an image in the pool, as the admin of the host does.
+func (f *FakeConn) AddVolume(pool, name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.volumes[volumePath(pool, name)] = virt.Volume{Name: name}
+}
+
+// FailOn makes the method fail with err.
+func (f *FakeConn) FailOn(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[method] = err
+}
+
+// Calls returns the methods called, in order.
+func (f *FakeConn) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.calls...)
+}
+
+// Domain returns a copy of the domain, nil once undefined.
+func (f *FakeConn) Domain(name string) *FakeDomain {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if d, ok := f.domains[name]; ok {
+		c := *d
+		return &c
+	}
+	return nil
+}
+
+// Volume returns the volume at path.
+func (f *FakeConn) Volume(path string) (virt.Volume, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.volumes[path]
+	return v, ok
+}
+
+func (f *FakeConn) Closed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed
+}
+
+func volumePath(pool, name string) string {
+	return path.Join(poolDir, pool, name)
+}
+
+//call records the method and returns its failure, the lock is held until unlock.
+func (f *FakeConn) call(method string) (func(), error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, method)
+	return f.mu.Unlock, f.failures[method]
+}
+
+func (f *FakeConn) domain(name string) (*FakeDomain, error) {
+	d, ok := f.domains[name]
+	if !ok {
+		return nil, virt.ErrDomainNotFound
+	}
+	return d, nil
+}
+
+//to moves the domain to state when it is in one of from.
+func (f *FakeConn) to(method, name string, state virt.State, from ...virt.State) error {
+	unlock, err := f.call(method)
+	defer unlock()
+	if err != nil {
+		return err
+	}
+	d, err := f.domain(name)
+	if err != nil {
+		return err
+	}
+	for _, s := range from {
+		if d.State == s {
+			d.State = state
+			if state == virt.Running {
+				d.Addrs = f.Addrs
+			} else if state == virt.Shutoff {
+				d.Addrs = nil
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("domain %s is %s, can't %s", name, d.State, method)
+}
+
+func (f *FakeConn) DefineDomain(xml string) error {
+	unlock, err := f.call("DefineDomain")
+	defer unlock()
+	if err != nil {
+		return err
+	}
+	d, err := virt.ParseDomain(xml)
+	if err != nil {
+		return err
+	}
+	for _, k := range d.Devices.Disks {
+		if _, ok := f.volumes[k.Source.File]; !ok {
+			return fmt.Errorf("domain %s: no volume %s", d.Name, k.Source.File)
+		}
+	}
+	if old, ok := f.domains[d.Name]; ok {
+		old.Domain = *d
+		return nil
+	}
+	f.domains[d.Name] = &FakeDomain{Domain: *d, State: virt.Shutoff}
+	return nil
+}
+
+func (f *FakeConn) UndefineDomain(name string) error {
+	unlock, err := f.call("UndefineDomain")
+	defer unlock()
+	if err != nil {
+		return err
+	}
+	d, err := f.domain(name)
+	if err != nil {
+		return err
+	}
+	if d.State != virt.Shutoff {
+		return fmt.Errorf("domain %s is %s, destroy it first", name, d.State)
+	}
+	delete(f.domains, name)
+	return nil
+}
+
+func (f *FakeConn) DomainXML(name string) (string, error) {
+	unlock, err := f.call("DomainXML")
+	defer unlock()
+	if err != nil {
+		return "", err
+	}
+	d, err := f.domain(name)
+	if err != nil {
+		return "", err
+	}
+	c := d.Domain
+	if d.State == virt.Running || d.State == virt.Paused {
+		c.Devices.Graphics = append([]virt.Graphics{}, c.Devices.Graphics...)
+		for i := range c.Devices.Graphics {
+			c.Devices.Graphics[i].Port = 5900 + i
+		}
+	}
+	return c.XML()
+}
+
+func (f *FakeConn) DomainState(name string) (virt.State, error) {
+	unlock, err := f.call("DomainState")
+	defer unlock()
+	if err != nil {
+		return virt.NoState, err
+	}
+	d, err := f.domain(name)
+	if err != nil {
+		return virt.NoState, err
+	}
+	return d.State, nil
+}
+
+func (f *FakeConn) DomainAddrs(name string) ([]string, error) {
+	unlock, err := f.call("DomainAddrs")
+	defer unlock()
+	if err != nil {
+		return nil, err
+	}
+	d, err := f.domain(name)
+	if err != nil {
+		return nil, err
+	}
+	return d.Addrs, nil
+}
+
+func (f *FakeConn) StartDomain(name string) error {
+	return f.to("StartDomain", name, virt.Running, virt.Shutoff, virt.Crashed)
+}
+
+//the guest powers off at once, unless it ignores the power button.
+func (f *FakeConn) ShutdownDomain(name string) error {
+	to := virt.Shutoff
+	if f.IgnoreShutdown {
+		to = virt.Running
+	}
+	return f.to("ShutdownDomain", name, to, virt.Running)
+}
+
+func (f *FakeConn) DestroyDomain(name string) error {
+	return f.to("DestroyDomain", name, virt.Shutoff, virt.Running, virt.Paused, virt.Blocked, virt.Crashed)
+}
+
+func (f *FakeConn) RebootDomain(name string) error {
+	return f.to("RebootDomain", name, virt.Running, virt.Running)
+}
+
+func (f *FakeConn) SuspendDomain(name string) error {
+	return f.to("SuspendDomain", name, virt.Paused, virt.Running)
+}
+
+func (f *FakeConn) ResumeDomain(name string) error {
+	return f.to("ResumeDomain", name, virt.Running, virt.Paused)
+}
+
+func (f *FakeConn) AttachDevice(name, xml string) error {
+	unlock, err := f.call("AttachDevice")
+	defer unlock()
+	if err != nil {
+		return err
+	}
+	d, err := f.domain(name)
+	if err != nil {
+		return err
+	}
+	k, err := parseDisk(xml)
+	if err != nil {
+		return err
+	}
+	if _, ok := f.volumes[k.Source.File]; !ok {
+		return fmt.Errorf("domain %s: no volume %s", name, k.Source.File)
+	}
+	if _, ok := d.Domain.DiskBySource(k.Source.File); ok {
+		return fmt.Errorf("domain %s: %s is attached", name, k.Source.File)
+	}
+	d.Domain.Devices.Disks = append(d.Domain.Devices.Disks, k)
+	return nil
+}
+
+func (f *FakeConn) DetachDevice(name, xml string) error {
+	unlock, err := f.call("DetachDevice")
+	defer unlock()
+	if err != nil {
+		return err
+	}
+	d, err := f.domain(name)
+	if err != nil {
+		return err
+	}
+	k, err := parseDisk(xml)
+	if err != nil {
+		return err
+	}
+	disks := d.Domain.Devices.Disks[:0]
+	for _, o := range d.Domain.Devices.Disks {
+		if o.Source.File != k.Source.File {
+			disks = append(disks, o)
+		}
+	}
+	if len(disks) == len(d.Domain.Devices.Disks) {
+		return fmt.Errorf("domain %s: %s is not attached", name, k.Source.File)
+	}
+	d.Domain.Devices.Disks = disks
+	return nil
+}
+
+func parseDisk(s string) (virt.Disk, error) {
+	d, err := virt.ParseDomain("<domain><devices>" + s + "</devices></domain>")
+	if err != nil {
+		return virt.Disk{}, err
+	}
+	if len(d.Devices.Disks) != 1 {
+		return virt.Disk{}, fmt.Errorf("not a disk: %s", s)
+	}
+	return d.Devices.Disks[0], nil
+}
+
+func (f *FakeConn) CreateVolume(pool, xml string) (string, error) {
+	unlock, err := f.call("CreateVolume")
+	defer unlock()
+	if err != nil {
+		return "", err
+	}
+	v, err := virt.ParseVolume(xml)
+	if err != nil {
+		return "", err
+	}
+	if v.BackingStore != nil {
+		if _, ok := f.volumes[v.BackingStore.Path]; !ok {
+			return "", fmt.Errorf("volume %s: no backing store %s", v.Name, v.BackingStore.Path)
+		}
+	}
+	p := volumePath(pool, v.Name)
+	if _, ok := f.volumes[p]; ok {
+		return "", fmt.Errorf("volume %s exists", p)
+	}
+	f.volumes[p] = *v
+	return p, nil
+}
+
+func (f *FakeConn) VolumePath(pool, name string) (string, error) {
+	unlock, err := f.call("VolumePath")
+	defer unlock()
+	if err != nil {
+		return "", err
+	}
+	p := volumePath(pool, name)
+	if _, ok := f.volumes[p]; !ok {
+		return "", virt.ErrVolumeNotFound
+	}
+	return p, nil
+}
+
+func (f *FakeConn) DeleteVolume(pool, name string) error {
+	unlock, err := f.call("DeleteVolume")
+	defer unlock()
+	if err != nil {
+		return err
+	}
+	p := volumePath(pool, name)
+	if _, ok := f.volumes[p]; !ok {
+		return virt.ErrVolumeNotFound
+	}
+	delete(f.volumes, p)
+	return nil
+}
+
+func (f *FakeConn) CreateSnapshot(name, xml string) error {
+	unlock, err := f.call("CreateSnapshot")
+	defer unlock()
+	if err != nil {
+		return err
+	}
+	d, err := f.domain(name)
+	if err != nil {
+		return err
+	}
+	s, err := virt.ParseSnapshot(xml)
+	if err != nil {
+		return err
+	}
+	d.Snapshots = append(d.Snapshots, s.Name)
+	return nil
+}
+
+func (f *FakeConn) RevertSnapshot(name, snapshot string) error {
+	unlock, err := f.call("RevertSnapshot")
+	defer unlock()
+	if err != nil {
+		return err
+	}
+	d, err := f.domain(name)
+	if err != nil {
+		return err
+	}
+	for _, s := range d.Snapshots {
+		if s == snapshot {
+			return nil
+		}
+	}
+	return virt.ErrSnapshotNotFound
+}
+
+func (f *FakeConn) DeleteSnapshot(name, snapshot string) error {
+	unlock, err := f.call("DeleteSnapshot")
+	defer unlock()
+	if err != nil {
+		return err
+	}
+	d, err := f.domain(name)
+	if err != nil {
+		return err
+	}
+	for i, s := range d.Snapshots {
+		if s == snapshot {
+			d.Snapshots = append(d.Snapshots[:i], d.Snapshots[i+1:]...)
+			return nil
+		}
+	}
+	return virt.ErrSnapshotNotFound
+}
+
+func (f *FakeConn) Close() error {
+	unlock, err := f.call("Close")
+	defer unlock()
+	f.closed = true
+	return err
+}
@@ -0,0 +1,519 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package libvirt
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/libgo/safe"
+	"github.com/virtengine/libgo/utils"
+	constants "github.com/virtengine/libgo/utils"
+	"github.com/virtengine/vertice/carton"
+	"github.com/virtengine/vertice/provision"
+	"github.com/virtengine/vertice/provision/libvirt/virt"
+)
+
+//how long the domains get to boot, lease an address or power off.
+var (
+	waitTimeout  = 10 * time.Minute
+	waitInterval = 5 * time.Second
+)
+
+// Machine is a box running as a domain of a kvm host, the domain is named
+// after the box.
+type Machine struct {
+	Name      string
+	Id        string
+	CartonId  string
+	CartonsId string
+	AccountId string
+	Region    string
+	Level     provision.BoxLevel
+	Image     string
+	Compute   provision.BoxCompute
+	Disk      string
+	Addrs     []string
+	VNCPort   int
+	VNCPasswd string
+	Status    utils.Status
+	State     utils.State
+}
+
+func (m *Machine) rootVolume() string {
+	return m.Name + ".qcow2"
+}
+
+//the volume of the disk attached for the request cartonsId.
+func (m *Machine) diskVolume() string {
+	return m.Name + "-" + m.CartonsId + ".qcow2"
+}
+
+func (m *Machine) domain(h Host) *virt.Domain {
+	nic := virt.Interface{Type: "network", Source: virt.InterfaceSource{Network: h.Network}, Model: virt.InterfaceModel{Type: "virtio"}}
+	if h.Bridge != "" {
+		nic = virt.Interface{Type: "bridge", Source: virt.InterfaceSource{Bridge: h.Bridge}, Model: virt.InterfaceModel{Type: "virtio"}}
+	}
+	return &virt.Domain{
+		Type:   "kvm",
+		Name:   m.Name,
+		Memory: virt.Size{Unit: "MiB", Value: m.Compute.Memory.MB()},
+		VCPU:   m.Compute.Cpushare,
+		OS: virt.OS{
+			Type: virt.OSType{Arch: "x86_64", Value: "hvm"},
+			Boot: []virt.Boot{{Dev: "hd"}},
+		},
+		Features: virt.Features{ACPI: &struct{}{}, APIC: &struct{}{}},
+		Devices: virt.Devices{
+			Disks: []virt.Disk{{
+				Type:   "file",
+				Device: "disk",
+				Driver: virt.DiskDriver{Name: "qemu", Type: "qcow2"},
+				Source: virt.DiskSource{File: m.Disk},
+				Target: virt.DiskTarget{Dev: "vda", Bus: "virtio"},
+			}},
+			Interfaces: []virt.Interface{nic},
+			Graphics:   []virt.Graphics{{Type: "vnc", Port: -1, AutoPort: "yes", Listen: h.Listen(), Passwd: m.VNCPasswd}},
+		},
+	}
+}
+
+//CreateRoot makes the root disk a copy on write of the image, both in the pool of the host.
+func (m *Machine) CreateRoot(c virt.Conn, h Host) error {
+	log.Debugf("  creating root disk of machine (%s, %s)", m.Name, m.Image)
+	base, err := c.VolumePath(h.Pool, m.Image)
+	if err != nil {
+		return fmt.Errorf("image %s in pool %s: %s", m.Image, h.Pool, err)
+	}
+	vol := &virt.Volume{
+		Name:         m.rootVolume(),
+		Capacity:     virt.Size{Unit: "MiB", Value: m.Compute.HDD.MB()},
+		Target:       virt.VolumeTarget{Format: virt.Format{Type: "qcow2"}},
+		BackingStore: &virt.BackingStore{Path: base, Format: virt.Format{Type: "qcow2"}},
+	}
+	x, err := vol.XML()
+	if err != nil {
+		return err
+	}
+	m.Disk, err = c.CreateVolume(h.Pool, x)
+	return err
+}
+
+func (m *Machine) RemoveRoot(c virt.Conn, h Host) error {
+	return ignoreNotFound(c.DeleteVolume(h.Pool, m.rootVolume()))
+}
+
+//Define makes the domain with a vnc password of its own, the console is
+//reached by whoever gets to the management network of the host.
+func (m *Machine) Define(c virt.Conn, h Host) error {
+	if m.VNCPasswd == "" {
+		passwd, err := vncPasswd()
+		if err != nil {
+			return err
+		}
+		m.VNCPasswd = passwd
+	}
+	x, err := m.domain(h).XML()
+	if err != nil {
+		return err
+	}
+	log.Debugf("  defining machine (%s)", m.Name)
+	return c.DefineDomain(x)
+}
+
+//vncPasswd is random, of the 8 characters vnc makes use of.
+func vncPasswd() (string, error) {
+	const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_"
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = chars[b[i]%64]
+	}
+	return string(b), nil
+}
+
+//Remove powers off and undefines the domain, and deletes the volumes of its disks.
+func (m *Machine) Remove(c virt.Conn, h Host) error {
+	log.Debugf("  removing machine (%s)", m.Name)
+	x, err := c.DomainXML(m.Name)
+	if err == virt.ErrDomainNotFound {
+		return m.RemoveRoot(c, h)
+	} else if err != nil {
+		return err
+	}
+	dom, err := virt.ParseDomain(x)
+	if err != nil {
+		return err
+	}
+	if s, err := c.DomainState(m.Name); err != nil {
+		return err
+	} else if s != virt.Shutoff {
+		if err = c.DestroyDomain(m.Name); err != nil {
+			return err
+		}
+	}
+	if err = c.UndefineDomain(m.Name); err != nil {
+		return err
+	}
+	for _, k := range dom.Devices.Disks {
+		if err = ignoreNotFound(c.DeleteVolume(h.Pool, path.Base(k.Source.File))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Start boots the domain, or resumes it when suspended.
+func (m *Machine) Start(c virt.Conn) error {
+	s, err := c.DomainState(m.Name)
+	if err != nil {
+		return err
+	}
+	switch s {
+	case virt.Running:
+		return nil
+	case virt.Paused:
+		return c.ResumeDomain(m.Name)
+	}
+	return c.StartDomain(m.Name)
+}
+
+//Stop asks the guest to power off, and pulls the plug when it doesn't in time.
+func (m *Machine) Stop(c virt.Conn) error {
+	s, err := c.DomainState(m.Name)
+	if err != nil {
+		return err
+	}
+	switch s {
+	case virt.Shutoff:
+		return nil
+	case virt.Paused:
+		return c.DestroyDomain(m.Name)
+	}
+	if err = c.ShutdownDomain(m.Name); err != nil {
+		return err
+	}
+	if err = m.WaitState(c, virt.Shutoff); err != nil {
+		log.Warnf("  machine (%s) didn't power off, destroying it: %s", m.Name, err)
+		return c.DestroyDomain(m.Name)
+	}
+	return nil
+}
+
+func (m *Machine) Restart(c virt.Conn) error {
+	return c.RebootDomain(m.Name)
+}
+
+func (m *Machine) Suspend(c virt.Conn) error {
+	return c.SuspendDomain(m.Name)
+}
+
+func (m *Machine) WaitState(c virt.Conn, state virt.State) error {
+	return safe.WaitCondition(waitTimeout, waitInterval, func() (bool, error) {
+		s, err := c.DomainState(m.Name)
+		if err != nil {
+			return false, err
+		}
+		if s == virt.Crashed {
+			return false, fmt.Errorf("machine %s crashed", m.Name)
+		}
+		return s == state, nil
+	})
+}
+
+//WaitAddrs waits for an address of the domain, and reads its vnc port. The
+//host may never tell the address of a domain on a bridge, one with a static ip
+//and no guest agent, it is deployed all the same.
+func (m *Machine) WaitAddrs(c virt.Conn, h Host) error {
+	err := safe.WaitCondition(waitTimeout, waitInterval, func() (bool, error) {
+		addrs, err := c.DomainAddrs(m.Name)
+		if err != nil {
+			return false, err
+		}
+		m.Addrs = addrs
+		return len(addrs) > 0, nil
+	})
+	if err != nil {
+		if h.Bridge == "" {
+			return err
+		}
+		log.Warnf("  no address of machine (%s) on bridge %s: %s", m.Name, h.Bridge, err)
+	}
+	x, err := c.DomainXML(m.Name)
+	if err != nil {
+		return err
+	}
+	dom, err := virt.ParseDomain(x)
+	if err != nil {
+		return err
+	}
+	m.VNCPort = dom.VNCPort()
+	return nil
+}
+
+func (m *Machine) CreateSnapshot(c virt.Conn) error {
+	s := &virt.Snapshot{Name: m.CartonsId, Description: "snapshot of " + m.Name}
+	x, err := s.XML()
+	if err != nil {
+		return err
+	}
+	return c.CreateSnapshot(m.Name, x)
+}
+
+func (m *Machine) RestoreSnapshot(c virt.Conn) error {
+	return c.RevertSnapshot(m.Name, m.CartonsId)
+}
+
+func (m *Machine) RemoveSnapshot(c virt.Conn) error {
+	return ignoreNotFound(c.DeleteSnapshot(m.Name, m.CartonsId))
+}
+
+//AttachDisk creates a volume of size MB and plugs it on the next free device,
+//it returns the device.
+func (m *Machine) AttachDisk(c virt.Conn, h Host, size uint64) (string, error) {
+	x, err := c.DomainXML(m.Name)
+	if err != nil {
+		return "", err
+	}
+	dom, err := virt.ParseDomain(x)
+	if err != nil {
+		return "", err
+	}
+	dev := dom.NextTarget()
+	if dev == "" {
+		return "", fmt.Errorf("machine %s has no device left for a disk", m.Name)
+	}
+	vol := &virt.Volume{
+		Name:     m.diskVolume(),
+		Capacity: virt.Size{Unit: "MiB", Value: size},
+		Target:   virt.VolumeTarget{Format: virt.Format{Type: "qcow2"}},
+	}
+	if x, err = vol.XML(); err != nil {
+		return "", err
+	}
+	file, err := c.CreateVolume(h.Pool, x)
+	if err != nil {
+		return "", err
+	}
+	disk := &virt.Disk{
+		Type:   "file",
+		Device: "disk",
+		Driver: virt.DiskDriver{Name: "qemu", Type: "qcow2"},
+		Source: virt.DiskSource{File: file},
+		Target: virt.DiskTarget{Dev: dev, Bus: "virtio"},
+	}
+	if x, err = disk.XML(); err != nil {
+		return "", err
+	}
+	if err = c.AttachDevice(m.Name, x); err != nil {
+		_ = c.DeleteVolume(h.Pool, vol.Name)
+		return "", err
+	}
+	return dev, nil
+}
+
+func (m *Machine) DetachDisk(c virt.Conn, h Host) error {
+	file, err := c.VolumePath(h.Pool, m.diskVolume())
+	if err != nil {
+		return err
+	}
+	x, err := c.DomainXML(m.Name)
+	if err != nil {
+		return err
+	}
+	dom, err := virt.ParseDomain(x)
+	if err != nil {
+		return err
+	}
+	if disk, ok := dom.DiskBySource(file); ok {
+		if x, err = disk.XML(); err != nil {
+			return err
+		}
+		if err = c.DetachDevice(m.Name, x); err != nil {
+			return err
+		}
+	}
+	return c.DeleteVolume(h.Pool, m.diskVolume())
+}
+
+func ignoreNotFound(err error) error {
+	switch err {
+	case virt.ErrDomainNotFound, virt.ErrVolumeNotFound, virt.ErrSnapshotNotFound:
+		return nil
+	}
+	return err
+}
+
+func (m *Machine) SetStatus(status utils.Status) error {
+	log.Debugf("  set status[%s] of machine (%s, %s)", m.Id, m.Name, status.String())
+
+	if asm, err := carton.NewAssembly(m.CartonId, m.AccountId, ""); err != nil {
+		return err
+	} else if err = asm.SetStatus(status); err != nil {
+		return err
+	}
+
+	if m.Level == provision.BoxSome {
+		if comp, err := carton.NewComponent(m.Id, m.AccountId, ""); err != nil {
+			return err
+		} else if err = comp.SetStatus(status, m.AccountId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Machine) SetStatusErr(status utils.Status, causeof error) error {
+	log.Debugf("  set status[%s] of machine (%s, %s)", m.Id, m.Name, status.String())
+
+	if asm, err := carton.NewAssembly(m.CartonId, m.AccountId, ""); err != nil {
+		return err
+	} else if err = asm.SetStatusErr(status, causeof); err != nil {
+		return err
+	}
+
+	if m.Level == provision.BoxSome {
+		if comp, err := carton.NewComponent(m.Id, m.AccountId, ""); err != nil {
+			return err
+		} else if err = comp.SetStatus(status, m.AccountId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Machine) SetMileStone(state utils.State) error {
+	log.Debugf("  set state[%s] of machine (%s, %s)", m.Id, m.Name, state.String())
+
+	if asm, err := carton.NewAssembly(m.CartonId, m.AccountId, ""); err != nil {
+		return err
+	} else if err = asm.SetState(state); err != nil {
+		return err
+	}
+
+	if m.Level == provision.BoxSome {
+		if comp, err := carton.NewComponent(m.Id, m.AccountId, ""); err != nil {
+			return err
+		} else if err = comp.SetState(state, m.AccountId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Outputs are the instance, addresses and vnc console of the machine, as
+//the assembly keeps them.
+func (m *Machine) Outputs(h Host) map[string][]string {
+	var pri, pub []string
+	for _, a := range m.Addrs {
+		if isPrivate(net.ParseIP(a)) {
+			pri = append(pri, a)
+		} else {
+			pub = append(pub, a)
+		}
+	}
+	out := map[string][]string{
+		carton.INSTANCE_ID:    {m.Name},
+		constants.PRIVATEIPV4: pri,
+		constants.PUBLICIPV4:  pub,
+	}
+	if m.VNCPort > 0 {
+		out[carton.VNCHOST] = []string{h.Listen()}
+		out[carton.VNCPORT] = []string{strconv.Itoa(m.VNCPort)}
+		if m.VNCPasswd != "" {
+			out[carton.VNCPASSWD] = []string{m.VNCPasswd}
+		}
+	}
+	return out
+}
+
+//the private ranges of RFC 1918.
+var privateNets = []*net.IPNet{
+	{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv4(172, 16, 0, 0), Mask: net.CIDRMask(12, 32)},
+	{IP: net.IPv4(192, 168, 0, 0), Mask: net.CIDRMask(16, 32)},
+}
+
+func isPrivate(ip net.IP) bool {
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Machine) SetOutputs(h Host) error {
+	asm, err := carton.NewAssembly(m.CartonId, m.AccountId, "")
+	if err != nil {
+		return err
+	}
+	return asm.NukeAndSetOutputs(m.Outputs(h))
+}
+
+func (m *Machine) UpdateSnap() error {
+	sns, err := carton.GetSnap(m.CartonsId, m.AccountId)
+	if err != nil {
+		return err
+	}
+	sns.SnapId = m.CartonsId
+	sns.DiskId = "0"
+	sns.Status = "created"
+	return sns.UpdateSnap()
+}
+
+func (m *Machine) UpdateSnapStatus(status utils.Status) error {
+	sns, err := carton.GetSnap(m.CartonsId, m.AccountId)
+	if err != nil {
+		return err
+	}
+	sns.Status = status.String()
+	return sns.UpdateSnap()
+}
+
+func (m *Machine) RemoveSnap() error {
+	sns, err := carton.GetSnap(m.CartonsId, m.AccountId)
+	if err != nil {
+		return err
+	}
+	return sns.RemoveSnap()
+}
+
+//DiskSize is the size in MB of the disk requested for cartonsId.
+func (m *Machine) DiskSize() (uint64, error) {
+	dsk, err := carton.GetDisks(m.CartonsId, m.AccountId)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(dsk.NumMemory(), 10, 64)
+}
+
+func (m *Machine) UpdateDisk(dev string) error {
+	d, err := carton.GetDisks(m.CartonsId, m.AccountId)
+	if err != nil {
+		return err
+	}
+	d.DiskId = dev
+	d.Status = "success"
+	return d.UpdateDisk()
+}
@@ -0,0 +1,237 @@
+package libvirt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/virtengine/libgo/action"
+	constants "github.com/virtengine/libgo/utils"
+	"github.com/virtengine/vertice/carton"
+	"github.com/virtengine/vertice/provision"
+	"github.com/virtengine/vertice/provision/libvirt/libvirttest"
+	"github.com/virtengine/vertice/provision/libvirt/virt"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct {
+	conn *libvirttest.FakeConn
+	host Host
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpSuite(c *check.C) {
+	waitInterval = time.Millisecond
+	waitTimeout = 50 * time.Millisecond
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	s.conn = libvirttest.NewFakeConn()
+	s.conn.AddVolume("default", "ubuntu")
+	s.host = Host{Zone: "edge1", Uri: "qemu+tcp://10.0.0.2/system", Pool: "default", Network: "default"}
+}
+
+func (s *S) box() *provision.Box {
+	return &provision.Box{Id: "BOX1", CartonId: "ASM1", CartonsId: "SNP1", CartonName: "vm1", DomainName: "megam.io", Region: "edge1",
+		Compute: provision.BoxCompute{Cpushare: 2, Memory: 2 * provision.GB, HDD: 20 * provision.GB}}
+}
+
+func (s *S) args() runMachineActionsArgs {
+	return runMachineActionsArgs{box: s.box(), imageId: "ubuntu", conn: s.conn, host: s.host, machineStatus: constants.StatusLaunching}
+}
+
+//forward runs the actions as a pipeline would, each on the result of the previous.
+func (s *S) forward(c *check.C, actions ...*action.Action) Machine {
+	var prev action.Result
+	for _, a := range actions {
+		r, err := a.Forward(action.FWContext{Previous: prev, Params: []interface{}{s.args()}})
+		c.Assert(err, check.IsNil, check.Commentf("action %s", a.Name))
+		prev = r
+	}
+	return prev.(Machine)
+}
+
+func (s *S) TestDeployActions(c *check.C) {
+	m := s.forward(c, &machCreating, &createRootDisk, &defineMachine, &bootMachine)
+	c.Assert(m.Name, check.Equals, "vm1.megam.io")
+	c.Assert(m.Disk, check.Equals, "/var/lib/libvirt/images/default/vm1.megam.io.qcow2")
+	c.Assert(m.Status, check.Equals, constants.StatusLaunched)
+	c.Assert(m.State, check.Equals, constants.StateRunning)
+
+	vol, ok := s.conn.Volume(m.Disk)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(vol.Capacity, check.DeepEquals, virt.Size{Unit: "MiB", Value: 20480})
+	c.Assert(vol.BackingStore.Path, check.Equals, "/var/lib/libvirt/images/default/ubuntu")
+
+	d := s.conn.Domain("vm1.megam.io")
+	c.Assert(d, check.NotNil)
+	c.Assert(d.State, check.Equals, virt.Running)
+	c.Assert(d.Domain.VCPU, check.Equals, uint64(2))
+	c.Assert(d.Domain.Memory, check.DeepEquals, virt.Size{Unit: "MiB", Value: 2048})
+	c.Assert(d.Domain.Devices.Interfaces[0].Source.Network, check.Equals, "default")
+	c.Assert(d.Domain.Devices.Graphics[0].Listen, check.Equals, "10.0.0.2")
+	c.Assert(d.Domain.Devices.Graphics[0].Passwd, check.HasLen, 8)
+	c.Assert(d.Domain.Devices.Graphics[0].Passwd, check.Equals, m.VNCPasswd)
+}
+
+func (s *S) TestCreateRootDiskWithoutImage(c *check.C) {
+	m := s.forward(c, &machCreating)
+	m.Image = "centos"
+	_, err := createRootDisk.Forward(action.FWContext{Previous: m, Params: []interface{}{s.args()}})
+	c.Assert(err, check.ErrorMatches, "image centos in pool default: volume not found")
+}
+
+func (s *S) TestDefineMachineBackward(c *check.C) {
+	m := s.forward(c, &machCreating, &createRootDisk, &defineMachine)
+	defineMachine.Backward(action.BWContext{FWResult: m, Params: []interface{}{s.args()}})
+	c.Assert(s.conn.Domain(m.Name), check.IsNil)
+	_, ok := s.conn.Volume(m.Disk)
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestMachineOnBridge(c *check.C) {
+	m := Machine{Name: "vm1"}
+	d := m.domain(Host{Bridge: "br0"})
+	c.Assert(d.Devices.Interfaces[0].Type, check.Equals, "bridge")
+	c.Assert(d.Devices.Interfaces[0].Source.Bridge, check.Equals, "br0")
+}
+
+func (s *S) TestLifecycle(c *check.C) {
+	m := s.forward(c, &machCreating, &createRootDisk, &defineMachine, &bootMachine)
+
+	m = s.forward(c, &machCreating, &suspendMachine)
+	c.Assert(m.Status, check.Equals, constants.StatusSuspended)
+	c.Assert(s.conn.Domain(m.Name).State, check.Equals, virt.Paused)
+
+	m = s.forward(c, &machCreating, &startMachine)
+	c.Assert(m.Status, check.Equals, constants.StatusStarted)
+	c.Assert(s.conn.Domain(m.Name).State, check.Equals, virt.Running)
+
+	m = s.forward(c, &machCreating, &stopMachine)
+	c.Assert(m.State, check.Equals, constants.StateStopped)
+	c.Assert(s.conn.Domain(m.Name).State, check.Equals, virt.Shutoff)
+
+	m = s.forward(c, &machCreating, &stopMachine)
+	c.Assert(m.Status, check.Equals, constants.StatusStopped)
+
+	m = s.forward(c, &machCreating, &startMachine, &restartMachine)
+	c.Assert(s.conn.Domain(m.Name).State, check.Equals, virt.Running)
+}
+
+func (s *S) TestStopPullsThePlug(c *check.C) {
+	m := s.forward(c, &machCreating, &createRootDisk, &defineMachine, &bootMachine)
+	s.conn.IgnoreShutdown = true
+	m = s.forward(c, &machCreating, &stopMachine)
+	c.Assert(m.Status, check.Equals, constants.StatusStopped)
+	c.Assert(s.conn.Domain(m.Name).State, check.Equals, virt.Shutoff)
+	c.Assert(s.conn.Calls()[len(s.conn.Calls())-1], check.Equals, "DestroyDomain")
+}
+
+func (s *S) TestStopFails(c *check.C) {
+	m := s.forward(c, &machCreating, &createRootDisk, &defineMachine, &bootMachine)
+	s.conn.FailOn("ShutdownDomain", errors.New("no acpi"))
+	_, err := stopMachine.Forward(action.FWContext{Previous: m, Params: []interface{}{s.args()}})
+	c.Assert(err, check.ErrorMatches, "no acpi")
+	c.Assert(s.conn.Domain(m.Name).State, check.Equals, virt.Running)
+}
+
+func (s *S) TestDestroy(c *check.C) {
+	m := s.forward(c, &machCreating, &createRootDisk, &defineMachine, &bootMachine)
+	m.CartonsId = "DSK1"
+	_, err := m.AttachDisk(s.conn, s.host, 1024)
+	c.Assert(err, check.IsNil)
+
+	m = s.forward(c, &machCreating, &destroyOldMachine)
+	c.Assert(m.Status, check.Equals, constants.StatusDestroyed)
+	c.Assert(s.conn.Domain(m.Name), check.IsNil)
+	_, ok := s.conn.Volume("/var/lib/libvirt/images/default/vm1.megam.io.qcow2")
+	c.Assert(ok, check.Equals, false)
+	_, ok = s.conn.Volume("/var/lib/libvirt/images/default/vm1.megam.io-DSK1.qcow2")
+	c.Assert(ok, check.Equals, false)
+	_, ok = s.conn.Volume("/var/lib/libvirt/images/default/ubuntu")
+	c.Assert(ok, check.Equals, true)
+
+	//once more, nothing left to remove.
+	s.forward(c, &machCreating, &destroyOldMachine)
+}
+
+func (s *S) TestSnapshots(c *check.C) {
+	s.forward(c, &machCreating, &createRootDisk, &defineMachine, &bootMachine)
+	m := s.forward(c, &machCreating, &createSnapshot)
+	c.Assert(m.Status, check.Equals, constants.StatusSnapCreated)
+	c.Assert(s.conn.Domain(m.Name).Snapshots, check.DeepEquals, []string{"SNP1"})
+
+	m = s.forward(c, &machCreating, &restoreSnapshot)
+	c.Assert(m.Status, check.Equals, constants.StatusSnapRestored)
+
+	m = s.forward(c, &machCreating, &removeSnapshot)
+	c.Assert(m.Status, check.Equals, constants.StatusSnapDeleted)
+	c.Assert(s.conn.Domain(m.Name).Snapshots, check.HasLen, 0)
+}
+
+func (s *S) TestDisks(c *check.C) {
+	m := s.forward(c, &machCreating, &createRootDisk, &defineMachine, &bootMachine)
+	m.CartonsId = "DSK1"
+	dev, err := m.AttachDisk(s.conn, s.host, 1024)
+	c.Assert(err, check.IsNil)
+	c.Assert(dev, check.Equals, "vdb")
+	m.CartonsId = "DSK2"
+	dev, err = m.AttachDisk(s.conn, s.host, 1024)
+	c.Assert(err, check.IsNil)
+	c.Assert(dev, check.Equals, "vdc")
+
+	m.CartonsId = "DSK1"
+	c.Assert(m.DetachDisk(s.conn, s.host), check.IsNil)
+	disks := s.conn.Domain(m.Name).Domain.Devices.Disks
+	c.Assert(disks, check.HasLen, 2)
+	c.Assert(disks[1].Target.Dev, check.Equals, "vdc")
+	_, ok := s.conn.Volume("/var/lib/libvirt/images/default/vm1.megam.io-DSK1.qcow2")
+	c.Assert(ok, check.Equals, false)
+
+	m.CartonsId = "DSK3"
+	dev, err = m.AttachDisk(s.conn, s.host, 1024)
+	c.Assert(err, check.IsNil)
+	c.Assert(dev, check.Equals, "vdb")
+}
+
+func (s *S) TestWaitAddrsAndOutputs(c *check.C) {
+	s.conn.Addrs = []string{"192.168.122.10", "203.0.113.7"}
+	m := s.forward(c, &machCreating, &createRootDisk, &defineMachine, &bootMachine)
+	c.Assert(m.WaitAddrs(s.conn, s.host), check.IsNil)
+	c.Assert(m.VNCPort, check.Equals, 5900)
+	c.Assert(m.Outputs(s.host), check.DeepEquals, map[string][]string{
+		carton.INSTANCE_ID:    {"vm1.megam.io"},
+		constants.PRIVATEIPV4: {"192.168.122.10"},
+		constants.PUBLICIPV4:  {"203.0.113.7"},
+		carton.VNCHOST:        {"10.0.0.2"},
+		carton.VNCPORT:        {"5900"},
+		carton.VNCPASSWD:      {m.VNCPasswd},
+	})
+}
+
+func (s *S) TestWaitAddrsTimesOut(c *check.C) {
+	s.conn.Addrs = nil
+	m := s.forward(c, &machCreating, &createRootDisk, &defineMachine, &bootMachine)
+	c.Assert(m.WaitAddrs(s.conn, s.host), check.NotNil)
+}
+
+func (s *S) TestWaitAddrsOnBridge(c *check.C) {
+	s.conn.Addrs = nil
+	s.host.Bridge = "br0"
+	m := s.forward(c, &machCreating, &createRootDisk, &defineMachine, &bootMachine)
+	c.Assert(m.WaitAddrs(s.conn, s.host), check.IsNil)
+	c.Assert(m.Addrs, check.HasLen, 0)
+	c.Assert(m.VNCPort, check.Equals, 5900)
+}
+
+func (s *S) TestOutputsOfPrivateAddrs(c *check.C) {
+	m := Machine{Name: "vm1", Addrs: []string{"10.1.2.3", "172.16.0.5", "172.217.3.4", "192.168.1.9", "192.0.2.1"}}
+	out := m.Outputs(s.host)
+	c.Assert(out[constants.PRIVATEIPV4], check.DeepEquals, []string{"10.1.2.3", "172.16.0.5", "192.168.1.9"})
+	c.Assert(out[constants.PUBLICIPV4], check.DeepEquals, []string{"172.217.3.4", "192.0.2.1"})
+}
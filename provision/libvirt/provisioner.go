@@ -0,0 +1,382 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+
+// Package libvirt is a provisioner that runs the boxes as kvm domains of
+// plain libvirt hosts, one host per region, with no cloud around them.
+package libvirt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/libgo/action"
+	"github.com/virtengine/libgo/cmd"
+	"github.com/virtengine/libgo/events/alerts"
+	"github.com/virtengine/libgo/utils"
+	constants "github.com/virtengine/libgo/utils"
+	"github.com/virtengine/vertice/carton"
+	lb "github.com/virtengine/vertice/logbox"
+	"github.com/virtengine/vertice/provision"
+	"github.com/virtengine/vertice/provision/libvirt/virt"
+)
+
+// Provider is the name the libvirt provisioner registers with.
+const Provider = "libvirt"
+
+func init() {
+	provision.Register(Provider, &libvirtProvisioner{dial: virt.Dial})
+}
+
+type libvirtProvisioner struct {
+	hosts map[string]Host
+	dial  func(uri string) (virt.Conn, error)
+}
+
+type Libvirt struct {
+	Enabled bool   `json:"enabled" toml:"enabled"`
+	Hosts   []Host `json:"host" toml:"host"`
+}
+
+// Host is a kvm host, the region its boxes are deployed to.
+type Host struct {
+	Zone      string `json:"zone" toml:"zone"`
+	Uri       string `json:"uri" toml:"uri"`
+	Pool      string `json:"pool" toml:"pool"`
+	Network   string `json:"network" toml:"network"`
+	Bridge    string `json:"bridge" toml:"bridge"`
+	VncListen string `json:"vnc_listen" toml:"vnc_listen"`
+}
+
+// Address is the host of the uri.
+func (h Host) Address() string {
+	if u, err := url.Parse(h.Uri); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return "127.0.0.1"
+}
+
+// Listen is where the vnc consoles listen, the management address of the host:
+// vnc_listen, or else the host of the uri when it is an ip. With neither they
+// listen on 127.0.0.1, for a vertice that runs on the host.
+func (h Host) Listen() string {
+	if h.VncListen != "" {
+		return h.VncListen
+	}
+	if ip := net.ParseIP(h.Address()); ip != nil {
+		return ip.String()
+	}
+	return "127.0.0.1"
+}
+
+func (p *libvirtProvisioner) String() string {
+	if len(p.hosts) == 0 {
+		return "✗ libvirt hosts"
+	}
+	return "ready"
+}
+
+//no backups, migrations or resizes of the domains yet.
+func (p *libvirtProvisioner) Capabilities() []provision.Capability {
+	return []provision.Capability{
+		provision.CapDeploy, provision.CapDestroy,
+		provision.CapStart, provision.CapStop, provision.CapRestart, provision.CapSuspend,
+		provision.CapSnapshot, provision.CapDisk,
+	}
+}
+
+func (p *libvirtProvisioner) Initialize(m interface{}) error {
+	l, ok := m.(Libvirt)
+	if !ok {
+		return errors.New("libvirt provisioner needs its libvirt config")
+	}
+	p.hosts = make(map[string]Host, len(l.Hosts))
+	for _, h := range l.Hosts {
+		if h.Zone == "" || h.Uri == "" || h.Pool == "" {
+			return fmt.Errorf("libvirt host %q needs a zone, an uri and a pool", h.Zone)
+		}
+		if h.Network == "" && h.Bridge == "" {
+			h.Network = "default"
+		}
+		p.hosts[h.Zone] = h
+	}
+	if p.dial == nil {
+		p.dial = virt.Dial
+	}
+	return nil
+}
+
+func (p *libvirtProvisioner) StartupMessage() (string, error) {
+	w := new(tabwriter.Writer)
+	var b bytes.Buffer
+	w.Init(&b, 0, 8, 0, '\t', 0)
+	b.Write([]byte(cmd.Colorfy("  > libvirt ", "white", "", "bold") + "\t" +
+		cmd.Colorfy(p.String(), "cyan", "", "")))
+	for _, h := range p.hosts {
+		b.Write([]byte("\n    " + h.Zone + "\t" + h.Uri))
+	}
+	fmt.Fprintln(w)
+	w.Flush()
+	return strings.TrimSpace(b.String()), nil
+}
+
+//host returns the host of the region of the box, the only one when the box has none.
+func (p *libvirtProvisioner) host(box *provision.Box) (Host, error) {
+	if h, ok := p.hosts[box.Region]; ok {
+		return h, nil
+	}
+	if box.Region == "" && len(p.hosts) == 1 {
+		for _, h := range p.hosts {
+			return h, nil
+		}
+	}
+	return Host{}, fmt.Errorf("no libvirt host for the region %q of box %s", box.Region, box.GetFullName())
+}
+
+//run connects to the host of the box and runs the actions, the connection is
+//closed once they are done.
+func (p *libvirtProvisioner) run(args runMachineActionsArgs, actions ...*action.Action) error {
+	h, err := p.host(args.box)
+	if err != nil {
+		return err
+	}
+	c, err := p.dial(h.Uri)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	args.conn, args.host = c, h
+	return action.NewPipeline(actions...).Execute(args)
+}
+
+func (p *libvirtProvisioner) ImageDeploy(box *provision.Box, imageId string, w io.Writer) (string, error) {
+	return p.deployPipeline(box, imageId, w)
+}
+
+//the backups are images in the pool of the host, as the others.
+func (p *libvirtProvisioner) BackupDeploy(box *provision.Box, imageId string, w io.Writer) (string, error) {
+	return p.deployPipeline(box, imageId, w)
+}
+
+//1. &updateStatus in Scylla - Launching..
+//2. &create the root disk over the image, define and boot the domain.
+//3. &wait for its address and set the outputs, then it is running.
+func (p *libvirtProvisioner) deployPipeline(box *provision.Box, imageId string, w io.Writer) (string, error) {
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- deploy box (%s, image:%s)", box.GetFullName(), imageId)))
+	args := runMachineActionsArgs{
+		box:           box,
+		imageId:       imageId,
+		writer:        w,
+		isDeploy:      true,
+		machineStatus: constants.StatusLaunching,
+		machineState:  constants.StateInitializing,
+	}
+	err := p.run(args, &machCreating, &updateStatusInScylla, &mileStoneUpdate, &createRootDisk, &defineMachine,
+		&mileStoneUpdate, &bootMachine, &updateNetworkIps, &updateStatusInScylla, &mileStoneUpdate)
+	if err != nil {
+		fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.ERROR, fmt.Sprintf("--- deploy pipeline for box (%s, image:%s)\n --> %s", box.GetFullName(), imageId, err)))
+		return "", err
+	}
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- deploy box (%s, image:%s)OK", box.GetFullName(), imageId)))
+	//no agent in the domain calls back, it runs once booted.
+	return imageId, p.SetRunning(box, w)
+}
+
+func (p *libvirtProvisioner) Destroy(box *provision.Box, w io.Writer) error {
+	fmt.Fprintf(w, lb.W(lb.DESTORYING, lb.INFO, fmt.Sprintf("--- destroying box (%s)", box.GetFullName())))
+	args := runMachineActionsArgs{
+		box:           box,
+		writer:        w,
+		machineStatus: constants.StatusDestroying,
+		machineState:  constants.StateDestroying,
+	}
+	err := p.run(args, &machCreating, &updateStatusInScylla, &mileStoneUpdate, &destroyOldMachine, &mileStoneUpdate, &updateStatusInScylla)
+	if err != nil {
+		fmt.Fprintf(w, lb.W(lb.DESTORYING, lb.ERROR, fmt.Sprintf("--- destroying box (%s)--> %s", box.GetFullName(), err)))
+		return err
+	}
+	fmt.Fprintf(w, lb.W(lb.DESTORYING, lb.INFO, fmt.Sprintf("--- destroying box (%s)OK", box.GetFullName())))
+	return carton.DoneNotify(box, w, alerts.DESTROYED, "")
+}
+
+func (p *libvirtProvisioner) SetRunning(box *provision.Box, w io.Writer) error {
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- set state running box (%s)", box.GetFullName())))
+	args := runMachineActionsArgs{
+		box:           box,
+		writer:        w,
+		machineStatus: constants.StatusRunning,
+		machineState:  constants.StateRunning,
+	}
+	err := p.run(args, &machCreating, &updateStatusInScylla, &mileStoneUpdate)
+	if err != nil {
+		fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.ERROR, fmt.Sprintf("--- set state running pipeline for box (%s)\n --> %s", box.GetFullName(), err)))
+		return err
+	}
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- set state running box (%s)OK", box.GetFullName())))
+	return carton.DoneNotify(box, w, alerts.RUNNING, "")
+}
+
+func (p *libvirtProvisioner) SetState(box *provision.Box, w io.Writer, changeto utils.Status) error {
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- stateto %s", box.GetFullName())))
+	if err := p.SetBoxStatus(box, w, changeto); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- stateto %s OK", box.GetFullName())))
+	return carton.DoneNotify(box, w, alerts.LAUNCHED, "")
+}
+
+func (p *libvirtProvisioner) SetBoxStatus(box *provision.Box, w io.Writer, status utils.Status) error {
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- status %s box %s", box.GetFullName(), status.String())))
+	mach := Machine{Name: box.GetFullName(), Id: box.Id, CartonId: box.CartonId, AccountId: box.AccountId, Level: box.Level}
+	if err := mach.SetStatus(status); err != nil {
+		log.Errorf("error on set status for box %s - %s", box.GetFullName(), err)
+		return err
+	}
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- status %s box %s OK", box.GetFullName(), status.String())))
+	return nil
+}
+
+//op runs the lifecycle action, between the statuses of the request.
+func (p *libvirtProvisioner) op(box *provision.Box, w io.Writer, kind, desc string, status utils.Status, state utils.State, act *action.Action) error {
+	fmt.Fprintf(w, lb.W(kind, lb.INFO, fmt.Sprintf("--- %s box (%s)", desc, box.GetFullName())))
+	args := runMachineActionsArgs{
+		box:           box,
+		writer:        w,
+		machineStatus: status,
+		machineState:  state,
+	}
+	actions := []*action.Action{&machCreating, &updateStatusInScylla, act}
+	if state != "" {
+		actions = append(actions, &mileStoneUpdate)
+	}
+	if err := p.run(args, append(actions, &updateStatusInScylla)...); err != nil {
+		fmt.Fprintf(w, lb.W(kind, lb.ERROR, fmt.Sprintf("--- %s box (%s)--> %s", desc, box.GetFullName(), err)))
+		return err
+	}
+	fmt.Fprintf(w, lb.W(kind, lb.INFO, fmt.Sprintf("--- %s box (%s)OK", desc, box.GetFullName())))
+	return nil
+}
+
+func (p *libvirtProvisioner) Start(box *provision.Box, process string, w io.Writer) error {
+	return p.op(box, w, lb.STARTING, "starting", constants.StatusStarting, constants.StateRunning, &startMachine)
+}
+
+func (p *libvirtProvisioner) Stop(box *provision.Box, process string, w io.Writer) error {
+	return p.op(box, w, lb.STOPPING, "stopping", constants.StatusStopping, constants.StateStopped, &stopMachine)
+}
+
+func (p *libvirtProvisioner) Restart(box *provision.Box, process string, w io.Writer) error {
+	return p.op(box, w, lb.RESTARTING, "restarting", constants.StatusStarting, constants.StateRunning, &restartMachine)
+}
+
+func (p *libvirtProvisioner) Suspend(box *provision.Box, process string, w io.Writer) error {
+	return p.op(box, w, lb.STOPPING, "suspending", constants.StatusSuspending, "", &suspendMachine)
+}
+
+func (p *libvirtProvisioner) CreateSnapshot(box *provision.Box, w io.Writer) error {
+	fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("--- creating snapshot box (%s)", box.GetFullName())))
+	args := runMachineActionsArgs{
+		box:           box,
+		writer:        w,
+		machineStatus: constants.StatusSnapCreating,
+	}
+	err := p.run(args, &machCreating, &updateSnapStatus, &createSnapshot, &updateIdInSnapTable, &updateStatusInScylla)
+	if err != nil {
+		fmt.Fprintf(w, lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("--- creating snapshot box (%s)--> %s", box.GetFullName(), err)))
+		return err
+	}
+	fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("--- creating snapshot box (%s)OK", box.GetFullName())))
+	return nil
+}
+
+func (p *libvirtProvisioner) RestoreSnapshot(box *provision.Box, w io.Writer) error {
+	return p.op(box, w, lb.UPDATING, "restore snapshot", constants.StatusSnapRestoring, "", &restoreSnapshot)
+}
+
+func (p *libvirtProvisioner) DeleteSnapshot(box *provision.Box, w io.Writer) error {
+	fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("--- removing snapshot box (%s)", box.GetFullName())))
+	args := runMachineActionsArgs{
+		box:           box,
+		writer:        w,
+		machineStatus: constants.StatusSnapDeleting,
+	}
+	err := p.run(args, &machCreating, &updateStatusInScylla, &removeSnapshot, &removeSnapInScylla, &updateStatusInScylla)
+	if err != nil {
+		fmt.Fprintf(w, lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("--- removing snapshot box (%s)--> %s", box.GetFullName(), err)))
+		return err
+	}
+	fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("--- removing snapshot box (%s)OK", box.GetFullName())))
+	return nil
+}
+
+func (p *libvirtProvisioner) AttachDisk(box *provision.Box, w io.Writer) error {
+	return p.op(box, w, lb.UPDATING, "adding new storage to", constants.StatusDiskAttaching, "", &addNewStorage)
+}
+
+func (p *libvirtProvisioner) DetachDisk(box *provision.Box, w io.Writer) error {
+	return p.op(box, w, lb.UPDATING, "removing existing storage from", constants.StatusDiskDetaching, "", &removeDiskStorage)
+}
+
+func (p *libvirtProvisioner) SaveImage(box *provision.Box, w io.Writer) error {
+	return provision.ErrNotImplemented
+}
+
+func (p *libvirtProvisioner) DeleteImage(box *provision.Box, w io.Writer) error {
+	return provision.ErrNotImplemented
+}
+
+func (p *libvirtProvisioner) Shell(provision.ShellOptions) error {
+	return provision.ErrNotImplemented
+}
+
+func (p *libvirtProvisioner) ExecuteCommandOnce(stdout, stderr io.Writer, box *provision.Box, cmd string, args ...string) error {
+	return provision.ErrNotImplemented
+}
+
+//Addr is the first address the domain leased.
+func (p *libvirtProvisioner) Addr(box *provision.Box) (string, error) {
+	h, err := p.host(box)
+	if err != nil {
+		return "", err
+	}
+	c, err := p.dial(h.Uri)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+	addrs, err := c.DomainAddrs(box.GetFullName())
+	if err != nil {
+		return "", err
+	}
+	if len(addrs) == 0 {
+		return "", provision.ErrBoxNotFound
+	}
+	return addrs[0], nil
+}
+
+func (p *libvirtProvisioner) MetricEnvs(start int64, end int64, region string, w io.Writer) ([]interface{}, error) {
+	return nil, nil
+}
+
+func (p *libvirtProvisioner) TriggerBills(account_id, cat_id, name string) error {
+	return nil
+}
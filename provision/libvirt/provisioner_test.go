@@ -0,0 +1,79 @@
+package libvirt
+
+import (
+	"github.com/virtengine/vertice/provision"
+	"github.com/virtengine/vertice/provision/libvirt/virt"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) provisioner(c *check.C, hosts ...Host) *libvirtProvisioner {
+	p := &libvirtProvisioner{dial: func(uri string) (virt.Conn, error) { return s.conn, nil }}
+	c.Assert(p.Initialize(Libvirt{Enabled: true, Hosts: hosts}), check.IsNil)
+	return p
+}
+
+func (s *S) TestInitialize(c *check.C) {
+	p := s.provisioner(c, Host{Zone: "edge1", Uri: "qemu:///system", Pool: "default"})
+	c.Assert(p.String(), check.Equals, "ready")
+	c.Assert(p.hosts["edge1"].Network, check.Equals, "default")
+
+	c.Assert((&libvirtProvisioner{}).Initialize("libvirt"), check.NotNil)
+	err := (&libvirtProvisioner{}).Initialize(Libvirt{Hosts: []Host{{Zone: "edge1", Uri: "qemu:///system"}}})
+	c.Assert(err, check.ErrorMatches, `libvirt host "edge1" needs a zone, an uri and a pool`)
+}
+
+func (s *S) TestHost(c *check.C) {
+	p := s.provisioner(c, s.host)
+	box := s.box()
+	h, err := p.host(box)
+	c.Assert(err, check.IsNil)
+	c.Assert(h.Zone, check.Equals, "edge1")
+	box.Region = ""
+	_, err = p.host(box)
+	c.Assert(err, check.IsNil)
+	box.Region = "edge2"
+	_, err = p.host(box)
+	c.Assert(err, check.ErrorMatches, `no libvirt host for the region "edge2" of box vm1.megam.io`)
+
+	p = s.provisioner(c, s.host, Host{Zone: "edge2", Uri: "qemu+tcp://10.0.0.3/system", Pool: "default"})
+	box.Region = ""
+	_, err = p.host(box)
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestHostAddress(c *check.C) {
+	c.Assert(s.host.Address(), check.Equals, "10.0.0.2")
+	c.Assert(Host{Uri: "qemu:///system"}.Address(), check.Equals, "127.0.0.1")
+}
+
+func (s *S) TestHostListen(c *check.C) {
+	c.Assert(s.host.Listen(), check.Equals, "10.0.0.2")
+	c.Assert(Host{Uri: "qemu:///system"}.Listen(), check.Equals, "127.0.0.1")
+	c.Assert(Host{Uri: "qemu+tcp://kvm1.megam.io/system"}.Listen(), check.Equals, "127.0.0.1")
+	c.Assert(Host{Uri: "qemu+tcp://kvm1.megam.io/system", VncListen: "10.0.0.3"}.Listen(), check.Equals, "10.0.0.3")
+}
+
+func (s *S) TestCapabilities(c *check.C) {
+	p := s.provisioner(c, s.host)
+	c.Assert(provision.Capabilities(p), check.DeepEquals, []provision.Capability{
+		provision.CapDeploy, provision.CapDestroy, provision.CapDisk, provision.CapRestart,
+		provision.CapSnapshot, provision.CapStart, provision.CapStop, provision.CapSuspend})
+	c.Assert(provision.Supports(p, provision.CapShell), check.Equals, false)
+}
+
+func (s *S) TestAddr(c *check.C) {
+	p := s.provisioner(c, s.host)
+	_, err := p.Addr(s.box())
+	c.Assert(err, check.Equals, virt.ErrDomainNotFound)
+	s.forward(c, &machCreating, &createRootDisk, &defineMachine, &bootMachine)
+	addr, err := p.Addr(s.box())
+	c.Assert(err, check.IsNil)
+	c.Assert(addr, check.Equals, "192.168.122.10")
+	c.Assert(s.conn.Closed(), check.Equals, true)
+}
+
+func (s *S) TestNotImplemented(c *check.C) {
+	p := s.provisioner(c, s.host)
+	c.Assert(p.Shell(provision.ShellOptions{}), check.Equals, provision.ErrNotImplemented)
+	c.Assert(p.SaveImage(s.box(), nil), check.Equals, provision.ErrNotImplemented)
+}
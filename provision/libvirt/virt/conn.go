@@ -0,0 +1,121 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+
+// Package virt is the part of the libvirt API the libvirt provisioner drives,
+// the domains, volumes and snapshots of a KVM host.
+package virt
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDomainNotFound   = errors.New("domain not found")
+	ErrVolumeNotFound   = errors.New("volume not found")
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+)
+
+// State is the state libvirt reports for a domain.
+type State int
+
+const (
+	NoState State = iota
+	Running
+	Blocked
+	Paused
+	Shutdown
+	Shutoff
+	Crashed
+	PMSuspended
+)
+
+var stateNames = []string{"nostate", "running", "blocked", "paused", "shutdown", "shutoff", "crashed", "pmsuspended"}
+
+func (s State) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return "unknown"
+	}
+	return stateNames[s]
+}
+
+// Conn is a connection to the libvirtd of a host. The domains are looked up
+// by their name, the volumes by their pool and name.
+type Conn interface {
+	DefineDomain(xml string) error
+	UndefineDomain(name string) error
+	DomainXML(name string) (string, error)
+	DomainState(name string) (State, error)
+	DomainAddrs(name string) ([]string, error)
+
+	StartDomain(name string) error
+	ShutdownDomain(name string) error
+	DestroyDomain(name string) error
+	RebootDomain(name string) error
+	SuspendDomain(name string) error
+	ResumeDomain(name string) error
+
+	AttachDevice(name, xml string) error
+	DetachDevice(name, xml string) error
+
+	CreateVolume(pool, xml string) (string, error)
+	VolumePath(pool, name string) (string, error)
+	DeleteVolume(pool, name string) error
+
+	CreateSnapshot(name, xml string) error
+	RevertSnapshot(name, snapshot string) error
+	DeleteSnapshot(name, snapshot string) error
+
+	Close() error
+}
+
+const (
+	libvirtPort   = "16509"
+	libvirtSocket = "/var/run/libvirt/libvirt-sock"
+	dialTimeout   = 5 * time.Second
+)
+
+// Dial connects to the libvirtd of the uri, qemu+tcp://host/system or
+// qemu:///system for the local one.
+func Dial(uri string) (Conn, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	network, address := "unix", libvirtSocket
+	switch u.Scheme {
+	case "qemu", "qemu+unix":
+		if s := u.Query().Get("socket"); s != "" {
+			address = s
+		}
+	case "qemu+tcp":
+		network, address = "tcp", u.Host
+		if !strings.Contains(address, ":") {
+			address = net.JoinHostPort(address, libvirtPort)
+		}
+	default:
+		return nil, fmt.Errorf("libvirt uri %s: only qemu, qemu+unix and qemu+tcp are supported", uri)
+	}
+	c, err := net.DialTimeout(network, address, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return newRemote(c)
+}
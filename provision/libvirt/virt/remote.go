@@ -0,0 +1,284 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package virt
+
+import (
+	"net"
+
+	"github.com/digitalocean/go-libvirt"
+)
+
+//remote speaks the rpc protocol of libvirtd, no libvirt C library is needed.
+type remote struct {
+	l *libvirt.Libvirt
+}
+
+func newRemote(c net.Conn) (Conn, error) {
+	l := libvirt.New(c)
+	if err := l.Connect(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &remote{l: l}, nil
+}
+
+func (r *remote) domain(name string) (libvirt.Domain, error) {
+	d, err := r.l.DomainLookupByName(name)
+	if libvirt.IsNotFound(err) {
+		return d, ErrDomainNotFound
+	}
+	return d, err
+}
+
+func (r *remote) pool(name string) (libvirt.StoragePool, error) {
+	return r.l.StoragePoolLookupByName(name)
+}
+
+func (r *remote) volume(pool, name string) (libvirt.StorageVol, error) {
+	p, err := r.pool(pool)
+	if err != nil {
+		return libvirt.StorageVol{}, err
+	}
+	v, err := r.l.StorageVolLookupByName(p, name)
+	if libvirt.IsNotFound(err) {
+		return v, ErrVolumeNotFound
+	}
+	return v, err
+}
+
+func (r *remote) snapshot(name, snapshot string) (libvirt.DomainSnapshot, error) {
+	d, err := r.domain(name)
+	if err != nil {
+		return libvirt.DomainSnapshot{}, err
+	}
+	s, err := r.l.DomainSnapshotLookupByName(d, snapshot, 0)
+	if libvirt.IsNotFound(err) {
+		return s, ErrSnapshotNotFound
+	}
+	return s, err
+}
+
+func (r *remote) DefineDomain(xml string) error {
+	_, err := r.l.DomainDefineXML(xml)
+	return err
+}
+
+func (r *remote) UndefineDomain(name string) error {
+	d, err := r.domain(name)
+	if err != nil {
+		return err
+	}
+	return r.l.DomainUndefineFlags(d, libvirt.DomainUndefineManagedSave|libvirt.DomainUndefineSnapshotsMetadata)
+}
+
+func (r *remote) DomainXML(name string) (string, error) {
+	d, err := r.domain(name)
+	if err != nil {
+		return "", err
+	}
+	return r.l.DomainGetXMLDesc(d, 0)
+}
+
+func (r *remote) DomainState(name string) (State, error) {
+	d, err := r.domain(name)
+	if err != nil {
+		return NoState, err
+	}
+	s, _, err := r.l.DomainGetState(d, 0)
+	return State(s), err
+}
+
+//the ipv4 addresses of the domain: the leases of the dhcp of the libvirt
+//network, or for a domain on a bridge, that leases nothing, the arp table of
+//the host and else the guest agent.
+func (r *remote) DomainAddrs(name string) ([]string, error) {
+	d, err := r.domain(name)
+	if err != nil {
+		return nil, err
+	}
+	ifaces, err := r.l.DomainInterfaceAddresses(d, uint32(libvirt.DomainInterfaceAddressesSrcLease), 0)
+	if err != nil {
+		return nil, err
+	}
+	if addrs := ipv4s(ifaces); len(addrs) > 0 {
+		return addrs, nil
+	}
+	//the arp table knows the domain once it sent a packet, the agent only
+	//answers when the image runs one: their errors are no addresses yet.
+	for _, src := range []uint32{uint32(libvirt.DomainInterfaceAddressesSrcArp), uint32(libvirt.DomainInterfaceAddressesSrcAgent)} {
+		if ifaces, err = r.l.DomainInterfaceAddresses(d, src, 0); err != nil {
+			continue
+		}
+		if addrs := ipv4s(ifaces); len(addrs) > 0 {
+			return addrs, nil
+		}
+	}
+	return nil, nil
+}
+
+func ipv4s(ifaces []libvirt.DomainInterface) []string {
+	var addrs []string
+	for _, i := range ifaces {
+		for _, a := range i.Addrs {
+			if ip := net.ParseIP(a.Addr); a.Type == int32(libvirt.IPAddrTypeIpv4) && ip != nil && !ip.IsLoopback() {
+				addrs = append(addrs, a.Addr)
+			}
+		}
+	}
+	return addrs
+}
+
+func (r *remote) StartDomain(name string) error {
+	d, err := r.domain(name)
+	if err != nil {
+		return err
+	}
+	return r.l.DomainCreate(d)
+}
+
+func (r *remote) ShutdownDomain(name string) error {
+	d, err := r.domain(name)
+	if err != nil {
+		return err
+	}
+	return r.l.DomainShutdown(d)
+}
+
+func (r *remote) DestroyDomain(name string) error {
+	d, err := r.domain(name)
+	if err != nil {
+		return err
+	}
+	return r.l.DomainDestroy(d)
+}
+
+func (r *remote) RebootDomain(name string) error {
+	d, err := r.domain(name)
+	if err != nil {
+		return err
+	}
+	return r.l.DomainReboot(d, 0)
+}
+
+func (r *remote) SuspendDomain(name string) error {
+	d, err := r.domain(name)
+	if err != nil {
+		return err
+	}
+	return r.l.DomainSuspend(d)
+}
+
+func (r *remote) ResumeDomain(name string) error {
+	d, err := r.domain(name)
+	if err != nil {
+		return err
+	}
+	return r.l.DomainResume(d)
+}
+
+//the device is kept in the config, and plugged live when the domain runs.
+func (r *remote) deviceFlags(name string) (uint32, error) {
+	s, err := r.DomainState(name)
+	if err != nil {
+		return 0, err
+	}
+	flags := uint32(libvirt.DomainDeviceModifyConfig)
+	if s == Running || s == Paused {
+		flags |= uint32(libvirt.DomainDeviceModifyLive)
+	}
+	return flags, nil
+}
+
+func (r *remote) AttachDevice(name, xml string) error {
+	d, err := r.domain(name)
+	if err != nil {
+		return err
+	}
+	flags, err := r.deviceFlags(name)
+	if err != nil {
+		return err
+	}
+	return r.l.DomainAttachDeviceFlags(d, xml, flags)
+}
+
+func (r *remote) DetachDevice(name, xml string) error {
+	d, err := r.domain(name)
+	if err != nil {
+		return err
+	}
+	flags, err := r.deviceFlags(name)
+	if err != nil {
+		return err
+	}
+	return r.l.DomainDetachDeviceFlags(d, xml, flags)
+}
+
+func (r *remote) CreateVolume(pool, xml string) (string, error) {
+	p, err := r.pool(pool)
+	if err != nil {
+		return "", err
+	}
+	v, err := r.l.StorageVolCreateXML(p, xml, 0)
+	if err != nil {
+		return "", err
+	}
+	return r.l.StorageVolGetPath(v)
+}
+
+func (r *remote) VolumePath(pool, name string) (string, error) {
+	v, err := r.volume(pool, name)
+	if err != nil {
+		return "", err
+	}
+	return r.l.StorageVolGetPath(v)
+}
+
+func (r *remote) DeleteVolume(pool, name string) error {
+	v, err := r.volume(pool, name)
+	if err != nil {
+		return err
+	}
+	return r.l.StorageVolDelete(v, 0)
+}
+
+func (r *remote) CreateSnapshot(name, xml string) error {
+	d, err := r.domain(name)
+	if err != nil {
+		return err
+	}
+	_, err = r.l.DomainSnapshotCreateXML(d, xml, 0)
+	return err
+}
+
+func (r *remote) RevertSnapshot(name, snapshot string) error {
+	s, err := r.snapshot(name, snapshot)
+	if err != nil {
+		return err
+	}
+	return r.l.DomainRevertToSnapshot(s, 0)
+}
+
+func (r *remote) DeleteSnapshot(name, snapshot string) error {
+	s, err := r.snapshot(name, snapshot)
+	if err != nil {
+		return err
+	}
+	return r.l.DomainSnapshotDelete(s, 0)
+}
+
+func (r *remote) Close() error {
+	return r.l.Disconnect()
+}
@@ -0,0 +1,220 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package virt
+
+import (
+	"encoding/xml"
+)
+
+//the few elements of the libvirt xml formats a kvm box needs,
+//see https://libvirt.org/format.html
+
+// Domain is a kvm virtual machine.
+type Domain struct {
+	XMLName  xml.Name `xml:"domain"`
+	Type     string   `xml:"type,attr"`
+	Name     string   `xml:"name"`
+	Memory   Size     `xml:"memory"`
+	VCPU     uint64   `xml:"vcpu"`
+	OS       OS       `xml:"os"`
+	Features Features `xml:"features"`
+	Devices  Devices  `xml:"devices"`
+}
+
+// Size is an amount of memory or storage with its unit, MiB or GiB.
+type Size struct {
+	Unit  string `xml:"unit,attr"`
+	Value uint64 `xml:",chardata"`
+}
+
+type OS struct {
+	Type OSType `xml:"type"`
+	Boot []Boot `xml:"boot"`
+}
+
+type OSType struct {
+	Arch  string `xml:"arch,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type Boot struct {
+	Dev string `xml:"dev,attr"`
+}
+
+type Features struct {
+	ACPI *struct{} `xml:"acpi"`
+	APIC *struct{} `xml:"apic"`
+}
+
+type Devices struct {
+	Disks      []Disk      `xml:"disk"`
+	Interfaces []Interface `xml:"interface"`
+	Graphics   []Graphics  `xml:"graphics"`
+}
+
+type Disk struct {
+	XMLName xml.Name   `xml:"disk"`
+	Type    string     `xml:"type,attr"`
+	Device  string     `xml:"device,attr"`
+	Driver  DiskDriver `xml:"driver"`
+	Source  DiskSource `xml:"source"`
+	Target  DiskTarget `xml:"target"`
+}
+
+type DiskDriver struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type DiskSource struct {
+	File string `xml:"file,attr"`
+}
+
+type DiskTarget struct {
+	Dev string `xml:"dev,attr"`
+	Bus string `xml:"bus,attr"`
+}
+
+// Interface is a nic on a libvirt network, or on a bridge of the host.
+type Interface struct {
+	Type   string          `xml:"type,attr"`
+	Source InterfaceSource `xml:"source"`
+	Model  InterfaceModel  `xml:"model"`
+}
+
+type InterfaceSource struct {
+	Network string `xml:"network,attr,omitempty"`
+	Bridge  string `xml:"bridge,attr,omitempty"`
+}
+
+type InterfaceModel struct {
+	Type string `xml:"type,attr"`
+}
+
+// Graphics is the vnc console, its port is picked by libvirt when the domain starts.
+type Graphics struct {
+	Type     string `xml:"type,attr"`
+	Port     int    `xml:"port,attr"`
+	AutoPort string `xml:"autoport,attr,omitempty"`
+	Listen   string `xml:"listen,attr,omitempty"`
+	Passwd   string `xml:"passwd,attr,omitempty"`
+}
+
+// Volume is a disk image in a storage pool, a copy on write of its backing
+// store when it has one.
+type Volume struct {
+	XMLName      xml.Name      `xml:"volume"`
+	Name         string        `xml:"name"`
+	Capacity     Size          `xml:"capacity"`
+	Target       VolumeTarget  `xml:"target"`
+	BackingStore *BackingStore `xml:"backingStore"`
+}
+
+type VolumeTarget struct {
+	Format Format `xml:"format"`
+}
+
+type BackingStore struct {
+	Path   string `xml:"path"`
+	Format Format `xml:"format"`
+}
+
+type Format struct {
+	Type string `xml:"type,attr"`
+}
+
+// Snapshot is an internal snapshot of the disks and memory of a domain.
+type Snapshot struct {
+	XMLName     xml.Name `xml:"domainsnapshot"`
+	Name        string   `xml:"name"`
+	Description string   `xml:"description,omitempty"`
+}
+
+func toXML(v interface{}) (string, error) {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (d *Domain) XML() (string, error) { return toXML(d) }
+
+func (d *Disk) XML() (string, error) { return toXML(d) }
+
+func (v *Volume) XML() (string, error) { return toXML(v) }
+
+func (s *Snapshot) XML() (string, error) { return toXML(s) }
+
+// ParseDomain reads the xml of a domain as libvirt describes it.
+func ParseDomain(s string) (*Domain, error) {
+	d := &Domain{}
+	if err := xml.Unmarshal([]byte(s), d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func ParseVolume(s string) (*Volume, error) {
+	v := &Volume{}
+	if err := xml.Unmarshal([]byte(s), v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func ParseSnapshot(s string) (*Snapshot, error) {
+	n := &Snapshot{}
+	if err := xml.Unmarshal([]byte(s), n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// DiskBySource returns the disk of the domain on the file.
+func (d *Domain) DiskBySource(file string) (Disk, bool) {
+	for _, k := range d.Devices.Disks {
+		if k.Source.File == file {
+			return k, true
+		}
+	}
+	return Disk{}, false
+}
+
+// NextTarget returns the first virtio device name, vda, vdb.., no disk of
+// the domain is on.
+func (d *Domain) NextTarget() string {
+	used := make(map[string]bool, len(d.Devices.Disks))
+	for _, k := range d.Devices.Disks {
+		used[k.Target.Dev] = true
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		if dev := "vd" + string(c); !used[dev] {
+			return dev
+		}
+	}
+	return ""
+}
+
+// VNCPort returns the port of the vnc console, 0 until the domain runs.
+func (d *Domain) VNCPort() int {
+	for _, g := range d.Devices.Graphics {
+		if g.Type == "vnc" && g.Port > 0 {
+			return g.Port
+		}
+	}
+	return 0
+}
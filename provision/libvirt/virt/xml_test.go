@@ -0,0 +1,86 @@
+package virt
+
+import (
+	"testing"
+
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func (s *S) TestDomainXML(c *check.C) {
+	d := &Domain{
+		Type:   "kvm",
+		Name:   "vm1.megam.io",
+		Memory: Size{Unit: "MiB", Value: 2048},
+		VCPU:   2,
+		OS:     OS{Type: OSType{Arch: "x86_64", Value: "hvm"}, Boot: []Boot{{Dev: "hd"}}},
+		Devices: Devices{
+			Disks: []Disk{{Type: "file", Device: "disk", Source: DiskSource{File: "/pool/vm1.qcow2"}, Target: DiskTarget{Dev: "vda", Bus: "virtio"}}},
+		},
+	}
+	x, err := d.XML()
+	c.Assert(err, check.IsNil)
+	c.Assert(x, check.Matches, `(?s)<domain type="kvm">.*<name>vm1.megam.io</name>.*<memory unit="MiB">2048</memory>.*<source file="/pool/vm1.qcow2"></source>.*`)
+
+	p, err := ParseDomain(x)
+	c.Assert(err, check.IsNil)
+	c.Assert(p.Name, check.Equals, "vm1.megam.io")
+	c.Assert(p.VCPU, check.Equals, uint64(2))
+	c.Assert(p.Devices.Disks[0].Target.Dev, check.Equals, "vda")
+}
+
+func (s *S) TestNextTarget(c *check.C) {
+	d := &Domain{}
+	c.Assert(d.NextTarget(), check.Equals, "vda")
+	d.Devices.Disks = []Disk{{Target: DiskTarget{Dev: "vda"}}, {Target: DiskTarget{Dev: "vdc"}}}
+	c.Assert(d.NextTarget(), check.Equals, "vdb")
+}
+
+func (s *S) TestDiskBySource(c *check.C) {
+	d := &Domain{Devices: Devices{Disks: []Disk{{Source: DiskSource{File: "/a"}, Target: DiskTarget{Dev: "vdb"}}}}}
+	k, ok := d.DiskBySource("/a")
+	c.Assert(ok, check.Equals, true)
+	c.Assert(k.Target.Dev, check.Equals, "vdb")
+	_, ok = d.DiskBySource("/b")
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestVNCPortOfLibvirtXML(c *check.C) {
+	d, err := ParseDomain(`<domain type='kvm' id='3'>
+  <name>vm1</name>
+  <devices>
+    <graphics type='vnc' port='5901' autoport='yes' listen='0.0.0.0'/>
+  </devices>
+</domain>`)
+	c.Assert(err, check.IsNil)
+	c.Assert(d.VNCPort(), check.Equals, 5901)
+	c.Assert((&Domain{Devices: Devices{Graphics: []Graphics{{Type: "vnc", Port: -1}}}}).VNCPort(), check.Equals, 0)
+}
+
+func (s *S) TestVolumeXML(c *check.C) {
+	v := &Volume{
+		Name:         "vm1.qcow2",
+		Capacity:     Size{Unit: "MiB", Value: 20480},
+		Target:       VolumeTarget{Format: Format{Type: "qcow2"}},
+		BackingStore: &BackingStore{Path: "/pool/ubuntu", Format: Format{Type: "qcow2"}},
+	}
+	x, err := v.XML()
+	c.Assert(err, check.IsNil)
+	p, err := ParseVolume(x)
+	c.Assert(err, check.IsNil)
+	c.Assert(p.Capacity, check.DeepEquals, v.Capacity)
+	c.Assert(p.BackingStore, check.DeepEquals, v.BackingStore)
+}
+
+func (s *S) TestStateString(c *check.C) {
+	c.Assert(Running.String(), check.Equals, "running")
+	c.Assert(Shutoff.String(), check.Equals, "shutoff")
+	c.Assert(State(42).String(), check.Equals, "unknown")
+}
@@ -43,6 +43,8 @@ type runMachineActionsArgs struct {
 	machineState  utils.State
 	provisioner   *oneProvisioner
 	process       string
+	region        string               //the zone a box migrates to.
+	compute       provision.BoxCompute //the size a box is resized to.
 }
 
 //If there is a previous machine created and it has a status, we use that.
@@ -1253,3 +1255,61 @@ var removeNetworkIps = action.Action{
 	Backward: func(ctx action.BWContext) {
 	},
 }
+
+const (
+	statusResizing = constants.Status("resizing")
+	statusResized  = constants.Status("resized")
+
+	//a running vm is powered off for the resize.
+	statusResizingOffline = constants.Status("resizing_offline")
+)
+
+var resizeMachine = action.Action{
+	Name: "resize-machine",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(machine.Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		writer := args.writer
+		if writer == nil {
+			writer = ioutil.Discard
+		}
+		to := *args.box
+		to.Compute = args.compute
+		running := args.box.CanCycleStop()
+		if running {
+			fmt.Fprintf(writer, lb.W(lb.STOPPING, lb.INFO, fmt.Sprintf("  powering machine %s off for an offline resize", mach.Name)))
+			if err := mach.LifecycleOps(args.provisioner, constants.STOP); err != nil {
+				return nil, err
+			}
+			if err := mach.WaitUntillVMState(args.provisioner, vm.POWEROFF, vm.LCM_INIT); err != nil {
+				return nil, err
+			}
+		}
+
+		fmt.Fprintf(writer, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  resizing machine (%s, %s)", mach.Name, to.Compute.String())))
+		err := mach.Resize(args.provisioner, args.box, &to)
+		if err != nil {
+			fmt.Fprintf(writer, lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("  resizing machine (%s) error   %s", mach.Name, err)))
+		}
+
+		if running { //back to running, resized or not.
+			fmt.Fprintf(writer, lb.W(lb.STARTING, lb.INFO, fmt.Sprintf("  starting machine %s", mach.Name)))
+			if serr := mach.LifecycleOps(args.provisioner, constants.START); serr != nil {
+				return nil, serr
+			}
+			if serr := mach.WaitUntillVMState(args.provisioner, vm.ACTIVE, vm.RUNNING); serr != nil {
+				return nil, serr
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		mach.Status = statusResized
+		fmt.Fprintf(writer, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  resizing machine (%s, %s)OK", mach.Name, to.Compute.String())))
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
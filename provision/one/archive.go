@@ -0,0 +1,94 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package one
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/virtengine/opennebula-go/images"
+	lb "github.com/virtengine/vertice/logbox"
+	"github.com/virtengine/vertice/provision"
+)
+
+// OpenImage reads the backup image from its datastore, which has to be mounted
+// on this host at the path OpenNebula knows it by.
+func (p *oneProvisioner) OpenImage(box *provision.Box, source string) (io.ReadCloser, int64, error) {
+	if source == "" {
+		return nil, 0, fmt.Errorf("the backup of %s has no source path yet", box.GetFullName())
+	}
+	f, err := os.Open(source)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, fmt.Errorf("image %s not found, is the datastore of %s mounted here ?", source, box.Region)
+		}
+		return nil, 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, fi.Size(), nil
+}
+
+// StoreImage stages the image in the one_image_dir of the zone, a dir its
+// frontend reads too, and registers it in the datastore.
+func (p *oneProvisioner) StoreImage(box *provision.Box, name string, r io.Reader, w io.Writer) (string, error) {
+	if _, err := p.importImage(box.Region, name, r, w); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+//importImage registers the image read from r in the zone, and returns its id.
+func (p *oneProvisioner) importImage(region, name string, r io.Reader, w io.Writer) (int, error) {
+	dir := p.imageDirs[region]
+	if dir == "" {
+		return 0, fmt.Errorf("zone %s has no one_image_dir to import images", region)
+	}
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- importing image %s in %s", name, region)))
+	f, err := ioutil.TempFile(dir, name)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name()) //the datastore has its copy once the image is ready.
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err = os.Chmod(f.Name(), 0644); err != nil { //oneadmin reads it.
+		return 0, err
+	}
+
+	res, err := p.Cluster().ImageCreate(images.Image{Name: name, Path: f.Name(), Type: images.OPERATING_SYSTEM}, region)
+	if err != nil {
+		return 0, err
+	}
+	id, _ := strconv.Atoi(res.(string))
+	if err = p.Cluster().IsImageReady(&images.Image{Id: id}, region); err != nil {
+		fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.ERROR, fmt.Sprintf("--- importing image %s --> %s", name, err)))
+		return id, err
+	}
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- importing image %s OK", name)))
+	return id, nil
+}
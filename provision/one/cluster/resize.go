@@ -0,0 +1,70 @@
+package cluster
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/virtengine/opennebula-go/api"
+	"github.com/virtengine/opennebula-go/compute"
+)
+
+//the xml-rpc methods opennebula-go has no wrapper for.
+const (
+	vmResize     = "one.vm.resize"
+	vmDiskResize = "one.vm.diskresize"
+	vmUpdate     = "one.vm.update"
+
+	//merges the attributes in the user template, instead of replacing it.
+	updateMerge = 1
+)
+
+// ResizeVM changes the cpu, vcpu and memory of a vm to the ones of opts, and
+// the costs showback reads. The vm has to be powered off.
+func (c *Cluster) ResizeVM(opts compute.VirtualMachine, throttle string) error {
+	nodlist, err := c.Nodes()
+	if err != nil {
+		return err
+	}
+	for _, v := range nodlist {
+		if v.Metadata[api.ONEZONE] == opts.Region {
+			if v.Metadata[api.VCPU_PERCENTAGE] != "" {
+				throttle = v.Metadata[api.VCPU_PERCENTAGE]
+			}
+			break
+		}
+	}
+	node, err := c.getNodeRegion(opts.Region)
+	if err != nil {
+		return err
+	}
+	defer node.Client.Client.Close()
+
+	capacity := strings.Join([]string{
+		"CPU=" + cpuThrottle(throttle, opts.Cpu),
+		"VCPU=" + opts.VCpu,
+		"MEMORY=" + opts.Memory,
+	}, "\n")
+	if _, err = node.Client.Call(vmResize, []interface{}{node.Client.Key, opts.VMId, capacity, false}); err != nil {
+		return wrapErrorWithCmd(node, err, "ResizeVM")
+	}
+
+	costs := fmt.Sprintf("CPU_COST=%q\nMEMORY_COST=%q\nDISK_COST=%q", opts.CpuCost, opts.MemoryCost, opts.HDDCost)
+	if _, err = node.Client.Call(vmUpdate, []interface{}{node.Client.Key, opts.VMId, costs, updateMerge}); err != nil {
+		return wrapErrorWithCmd(node, err, "ResizeVM")
+	}
+	return nil
+}
+
+// ResizeDisk grows the disk of a vm to size megabytes, disks don't shrink.
+func (c *Cluster) ResizeDisk(opts compute.VirtualMachine, diskId int, size string) error {
+	node, err := c.getNodeRegion(opts.Region)
+	if err != nil {
+		return err
+	}
+	defer node.Client.Client.Close()
+
+	if _, err = node.Client.Call(vmDiskResize, []interface{}{node.Client.Key, opts.VMId, diskId, size}); err != nil {
+		return wrapErrorWithCmd(node, err, "ResizeDisk")
+	}
+	return nil
+}
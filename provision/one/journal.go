@@ -0,0 +1,67 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package one
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/virtengine/libgo/action"
+	"github.com/virtengine/vertice/provision/journal"
+	"github.com/virtengine/vertice/provision/one/machine"
+)
+
+//the journaled pipelines, and what they need to be built again.
+const (
+	deployOp  = "deploy"
+	argImage  = "image"
+	argBackup = "backup"
+)
+
+//the steps of the machine pipelines hand a machine to each other.
+func decodeMachine(raw json.RawMessage) (action.Result, error) {
+	var m machine.Machine
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Resume carries on with a deploy cut by a restart.
+func (p *oneProvisioner) Resume(j *journal.Journal, w io.Writer) error {
+	switch j.Op {
+	case deployOp:
+		_, err := p.runDeploy(j, w)
+		return err
+	default:
+		return fmt.Errorf("can't resume %s of box %s", j.Op, j.Box.GetFullName())
+	}
+}
+
+// Rewind rolls back what a deploy cut by a restart has done.
+func (p *oneProvisioner) Rewind(j *journal.Journal, w io.Writer) error {
+	defer j.Close()
+	switch j.Op {
+	case deployOp:
+		backup, _ := strconv.ParseBool(j.Args[argBackup])
+		j.Rewind(p.deployActions(j.Box, backup), decodeMachine, p.deployArgs(j, w))
+		return nil
+	default:
+		return fmt.Errorf("can't rewind %s of box %s", j.Op, j.Box.GetFullName())
+	}
+}
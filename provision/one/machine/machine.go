@@ -104,6 +104,7 @@ func (m *Machine) Create(args *CreateArgs) error {
 	m.VMId = vmid
 	var id = make(map[string][]string)
 	id[carton.INSTANCE_ID] = []string{m.VMId}
+	id[carton.SSH_HOST_KEY] = []string{""} //a new vm, its host key is pinned at the next login.
 	if err = asm.NukeAndSetOutputs(id); err != nil {
 		return err
 	}
@@ -116,17 +117,20 @@ func (m *Machine) CreateBackupVM(args *CreateArgs) error {
 	if err != nil {
 		return err
 	}
-	bk, err := carton.GetBackup(asm.Inputs.Match("backup_id"), m.AccountId)
-	if err != nil {
-		return err
-	}
+	//an assembly imported from an archive has no backup here, nor ips to keep.
+	if bkid := asm.Inputs.Match("backup_id"); bkid != "" {
+		bk, err := carton.GetBackup(bkid, m.AccountId)
+		if err != nil {
+			return err
+		}
 
-	nics := []string{constants.PUBLICIPV4, constants.PRIVATEIPV4, constants.PUBLICIPV6, constants.PRIVATEIPV6}
-	for _, nic := range nics {
-		if ip := bk.Outputs.Match(nic); ip != "" {
-			t := strings.Split(ip, ",")
-			if len(t) > 0 {
-				ips[nic] = t
+		nics := []string{constants.PUBLICIPV4, constants.PRIVATEIPV4, constants.PUBLICIPV6, constants.PRIVATEIPV6}
+		for _, nic := range nics {
+			if ip := bk.Outputs.Match(nic); ip != "" {
+				t := strings.Split(ip, ",")
+				if len(t) > 0 {
+					ips[nic] = t
+				}
 			}
 		}
 	}
@@ -151,6 +155,7 @@ func (m *Machine) CreateBackupVM(args *CreateArgs) error {
 	m.VMId = vmid
 	var id = make(map[string][]string)
 	id[carton.INSTANCE_ID] = []string{m.VMId}
+	id[carton.SSH_HOST_KEY] = []string{""} //a new vm, its host key is pinned at the next login.
 	if err = asm.NukeAndSetOutputs(id); err != nil {
 		return err
 	}
@@ -268,14 +273,10 @@ func (m *Machine) UpdateVncHostPost() error {
 }
 
 func (m *Machine) UpdateVMIps(p OneProvisioner) error {
-	opts := virtualmachine.Vnc{
-		VmId: m.VMId,
-	}
-	res, err := p.Cluster().GetVM(opts, m.Region)
+	ips, err := m.VMIps(p)
 	if err != nil {
 		return err
 	}
-	ips := m.mergeSameIPtype(m.IPs(res.Nics()))
 	log.Debugf("  find and setips of machine (%s, %s)", m.Id, m.Name)
 	asm, err := carton.NewAssembly(m.CartonId, m.AccountId, "")
 	if err != nil {
@@ -963,6 +964,7 @@ func (m *Machine) CreateInstance(p OneProvisioner, box *provision.Box) error {
 	m.VMId = vmid
 	var id = make(map[string][]string)
 	id[carton.INSTANCE_ID] = []string{m.VMId}
+	id[carton.SSH_HOST_KEY] = []string{""} //a new vm, its host key is pinned at the next login.
 	if err = mark.NukeAndSetOutputs(id); err != nil {
 		return err
 	}
@@ -0,0 +1,136 @@
+package machine
+
+import (
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	constants "github.com/virtengine/libgo/utils"
+	"github.com/virtengine/opennebula-go/compute"
+	"github.com/virtengine/opennebula-go/disk"
+	"github.com/virtengine/opennebula-go/images"
+	"github.com/virtengine/opennebula-go/template"
+	"github.com/virtengine/opennebula-go/virtualmachine"
+	"github.com/virtengine/vertice/carton"
+	"github.com/virtengine/vertice/provision"
+)
+
+//MigrationDisks lists the disks attached to the vm, the first one boots it.
+func (m *Machine) MigrationDisks(p OneProvisioner) ([]int, error) {
+	id, _ := strconv.Atoi(m.VMId)
+	return p.Cluster().GetDiskId(&disk.VmDisk{VmId: id}, m.Region)
+}
+
+//SaveMigrationDisk saves the disk diskId of the vm as the image name, in its
+//region, and returns the id of the image once it is ready.
+func (m *Machine) SaveMigrationDisk(p OneProvisioner, diskId int, name string) (string, error) {
+	log.Debugf("  saving the disk %d of machine (%s) to migrate as %s", diskId, m.Name, name)
+	vmid, _ := strconv.Atoi(m.VMId)
+	opts := compute.Image{
+		Name:   name,
+		Region: m.Region,
+		VMId:   vmid,
+		DiskId: diskId,
+		SnapId: -1,
+	}
+	imageId, err := p.Cluster().SaveDiskImage(opts)
+	if err != nil {
+		return "", err
+	}
+	id, _ := strconv.Atoi(imageId)
+	return imageId, p.Cluster().IsImageReady(&images.Image{Id: id}, m.Region)
+}
+
+//ImageSource returns the path of the image imageId in the datastore of the region.
+func (m *Machine) ImageSource(p OneProvisioner, imageId string) (string, error) {
+	id, _ := strconv.Atoi(imageId)
+	res, err := p.Cluster().GetImage(images.Image{Id: id}, m.Region)
+	if err != nil {
+		return "", err
+	}
+	return res.Source, nil
+}
+
+func (m *Machine) RemoveMigrationDisk(p OneProvisioner, imageId, name string) error {
+	if imageId == "" {
+		return nil
+	}
+	id, _ := strconv.Atoi(imageId)
+	log.Debugf("  remove migration image %s (%s) in %s", name, imageId, m.Region)
+	return p.Cluster().RemoveImage(compute.Image{Name: name, Region: m.Region, ImageId: id})
+}
+
+//CreateMigratedVM instantiates the template of the region of the machine with the
+//images migrated as its disks, in order, the size of the box and the costs of
+//its flavor.
+func (m *Machine) CreateMigratedVM(p OneProvisioner, box *provision.Box, imageNames []string) error {
+	asm, err := carton.NewAssembly(m.CartonId, m.AccountId, "")
+	if err != nil {
+		return err
+	}
+	flv, err := carton.GetFlavor(m.AccountId, asm.FlavorId())
+	if err != nil {
+		return err
+	}
+	XMLtemplate, err := p.Cluster().GetTemplate(m.Region)
+	if err != nil {
+		return err
+	}
+
+	XMLtemplate.Template.Cpu = strconv.FormatInt(int64(box.GetCpushare()), 10)
+	XMLtemplate.Template.VCpu = XMLtemplate.Template.Cpu
+	XMLtemplate.Template.Memory = strconv.FormatInt(int64(box.GetMemory()), 10)
+	XMLtemplate.Template.Cpu_cost = flv.GetCpuCost()
+	XMLtemplate.Template.Memory_cost = flv.GetMemoryCost()
+	XMLtemplate.Template.Disk_cost = flv.GetHDDCost()
+	XMLtemplate.Template.Context.Accounts_id = box.AccountId
+	XMLtemplate.Template.Context.ApiKey = box.ApiArgs.Api_Key
+	XMLtemplate.Template.Context.Org_id = box.OrgId
+
+	uname := "oneadmin"
+	if len(XMLtemplate.Template.Disks) > 0 {
+		uname = XMLtemplate.Template.Disks[0].Image_Uname
+	}
+	XMLtemplate.Template.Disks = make([]*template.Disk, 0, len(imageNames))
+	for _, image := range imageNames {
+		XMLtemplate.Template.Disks = append(XMLtemplate.Template.Disks, &template.Disk{Image_Uname: uname, Image: image})
+	}
+	vmid, err := p.Cluster().InstantiateVM(XMLtemplate, m.Name, m.VCPUThrottle, m.Region)
+	if err != nil {
+		return err
+	}
+	m.VMId = vmid
+	return nil
+}
+
+//VMIps returns the ips of the vm by type, as the outputs of the assembly keep them.
+func (m *Machine) VMIps(p OneProvisioner) (map[string][]string, error) {
+	res, err := p.Cluster().GetVM(virtualmachine.Vnc{VmId: m.VMId}, m.Region)
+	if err != nil {
+		return nil, err
+	}
+	return m.mergeSameIPtype(m.IPs(res.Nics())), nil
+}
+
+//PublicIp is the first public ipv4 of the vm.
+func (m *Machine) PublicIp(p OneProvisioner) (string, error) {
+	ips, err := m.VMIps(p)
+	if err != nil {
+		return "", err
+	}
+	if len(ips[constants.PUBLICIPV4]) == 0 {
+		return "", nil
+	}
+	return ips[constants.PUBLICIPV4][0], nil
+}
+
+//SwitchRegion makes the vm of the machine the one of the assembly, in its region.
+func (m *Machine) SwitchRegion() error {
+	asm, err := carton.NewAssembly(m.CartonId, m.AccountId, "")
+	if err != nil {
+		return err
+	}
+	if err = asm.NukeAndSetOutputs(map[string][]string{carton.INSTANCE_ID: {m.VMId}}); err != nil {
+		return err
+	}
+	return asm.NukeAndSetInputs(map[string][]string{carton.REGION: {m.Region}})
+}
@@ -0,0 +1,43 @@
+package machine
+
+import (
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/opennebula-go/compute"
+	"github.com/virtengine/vertice/carton"
+	"github.com/virtengine/vertice/provision"
+)
+
+//Resize gives the vm the size of the box to, and the costs of the flavor of the
+//assembly. The disk grows when to has a bigger hdd than from, it never shrinks.
+func (m *Machine) Resize(p OneProvisioner, from, to *provision.Box) error {
+	asm, err := carton.NewAssembly(m.CartonId, m.AccountId, "")
+	if err != nil {
+		return err
+	}
+	flv, err := carton.GetFlavor(m.AccountId, asm.FlavorId())
+	if err != nil {
+		return err
+	}
+	id, _ := strconv.Atoi(m.VMId)
+	opts := compute.VirtualMachine{
+		Name:       m.Name,
+		Region:     m.Region,
+		VMId:       id,
+		Cpu:        strconv.FormatInt(int64(to.GetCpushare()), 10),
+		Memory:     strconv.FormatInt(int64(to.GetMemory()), 10),
+		CpuCost:    flv.GetCpuCost(),
+		MemoryCost: flv.GetMemoryCost(),
+		HDDCost:    flv.GetHDDCost(),
+	}
+	opts.VCpu = opts.Cpu
+	log.Debugf("  resizing machine in one (%s) to %s", m.Name, to.Compute.String())
+	if err = p.Cluster().ResizeVM(opts, m.VCPUThrottle); err != nil {
+		return err
+	}
+	if to.GetHDD() > from.GetHDD() {
+		return p.Cluster().ResizeDisk(opts, 0, strconv.FormatUint(to.GetHDD(), 10))
+	}
+	return nil
+}
@@ -0,0 +1,447 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package one
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"github.com/virtengine/libgo/action"
+	constants "github.com/virtengine/libgo/utils"
+	vm "github.com/virtengine/opennebula-go/virtualmachine"
+	lb "github.com/virtengine/vertice/logbox"
+	"github.com/virtengine/vertice/provision"
+	"github.com/virtengine/vertice/provision/one/machine"
+)
+
+const statusMigrating = constants.Status("migrating")
+
+// migration is the result passed between the migrate actions, the same box
+// as a machine in each region.
+type migration struct {
+	from machine.Machine
+	to   machine.Machine
+	//the prefix of the names of the disks saved in the source.
+	image string
+	disks []migrationDisk
+	//the source was powered off by the migration, a rollback starts it again.
+	stopped bool
+	oldIp   string
+	newIp   string
+	routed  bool
+	started time.Time
+}
+
+// migrationDisk is a disk of the source vm, saved as the image name in the
+// source and copied under the same name to the target.
+type migrationDisk struct {
+	name string
+	from string //the id of the image in the source.
+	to   string //the id of the image in the target.
+}
+
+func (mg migration) imageNames() []string {
+	names := make([]string, len(mg.disks))
+	for i, d := range mg.disks {
+		names[i] = d.name
+	}
+	return names
+}
+
+//removeDisks removes the images of the disks in the region of mach, from the
+//source or the target.
+func (mg migration) removeDisks(args runMachineActionsArgs, mach machine.Machine, target bool) {
+	for _, d := range mg.disks {
+		id := d.from
+		if target {
+			id = d.to
+		}
+		if err := mach.RemoveMigrationDisk(args.provisioner, id, d.name); err != nil {
+			fmt.Fprintf(migrationWriter(args), lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("  remove disk %s in %s error   %s", d.name, mach.Region, err)))
+		}
+	}
+}
+
+func migrationWriter(args runMachineActionsArgs) io.Writer {
+	if args.writer == nil {
+		return ioutil.Discard
+	}
+	return args.writer
+}
+
+//Migrate moves the box to the zone region. The target vm runs from a copy of the
+//disks of the source, which is destroyed once the target runs and has the routes.
+//1. &power off the source, its disks are saved as they are on the storage.
+//2. &save every disk of the source, in its zone.
+//3. &copy the disks to the datastore of the target zone.
+//4. &instantiate the vm in the target zone and wait for it to run.
+//5. &move the dns of the box to the ip of the target.
+//6. &switch the assembly to the target vm, and destroy the source.
+//A failed migration starts the source again.
+func (p *oneProvisioner) Migrate(box *provision.Box, region string, w io.Writer) error {
+	if p.imageDirs[region] == "" {
+		return fmt.Errorf("zone %s has no one_image_dir to migrate %s to", region, box.GetFullName())
+	}
+	fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("--- migrate box (%s, %s -> %s)", box.GetFullName(), box.Region, region)))
+	args := runMachineActionsArgs{
+		box:           box,
+		writer:        w,
+		machineStatus: statusMigrating,
+		provisioner:   p,
+		region:        region,
+	}
+
+	actions := []*action.Action{
+		&machCreating,
+		&updateStatusInScylla,
+		&startMigration,
+		&stopMigrationSource,
+		&saveMigrationDisk,
+		&copyMigrationDisk,
+		&createMigratedMachine,
+		&waitMigratedMachine,
+		&moveMigratedRoute,
+		&switchMigratedMachine,
+		&destroyMigratedSource,
+		&updateStatusInScylla,
+	}
+
+	pipeline := action.NewPipeline(actions...)
+	err := pipeline.Execute(args)
+	if err != nil {
+		fmt.Fprintf(w, lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("--- migrate box (%s, %s -> %s)--> %s", box.GetFullName(), box.Region, region, err)))
+		return err
+	}
+	fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("--- migrate box (%s, %s -> %s)OK", box.GetFullName(), box.Region, region)))
+	return nil
+}
+
+var startMigration = action.Action{
+	Name: "start-migration",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(machine.Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		if mach.VMId == "" {
+			return nil, fmt.Errorf("machine %s has no vm to migrate", mach.Name)
+		}
+		to := mach
+		to.Region = args.region
+		to.VMId = ""
+		to.ImageId = ""
+		now := time.Now()
+		return migration{
+			from:    mach,
+			to:      to,
+			image:   mach.Name + "-migrate-" + strconv.FormatInt(now.Unix(), 10),
+			oldIp:   args.box.PublicIp,
+			started: now,
+		}, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+}
+
+//stopMigrationSource powers off the source, a disk saved while the vm writes
+//to it is not consistent.
+var stopMigrationSource = action.Action{
+	Name: "stop-migration-source",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mg := ctx.Previous.(migration)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		w := migrationWriter(args)
+		if !args.box.CanCycleStop() {
+			return mg, nil
+		}
+		fmt.Fprintf(w, lb.W(lb.STOPPING, lb.INFO, fmt.Sprintf("  stopping machine (%s) to save its disks", mg.from.Name)))
+		if err := mg.from.LifecycleOps(args.provisioner, constants.STOP); err != nil {
+			return nil, err
+		}
+		mg.stopped = true
+		if err := mg.from.WaitUntillVMState(args.provisioner, vm.POWEROFF, vm.LCM_INIT); err != nil {
+			startMigrationSource(mg, args)
+			return nil, err
+		}
+		fmt.Fprintf(w, lb.W(lb.STOPPING, lb.INFO, fmt.Sprintf("  stopping machine (%s) OK", mg.from.Name)))
+		return mg, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		startMigrationSource(ctx.FWResult.(migration), ctx.Params[0].(runMachineActionsArgs))
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+//startMigrationSource starts the source the migration stopped.
+func startMigrationSource(mg migration, args runMachineActionsArgs) {
+	if !mg.stopped {
+		return
+	}
+	w := migrationWriter(args)
+	fmt.Fprintf(w, lb.W(lb.STARTING, lb.INFO, fmt.Sprintf("  starting machine (%s) again", mg.from.Name)))
+	err := mg.from.LifecycleOps(args.provisioner, constants.START)
+	if err == nil {
+		err = mg.from.WaitUntillVMState(args.provisioner, vm.ACTIVE, vm.RUNNING)
+	}
+	if err != nil {
+		fmt.Fprintf(w, lb.W(lb.STARTING, lb.ERROR, fmt.Sprintf("  starting machine (%s) again error   %s", mg.from.Name, err)))
+	}
+}
+
+var saveMigrationDisk = action.Action{
+	Name: "save-migration-disk",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mg := ctx.Previous.(migration)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		w := migrationWriter(args)
+		ids, err := mg.from.MigrationDisks(args.provisioner)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			return nil, fmt.Errorf("machine %s has no disk to migrate", mg.from.Name)
+		}
+		for _, id := range ids {
+			d := migrationDisk{name: mg.image + "-" + strconv.Itoa(id)}
+			fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  saving disk %d of machine (%s) as %s in %s", id, mg.from.Name, d.name, mg.from.Region)))
+			d.from, err = mg.from.SaveMigrationDisk(args.provisioner, id, d.name)
+			mg.disks = append(mg.disks, d)
+			if err != nil {
+				mg.removeDisks(args, mg.from, false)
+				return nil, err
+			}
+		}
+		fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  saving %d disks of machine (%s) OK", len(mg.disks), mg.from.Name)))
+		return mg, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		mg := ctx.FWResult.(migration)
+		mg.removeDisks(ctx.Params[0].(runMachineActionsArgs), mg.from, false)
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var copyMigrationDisk = action.Action{
+	Name: "copy-migration-disk",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mg := ctx.Previous.(migration)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		for i := range mg.disks {
+			if err := copyDisk(args, &mg, &mg.disks[i]); err != nil {
+				mg.removeDisks(args, mg.to, true)
+				return nil, err
+			}
+		}
+		return mg, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		mg := ctx.FWResult.(migration)
+		mg.removeDisks(ctx.Params[0].(runMachineActionsArgs), mg.to, true)
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+//copyDisk imports the image of the disk d in the source to the target zone.
+func copyDisk(args runMachineActionsArgs, mg *migration, d *migrationDisk) error {
+	source, err := mg.from.ImageSource(args.provisioner, d.from)
+	if err != nil {
+		return err
+	}
+	r, _, err := args.provisioner.OpenImage(args.box, source)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	id, err := args.provisioner.importImage(mg.to.Region, d.name, r, migrationWriter(args))
+	if id > 0 {
+		d.to = strconv.Itoa(id)
+	}
+	return err
+}
+
+var createMigratedMachine = action.Action{
+	Name: "create-migrated-machine",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mg := ctx.Previous.(migration)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		w := migrationWriter(args)
+		fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  creating machine (%s) in %s", mg.to.Name, mg.to.Region)))
+		if err := mg.to.CreateMigratedVM(args.provisioner, args.box, mg.imageNames()); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  creating machine (%s, %s) in %s OK", mg.to.Name, mg.to.VMId, mg.to.Region)))
+		return mg, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		mg := ctx.FWResult.(migration)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		if err := mg.to.Remove(args.provisioner); err != nil {
+			fmt.Fprintf(migrationWriter(args), lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("  destroy machine (%s, %s) in %s error   %s", mg.to.Name, mg.to.VMId, mg.to.Region, err)))
+		}
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var waitMigratedMachine = action.Action{
+	Name: "wait-migrated-machine",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mg := ctx.Previous.(migration)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		w := migrationWriter(args)
+		fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  waiting for machine (%s) to run in %s", mg.to.Name, mg.to.Region)))
+		if err := mg.to.WaitUntillVMState(args.provisioner, vm.ACTIVE, vm.RUNNING); err != nil {
+			return nil, err
+		}
+		if err := mg.to.VmHostIpPort(&machine.CreateArgs{Provisioner: args.provisioner}); err != nil {
+			return nil, err
+		}
+		ip, err := mg.to.PublicIp(args.provisioner)
+		if err != nil {
+			return nil, err
+		}
+		mg.newIp = ip
+		fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  machine (%s) runs in %s OK", mg.to.Name, mg.to.Region)))
+		return mg, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var moveMigratedRoute = action.Action{
+	Name: "move-migrated-route",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mg := ctx.Previous.(migration)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		w := migrationWriter(args)
+		mg.from.SetRoutable(mg.oldIp)
+		mg.to.SetRoutable(mg.newIp)
+		if !mg.from.Routable && !mg.to.Routable {
+			fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  skip routes of machine (%s), no public ip", mg.to.Name)))
+			return mg, nil
+		}
+		r, err := getRouterForBox(args.box)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  moving route of machine (%s, %s -> %s)", mg.to.Name, mg.oldIp, mg.newIp)))
+		if mg.to.Routable {
+			if err = r.SetCName(mg.to.Name, mg.newIp); err != nil {
+				return nil, err
+			}
+			mg.routed = true
+		}
+		if mg.from.Routable && mg.oldIp != mg.newIp {
+			if err = r.UnsetCName(mg.from.Name, mg.oldIp); err != nil {
+				fmt.Fprintf(w, lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("  destroy route error (%s, %s)   %s", mg.from.Name, mg.oldIp, err)))
+			}
+		}
+		fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  moving route of machine (%s, %s -> %s) OK", mg.to.Name, mg.oldIp, mg.newIp)))
+		return mg, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		mg := ctx.FWResult.(migration)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		w := migrationWriter(args)
+		r, err := getRouterForBox(args.box)
+		if err != nil {
+			fmt.Fprintf(w, lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("  route rollback error   %s", err)))
+			return
+		}
+		if mg.routed && mg.oldIp != mg.newIp {
+			if err = r.UnsetCName(mg.to.Name, mg.newIp); err != nil {
+				fmt.Fprintf(w, lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("  destroy route error (%s, %s)   %s", mg.to.Name, mg.newIp, err)))
+			}
+		}
+		if mg.from.Routable {
+			if err = r.SetCName(mg.from.Name, mg.oldIp); err != nil {
+				fmt.Fprintf(w, lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("  adding back route error (%s, %s)   %s", mg.from.Name, mg.oldIp, err)))
+			}
+		}
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var switchMigratedMachine = action.Action{
+	Name: "switch-migrated-machine",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mg := ctx.Previous.(migration)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		w := migrationWriter(args)
+		fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  switching assembly (%s) to the machine in %s", mg.to.CartonId, mg.to.Region)))
+		err := mg.to.SwitchRegion()
+		if err == nil {
+			err = mg.to.UpdateVMIps(args.provisioner)
+		}
+		if err == nil {
+			err = mg.to.UpdateVncHostPost()
+		}
+		if err != nil {
+			switchBack(mg, args)
+			return nil, err
+		}
+		fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  switching assembly (%s) to the machine in %s OK", mg.to.CartonId, mg.to.Region)))
+		return mg, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		switchBack(ctx.FWResult.(migration), ctx.Params[0].(runMachineActionsArgs))
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+//switchBack points the assembly to the source vm again.
+func switchBack(mg migration, args runMachineActionsArgs) {
+	w := migrationWriter(args)
+	if err := mg.from.SwitchRegion(); err != nil {
+		fmt.Fprintf(w, lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("  switch back assembly (%s) error   %s", mg.from.CartonId, err)))
+		return
+	}
+	if err := mg.from.UpdateVMIps(args.provisioner); err != nil {
+		fmt.Fprintf(w, lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("  switch back ips of assembly (%s) error   %s", mg.from.CartonId, err)))
+	}
+}
+
+//destroyMigratedSource is the last step, the assembly runs in the target by now.
+//A source left behind is reported and not rolled back. The disks in the target
+//stay, the vm uses them.
+var destroyMigratedSource = action.Action{
+	Name: "destroy-migrated-source",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mg := ctx.Previous.(migration)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		w := migrationWriter(args)
+		fmt.Fprintf(w, lb.W(lb.DESTORYING, lb.INFO, fmt.Sprintf("  destroying source machine (%s, %s) in %s", mg.from.Name, mg.from.VMId, mg.from.Region)))
+		if err := mg.from.Remove(args.provisioner); err != nil {
+			fmt.Fprintf(w, lb.W(lb.DESTORYING, lb.ERROR, fmt.Sprintf("  destroying source machine (%s, %s) in %s, remove it by hand   %s", mg.from.Name, mg.from.VMId, mg.from.Region, err)))
+		}
+		mg.removeDisks(args, mg.from, false)
+		fmt.Fprintf(w, lb.W(lb.DESTORYING, lb.INFO, fmt.Sprintf("  migrated machine (%s) to %s in %s OK", mg.to.Name, mg.to.Region, time.Since(mg.started))))
+		mach := mg.to
+		mach.Status = constants.StatusRunning
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+	MinParams: 1,
+}
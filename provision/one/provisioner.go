@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 
@@ -34,7 +35,9 @@ import (
 	"github.com/virtengine/vertice/carton"
 	lb "github.com/virtengine/vertice/logbox"
 	"github.com/virtengine/vertice/provision"
+	"github.com/virtengine/vertice/provision/journal"
 	"github.com/virtengine/vertice/provision/one/cluster"
+	"github.com/virtengine/vertice/provision/one/machine"
 	"github.com/virtengine/vertice/repository"
 	"github.com/virtengine/vertice/router"
 	_ "github.com/virtengine/vertice/router/route53"
@@ -50,6 +53,8 @@ func init() {
 type oneProvisioner struct {
 	defaultImage string
 	vcpuThrottle string
+	imageDirs    map[string]string //the dirs the zones import images from
+	shellUser    string
 	cluster      *cluster.Cluster
 	storage      cluster.Storage
 }
@@ -60,6 +65,7 @@ type One struct {
 	Image          string   `json:"image" toml:"image"`
 	VCPUPercentage string   `json:"vcpu_percentage" toml:"vcpu_percentage"`
 	OneTemplate    string   `json:"one_template" toml:"one_template"`
+	ShellUser      string   `json:"shell_user" toml:"shell_user"`
 }
 
 type Region struct {
@@ -73,6 +79,7 @@ type Region struct {
 	VCPUPercentage string    `json:"vcpu_percentage" toml:"vcpu_percentage"`
 	Datastore      string    `json:"one_datastore_id" toml:"one_datastore_id"`
 	Certificate    string    `json:"certificate" toml:"certificate"`
+	ImageDir       string    `json:"one_image_dir" toml:"one_image_dir"`
 	Clusters       []Cluster `json:"cluster" toml:"cluster"`
 }
 
@@ -101,6 +108,15 @@ func (p *oneProvisioner) String() string {
 	return "ready"
 }
 
+func (p *oneProvisioner) Capabilities() []provision.Capability {
+	return []provision.Capability{
+		provision.CapDeploy, provision.CapUpgrade, provision.CapDestroy,
+		provision.CapStart, provision.CapStop, provision.CapRestart, provision.CapSuspend,
+		provision.CapSnapshot, provision.CapBackup, provision.CapArchive, provision.CapDisk,
+		provision.CapNetwork, provision.CapMigrate, provision.CapResize, provision.CapShell,
+	}
+}
+
 func (p *oneProvisioner) Initialize(m interface{}) error {
 	return p.initOneCluster(m)
 }
@@ -118,7 +134,10 @@ func (p *oneProvisioner) initOneCluster(i interface{}) error {
 		var nodes []cluster.Node
 		p.defaultImage = w.Image
 		p.vcpuThrottle = w.VCPUPercentage
+		p.shellUser = w.ShellUser
+		p.imageDirs = make(map[string]string, len(w.Regions))
 		for i := 0; i < len(w.Regions); i++ {
+			p.imageDirs[w.Regions[i].OneZone] = w.Regions[i].ImageDir
 			m := w.Regions[i].ToMap()
 			c := w.Regions[i].ToClusterMap()
 			n := cluster.Node{
@@ -247,9 +266,11 @@ func (p *oneProvisioner) BackupDeploy(box *provision.Box, imageId string, w io.W
 //3. &updateStatus in Scylla - Creating..
 //4. &followLogs by posting it in the queue.
 func (p *oneProvisioner) deployPipeline(box *provision.Box, imageId string, backup bool, w io.Writer) (string, error) {
+	j := journal.New(journal.DefaultStore(), deployOp, box, map[string]string{argImage: imageId, argBackup: strconv.FormatBool(backup)})
+	return p.runDeploy(j, w)
+}
 
-	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- deploy box (%s, image:%s)", box.GetFullName(), imageId)))
-
+func (p *oneProvisioner) deployActions(box *provision.Box, backup bool) []*action.Action {
 	actions := []*action.Action{&machCreating}
 	if events.IsEnabled(constants.BILLMGR) && !strings.Contains(box.Authority, "admin") {
 		if !(len(box.QuotaId) > 0) {
@@ -265,21 +286,32 @@ func (p *oneProvisioner) deployPipeline(box *provision.Box, imageId string, back
 	} else {
 		actions = append(actions, &createMachine)
 	}
-	actions = append(actions, &getVmHostIpPort, &mileStoneUpdate, &updateStatusInScylla, &updateVnchostPostInScylla, &updateStatusInScylla, &setFinalStatus, &updateStatusInScylla, &followLogs)
-
-	pipeline := action.NewPipeline(actions...)
+	return append(actions, &getVmHostIpPort, &mileStoneUpdate, &updateStatusInScylla, &updateVnchostPostInScylla, &updateStatusInScylla, &setFinalStatus, &updateStatusInScylla, &followLogs)
+}
 
-	args := runMachineActionsArgs{
-		box:           box,
-		imageId:       imageId,
+func (p *oneProvisioner) deployArgs(j *journal.Journal, w io.Writer) runMachineActionsArgs {
+	return runMachineActionsArgs{
+		box:           j.Box,
+		imageId:       j.Args[argImage],
 		writer:        w,
 		isDeploy:      true,
 		machineStatus: constants.StatusLaunching,
 		machineState:  constants.StateInitializing,
 		provisioner:   p,
 	}
+}
 
-	err := pipeline.Execute(args)
+//runs the deploy pipeline of the journal, the steps done by an earlier run are skipped.
+func (p *oneProvisioner) runDeploy(j *journal.Journal, w io.Writer) (string, error) {
+	box, imageId := j.Box, j.Args[argImage]
+	backup, _ := strconv.ParseBool(j.Args[argBackup])
+	defer j.Close()
+
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- deploy box (%s, image:%s)", box.GetFullName(), imageId)))
+
+	pipeline := action.NewPipeline(j.Wrap(p.deployActions(box, backup), decodeMachine)...)
+
+	err := pipeline.Execute(p.deployArgs(j, w))
 	if err != nil {
 		fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.ERROR, fmt.Sprintf("--- deploy pipeline for box (%s, image:%s)\n --> %s", box.GetFullName(), imageId, err)))
 		return "", err
@@ -327,6 +359,27 @@ func (p *oneProvisioner) Destroy(box *provision.Box, w io.Writer) error {
 	return nil
 }
 
+//Units is the vm of the box, a deploy over the box creates a new one next to it.
+func (p *oneProvisioner) Units(box *provision.Box) ([]string, error) {
+	if box.InstanceId == "" {
+		return nil, nil
+	}
+	return []string{box.InstanceId}, nil
+}
+
+//RemoveUnits removes the vms a deploy replaced, the box is left with its new one.
+func (p *oneProvisioner) RemoveUnits(box *provision.Box, units []string, w io.Writer) error {
+	for _, id := range units {
+		mach := machine.Machine{Name: box.GetFullName(), Region: box.Region, VMId: id}
+		fmt.Fprintf(w, lb.W(lb.DESTORYING, lb.INFO, fmt.Sprintf("  destroying old machine (%s, %s)", id, mach.Name)))
+		if err := mach.Remove(p); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, lb.W(lb.DESTORYING, lb.INFO, fmt.Sprintf("  destroyed old machine (%s, %s) OK", id, mach.Name)))
+	}
+	return nil
+}
+
 func (p *oneProvisioner) SetRunning(box *provision.Box, w io.Writer) error {
 	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- set state running box (%s)", box.GetFullName())))
 	actions := []*action.Action{
@@ -548,6 +601,37 @@ func (p *oneProvisioner) DeleteSnapshot(box *provision.Box, w io.Writer) error {
 	return nil
 }
 
+//ResizesOffline tells whether the resize powers the box off, one resizes no running vm.
+func (p *oneProvisioner) ResizesOffline(box *provision.Box) bool {
+	return box.CanCycleStop()
+}
+
+//Resize powers the machine off for the resize when it runs, see ResizesOffline.
+func (p *oneProvisioner) Resize(box *provision.Box, to provision.BoxCompute, w io.Writer) error {
+	op, status := "resize", statusResizing
+	if p.ResizesOffline(box) {
+		op, status = "offline resize", statusResizingOffline
+	}
+	fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("--- %s box (%s, %s -> %s)", op, box.GetFullName(), box.Compute.String(), to.String())))
+	args := runMachineActionsArgs{
+		box:           box,
+		writer:        w,
+		machineStatus: status,
+		provisioner:   p,
+		compute:       to,
+	}
+	actions := []*action.Action{&machCreating, &updateStatusInScylla, &resizeMachine, &updateStatusInScylla}
+
+	pipeline := action.NewPipeline(actions...)
+	err := pipeline.Execute(args)
+	if err != nil {
+		fmt.Fprintf(w, lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("--- %s box (%s)--> %s", op, box.GetFullName(), err)))
+		return err
+	}
+	fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("--- %s box (%s)OK", op, box.GetFullName())))
+	return nil
+}
+
 func (p *oneProvisioner) AttachDisk(box *provision.Box, w io.Writer) error {
 	fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("--- adding new storage to box (%s)", box.GetFullName())))
 	args := runMachineActionsArgs{
@@ -763,10 +847,6 @@ func (p *oneProvisioner) Suspend(box *provision.Box, process string, w io.Writer
 	return nil
 }
 
-func (p *oneProvisioner) Shell(provision.ShellOptions) error {
-	return provision.ErrNotImplemented
-}
-
 func (*oneProvisioner) Addr(box *provision.Box) (string, error) {
 	r, err := getRouterForBox(box)
 	if err != nil {
@@ -866,23 +946,6 @@ func (p *oneProvisioner) usePlatformImage(re *repository.Repo) bool {
 	return !re.OneClick
 }
 
-func (p *oneProvisioner) ExecuteCommandOnce(stdout, stderr io.Writer, box *provision.Box, cmd string, args ...string) error {
-	/*if boxs, err := p.listRunnableMachinesByBox(box.GetName()); err ! =nil {
-					return err
-	    }
-
-		if err := nil; err != nil {
-			return err
-		}
-		if len(boxs) == 0 {
-			return provision.ErrBoxNotFound
-		}
-		box := boxs[0]
-		return box.Exec(p, stdout, stderr, cmd, args...)
-	*/
-	return nil
-}
-
 func (p *oneProvisioner) NetworkUpdate(box *provision.Box, w io.Writer) error {
 	switch box.PolicyOps.Operation {
 	case carton.NETWORK_ATTACH:
@@ -0,0 +1,246 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+
+// Package remote runs the shells and the commands of the vms over ssh.
+package remote
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/vertice/provision"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	DefaultPort    = "22"
+	DefaultTimeout = 10 * time.Second
+)
+
+//HangupGrace is how long a shell has to exit once its client is gone, it is
+//closed after.
+var HangupGrace = 5 * time.Second
+
+var (
+	ErrNoAuth          = errors.New("no ssh key or password to log in")
+	ErrNoHostKey       = errors.New("no ssh host key to check the vm against")
+	ErrHostKeyMismatch = errors.New("ssh host key of the vm changed")
+)
+
+// Target is the vm to log in to, with the key or the password of its user.
+// HostKey is the key the vm showed at its first login, in the authorized_keys
+// format. With none, the vm is trusted on first use, Pin keeps the key it
+// shows for the next logins.
+type Target struct {
+	Host     string
+	Port     string
+	User     string
+	Key      []byte
+	Password string
+	HostKey  string
+	Pin      func(hostKey string) error
+	Timeout  time.Duration
+}
+
+// Pty is the terminal of a shell.
+type Pty struct {
+	Term   string
+	Width  int
+	Height int
+	Resize <-chan provision.TermSize
+}
+
+//the key is PEM, or PEM in base64 as the gateway may keep it.
+func signer(key []byte) (ssh.Signer, error) {
+	s, err := ssh.ParsePrivateKey(key)
+	if err == nil {
+		return s, nil
+	}
+	pem, derr := base64.StdEncoding.DecodeString(strings.TrimSpace(string(key)))
+	if derr != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(pem)
+}
+
+func (t Target) config() (*ssh.ClientConfig, error) {
+	var methods []ssh.AuthMethod
+	if len(t.Key) > 0 {
+		s, err := signer(t.Key)
+		if err != nil {
+			return nil, fmt.Errorf("ssh key of %s: %s", t.Host, err)
+		}
+		methods = append(methods, ssh.PublicKeys(s))
+	}
+	if t.Password != "" {
+		methods = append(methods, ssh.Password(t.Password))
+	}
+	if len(methods) == 0 {
+		return nil, ErrNoAuth
+	}
+	timeout := t.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	cfg := &ssh.ClientConfig{
+		User:            t.User,
+		Auth:            methods,
+		HostKeyCallback: t.checkHostKey,
+		Timeout:         timeout,
+	}
+	if t.HostKey != "" {
+		pinned, _, _, _, err := ssh.ParseAuthorizedKey([]byte(t.HostKey))
+		if err != nil {
+			return nil, fmt.Errorf("ssh host key of %s: %s", t.Host, err)
+		}
+		//the vm shows the key of the type it was pinned with, not another one of its keys.
+		cfg.HostKeyAlgorithms = []string{pinned.Type()}
+	}
+	return cfg, nil
+}
+
+//checkHostKey fails the login on a vm whose key isn't the pinned one, the vms
+//are reached on a network others may answer on.
+func (t Target) checkHostKey(hostname string, addr net.Addr, key ssh.PublicKey) error {
+	shown := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	if t.HostKey == "" {
+		if t.Pin == nil {
+			return ErrNoHostKey
+		}
+		log.Debugf("  pin ssh host key of %s %s", t.Host, ssh.FingerprintSHA256(key))
+		return t.Pin(shown)
+	}
+	pinned, _, _, _, err := ssh.ParseAuthorizedKey([]byte(t.HostKey))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(pinned.Marshal(), key.Marshal()) {
+		log.Warnf("ssh host key of %s changed, %s is not the pinned %s", t.Host, ssh.FingerprintSHA256(key), ssh.FingerprintSHA256(pinned))
+		return ErrHostKeyMismatch
+	}
+	return nil
+}
+
+func (t Target) dial() (*ssh.Client, error) {
+	cfg, err := t.config()
+	if err != nil {
+		return nil, err
+	}
+	port := t.Port
+	if port == "" {
+		port = DefaultPort
+	}
+	return ssh.Dial("tcp", net.JoinHostPort(t.Host, port), cfg)
+}
+
+// Shell opens a login shell on the vm, the conn is its terminal till either
+// side closes.
+func Shell(t Target, conn io.ReadWriter, pty Pty) error {
+	client, err := t.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	term := pty.Term
+	if term == "" {
+		term = "xterm-256color"
+	}
+	modes := ssh.TerminalModes{ssh.ECHO: 1, ssh.TTY_OP_ISPEED: 14400, ssh.TTY_OP_OSPEED: 14400}
+	if err = session.RequestPty(term, pty.Height, pty.Width, modes); err != nil {
+		return err
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	session.Stdout = conn
+	session.Stderr = conn
+	if err = session.Shell(); err != nil {
+		return err
+	}
+	grace := HangupGrace
+	go func() {
+		io.Copy(stdin, conn)
+		stdin.Close()
+		//the client is gone, hang the shell up. One that keeps running would
+		//hold the session and the vm's sshd till it exits.
+		if err := session.Signal(ssh.SIGHUP); err != nil {
+			log.Debugf("hang up shell of %s: %s", t.Host, err)
+		}
+		time.AfterFunc(grace, func() { session.Close() })
+	}()
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+	resize := pty.Resize
+	for {
+		select {
+		case err = <-done:
+			if _, ok := err.(*ssh.ExitMissingError); ok {
+				return nil //the client went away before the shell exited.
+			}
+			if _, ok := err.(*ssh.ExitError); ok {
+				return nil //the exit code of a shell is the user's business.
+			}
+			return err
+		case size, ok := <-resize:
+			if !ok {
+				resize = nil //the client is gone, the shell reads the end of its input.
+				continue
+			}
+			if err := session.WindowChange(size.Height, size.Width); err != nil {
+				log.Debugf("resize shell of %s: %s", t.Host, err)
+			}
+		}
+	}
+}
+
+// Exec runs the command on the vm, it fails when the command does.
+func Exec(t Target, stdout, stderr io.Writer, cmd string, args ...string) error {
+	client, err := t.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	session.Stdout = stdout
+	session.Stderr = stderr
+	return session.Run(Command(cmd, args...))
+}
+
+// Command is the command line a remote shell runs, the args are quoted.
+func Command(cmd string, args ...string) string {
+	line := []string{cmd}
+	for _, a := range args {
+		line = append(line, "'"+strings.Replace(a, "'", `'\''`, -1)+"'")
+	}
+	return strings.Join(line, " ")
+}
@@ -0,0 +1,318 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+
+package remote
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/virtengine/vertice/provision"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct {
+	key     []byte
+	hostKey string
+	server  *fakeServer
+}
+
+var _ = check.Suite(&S{})
+
+func pemKey(c *check.C) (*rsa.PrivateKey, []byte) {
+	k, err := rsa.GenerateKey(rand.Reader, 1024)
+	c.Assert(err, check.IsNil)
+	return k, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)})
+}
+
+func (s *S) SetUpSuite(c *check.C) {
+	k, key := pemKey(c)
+	s.key = key
+	pub, err := ssh.NewPublicKey(&k.PublicKey)
+	c.Assert(err, check.IsNil)
+	hostKey, _ := pemKey(c)
+	host, err := ssh.NewSignerFromKey(hostKey)
+	c.Assert(err, check.IsNil)
+	s.hostKey = string(ssh.MarshalAuthorizedKey(host.PublicKey()))
+	s.server = newFakeServer(c, host, pub)
+}
+
+func (s *S) TearDownSuite(c *check.C) {
+	s.server.l.Close()
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	s.server.reset()
+}
+
+func (s *S) target() Target {
+	host, port, _ := net.SplitHostPort(s.server.l.Addr().String())
+	return Target{Host: host, Port: port, User: "root", Key: s.key, HostKey: s.hostKey}
+}
+
+//fakeServer is a vm, its shell echoes the input and its commands print
+//themselves.
+type fakeServer struct {
+	l   net.Listener
+	cfg *ssh.ServerConfig
+
+	mu      sync.Mutex
+	term    string
+	sizes   [][2]uint32
+	hang    bool //the shell doesn't exit at the end of its input.
+	signals []string
+}
+
+func newFakeServer(c *check.C, host ssh.Signer, pub ssh.PublicKey) *fakeServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, k ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(k.Marshal(), pub.Marshal()) {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+		PasswordCallback: func(_ ssh.ConnMetadata, p []byte) (*ssh.Permissions, error) {
+			if string(p) == "secret" {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	cfg.AddHostKey(host)
+	f := &fakeServer{l: l, cfg: cfg}
+	go f.serve()
+	return f
+}
+
+func (f *fakeServer) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.term, f.sizes, f.hang, f.signals = "", nil, false, nil
+}
+
+func (f *fakeServer) signaled() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.signals...)
+}
+
+func (f *fakeServer) resized() [][2]uint32 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][2]uint32{}, f.sizes...)
+}
+
+func (f *fakeServer) serve() {
+	for {
+		nc, err := f.l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			_, chans, reqs, err := ssh.NewServerConn(nc, f.cfg)
+			if err != nil {
+				return
+			}
+			go ssh.DiscardRequests(reqs)
+			for nch := range chans {
+				ch, chReqs, err := nch.Accept()
+				if err != nil {
+					return
+				}
+				go f.session(ch, chReqs)
+			}
+		}()
+	}
+}
+
+func (f *fakeServer) session(ch ssh.Channel, reqs <-chan *ssh.Request) {
+	exit := func(code uint32) {
+		ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Code uint32 }{code}))
+		ch.Close()
+	}
+	for req := range reqs {
+		switch req.Type {
+		case "pty-req":
+			var pty struct {
+				Term             string
+				Cols, Rows, W, H uint32
+				Modes            string
+			}
+			ssh.Unmarshal(req.Payload, &pty)
+			f.mu.Lock()
+			f.term = pty.Term
+			f.sizes = append(f.sizes, [2]uint32{pty.Cols, pty.Rows})
+			f.mu.Unlock()
+			req.Reply(true, nil)
+		case "window-change":
+			var size struct{ Cols, Rows, W, H uint32 }
+			ssh.Unmarshal(req.Payload, &size)
+			f.mu.Lock()
+			f.sizes = append(f.sizes, [2]uint32{size.Cols, size.Rows})
+			f.mu.Unlock()
+		case "signal":
+			var sig struct{ Signal string }
+			ssh.Unmarshal(req.Payload, &sig)
+			f.mu.Lock()
+			f.signals = append(f.signals, sig.Signal)
+			f.mu.Unlock()
+		case "shell":
+			req.Reply(true, nil)
+			f.mu.Lock()
+			hang := f.hang
+			f.mu.Unlock()
+			go func() {
+				in, _ := ioutil.ReadAll(ch)
+				io.WriteString(ch, "$ "+string(in))
+				if !hang {
+					exit(0)
+				}
+			}()
+		case "exec":
+			var cmd struct{ Command string }
+			ssh.Unmarshal(req.Payload, &cmd)
+			req.Reply(true, nil)
+			go func() {
+				io.WriteString(ch, cmd.Command+"\n")
+				if strings.HasPrefix(cmd.Command, "false") {
+					io.WriteString(ch.Stderr(), "failed\n")
+					exit(1)
+					return
+				}
+				exit(0)
+			}()
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+//conn is the websocket of a shell.
+type conn struct {
+	io.Reader
+	io.Writer
+}
+
+func (s *S) TestShell(c *check.C) {
+	in, typed := io.Pipe()
+	resize := make(chan provision.TermSize)
+	var out bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- Shell(s.target(), conn{in, &out}, Pty{Term: "xterm", Width: 140, Height: 38, Resize: resize})
+	}()
+	io.WriteString(typed, "ls\n")
+	resize <- provision.TermSize{Width: 80, Height: 24}
+	for i := 0; len(s.server.resized()) < 2 && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(resize)
+	typed.Close()
+	c.Assert(<-done, check.IsNil)
+	c.Assert(out.String(), check.Equals, "$ ls\n")
+	c.Assert(s.server.term, check.Equals, "xterm")
+	c.Assert(s.server.resized(), check.DeepEquals, [][2]uint32{{140, 38}, {80, 24}})
+}
+
+func (s *S) TestShellHangsUpWhenTheClientLeaves(c *check.C) {
+	defer func(g time.Duration) { HangupGrace = g }(HangupGrace)
+	HangupGrace = 10 * time.Millisecond
+	s.server.mu.Lock()
+	s.server.hang = true
+	s.server.mu.Unlock()
+	in, typed := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- Shell(s.target(), conn{in, ioutil.Discard}, Pty{})
+	}()
+	io.WriteString(typed, "top\n")
+	typed.Close()
+	select {
+	case err := <-done:
+		c.Assert(err, check.IsNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("the shell outlived its client")
+	}
+	c.Assert(s.server.signaled(), check.DeepEquals, []string{"HUP"})
+}
+
+func (s *S) TestExec(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	c.Assert(Exec(s.target(), &stdout, &stderr, "echo", "it's", "$HOME"), check.IsNil)
+	c.Assert(stdout.String(), check.Equals, `echo 'it'\''s' '$HOME'`+"\n")
+
+	stdout.Reset()
+	err := Exec(s.target(), &stdout, &stderr, "false")
+	c.Assert(err, check.FitsTypeOf, &ssh.ExitError{})
+	c.Assert(stderr.String(), check.Equals, "failed\n")
+}
+
+func (s *S) TestLogIn(c *check.C) {
+	t := s.target()
+	t.Key = []byte(base64.StdEncoding.EncodeToString(s.key))
+	c.Assert(Exec(t, ioutil.Discard, ioutil.Discard, "true"), check.IsNil)
+
+	t.Key = nil
+	c.Assert(Exec(t, ioutil.Discard, ioutil.Discard, "true"), check.Equals, ErrNoAuth)
+	t.Password = "secret"
+	c.Assert(Exec(t, ioutil.Discard, ioutil.Discard, "true"), check.IsNil)
+	t.Password = "guess"
+	c.Assert(Exec(t, ioutil.Discard, ioutil.Discard, "true"), check.ErrorMatches, "ssh: handshake failed.*")
+	t.Key = []byte("not a key")
+	c.Assert(Exec(t, ioutil.Discard, ioutil.Discard, "true"), check.ErrorMatches, "ssh key of 127.0.0.1: .*")
+}
+
+func (s *S) TestHostKey(c *check.C) {
+	t := s.target()
+	t.HostKey = ""
+	c.Assert(Exec(t, ioutil.Discard, ioutil.Discard, "true"), check.ErrorMatches, ".*"+ErrNoHostKey.Error())
+
+	var pinned string
+	t.Pin = func(key string) error {
+		pinned = key
+		return nil
+	}
+	c.Assert(Exec(t, ioutil.Discard, ioutil.Discard, "true"), check.IsNil)
+	c.Assert(pinned, check.Equals, strings.TrimSpace(s.hostKey))
+
+	t.Pin = nil
+	t.HostKey = pinned
+	c.Assert(Exec(t, ioutil.Discard, ioutil.Discard, "true"), check.IsNil)
+
+	other, _ := pemKey(c)
+	pub, err := ssh.NewPublicKey(&other.PublicKey)
+	c.Assert(err, check.IsNil)
+	t.HostKey = string(ssh.MarshalAuthorizedKey(pub))
+	c.Assert(Exec(t, ioutil.Discard, ioutil.Discard, "true"), check.ErrorMatches, ".*"+ErrHostKeyMismatch.Error())
+}
@@ -0,0 +1,85 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+
+package one
+
+import (
+	b64 "encoding/base64"
+	"fmt"
+	"io"
+
+	"github.com/virtengine/vertice/carton"
+	"github.com/virtengine/vertice/provision"
+	"github.com/virtengine/vertice/provision/one/remote"
+)
+
+//the user the shells of the vms log in as, unless shell_user says otherwise.
+const defaultShellUser = "root"
+
+// Shell logs in to the vm over ssh, on its private ip.
+func (p *oneProvisioner) Shell(opts provision.ShellOptions) error {
+	t, err := p.sshTarget(opts.Box)
+	if err != nil {
+		return err
+	}
+	return remote.Shell(t, opts.Conn, remote.Pty{
+		Term:   opts.Term,
+		Width:  opts.Width,
+		Height: opts.Height,
+		Resize: opts.Resize,
+	})
+}
+
+func (p *oneProvisioner) ExecuteCommandOnce(stdout, stderr io.Writer, box *provision.Box, cmd string, args ...string) error {
+	t, err := p.sshTarget(box)
+	if err != nil {
+		return err
+	}
+	return remote.Exec(t, stdout, stderr, cmd, args...)
+}
+
+//sshTarget is the vm of the box, the ssh key named by its BoxSSH or else its
+//root password logs in. The host key of the vm is pinned in the outputs of the
+//assembly at the first login.
+func (p *oneProvisioner) sshTarget(box *provision.Box) (remote.Target, error) {
+	t := remote.Target{User: p.shellUser}
+	if t.User == "" {
+		t.User = defaultShellUser
+	}
+	asm, err := carton.NewAssembly(box.CartonId, box.AccountId, box.OrgId)
+	if err != nil {
+		return t, err
+	}
+	if t.Host = asm.PrivateIp(); t.Host == "" {
+		return t, fmt.Errorf("box %s has no private ip to log in", box.GetFullName())
+	}
+	t.HostKey, t.Pin = asm.SshHostKey(), asm.PinSshHostKey
+	if box.SSH.Prefix != "" {
+		k, err := carton.NewSshKey(box.AccountId, box.OrgId, box.SSH.Prefix)
+		if err != nil {
+			return t, err
+		}
+		t.Key = []byte(k.PrivateKey)
+	}
+	if box.SSH.Password != "" {
+		pwd, err := b64.StdEncoding.DecodeString(box.SSH.Password)
+		if err != nil {
+			return t, fmt.Errorf("root password of box %s: %s", box.GetFullName(), err)
+		}
+		t.Password = string(pwd)
+	}
+	return t, nil
+}
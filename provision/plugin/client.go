@@ -0,0 +1,82 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/virtengine/vertice/provision"
+)
+
+// Error is a call the plugin failed.
+type Error struct {
+	Plugin string
+	Method string
+	Status int
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("plugin %s: %s failed with %d: %s", e.Plugin, e.Method, e.Status, e.Reason)
+}
+
+type client struct {
+	name     string
+	endpoint string
+	http     *http.Client
+}
+
+func newClient(name, endpoint string, timeout time.Duration) *client {
+	return &client{
+		name:     name,
+		endpoint: strings.TrimRight(endpoint, "/"),
+		http:     &http.Client{Timeout: timeout},
+	}
+}
+
+//call posts the request to the method of the plugin, a 501 is provision.ErrNotImplemented.
+func (c *client) call(method string, req *Request) (*Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	hres, err := c.http.Post(c.endpoint+"/v1/"+method, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer hres.Body.Close()
+
+	res := &Response{}
+	derr := json.NewDecoder(hres.Body).Decode(res)
+	switch {
+	case hres.StatusCode == http.StatusNotImplemented:
+		return nil, provision.ErrNotImplemented
+	case hres.StatusCode/100 != 2:
+		reason := res.Error
+		if derr != nil || reason == "" {
+			reason = http.StatusText(hres.StatusCode)
+		}
+		return nil, &Error{Plugin: c.name, Method: method, Status: hres.StatusCode, Reason: reason}
+	case derr != nil:
+		return nil, fmt.Errorf("plugin %s: %s answered an invalid response: %s", c.name, method, derr)
+	}
+	return res, nil
+}
@@ -0,0 +1,59 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+
+// Package plugin is a provisioner that runs the boxes through an external
+// process, so a cloud vertice has no compiled-in provisioner for can be added
+// without forking it. The plugins are listed in vertice.conf:
+//
+//	[plugins]
+//	  enabled = true
+//	    [[plugins.plugin]]
+//	      name = "proxmox"
+//	      endpoint = "http://localhost:7910"
+//	      topic = "proxmox"
+//	      timeout = "10m"
+//
+// Protocol
+//
+// A plugin is an HTTP server. Every call is a POST of a JSON Request to
+// <endpoint>/v1/<method>, answered with a JSON Response:
+//
+//	Handshake        -> protocol, name, capabilities
+//	Deploy           box, image, backup -> output, outputs
+//	Destroy          box -> output
+//	Start, Stop,
+//	Restart, Suspend box, process -> output
+//	CreateSnapshot,
+//	DeleteSnapshot,
+//	RestoreSnapshot,
+//	SaveImage,
+//	DeleteImage,
+//	AttachDisk,
+//	DetachDisk       box -> output, outputs
+//	Resize           box, compute -> output
+//	Exec             box, cmd -> stdout, stderr
+//	Addr             box -> addr
+//
+// The output is copied to the log of the box, the outputs are merged in the
+// outputs of its assembly (instance_id, ips). A failed call answers a non 2xx
+// status with the error in the response, 501 when the method isn't supported.
+// The handshake answers the protocol version, ProtocolVersion, and the
+// capabilities of the plugin as provision.Capability names, only those
+// methods are called.
+//
+// The statuses of the boxes are set by vertice around the calls, a plugin
+// needn't reach the gateway. plugintest has a reference plugin.
+package plugin
@@ -0,0 +1,226 @@
+// Package plugintest is a reference plugin of the provision/plugin protocol,
+// it keeps the boxes in memory. It is written from the wire only, as a plugin
+// out of the tree would be.
+package plugintest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+const protocol = 1
+
+type compute struct {
+	Cpushare uint64 `json:"cpu"`
+	Memory   uint64 `json:"memory_mb"`
+	HDD      uint64 `json:"hdd_mb"`
+}
+
+type box struct {
+	Id      string  `json:"id"`
+	Name    string  `json:"name"`
+	Compute compute `json:"compute"`
+}
+
+type request struct {
+	Box     *box     `json:"box"`
+	Process string   `json:"process"`
+	Image   string   `json:"image"`
+	Compute *compute `json:"compute"`
+	Cmd     []string `json:"cmd"`
+}
+
+type response struct {
+	Protocol     int                 `json:"protocol,omitempty"`
+	Name         string              `json:"name,omitempty"`
+	Capabilities []string            `json:"capabilities,omitempty"`
+	Output       string              `json:"output,omitempty"`
+	Outputs      map[string][]string `json:"outputs,omitempty"`
+	Stdout       string              `json:"stdout,omitempty"`
+	Addr         string              `json:"addr,omitempty"`
+	Error        string              `json:"error,omitempty"`
+}
+
+// Machine is a box the plugin runs.
+type Machine struct {
+	Image     string
+	State     string
+	Compute   compute
+	Snapshots int
+	Disks     int
+}
+
+// FakePlugin is the plugin, serve it with Handler or start it with NewServer.
+type FakePlugin struct {
+	Name         string
+	Capabilities []string
+
+	mu       sync.Mutex
+	machines map[string]*Machine
+	calls    []string
+	failures map[string]string
+}
+
+// New returns a plugin that supports the capabilities, the methods of the
+// others answer 501.
+func New(name string, capabilities ...string) *FakePlugin {
+	return &FakePlugin{
+		Name:         name,
+		Capabilities: capabilities,
+		machines:     make(map[string]*Machine),
+		failures:     make(map[string]string),
+	}
+}
+
+// NewServer starts the plugin on a local port, see httptest.Server.
+func NewServer(name string, capabilities ...string) (*FakePlugin, *httptest.Server) {
+	f := New(name, capabilities...)
+	return f, httptest.NewServer(f.Handler())
+}
+
+// FailOn makes the method fail with the reason.
+func (f *FakePlugin) FailOn(method, reason string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[method] = reason
+}
+
+// Calls returns the methods called, in order.
+func (f *FakePlugin) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.calls...)
+}
+
+// Machine returns the box with the id, nil once destroyed.
+func (f *FakePlugin) Machine(id string) *Machine {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if m, ok := f.machines[id]; ok {
+		c := *m
+		return &c
+	}
+	return nil
+}
+
+func (f *FakePlugin) Handler() http.Handler {
+	return http.HandlerFunc(f.serve)
+}
+
+//the capability each method needs, none for the ones all the plugins answer.
+var needs = map[string]string{
+	"Handshake":       "",
+	"Exec":            "",
+	"Addr":            "",
+	"Deploy":          "deploy",
+	"Destroy":         "destroy",
+	"Start":           "start",
+	"Stop":            "stop",
+	"Restart":         "restart",
+	"Suspend":         "suspend",
+	"CreateSnapshot":  "snapshot",
+	"DeleteSnapshot":  "snapshot",
+	"RestoreSnapshot": "snapshot",
+	"SaveImage":       "backup",
+	"DeleteImage":     "backup",
+	"AttachDisk":      "disk",
+	"DetachDisk":      "disk",
+	"Resize":          "resize",
+}
+
+func (f *FakePlugin) supports(method string) bool {
+	c := needs[method]
+	if c == "" {
+		return true
+	}
+	for _, fc := range f.Capabilities {
+		if fc == c {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *FakePlugin) serve(w http.ResponseWriter, r *http.Request) {
+	method := strings.TrimPrefix(r.URL.Path, "/v1/")
+	if _, known := needs[method]; r.Method != "POST" || !known {
+		reply(w, http.StatusNotFound, &response{Error: "no such method " + r.URL.Path})
+		return
+	}
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		reply(w, http.StatusBadRequest, &response{Error: err.Error()})
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, method)
+	if reason, ok := f.failures[method]; ok {
+		reply(w, http.StatusInternalServerError, &response{Error: reason})
+		return
+	}
+	if !f.supports(method) {
+		reply(w, http.StatusNotImplemented, &response{Error: method + " is not supported"})
+		return
+	}
+	if method == "Handshake" {
+		reply(w, http.StatusOK, &response{Protocol: protocol, Name: f.Name, Capabilities: f.Capabilities})
+		return
+	}
+	if req.Box == nil {
+		reply(w, http.StatusBadRequest, &response{Error: "no box"})
+		return
+	}
+	if method == "Deploy" {
+		f.machines[req.Box.Id] = &Machine{Image: req.Image, State: "running", Compute: req.Box.Compute}
+		reply(w, http.StatusOK, &response{
+			Output:  "deployed " + req.Box.Name,
+			Outputs: map[string][]string{"instance_id": {"fake-" + req.Box.Id}},
+		})
+		return
+	}
+
+	m, ok := f.machines[req.Box.Id]
+	if !ok {
+		reply(w, http.StatusNotFound, &response{Error: "box " + req.Box.Id + " not found"})
+		return
+	}
+	res := &response{Output: strings.ToLower(method) + " " + req.Box.Name}
+	switch method {
+	case "Destroy":
+		delete(f.machines, req.Box.Id)
+	case "Start", "Restart":
+		m.State = "running"
+	case "Stop":
+		m.State = "stopped"
+	case "Suspend":
+		m.State = "suspended"
+	case "CreateSnapshot":
+		m.Snapshots++
+	case "DeleteSnapshot":
+		m.Snapshots--
+	case "AttachDisk":
+		m.Disks++
+	case "DetachDisk":
+		m.Disks--
+	case "Resize":
+		if req.Compute != nil {
+			m.Compute = *req.Compute
+		}
+	case "Exec":
+		res = &response{Stdout: strings.Join(req.Cmd, " ")}
+	case "Addr":
+		res = &response{Addr: "10.0.0.1"}
+	}
+	reply(w, http.StatusOK, res)
+}
+
+func reply(w http.ResponseWriter, status int, res *response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,127 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package plugin
+
+import (
+	"github.com/virtengine/vertice/provision"
+)
+
+// ProtocolVersion is the version of the protocol vertice speaks, a plugin
+// answering another one in the handshake is refused.
+const ProtocolVersion = 1
+
+//the methods of the protocol, see the package doc.
+const (
+	Handshake       = "Handshake"
+	Deploy          = "Deploy"
+	Destroy         = "Destroy"
+	Start           = "Start"
+	Stop            = "Stop"
+	Restart         = "Restart"
+	Suspend         = "Suspend"
+	CreateSnapshot  = "CreateSnapshot"
+	DeleteSnapshot  = "DeleteSnapshot"
+	RestoreSnapshot = "RestoreSnapshot"
+	SaveImage       = "SaveImage"
+	DeleteImage     = "DeleteImage"
+	AttachDisk      = "AttachDisk"
+	DetachDisk      = "DetachDisk"
+	Resize          = "Resize"
+	Exec            = "Exec"
+	Addr            = "Addr"
+)
+
+// Box is what a plugin is told of a provision.Box, without the credentials
+// of the account.
+type Box struct {
+	Id           string            `json:"id"`
+	CartonId     string            `json:"carton_id"`
+	CartonsId    string            `json:"cartons_id"`
+	AccountId    string            `json:"account_id"`
+	Name         string            `json:"name"`
+	Tosca        string            `json:"tosca"`
+	Region       string            `json:"region"`
+	InstanceId   string            `json:"instance_id,omitempty"`
+	ImageName    string            `json:"image_name,omitempty"`
+	ImageVersion string            `json:"image_version,omitempty"`
+	Repo         string            `json:"repo,omitempty"`
+	Compute      Compute           `json:"compute"`
+	Envs         map[string]string `json:"envs,omitempty"`
+}
+
+// Compute is the size of a box, the sizes in megabytes.
+type Compute struct {
+	Cpushare  uint64 `json:"cpu"`
+	Memory    uint64 `json:"memory_mb"`
+	Swap      uint64 `json:"swap_mb,omitempty"`
+	HDD       uint64 `json:"hdd_mb"`
+	DiskClass string `json:"disk_class,omitempty"`
+}
+
+type Request struct {
+	Box     *Box     `json:"box,omitempty"`
+	Process string   `json:"process,omitempty"`
+	Image   string   `json:"image,omitempty"`
+	Backup  bool     `json:"backup,omitempty"`
+	Compute *Compute `json:"compute,omitempty"`
+	Cmd     []string `json:"cmd,omitempty"`
+}
+
+type Response struct {
+	Protocol     int                    `json:"protocol,omitempty"`
+	Name         string                 `json:"name,omitempty"`
+	Capabilities []provision.Capability `json:"capabilities,omitempty"`
+	Output       string                 `json:"output,omitempty"`
+	Outputs      map[string][]string    `json:"outputs,omitempty"`
+	Stdout       string                 `json:"stdout,omitempty"`
+	Stderr       string                 `json:"stderr,omitempty"`
+	Addr         string                 `json:"addr,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+}
+
+func newCompute(c provision.BoxCompute) *Compute {
+	return &Compute{
+		Cpushare:  c.Cpushare,
+		Memory:    c.Memory.MB(),
+		Swap:      c.Swap.MB(),
+		HDD:       c.HDD.MB(),
+		DiskClass: string(c.DiskClass),
+	}
+}
+
+func newBox(b *provision.Box) *Box {
+	box := &Box{
+		Id:           b.Id,
+		CartonId:     b.CartonId,
+		CartonsId:    b.CartonsId,
+		AccountId:    b.AccountId,
+		Name:         b.GetFullName(),
+		Tosca:        b.Tosca,
+		Region:       b.Region,
+		InstanceId:   b.InstanceId,
+		ImageName:    b.ImageName,
+		ImageVersion: b.ImageVersion,
+		Compute:      *newCompute(b.Compute),
+		Envs:         make(map[string]string, len(b.Envs)),
+	}
+	if b.Repo != nil {
+		box.Repo = b.Repo.Gitr()
+	}
+	for _, e := range b.Envs {
+		box.Envs[e.Name] = e.Value
+	}
+	return box
+}
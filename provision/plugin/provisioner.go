@@ -0,0 +1,268 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/libgo/events/alerts"
+	"github.com/virtengine/libgo/utils"
+	constants "github.com/virtengine/libgo/utils"
+	lb "github.com/virtengine/vertice/logbox"
+	"github.com/virtengine/vertice/provision"
+	"github.com/virtengine/vertice/toml"
+)
+
+const DefaultTimeout = 10 * time.Minute
+
+//the statuses of a resize, as provision/one sets them.
+const (
+	statusResizing = constants.Status("resizing")
+	statusResized  = constants.Status("resized")
+)
+
+// Plugin is a plugin provisioner as vertice.conf lists it.
+type Plugin struct {
+	Name     string        `json:"name" toml:"name"`
+	Endpoint string        `json:"endpoint" toml:"endpoint"`
+	Topic    string        `json:"topic" toml:"topic"`
+	Timeout  toml.Duration `json:"timeout" toml:"timeout"`
+}
+
+type pluginProvisioner struct {
+	name     string
+	client   *client
+	caps     []provision.Capability
+	recorder Recorder
+}
+
+// Register adds the plugin to the provisioners under its name, it is
+// reachable once initialized with its Plugin.
+func Register(c Plugin) {
+	provision.Register(c.Name, &pluginProvisioner{name: c.Name, recorder: cartonRecorder{}})
+}
+
+func (p *pluginProvisioner) String() string {
+	if p.client == nil {
+		return "✗ plugin " + p.name
+	}
+	return "ready"
+}
+
+// Initialize shakes hands with the plugin, which answers its capabilities.
+func (p *pluginProvisioner) Initialize(m interface{}) error {
+	c, ok := m.(Plugin)
+	if !ok {
+		return errors.New("plugin provisioner needs its plugin config")
+	}
+	timeout := time.Duration(c.Timeout)
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	cl := newClient(c.Name, c.Endpoint, timeout)
+	res, err := cl.call(Handshake, &Request{})
+	if err != nil {
+		return err
+	}
+	if res.Protocol != ProtocolVersion {
+		return fmt.Errorf("plugin %s speaks the protocol %d, vertice speaks %d", c.Name, res.Protocol, ProtocolVersion)
+	}
+	p.client = cl
+	p.caps = make([]provision.Capability, 0, len(res.Capabilities))
+	for _, cp := range res.Capabilities {
+		if cp != provision.CapShell { //no shells over the protocol yet.
+			p.caps = append(p.caps, cp)
+		}
+	}
+	return nil
+}
+
+func (p *pluginProvisioner) StartupMessage() (string, error) {
+	return fmt.Sprintf("  > plugin %s (%s) %v", p.name, p.client.endpoint, p.caps), nil
+}
+
+func (p *pluginProvisioner) Capabilities() []provision.Capability {
+	return p.caps
+}
+
+//run sets the box to status, calls the method of the plugin and sets it to done,
+//or to error when the plugin failed.
+func (p *pluginProvisioner) run(box *provision.Box, w io.Writer, kind, method string, req *Request, status, done utils.Status) error {
+	fmt.Fprintf(w, lb.W(kind, lb.INFO, fmt.Sprintf("--- %s box (%s) on %s", method, box.GetFullName(), p.name)))
+	if err := p.recorder.SetStatus(box, status); err != nil {
+		return err
+	}
+	req.Box = newBox(box)
+	res, err := p.client.call(method, req)
+	if err != nil {
+		fmt.Fprintf(w, lb.W(kind, lb.ERROR, fmt.Sprintf("--- %s box (%s) on %s --> %s", method, box.GetFullName(), p.name, err)))
+		if serr := p.recorder.SetStatus(box, constants.StatusError); serr != nil {
+			log.Errorf("Unable to set the error of %s : %s", box.GetFullName(), serr)
+		}
+		return err
+	}
+	if res.Output != "" {
+		fmt.Fprintln(w, res.Output)
+	}
+	if err = p.recorder.SetOutputs(box, res.Outputs); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, lb.W(kind, lb.INFO, fmt.Sprintf("--- %s box (%s) on %s OK", method, box.GetFullName(), p.name)))
+	return p.recorder.SetStatus(box, done)
+}
+
+func (p *pluginProvisioner) deploy(box *provision.Box, image string, backup bool, w io.Writer) (string, error) {
+	err := p.run(box, w, lb.DEPLOY, Deploy, &Request{Image: image, Backup: backup}, constants.StatusLaunching, constants.StatusLaunched)
+	if err != nil {
+		return "", err
+	}
+	//nothing in the box calls back, it runs once the plugin is done.
+	return image, p.SetRunning(box, w)
+}
+
+func (p *pluginProvisioner) ImageDeploy(box *provision.Box, image string, w io.Writer) (string, error) {
+	return p.deploy(box, image, false, w)
+}
+
+func (p *pluginProvisioner) BackupDeploy(box *provision.Box, image string, w io.Writer) (string, error) {
+	return p.deploy(box, image, true, w)
+}
+
+func (p *pluginProvisioner) GitDeploy(box *provision.Box, w io.Writer) (string, error) {
+	if box.Repo == nil {
+		return "", fmt.Errorf("box %s has no repository to deploy", box.GetFullName())
+	}
+	return p.deploy(box, box.Repo.Gitr(), false, w)
+}
+
+func (p *pluginProvisioner) SetRunning(box *provision.Box, w io.Writer) error {
+	if err := p.recorder.SetStatus(box, constants.StatusRunning); err != nil {
+		return err
+	}
+	if err := p.recorder.SetState(box, constants.StateRunning); err != nil {
+		return err
+	}
+	return p.recorder.Notify(box, w, alerts.RUNNING)
+}
+
+func (p *pluginProvisioner) SetState(box *provision.Box, w io.Writer, changeto utils.Status) error {
+	if err := p.recorder.SetStatus(box, changeto); err != nil {
+		return err
+	}
+	return p.recorder.Notify(box, w, alerts.LAUNCHED)
+}
+
+func (p *pluginProvisioner) SetBoxStatus(box *provision.Box, w io.Writer, status utils.Status) error {
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- status %s box %s", box.GetFullName(), status.String())))
+	return p.recorder.SetStatus(box, status)
+}
+
+func (p *pluginProvisioner) Destroy(box *provision.Box, w io.Writer) error {
+	if err := p.run(box, w, lb.DESTORYING, Destroy, &Request{}, constants.StatusDestroying, constants.StatusDestroyed); err != nil {
+		return err
+	}
+	return p.recorder.Notify(box, w, alerts.DESTROYED)
+}
+
+func (p *pluginProvisioner) Start(box *provision.Box, process string, w io.Writer) error {
+	if err := p.run(box, w, lb.STARTING, Start, &Request{Process: process}, constants.StatusStarting, constants.StatusStarted); err != nil {
+		return err
+	}
+	return p.recorder.SetState(box, constants.StateRunning)
+}
+
+func (p *pluginProvisioner) Stop(box *provision.Box, process string, w io.Writer) error {
+	if err := p.run(box, w, lb.STOPPING, Stop, &Request{Process: process}, constants.StatusStopping, constants.StatusStopped); err != nil {
+		return err
+	}
+	return p.recorder.SetState(box, constants.StateStopped)
+}
+
+func (p *pluginProvisioner) Restart(box *provision.Box, process string, w io.Writer) error {
+	return p.run(box, w, lb.RESTARTING, Restart, &Request{Process: process}, constants.StatusStarting, constants.StatusStarted)
+}
+
+func (p *pluginProvisioner) Suspend(box *provision.Box, process string, w io.Writer) error {
+	return p.run(box, w, lb.STOPPING, Suspend, &Request{Process: process}, constants.StatusSuspending, constants.StatusSuspended)
+}
+
+func (p *pluginProvisioner) CreateSnapshot(box *provision.Box, w io.Writer) error {
+	return p.run(box, w, lb.UPDATING, CreateSnapshot, &Request{}, constants.StatusSnapCreating, constants.StatusSnapCreated)
+}
+
+func (p *pluginProvisioner) DeleteSnapshot(box *provision.Box, w io.Writer) error {
+	return p.run(box, w, lb.UPDATING, DeleteSnapshot, &Request{}, constants.StatusSnapDeleting, constants.StatusSnapDeleted)
+}
+
+func (p *pluginProvisioner) RestoreSnapshot(box *provision.Box, w io.Writer) error {
+	return p.run(box, w, lb.UPDATING, RestoreSnapshot, &Request{}, constants.StatusSnapRestoring, constants.StatusSnapRestored)
+}
+
+func (p *pluginProvisioner) SaveImage(box *provision.Box, w io.Writer) error {
+	return p.run(box, w, lb.UPDATING, SaveImage, &Request{}, constants.StatusBackupCreating, constants.StatusBackupCreated)
+}
+
+func (p *pluginProvisioner) DeleteImage(box *provision.Box, w io.Writer) error {
+	return p.run(box, w, lb.UPDATING, DeleteImage, &Request{}, constants.StatusBackupDeleting, constants.StatusBackupDeleted)
+}
+
+func (p *pluginProvisioner) AttachDisk(box *provision.Box, w io.Writer) error {
+	return p.run(box, w, lb.UPDATING, AttachDisk, &Request{}, constants.StatusDiskAttaching, constants.StatusRunning)
+}
+
+func (p *pluginProvisioner) DetachDisk(box *provision.Box, w io.Writer) error {
+	return p.run(box, w, lb.UPDATING, DetachDisk, &Request{}, constants.StatusDiskDetaching, constants.StatusDiskDetached)
+}
+
+func (p *pluginProvisioner) Resize(box *provision.Box, to provision.BoxCompute, w io.Writer) error {
+	return p.run(box, w, lb.UPDATING, Resize, &Request{Compute: newCompute(to)}, statusResizing, statusResized)
+}
+
+func (p *pluginProvisioner) Shell(provision.ShellOptions) error {
+	return provision.ErrNotImplemented
+}
+
+func (p *pluginProvisioner) ExecuteCommandOnce(stdout, stderr io.Writer, box *provision.Box, cmd string, args ...string) error {
+	res, err := p.client.call(Exec, &Request{Box: newBox(box), Cmd: append([]string{cmd}, args...)})
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(stdout, res.Stdout); err != nil {
+		return err
+	}
+	_, err = io.WriteString(stderr, res.Stderr)
+	return err
+}
+
+func (p *pluginProvisioner) Addr(box *provision.Box) (string, error) {
+	res, err := p.client.call(Addr, &Request{Box: newBox(box)})
+	if err != nil {
+		return "", err
+	}
+	return res.Addr, nil
+}
+
+func (p *pluginProvisioner) MetricEnvs(start int64, end int64, region string, w io.Writer) ([]interface{}, error) {
+	return nil, nil
+}
+
+func (p *pluginProvisioner) TriggerBills(account_id, cat_id, name string) error {
+	return nil
+}
@@ -0,0 +1,144 @@
+package plugin
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/virtengine/libgo/events/alerts"
+	"github.com/virtengine/libgo/utils"
+	constants "github.com/virtengine/libgo/utils"
+	"github.com/virtengine/vertice/provision"
+	"github.com/virtengine/vertice/provision/plugin/plugintest"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct {
+	fake   *plugintest.FakePlugin
+	server *httptest.Server
+	rec    *fakeRecorder
+	p      *pluginProvisioner
+}
+
+var _ = check.Suite(&S{})
+
+type fakeRecorder struct {
+	statuses []utils.Status
+	states   []utils.State
+	outputs  map[string][]string
+	notified []alerts.EventAction
+}
+
+func (r *fakeRecorder) SetStatus(b *provision.Box, status utils.Status) error {
+	r.statuses = append(r.statuses, status)
+	return nil
+}
+
+func (r *fakeRecorder) SetState(b *provision.Box, state utils.State) error {
+	r.states = append(r.states, state)
+	return nil
+}
+
+func (r *fakeRecorder) SetOutputs(b *provision.Box, outputs map[string][]string) error {
+	r.outputs = outputs
+	return nil
+}
+
+func (r *fakeRecorder) Notify(b *provision.Box, w io.Writer, action alerts.EventAction) error {
+	r.notified = append(r.notified, action)
+	return nil
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	s.fake, s.server = plugintest.NewServer("fake", "deploy", "destroy", "start", "stop", "resize", "shell")
+	s.rec = &fakeRecorder{}
+	s.p = &pluginProvisioner{name: "fake", recorder: s.rec}
+	c.Assert(s.p.Initialize(Plugin{Name: "fake", Endpoint: s.server.URL + "/"}), check.IsNil)
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	s.server.Close()
+}
+
+func (s *S) box() *provision.Box {
+	return &provision.Box{Id: "BOX1", CartonId: "ASM1", CartonName: "vm1", DomainName: "megam.io",
+		Compute: provision.BoxCompute{Cpushare: 2, Memory: 2 * provision.GB, HDD: 20 * provision.GB}}
+}
+
+func (s *S) TestInitialize(c *check.C) {
+	c.Assert(s.p.String(), check.Equals, "ready")
+	c.Assert(provision.Capabilities(s.p), check.DeepEquals, []provision.Capability{
+		provision.CapDeploy, provision.CapDestroy, provision.CapResize, provision.CapStart, provision.CapStop})
+	c.Assert(provision.Supports(s.p, provision.CapShell), check.Equals, false)
+
+	c.Assert((&pluginProvisioner{}).Initialize("fake"), check.NotNil)
+}
+
+func (s *S) TestInitializeRefusesAnotherProtocol(c *check.C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"protocol": 2}`))
+	}))
+	defer srv.Close()
+	err := (&pluginProvisioner{}).Initialize(Plugin{Name: "next", Endpoint: srv.URL})
+	c.Assert(err, check.ErrorMatches, ".*protocol 2.*")
+}
+
+func (s *S) TestDeploy(c *check.C) {
+	var w bytes.Buffer
+	image, err := s.p.ImageDeploy(s.box(), "ubuntu", &w)
+	c.Assert(err, check.IsNil)
+	c.Assert(image, check.Equals, "ubuntu")
+	c.Assert(s.rec.statuses, check.DeepEquals, []utils.Status{constants.StatusLaunching, constants.StatusLaunched, constants.StatusRunning})
+	c.Assert(s.rec.states, check.DeepEquals, []utils.State{constants.StateRunning})
+	c.Assert(s.rec.outputs, check.DeepEquals, map[string][]string{"instance_id": {"fake-BOX1"}})
+	c.Assert(s.rec.notified, check.DeepEquals, []alerts.EventAction{alerts.RUNNING})
+	c.Assert(w.String(), check.Matches, "(?s).*deployed vm1.megam.io.*")
+
+	m := s.fake.Machine("BOX1")
+	c.Assert(m.Image, check.Equals, "ubuntu")
+	c.Assert(m.Compute.Memory, check.Equals, uint64(2048))
+}
+
+func (s *S) TestLifecycle(c *check.C) {
+	_, err := s.p.ImageDeploy(s.box(), "ubuntu", &bytes.Buffer{})
+	c.Assert(err, check.IsNil)
+	c.Assert(s.p.Stop(s.box(), "", &bytes.Buffer{}), check.IsNil)
+	c.Assert(s.fake.Machine("BOX1").State, check.Equals, "stopped")
+	c.Assert(s.p.Resize(s.box(), provision.BoxCompute{Cpushare: 4, Memory: 8 * provision.GB, HDD: 40 * provision.GB}, &bytes.Buffer{}), check.IsNil)
+	c.Assert(s.fake.Machine("BOX1").Compute.Cpushare, check.Equals, uint64(4))
+	c.Assert(s.p.Destroy(s.box(), &bytes.Buffer{}), check.IsNil)
+	c.Assert(s.fake.Machine("BOX1"), check.IsNil)
+	c.Assert(s.fake.Calls(), check.DeepEquals, []string{"Handshake", "Deploy", "Stop", "Resize", "Destroy"})
+}
+
+func (s *S) TestFailure(c *check.C) {
+	s.fake.FailOn("Deploy", "no room left")
+	_, err := s.p.ImageDeploy(s.box(), "ubuntu", &bytes.Buffer{})
+	c.Assert(err, check.FitsTypeOf, &Error{})
+	c.Assert(err, check.ErrorMatches, ".*no room left")
+	c.Assert(s.rec.statuses, check.DeepEquals, []utils.Status{constants.StatusLaunching, constants.StatusError})
+}
+
+func (s *S) TestNotImplemented(c *check.C) {
+	_, err := s.p.ImageDeploy(s.box(), "ubuntu", &bytes.Buffer{})
+	c.Assert(err, check.IsNil)
+	c.Assert(s.p.CreateSnapshot(s.box(), &bytes.Buffer{}), check.Equals, provision.ErrNotImplemented)
+	c.Assert(s.p.Shell(provision.ShellOptions{}), check.Equals, provision.ErrNotImplemented)
+}
+
+func (s *S) TestExecAndAddr(c *check.C) {
+	_, err := s.p.ImageDeploy(s.box(), "ubuntu", &bytes.Buffer{})
+	c.Assert(err, check.IsNil)
+	var stdout, stderr bytes.Buffer
+	c.Assert(s.p.ExecuteCommandOnce(&stdout, &stderr, s.box(), "uptime", "-p"), check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "uptime -p")
+	addr, err := s.p.Addr(s.box())
+	c.Assert(err, check.IsNil)
+	c.Assert(addr, check.Equals, "10.0.0.1")
+}
@@ -0,0 +1,89 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package plugin
+
+import (
+	"io"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/libgo/events/alerts"
+	"github.com/virtengine/libgo/utils"
+	"github.com/virtengine/vertice/carton"
+	"github.com/virtengine/vertice/provision"
+)
+
+// Recorder keeps the status, state and outputs of the boxes a plugin runs,
+// on the side of vertice, and tells their users when they are done.
+type Recorder interface {
+	SetStatus(b *provision.Box, status utils.Status) error
+	SetState(b *provision.Box, state utils.State) error
+	SetOutputs(b *provision.Box, outputs map[string][]string) error
+	Notify(b *provision.Box, w io.Writer, action alerts.EventAction) error
+}
+
+//cartonRecorder records in the assemblies and components, as the machines of one do.
+type cartonRecorder struct{}
+
+func (cartonRecorder) SetStatus(b *provision.Box, status utils.Status) error {
+	log.Debugf("  set status[%s] of box (%s, %s)", b.Id, b.GetFullName(), status.String())
+	if asm, err := carton.NewAssembly(b.CartonId, b.AccountId, ""); err != nil {
+		return err
+	} else if err = asm.SetStatus(status); err != nil {
+		return err
+	}
+
+	if b.Level == provision.BoxSome {
+		if comp, err := carton.NewComponent(b.Id, b.AccountId, ""); err != nil {
+			return err
+		} else if err = comp.SetStatus(status, b.AccountId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cartonRecorder) SetState(b *provision.Box, state utils.State) error {
+	log.Debugf("  set state[%s] of box (%s, %s)", b.Id, b.GetFullName(), state.String())
+	if asm, err := carton.NewAssembly(b.CartonId, b.AccountId, ""); err != nil {
+		return err
+	} else if err = asm.SetState(state); err != nil {
+		return err
+	}
+
+	if b.Level == provision.BoxSome {
+		if comp, err := carton.NewComponent(b.Id, b.AccountId, ""); err != nil {
+			return err
+		} else if err = comp.SetState(state, b.AccountId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cartonRecorder) SetOutputs(b *provision.Box, outputs map[string][]string) error {
+	if len(outputs) == 0 {
+		return nil
+	}
+	asm, err := carton.NewAssembly(b.CartonId, b.AccountId, "")
+	if err != nil {
+		return err
+	}
+	return asm.NukeAndSetOutputs(outputs)
+}
+
+func (cartonRecorder) Notify(b *provision.Box, w io.Writer, action alerts.EventAction) error {
+	return carton.DoneNotify(b, w, action, "")
+}
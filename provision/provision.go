@@ -78,6 +78,16 @@ type ShellOptions struct {
 	Height int
 	Unit   string
 	Term   string
+
+	// Resize has the new sizes of the terminal of the client, it is closed when
+	// the client goes away. The size it starts with is Width and Height.
+	Resize <-chan TermSize
+}
+
+// TermSize is the size of a terminal, in characters.
+type TermSize struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
 }
 
 // GitDeployer is a provisioner that can deploy the box from a Git
@@ -93,6 +103,45 @@ type ImageDeployer interface {
 	BackupDeploy(b *Box, image string, w io.Writer) (string, error)
 }
 
+// UnitReplacer is a provisioner that deploys a box next to the unit it runs, a
+// machine or a container, the old unit keeps serving until the new one is up.
+// Units lists the units of the box before the deploy, RemoveUnits removes them
+// after it. Unlike Destroy it leaves the box, its state, quota and routes, alone.
+type UnitReplacer interface {
+	Units(b *Box) ([]string, error)
+	RemoveUnits(b *Box, units []string, w io.Writer) error
+}
+
+// ImageArchiver is a provisioner that can move the image of a backup in
+// and out of its datastore, to carry it in an archive.
+type ImageArchiver interface {
+	// OpenImage reads the backup image at source, with its size.
+	OpenImage(b *Box, source string) (io.ReadCloser, int64, error)
+
+	// StoreImage saves the image read from r in the datastore of the box
+	// region, and returns the image name to BackupDeploy.
+	StoreImage(b *Box, name string, r io.Reader, w io.Writer) (string, error)
+}
+
+// Migrator is a provisioner that can move a box to another region of its
+// cloud. The box runs in the target region before the source is destroyed.
+type Migrator interface {
+	Migrate(b *Box, region string, w io.Writer) error
+}
+
+// Resizer is a provisioner that can change the size of a deployed box, b
+// carries the compute it runs with.
+type Resizer interface {
+	Resize(b *Box, to BoxCompute, w io.Writer) error
+}
+
+// OfflineResizer is a Resizer that powers b off to resize it when it runs, the
+// box is down for the resize.
+type OfflineResizer interface {
+	Resizer
+	ResizesOffline(b *Box) bool
+}
+
 // StateChanger changes the state of a deployed box
 // A deployed box is termed as a machine or a container
 type StateChanger interface {
@@ -205,6 +254,11 @@ func Register(name string, p Provisioner) {
 	provisioners[name] = p
 }
 
+// Unregister removes the named provisioner from the registry.
+func Unregister(name string) {
+	delete(provisioners, name)
+}
+
 // Get gets the named provisioner from the registry.
 func Get(name string) (Provisioner, error) {
 	p, ok := provisioners[name]
@@ -44,6 +44,14 @@ func (ProvisionSuite) TestRegisterAndGetProvisioner(c *check.C) {
 	c.Assert(err.Error(), check.Equals, expectedMessage)
 }
 
+func (ProvisionSuite) TestUnregisterProvisioner(c *check.C) {
+	var p Provisioner
+	Register("my-provisioner", p)
+	Unregister("my-provisioner")
+	_, err := Get("my-provisioner")
+	c.Assert(err, check.NotNil)
+}
+
 func (ProvisionSuite) TestRegistry(c *check.C) {
 	var p1, p2 Provisioner
 	Register("my-provisioner", p1)
@@ -48,9 +48,9 @@ func NewFakeCarton(name, tosca string, lvl provision.BoxLevel, units int) *FakeC
 			Tosca:        tosca,
 			ImageVersion: "",
 			Compute: provision.BoxCompute{
-				Cpushare: "0.2",
-				Memory:   "512",
-				HDD:      "",
+				Cpushare: 1,
+				Memory:   512 * provision.MB,
+				HDD:      10 * provision.GB,
 			},
 			Status:   constants.StatusLaunching,
 			Provider: "one",
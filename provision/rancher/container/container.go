@@ -91,7 +91,7 @@ func (c *Container) Create(args *CreateArgs) error {
 		Name:          c.BoxName,
 		ImageUuid:     "docker" + ":" + args.ImageId,
 		Memory:        int64(args.Box.ConGetMemory()),
-		MemorySwap:    int64(args.Box.ConGetMemory() + args.Box.GetSwap()),
+		MemorySwap:    int64(args.Box.ConGetMemory() + args.Box.ConGetSwap()),
 		CpuShares:     int64(args.Box.GetCpushare()),
 		StartOnCreate: true,
 	}
@@ -68,6 +68,14 @@ func (p *rancherProvisioner) String() string {
 	return "ready"
 }
 
+//only the lifecycle of the containers, the rest are no-ops.
+func (p *rancherProvisioner) Capabilities() []provision.Capability {
+	return []provision.Capability{
+		provision.CapDeploy, provision.CapUpgrade, provision.CapDestroy,
+		provision.CapStart, provision.CapStop,
+	}
+}
+
 func (p *rancherProvisioner) Initialize(m interface{}) error {
 	return p.initRancherCluster(m)
 }
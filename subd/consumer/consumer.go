@@ -0,0 +1,183 @@
+// Package consumer runs the carton requests the provisioner daemons receive on
+// their topics. A request is held while it runs, skipped when the ledger saw it
+// before, retried or dead lettered by the retry policy and drained when vertice
+// shuts down.
+package consumer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	nsq "github.com/crackcomm/nsqueue/consumer"
+	"github.com/virtengine/libgo/cmd"
+	"github.com/virtengine/vertice/carton"
+	"github.com/virtengine/vertice/meta"
+	"github.com/virtengine/vertice/provision"
+	"github.com/virtengine/vertice/provision/journal"
+	"github.com/virtengine/vertice/subd/drain"
+	"github.com/virtengine/vertice/subd/retry"
+)
+
+const maxInFlight = 150
+
+// Topic is a topic of carton requests with what serves them.
+type Topic struct {
+	Name   string
+	Serve  func(r *carton.Requests) error
+	Retry  *retry.Policy
+	Ledger *Ledger
+}
+
+// NewTopic returns the topic with its retries and a ledger under the vertice dir.
+func NewTopic(c *meta.Config, name string, serve func(r *carton.Requests) error) *Topic {
+	return &Topic{
+		Name:   name,
+		Serve:  serve,
+		Retry:  retry.NewPolicy(name, nil),
+		Ledger: NewLedger(NewFileLedger(LedgerDir(c, name), DefaultLedgerTTL)),
+	}
+}
+
+//LedgerDir keeps the ledger of the topic under the vertice dir, it outlives a restart.
+func LedgerDir(c *meta.Config, topic string) string {
+	dir := os.TempDir()
+	if c != nil && c.Dir != "" {
+		dir = c.Dir
+	}
+	return filepath.Join(dir, "ledger", topic)
+}
+
+// Consumer reads the topics of a daemon.
+type Consumer struct {
+	inflight *drain.Tracker
+	nsq      *nsq.Consumer
+	Meta     *meta.Config
+	Topics   []*Topic
+}
+
+func New(c *meta.Config, topics ...*Topic) *Consumer {
+	return &Consumer{
+		inflight: drain.NewTracker(),
+		Meta:     c,
+		Topics:   topics,
+	}
+}
+
+// Open forgets the requests the last run left pending, unless resumed tells
+// that their journal picks them up, and starts listening to the topics.
+func (c *Consumer) Open(resumed func(e *LedgerEntry) bool) {
+	for _, t := range c.Topics {
+		t.Retry.NSQd = c.Meta.NSQd
+		if err := t.Ledger.ForgetInterrupted(resumed); err != nil {
+			log.Errorf("Unable to forget the interrupted requests of %s : %s", t.Name, err)
+		}
+	}
+	go func() error {
+		for _, t := range c.Topics {
+			t := t
+			if err := nsq.Register(t.Name, "engine", maxInFlight, func(msg *nsq.Message) { c.process(t, msg) }); err != nil {
+				return err
+			}
+		}
+		if err := nsq.Connect(c.Meta.NSQd...); err != nil {
+			return err
+		}
+		c.nsq = nsq.DefaultConsumer
+		nsq.Start(true)
+		return nil
+	}()
+}
+
+// process hands the request over to the topic in the background. The message is
+// acknowledged once the request is done, see retry.Policy.
+func (c *Consumer) process(t *Topic, msg *nsq.Message) {
+	log.Debugf(t.Name + " queue received message  :" + string(msg.Body))
+	release := t.Retry.Hold(msg)
+	re, err := carton.NewRequests(msg.Body)
+	if err != nil {
+		log.Errorf("%s", err)
+		release()
+		t.Retry.Done(msg, err)
+		return
+	}
+	done, ok := c.inflight.Add(&drain.Job{
+		Id:   re.Id,
+		Desc: t.Name + " " + re.Category + " " + re.Action + " " + re.CatId,
+		//the job may still answer the message, nsqd redelivers it once it
+		//times out otherwise.
+		Interrupt: release,
+	})
+	if !ok { //shutting down, leave it to the next vertice.
+		release()
+		msg.Requeue(0)
+		return
+	}
+	go func() {
+		defer done()
+		defer release()
+		_, err := t.Ledger.Run(re, t.Serve)
+		t.Retry.Done(msg, err)
+	}()
+}
+
+// Close closes the underlying subscribe channel, and waits for the requests in flight.
+func (c *Consumer) Close() error {
+	if c.nsq != nil {
+		c.nsq.Stop()
+	}
+
+	if left := c.inflight.Drain(drain.Timeout(c.Meta)); len(left) > 0 {
+		return fmt.Errorf("%d requests interrupted on %s", len(left), c.names())
+	}
+	return nil
+}
+
+func (c *Consumer) names() string {
+	names := make([]string, 0, len(c.Topics))
+	for _, t := range c.Topics {
+		names = append(names, t.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Journaled tells the requests the journal picks up after a restart, the
+// deploys, see Reconcile.
+func Journaled(e *LedgerEntry) bool {
+	return e.Action == carton.CREATE
+}
+
+// Reconcile resumes or rolls back the deploys of the provider cut by the last shutdown.
+func Reconcile(provider string) {
+	if err := carton.Reconcile(provider, journal.DefaultStore(), carton.DefaultResumeWindow); err != nil {
+		log.Errorf("%s", err)
+	}
+}
+
+// SetProvisioner initializes the provisioner pt with its config and hands it
+// over to the cartons.
+func SetProvisioner(pt string, config interface{}) error {
+	p, err := provision.Get(pt)
+	if err != nil {
+		return err
+	}
+	log.Debugf(cmd.Colorfy("  > configuring ", "blue", "", "bold") + fmt.Sprintf("%s ", pt))
+	if initializableProvisioner, ok := p.(provision.InitializableProvisioner); ok {
+		if err = initializableProvisioner.Initialize(config); err != nil {
+			return fmt.Errorf("unable to initialize %s provisioner\n --> %s", pt, err)
+		}
+		log.Debugf(cmd.Colorfy(fmt.Sprintf("  > %s initialized", pt), "blue", "", "bold"))
+	}
+
+	if messageProvisioner, ok := p.(provision.MessageProvisioner); ok {
+		startupMessage, err := messageProvisioner.StartupMessage()
+		if err == nil && startupMessage != "" {
+			log.Infof(startupMessage)
+		}
+	}
+
+	carton.ProvisionerMap[pt] = p
+	return nil
+}
@@ -0,0 +1,72 @@
+package consumer
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/virtengine/vertice/carton"
+	"github.com/virtengine/vertice/meta"
+	"github.com/virtengine/vertice/provision"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+//initProvisioner keeps the config it was initialized with.
+type initProvisioner struct {
+	provision.Provisioner
+	config interface{}
+	err    error
+}
+
+func (p *initProvisioner) Initialize(m interface{}) error {
+	p.config = m
+	return p.err
+}
+
+func (s *S) TestNewTopic(c *check.C) {
+	dir := c.MkDir()
+	serve := func(r *carton.Requests) error { return nil }
+	t := NewTopic(&meta.Config{Dir: dir}, "kvms", serve)
+	c.Assert(t.Name, check.Equals, "kvms")
+	c.Assert(t.Retry.Topic, check.Equals, "kvms")
+	c.Assert(LedgerDir(&meta.Config{Dir: dir}, "kvms"), check.Equals, filepath.Join(dir, "ledger", "kvms"))
+
+	ran, err := t.Ledger.Run(&carton.Requests{Id: "RQT1", CatId: "ASM1"}, t.Serve)
+	c.Assert(err, check.IsNil)
+	c.Assert(ran, check.Equals, true)
+	e, err := NewFileLedger(LedgerDir(&meta.Config{Dir: dir}, "kvms"), DefaultLedgerTTL).Get("RQT1")
+	c.Assert(err, check.IsNil)
+	c.Assert(e.Status, check.Equals, LEDGER_DONE)
+}
+
+func (s *S) TestConsumerNames(c *check.C) {
+	serve := func(r *carton.Requests) error { return nil }
+	cs := New(nil, NewTopic(nil, "edge", serve), NewTopic(nil, "cloud", serve))
+	c.Assert(cs.names(), check.Equals, "edge, cloud")
+	c.Assert(cs.Close(), check.IsNil)
+}
+
+func (s *S) TestSetProvisioner(c *check.C) {
+	p := &initProvisioner{}
+	provision.Register("fake", p)
+	defer provision.Unregister("fake")
+	defer delete(carton.ProvisionerMap, "fake")
+	c.Assert(SetProvisioner("fake", "config"), check.IsNil)
+	c.Assert(p.config, check.Equals, "config")
+	c.Assert(carton.ProvisionerMap["fake"], check.Equals, provision.Provisioner(p))
+
+	p.err = errors.New("no host")
+	delete(carton.ProvisionerMap, "fake")
+	c.Assert(SetProvisioner("fake", "config"), check.ErrorMatches, "(?s)unable to initialize fake provisioner.*no host")
+	_, ok := carton.ProvisionerMap["fake"]
+	c.Assert(ok, check.Equals, false)
+	c.Assert(SetProvisioner("gone", nil), check.NotNil)
+}
@@ -0,0 +1,395 @@
+package consumer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/vertice/carton"
+)
+
+const (
+	LEDGER_PENDING = "pending"
+	LEDGER_DONE    = "done"
+	LEDGER_FAILED  = "failed"
+
+	//how long a request id is remembered by the ledger.
+	DefaultLedgerTTL = 24 * time.Hour
+
+	//how often the file ledger looks for the entries to prune.
+	filePruneInterval = time.Minute
+	ledgerExt         = ".json"
+)
+
+// LedgerEntry is what the ledger knows about a request.
+type LedgerEntry struct {
+	Id        string
+	CatId     string
+	Action    string
+	Status    string
+	Error     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// LedgerStore records the requests received on a topic, so that a redelivered
+// or a double submitted request is processed only once.
+type LedgerStore interface {
+	// Record adds the request as pending. It returns false when the request
+	// was recorded before, which makes it a duplicate.
+	Record(r *carton.Requests) (bool, error)
+
+	// Finish saves the outcome of a recorded request.
+	Finish(id string, err error) error
+
+	// Get returns the entry of a request, or nil when it isn't recorded.
+	Get(id string) (*LedgerEntry, error)
+
+	// Forget drops the request, so that its redelivery is processed again.
+	Forget(id string) error
+
+	// Pending lists the requests recorded but not finished.
+	Pending() ([]*LedgerEntry, error)
+}
+
+// MemLedger is a LedgerStore living in memory. Entries older than the ttl are pruned.
+type MemLedger struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*LedgerEntry
+}
+
+func NewMemLedger(ttl time.Duration) *MemLedger {
+	return &MemLedger{ttl: ttl, entries: make(map[string]*LedgerEntry)}
+}
+
+func (m *MemLedger) Record(r *carton.Requests) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune()
+	if _, ok := m.entries[r.Id]; ok {
+		return false, nil
+	}
+	now := time.Now()
+	m.entries[r.Id] = &LedgerEntry{
+		Id:        r.Id,
+		CatId:     r.CatId,
+		Action:    r.Action,
+		Status:    LEDGER_PENDING,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	return true, nil
+}
+
+func (m *MemLedger) Finish(id string, err error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[id]
+	if !ok {
+		return nil
+	}
+	e.Status = LEDGER_DONE
+	if err != nil {
+		e.Status = LEDGER_FAILED
+		e.Error = err.Error()
+	}
+	e.UpdatedAt = time.Now()
+	return nil
+}
+
+func (m *MemLedger) Get(id string) (*LedgerEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.entries[id]; ok {
+		c := *e
+		return &c, nil
+	}
+	return nil, nil
+}
+
+func (m *MemLedger) Forget(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, id)
+	return nil
+}
+
+func (m *MemLedger) Pending() ([]*LedgerEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var pending []*LedgerEntry
+	for _, e := range m.entries {
+		if e.Status == LEDGER_PENDING {
+			c := *e
+			pending = append(pending, &c)
+		}
+	}
+	return pending, nil
+}
+
+//pending requests are kept, they are still running.
+func (m *MemLedger) prune() {
+	if m.ttl <= 0 {
+		return
+	}
+	for id, e := range m.entries {
+		if e.Status != LEDGER_PENDING && time.Since(e.UpdatedAt) > m.ttl {
+			delete(m.entries, id)
+		}
+	}
+}
+
+// FileLedger is a LedgerStore keeping an entry per file in a directory, the
+// requests seen survive a restart of vertice. Entries older than the ttl are
+// pruned. A request cut by a restart stays pending until its daemon starts again,
+// see Ledger.ForgetInterrupted.
+type FileLedger struct {
+	Dir    string
+	mu     sync.Mutex
+	ttl    time.Duration
+	pruned time.Time
+}
+
+func NewFileLedger(dir string, ttl time.Duration) *FileLedger {
+	return &FileLedger{Dir: dir, ttl: ttl}
+}
+
+func (f *FileLedger) path(id string) (string, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("request id %q can't name a ledger entry", id)
+	}
+	return filepath.Join(f.Dir, id+ledgerExt), nil
+}
+
+// Record links the entry written aside to its name, which fails when the
+// request was recorded before: two deliveries can't both win.
+func (f *FileLedger) Record(r *carton.Requests) (bool, error) {
+	path, err := f.path(r.Id)
+	if err != nil {
+		return false, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err = os.MkdirAll(f.Dir, 0700); err != nil {
+		return false, err
+	}
+	f.prune()
+	now := time.Now()
+	tmp, err := f.writeAside(path, &LedgerEntry{
+		Id:        r.Id,
+		CatId:     r.CatId,
+		Action:    r.Action,
+		Status:    LEDGER_PENDING,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp)
+	if err = os.Link(tmp, path); err != nil {
+		if os.IsExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (f *FileLedger) Finish(id string, err error) error {
+	path, perr := f.path(id)
+	if perr != nil {
+		return perr
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, rerr := f.read(path)
+	if rerr != nil || e == nil {
+		return rerr
+	}
+	e.Status = LEDGER_DONE
+	if err != nil {
+		e.Status = LEDGER_FAILED
+		e.Error = err.Error()
+	}
+	e.UpdatedAt = time.Now()
+	tmp, werr := f.writeAside(path, e)
+	if werr != nil {
+		return werr
+	}
+	return os.Rename(tmp, path)
+}
+
+func (f *FileLedger) Get(id string) (*LedgerEntry, error) {
+	path, err := f.path(id)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.read(path)
+}
+
+func (f *FileLedger) Forget(id string) error {
+	path, err := f.path(id)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (f *FileLedger) Pending() ([]*LedgerEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	files, err := ioutil.ReadDir(f.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var pending []*LedgerEntry
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ledgerExt) {
+			continue
+		}
+		e, err := f.read(filepath.Join(f.Dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if e != nil && e.Status == LEDGER_PENDING {
+			pending = append(pending, e)
+		}
+	}
+	return pending, nil
+}
+
+func (f *FileLedger) read(path string) (*LedgerEntry, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	e := &LedgerEntry{}
+	if err = json.Unmarshal(b, e); err != nil {
+		return nil, fmt.Errorf("ledger entry %s unreadable: %s", path, err)
+	}
+	return e, nil
+}
+
+//writeAside writes the entry next to path, a crash can't leave a half
+//written entry behind.
+func (f *FileLedger) writeAside(path string, e *LedgerEntry) (string, error) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempFile(f.Dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return "", err
+	}
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+//pending requests are kept, they are still running or were cut by a restart.
+func (f *FileLedger) prune() {
+	if f.ttl <= 0 || time.Since(f.pruned) < filePruneInterval {
+		return
+	}
+	f.pruned = time.Now()
+	files, err := ioutil.ReadDir(f.Dir)
+	if err != nil {
+		log.Errorf("Unable to prune the ledger %s : %s", f.Dir, err)
+		return
+	}
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ledgerExt) {
+			continue
+		}
+		path := filepath.Join(f.Dir, fi.Name())
+		if e, err := f.read(path); err == nil && e != nil && e.Status != LEDGER_PENDING && time.Since(e.UpdatedAt) > f.ttl {
+			os.Remove(path)
+		}
+	}
+}
+
+// Ledger skips the duplicate requests. The requests of an assembly are
+// serialized by the carton lock manager, see carton.OpLocks.
+type Ledger struct {
+	store LedgerStore
+}
+
+func NewLedger(store LedgerStore) *Ledger {
+	return &Ledger{store: store}
+}
+
+// Run processes the request unless it was seen before. It returns false for a duplicate.
+// Requests without an id can't be told apart, they are always run.
+func (l *Ledger) Run(r *carton.Requests, fn func(r *carton.Requests) error) (bool, error) {
+	if r.Id == "" {
+		return true, fn(r)
+	}
+	fresh, err := l.store.Record(r)
+	if err != nil {
+		return false, err
+	}
+	if !fresh {
+		log.Warnf("  skip duplicate request %s (%s - %s) for %s", r.Id, r.Category, r.Action, r.CatId)
+		return false, nil
+	}
+
+	err = fn(r)
+	if carton.IsTransient(err) { //it is coming back, see retry.Policy.
+		if ferr := l.store.Forget(r.Id); ferr != nil {
+			log.Errorf("Unable to forget request %s in the ledger : %s", r.Id, ferr)
+		}
+		return true, err
+	}
+	if ferr := l.store.Finish(r.Id, err); ferr != nil {
+		log.Errorf("Unable to finish request %s in the ledger : %s", r.Id, ferr)
+	}
+	return true, err
+}
+
+// ForgetInterrupted forgets the requests the last run of vertice left pending,
+// unless resumed tells that the journal of their pipeline picks them up. With
+// a nil resumed they are all forgotten. The redelivery of a request forgotten
+// runs it again. Call it before any request is received.
+func (l *Ledger) ForgetInterrupted(resumed func(e *LedgerEntry) bool) error {
+	pending, err := l.store.Pending()
+	if err != nil {
+		return err
+	}
+	for _, e := range pending {
+		if resumed != nil && resumed(e) {
+			continue
+		}
+		log.Warnf("  request %s (%s) for %s was interrupted, its redelivery runs it again", e.Id, e.Action, e.CatId)
+		if err = l.store.Forget(e.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package consumer
+
+import (
+	"errors"
+	"io/ioutil"
+	"sync/atomic"
+	"time"
+
+	"github.com/virtengine/vertice/carton"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestLedgerSkipsDuplicates(c *check.C) {
+	l := NewLedger(NewMemLedger(DefaultLedgerTTL))
+	r := &carton.Requests{Id: "RQT1", CatId: "ASM1", Category: "state", Action: "create"}
+	var runs int32
+	fn := func(r *carton.Requests) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}
+	ran, err := l.Run(r, fn)
+	c.Assert(err, check.IsNil)
+	c.Assert(ran, check.Equals, true)
+	ran, err = l.Run(r, fn)
+	c.Assert(err, check.IsNil)
+	c.Assert(ran, check.Equals, false)
+	c.Assert(atomic.LoadInt32(&runs), check.Equals, int32(1))
+}
+
+func (s *S) TestLedgerRecordsOutcome(c *check.C) {
+	store := NewMemLedger(DefaultLedgerTTL)
+	l := NewLedger(store)
+	r := &carton.Requests{Id: "RQT2", CatId: "ASM1", Action: "create"}
+	_, err := l.Run(r, func(r *carton.Requests) error { return errors.New("no capacity") })
+	c.Assert(err, check.ErrorMatches, "no capacity")
+	e, err := store.Get("RQT2")
+	c.Assert(err, check.IsNil)
+	c.Assert(e.Status, check.Equals, LEDGER_FAILED)
+	c.Assert(e.Error, check.Equals, "no capacity")
+}
+
+func (s *S) TestMemLedgerPrunesFinished(c *check.C) {
+	store := NewMemLedger(time.Millisecond)
+	ok, _ := store.Record(&carton.Requests{Id: "RQT3"})
+	c.Assert(ok, check.Equals, true)
+	store.Finish("RQT3", nil)
+	time.Sleep(5 * time.Millisecond)
+	ok, _ = store.Record(&carton.Requests{Id: "RQT4"})
+	c.Assert(ok, check.Equals, true)
+	e, _ := store.Get("RQT3")
+	c.Assert(e, check.IsNil)
+}
+
+func (s *S) TestLedgerForgetsTransientFailures(c *check.C) {
+	store := NewMemLedger(DefaultLedgerTTL)
+	l := NewLedger(store)
+	r := &carton.Requests{Id: "RQT5", CatId: "ASM1", Action: "create"}
+	_, err := l.Run(r, func(r *carton.Requests) error { return errors.New("dial tcp: i/o timeout") })
+	c.Assert(err, check.NotNil)
+	e, _ := store.Get("RQT5")
+	c.Assert(e, check.IsNil)
+	ran, err := l.Run(r, func(r *carton.Requests) error { return nil })
+	c.Assert(err, check.IsNil)
+	c.Assert(ran, check.Equals, true)
+}
+
+func (s *S) TestFileLedgerOutlivesARestart(c *check.C) {
+	dir := c.MkDir()
+	l := NewLedger(NewFileLedger(dir, DefaultLedgerTTL))
+	r := &carton.Requests{Id: "RQT6", CatId: "ASM1", Action: "create"}
+	ran, err := l.Run(r, func(r *carton.Requests) error { return errors.New("no capacity") })
+	c.Assert(err, check.ErrorMatches, "no capacity")
+	c.Assert(ran, check.Equals, true)
+
+	store := NewFileLedger(dir, DefaultLedgerTTL)
+	e, err := store.Get("RQT6")
+	c.Assert(err, check.IsNil)
+	c.Assert(e.Status, check.Equals, LEDGER_FAILED)
+	c.Assert(e.Error, check.Equals, "no capacity")
+	ran, err = NewLedger(store).Run(r, func(r *carton.Requests) error { return nil })
+	c.Assert(err, check.IsNil)
+	c.Assert(ran, check.Equals, false)
+}
+
+func (s *S) TestFileLedgerForgets(c *check.C) {
+	store := NewFileLedger(c.MkDir(), DefaultLedgerTTL)
+	ok, err := store.Record(&carton.Requests{Id: "RQT7"})
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, true)
+	ok, _ = store.Record(&carton.Requests{Id: "RQT7"})
+	c.Assert(ok, check.Equals, false)
+	c.Assert(store.Forget("RQT7"), check.IsNil)
+	c.Assert(store.Forget("RQT7"), check.IsNil)
+	ok, _ = store.Record(&carton.Requests{Id: "RQT7"})
+	c.Assert(ok, check.Equals, true)
+	files, err := ioutil.ReadDir(store.Dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.HasLen, 1)
+}
+
+func (s *S) TestFileLedgerPrunesFinished(c *check.C) {
+	store := NewFileLedger(c.MkDir(), time.Millisecond)
+	store.Record(&carton.Requests{Id: "RQT8"})
+	store.Record(&carton.Requests{Id: "RQT9"})
+	store.Finish("RQT8", nil)
+	time.Sleep(5 * time.Millisecond)
+	store.pruned = time.Time{}
+	store.Record(&carton.Requests{Id: "RQT10"})
+	e, _ := store.Get("RQT8")
+	c.Assert(e, check.IsNil)
+	e, _ = store.Get("RQT9")
+	c.Assert(e.Status, check.Equals, LEDGER_PENDING)
+}
+
+func (s *S) TestFileLedgerRefusesPaths(c *check.C) {
+	store := NewFileLedger(c.MkDir(), DefaultLedgerTTL)
+	for _, id := range []string{"../RQT1", "a/b", ".hidden"} {
+		_, err := store.Record(&carton.Requests{Id: id})
+		c.Assert(err, check.ErrorMatches, "request id .* can't name a ledger entry", check.Commentf("%s", id))
+	}
+}
+
+func (s *S) TestLedgerForgetsAllInterruptedWithoutAJournal(c *check.C) {
+	store := NewMemLedger(DefaultLedgerTTL)
+	store.Record(&carton.Requests{Id: "RQT16", Action: carton.CREATE})
+	c.Assert(NewLedger(store).ForgetInterrupted(nil), check.IsNil)
+	e, _ := store.Get("RQT16")
+	c.Assert(e, check.IsNil)
+}
+
+func (s *S) TestLedgerForgetsInterrupted(c *check.C) {
+	dir := c.MkDir()
+	store := NewFileLedger(dir, DefaultLedgerTTL)
+	store.Record(&carton.Requests{Id: "RQT11", CatId: "ASM1", Action: carton.CREATE})
+	store.Record(&carton.Requests{Id: "RQT12", CatId: "ASM1", Action: carton.STOP})
+	store.Record(&carton.Requests{Id: "RQT13", CatId: "ASM1", Action: carton.DESTROY})
+	store.Finish("RQT13", nil)
+
+	//vertice restarts, the deploys are resumed by their journal.
+	l := NewLedger(NewFileLedger(dir, DefaultLedgerTTL))
+	c.Assert(l.ForgetInterrupted(func(e *LedgerEntry) bool { return e.Action == carton.CREATE }), check.IsNil)
+	var runs []string
+	fn := func(r *carton.Requests) error {
+		runs = append(runs, r.Id)
+		return nil
+	}
+	for _, id := range []string{"RQT11", "RQT12", "RQT13"} {
+		_, err := l.Run(&carton.Requests{Id: id, CatId: "ASM1"}, fn)
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(runs, check.DeepEquals, []string{"RQT12"})
+}
+
+func (s *S) TestMemLedgerPending(c *check.C) {
+	store := NewMemLedger(DefaultLedgerTTL)
+	store.Record(&carton.Requests{Id: "RQT14"})
+	store.Record(&carton.Requests{Id: "RQT15"})
+	store.Finish("RQT15", errors.New("no capacity"))
+	pending, err := store.Pending()
+	c.Assert(err, check.IsNil)
+	c.Assert(pending, check.HasLen, 1)
+	c.Assert(pending[0].Id, check.Equals, "RQT14")
+}
@@ -2,6 +2,8 @@ package deployd
 
 import (
 	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/libgo/events"
+	constants "github.com/virtengine/libgo/utils"
 	"github.com/virtengine/vertice/carton"
 )
 
@@ -16,18 +18,27 @@ func NewHandler(c *Config) *Handler {
 }
 
 func (h *Handler) serveNSQ(r *carton.Requests) error {
-	p, err := carton.ParseRequest(r)
+	p, err := carton.ParseRequestFor(r, constants.PROVIDER_ONE)
 	if err != nil {
+		h.publish(r, nil, err) //tell why the action never ran.
 		return err
 	}
 	if rp := carton.NewReqOperator(r); rp != nil {
-		err = rp.Accept(&p)
+		results, err := rp.Accept(&p)
 		if err != nil {
 			log.Errorf("Error Request : %s  -  %s  : %s", r.Category, r.Action, err)
 		}
-
-		return err //error is swalled here.
+		h.publish(r, results, err)
+		return err
 	}
 
 	return nil
 }
+
+//publish sends the outcome of the request with the result of every box operated.
+func (h *Handler) publish(r *carton.Requests, results []*carton.BoxResult, err error) {
+	e := carton.OutcomeEvent(r, results, err)
+	if werr := events.NewMulti([]*events.Event{e}).Write(); werr != nil {
+		log.Errorf("Unable to publish the outcome of %s : %s", r.Id, werr)
+	}
+}
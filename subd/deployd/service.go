@@ -1,30 +1,20 @@
 package deployd
 
 import (
-	"fmt"
-	"sync"
-
 	log "github.com/Sirupsen/logrus"
-	nsq "github.com/crackcomm/nsqueue/consumer"
-	"github.com/virtengine/libgo/cmd"
 	constants "github.com/virtengine/libgo/utils"
-	"github.com/virtengine/vertice/carton"
 	"github.com/virtengine/vertice/meta"
-	"github.com/virtengine/vertice/provision"
 	_ "github.com/virtengine/vertice/provision/one"
+	"github.com/virtengine/vertice/subd/consumer"
 )
 
-const (
-	TOPIC       = "vms"
-	maxInFlight = 150
-)
+const TOPIC = "vms"
 
 // Service manages the listener and handler for an HTTP endpoint.
 type Service struct {
-	wg       sync.WaitGroup
 	err      chan error
 	Handler  *Handler
-	Consumer *nsq.Consumer
+	Consumer *consumer.Consumer
 	Meta     *meta.Config
 	Deployd  *Config
 }
@@ -37,86 +27,36 @@ func NewService(c *meta.Config, d *Config) *Service {
 		Deployd: d,
 	}
 	s.Handler = NewHandler(s.Deployd)
+	s.Consumer = consumer.New(c, consumer.NewTopic(c, TOPIC, s.Handler.serveNSQ))
 	//c.MkGlobal() //a setter for global meta config
 	return s
 }
 
 // Open starts the service
 func (s *Service) Open() error {
-	go func() error {
-		log.Info("starting deployd service")
-		if err := nsq.Register(TOPIC, "engine", maxInFlight, s.processNSQ); err != nil {
-			return err
-		}
-		if err := nsq.Connect(s.Meta.NSQd...); err != nil {
-			return err
-		}
-		s.Consumer = nsq.DefaultConsumer
-		nsq.Start(true)
-		return nil
-	}()
 	if s.Deployd.One.Enabled {
-		if err := s.setProvisioner(constants.PROVIDER_ONE); err != nil {
+		if err := consumer.SetProvisioner(constants.PROVIDER_ONE, s.Deployd.ToInterface()); err != nil {
 			return err
 		}
 	}
-	return nil
-}
-
-func (s *Service) processNSQ(msg *nsq.Message) {
-	log.Debugf(TOPIC + " queue received message  :" + string(msg.Body))
-	p, err := carton.NewPayload(msg.Body)
-	if err != nil {
-		return
-	}
-	re, err := p.Convert()
-	if err != nil {
-		log.Errorf("%s", err)
-		return
+	log.Info("starting deployd service")
+	s.Consumer.Open(s.resumed)
+	if s.Deployd.One.Enabled {
+		go consumer.Reconcile(constants.PROVIDER_ONE)
 	}
-	go s.Handler.serveNSQ(re)
-	return
+	return nil
 }
 
-// Close closes the underlying subscribe channel.
+// Close closes the underlying subscribe channel, and waits for the requests in flight.
 func (s *Service) Close() error {
-	if s.Consumer != nil {
-		s.Consumer.Stop()
-	}
+	return s.Consumer.Close()
+}
 
-	s.wg.Wait()
-	return nil
+//resumed tells the requests the journal picks up after a restart, the deploys
+//of one, see consumer.Reconcile.
+func (s *Service) resumed(e *consumer.LedgerEntry) bool {
+	return s.Deployd.One.Enabled && consumer.Journaled(e)
 }
 
 // Err returns a channel for fatal errors that occur on the listener.
 func (s *Service) Err() <-chan error { return s.err }
-
-//this is an array, a property provider helps to load the provider specific stuff
-func (s *Service) setProvisioner(pt string) error {
-	var err error
-	var tempProv provision.Provisioner
-
-	if tempProv, err = provision.Get(pt); err != nil {
-		return err
-	}
-	log.Debugf(cmd.Colorfy("  > configuring ", "blue", "", "bold") + fmt.Sprintf("%s ", pt))
-
-	if initializableProvisioner, ok := tempProv.(provision.InitializableProvisioner); ok {
-		err = initializableProvisioner.Initialize(s.Deployd.ToInterface())
-		if err != nil {
-			return fmt.Errorf("unable to initialize %s provisioner\n --> %s", pt, err)
-		} else {
-			log.Debugf(cmd.Colorfy(fmt.Sprintf("  > %s initialized", pt), "blue", "", "bold"))
-		}
-	}
-
-	if messageProvisioner, ok := tempProv.(provision.MessageProvisioner); ok {
-		startupMessage, err := messageProvisioner.StartupMessage()
-		if err == nil && startupMessage != "" {
-			log.Infof(startupMessage)
-		}
-	}
-
-	carton.ProvisionerMap[pt] = tempProv
-	return nil
-}
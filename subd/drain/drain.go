@@ -0,0 +1,115 @@
+package drain
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/libgo/cmd"
+	"github.com/virtengine/vertice/meta"
+)
+
+// Job is a request being processed by a daemon.
+type Job struct {
+	Id      string
+	Desc    string
+	Started time.Time
+	// Interrupt is called when the job is still running past the drain deadline,
+	// so it can be picked up again after a restart. The job may still finish
+	// before the daemon exits, it must not be handed over yet.
+	Interrupt func()
+}
+
+// Tracker keeps the jobs in flight, so that a daemon can wait for them when it shuts down.
+type Tracker struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	next     uint64
+	draining bool
+	jobs     map[uint64]*Job
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{jobs: make(map[uint64]*Job)}
+}
+
+// Add tracks the job till the returned func is called. It returns false
+// once the tracker is draining, the job must not be started then.
+func (t *Tracker) Add(j *Job) (func(), bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return nil, false
+	}
+	if j.Started.IsZero() {
+		j.Started = time.Now()
+	}
+	id := t.next
+	t.next++
+	t.jobs[id] = j
+	t.wg.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			delete(t.jobs, id)
+			t.mu.Unlock()
+			t.wg.Done()
+		})
+	}, true
+}
+
+// Len returns the number of jobs in flight.
+func (t *Tracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.jobs)
+}
+
+// Drain stops taking jobs and waits for the ones in flight, at most for timeout.
+// The jobs still running are interrupted and returned, oldest first.
+func (t *Tracker) Drain(timeout time.Duration) []*Job {
+	t.mu.Lock()
+	t.draining = true
+	n := len(t.jobs)
+	t.mu.Unlock()
+	if n > 0 {
+		log.Infof("  draining %d requests in flight (%s)", n, timeout)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+	}
+
+	t.mu.Lock()
+	left := make([]*Job, 0, len(t.jobs))
+	for _, j := range t.jobs {
+		left = append(left, j)
+	}
+	t.mu.Unlock()
+	sort.Slice(left, func(i, k int) bool { return left[i].Started.Before(left[k].Started) })
+
+	for _, j := range left {
+		log.Errorf("%s %s %s, running for %s", cmd.Colorfy("  interrupted", "red", "", "bold"), j.Id, j.Desc, time.Since(j.Started))
+		if j.Interrupt != nil {
+			j.Interrupt()
+		}
+	}
+	return left
+}
+
+// Timeout is the drain deadline set in vertice.conf.
+func Timeout(c *meta.Config) time.Duration {
+	if c != nil && c.DrainTimeout > 0 {
+		return time.Duration(c.DrainTimeout)
+	}
+	return meta.DefaultDrainTimeout
+}
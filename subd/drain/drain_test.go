@@ -0,0 +1,55 @@
+package drain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/virtengine/vertice/meta"
+	"github.com/virtengine/vertice/toml"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func (s *S) TestDrainWaitsForJobs(c *check.C) {
+	t := NewTracker()
+	done, ok := t.Add(&Job{Id: "RQT1"})
+	c.Assert(ok, check.Equals, true)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		done()
+	}()
+	c.Assert(t.Drain(time.Second), check.HasLen, 0)
+	c.Assert(t.Len(), check.Equals, 0)
+}
+
+func (s *S) TestDrainInterruptsLateJobs(c *check.C) {
+	t := NewTracker()
+	interrupted := false
+	_, ok := t.Add(&Job{Id: "RQT1", Interrupt: func() { interrupted = true }})
+	c.Assert(ok, check.Equals, true)
+	done, _ := t.Add(&Job{Id: "RQT2"})
+	done()
+	left := t.Drain(10 * time.Millisecond)
+	c.Assert(left, check.HasLen, 1)
+	c.Assert(left[0].Id, check.Equals, "RQT1")
+	c.Assert(interrupted, check.Equals, true)
+}
+
+func (s *S) TestAddWhileDraining(c *check.C) {
+	t := NewTracker()
+	t.Drain(time.Millisecond)
+	_, ok := t.Add(&Job{Id: "RQT1"})
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestTimeout(c *check.C) {
+	c.Assert(Timeout(nil), check.Equals, meta.DefaultDrainTimeout)
+	c.Assert(Timeout(&meta.Config{DrainTimeout: toml.Duration(time.Second)}), check.Equals, time.Second)
+}
@@ -0,0 +1,75 @@
+package kubernetesd
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/virtengine/libgo/cmd"
+	constants "github.com/virtengine/libgo/utils"
+	"github.com/virtengine/vertice/provision/kubernetes"
+	"github.com/virtengine/vertice/provision/kubernetes/cluster"
+)
+
+const (
+	DefaultProvider = kubernetes.Provider
+
+	// DefaultZone is the default region of the cluster.
+	DefaultZone = "africa"
+
+	// DefaultNamespace is the default namespace of the boxes.
+	DefaultNamespace = cluster.DefaultNamespace
+)
+
+type Config struct {
+	Provider   string                `json:"provider" toml:"provider"`
+	Kubernetes kubernetes.Kubernetes `json:"kubernetes" toml:"kubernetes"`
+}
+
+func NewConfig() *Config {
+	r := cluster.Region{
+		Zone:        DefaultZone,
+		Namespace:   DefaultNamespace,
+		ServiceType: string(cluster.DefaultServiceType),
+	}
+	return &Config{
+		Provider: DefaultProvider,
+		Kubernetes: kubernetes.Kubernetes{
+			Enabled: false,
+			Regions: []cluster.Region{r},
+		},
+	}
+}
+
+func (c Config) String() string {
+	w := new(tabwriter.Writer)
+	var b bytes.Buffer
+	w.Init(&b, 0, 8, 0, '\t', 0)
+	b.Write([]byte(cmd.Colorfy("\nConfig:", "white", "", "bold") + "\t" +
+		cmd.Colorfy("Kubernetesd", "cyan", "", "") + "\n"))
+	b.Write([]byte(constants.PROVIDER + "\t" + c.Provider + "\n"))
+	b.Write([]byte("enabled      " + "\t" + strconv.FormatBool(c.Kubernetes.Enabled) + "\n"))
+	for _, r := range c.Kubernetes.Regions {
+		b.Write([]byte("zone         " + "\t" + r.Zone + "\n"))
+		switch {
+		case r.Master != "":
+			b.Write([]byte("master       " + "\t" + r.Master + "\n"))
+		case r.Kubeconfig != "":
+			b.Write([]byte("kubeconfig   " + "\t" + r.Kubeconfig + "\n"))
+		default:
+			b.Write([]byte("master       " + "\t" + "in cluster" + "\n"))
+		}
+		b.Write([]byte("namespace    " + "\t" + r.Namespace + "\n"))
+		b.Write([]byte("service_type " + "\t" + r.ServiceType + "\n"))
+		b.Write([]byte("---\n"))
+	}
+	fmt.Fprintln(w)
+	w.Flush()
+	return strings.TrimSpace(b.String())
+}
+
+func (c Config) toInterface() interface{} {
+	return c.Kubernetes
+}
@@ -0,0 +1,32 @@
+package kubernetesd
+
+import (
+	"github.com/BurntSushi/toml"
+	"gopkg.in/check.v1"
+)
+
+// Ensure the configuration can be parsed.
+func (s *S) TestKubernetesdConfig_Parse(c *check.C) {
+	var cm Config
+	if _, err := toml.Decode(`
+	[kubernetes]
+	  enabled = true
+	  [[kubernetes.region]]
+	    zone = "chennai"
+	    kubeconfig = "/var/lib/vertice/kubeconfig"
+	    namespace = "boxes"
+	    service_type = "LoadBalancer"
+	`, &cm); err != nil {
+		c.Fatal(err)
+	}
+	c.Assert(cm.Kubernetes.Enabled, check.Equals, true)
+	c.Assert(cm.Kubernetes.Regions, check.HasLen, 1)
+	c.Assert(cm.Kubernetes.Regions[0].Kubeconfig, check.Equals, "/var/lib/vertice/kubeconfig")
+	c.Assert(cm.Kubernetes.Regions[0].ServiceType, check.Equals, "LoadBalancer")
+}
+
+func (s *S) TestNewConfig(c *check.C) {
+	cm := NewConfig()
+	c.Assert(cm.Kubernetes.Enabled, check.Equals, false)
+	c.Assert(cm.toInterface(), check.DeepEquals, cm.Kubernetes)
+}
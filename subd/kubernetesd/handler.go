@@ -0,0 +1,34 @@
+package kubernetesd
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/vertice/carton"
+	"github.com/virtengine/vertice/provision/kubernetes"
+)
+
+type Handler struct {
+	Provider string
+	D        *Config
+}
+
+// NewHandler returns a new instance of handler with routes.
+func NewHandler(c *Config) *Handler {
+	return &Handler{D: c, Provider: kubernetes.Provider}
+}
+
+func (h *Handler) serveNSQ(r *carton.Requests) error {
+	p, err := carton.ParseRequestFor(r, h.Provider)
+	if err != nil {
+		return err
+	}
+
+	if rp := carton.NewReqOperator(r); rp != nil {
+		_, err = rp.Accept(&p)
+		if err != nil {
+			log.Errorf("Error Request : %s  -  %s  : %s", r.Category, r.Action, err)
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package libvirtd
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/virtengine/libgo/cmd"
+	constants "github.com/virtengine/libgo/utils"
+	"github.com/virtengine/vertice/provision/libvirt"
+)
+
+const (
+	DefaultProvider = libvirt.Provider
+
+	// DefaultZone is the default region of the kvm host.
+	DefaultZone = "africa"
+
+	// DefaultUri is the default libvirtd of the kvm host, the local one.
+	DefaultUri = "qemu:///system"
+
+	// DefaultPool is the default storage pool of the images and the disks.
+	DefaultPool = "default"
+
+	// DefaultNetwork is the default libvirt network of the domains.
+	DefaultNetwork = "default"
+)
+
+type Config struct {
+	Provider string          `json:"provider" toml:"provider"`
+	Libvirt  libvirt.Libvirt `json:"libvirt" toml:"libvirt"`
+}
+
+func NewConfig() *Config {
+	h := libvirt.Host{
+		Zone:    DefaultZone,
+		Uri:     DefaultUri,
+		Pool:    DefaultPool,
+		Network: DefaultNetwork,
+	}
+	return &Config{
+		Provider: DefaultProvider,
+		Libvirt: libvirt.Libvirt{
+			Enabled: false,
+			Hosts:   []libvirt.Host{h},
+		},
+	}
+}
+
+func (c Config) String() string {
+	w := new(tabwriter.Writer)
+	var b bytes.Buffer
+	w.Init(&b, 0, 8, 0, '\t', 0)
+	b.Write([]byte(cmd.Colorfy("\nConfig:", "white", "", "bold") + "\t" +
+		cmd.Colorfy("Libvirtd", "cyan", "", "") + "\n"))
+	b.Write([]byte(constants.PROVIDER + "\t" + c.Provider + "\n"))
+	b.Write([]byte("enabled      " + "\t" + strconv.FormatBool(c.Libvirt.Enabled) + "\n"))
+	for _, h := range c.Libvirt.Hosts {
+		b.Write([]byte("zone         " + "\t" + h.Zone + "\n"))
+		b.Write([]byte("uri          " + "\t" + h.Uri + "\n"))
+		b.Write([]byte("pool         " + "\t" + h.Pool + "\n"))
+		if h.Bridge != "" {
+			b.Write([]byte("bridge       " + "\t" + h.Bridge + "\n"))
+		} else {
+			b.Write([]byte("network      " + "\t" + h.Network + "\n"))
+		}
+		b.Write([]byte("---\n"))
+	}
+	fmt.Fprintln(w)
+	w.Flush()
+	return strings.TrimSpace(b.String())
+}
+
+func (c Config) toInterface() interface{} {
+	return c.Libvirt
+}
@@ -0,0 +1,32 @@
+package libvirtd
+
+import (
+	"github.com/BurntSushi/toml"
+	"gopkg.in/check.v1"
+)
+
+// Ensure the configuration can be parsed.
+func (s *S) TestLibvirtdConfig_Parse(c *check.C) {
+	var cm Config
+	if _, err := toml.Decode(`
+	[libvirt]
+	  enabled = true
+	  [[libvirt.host]]
+	    zone = "chennai"
+	    uri = "qemu+tcp://10.0.0.2/system"
+	    pool = "vms"
+	    bridge = "br0"
+	`, &cm); err != nil {
+		c.Fatal(err)
+	}
+	c.Assert(cm.Libvirt.Enabled, check.Equals, true)
+	c.Assert(cm.Libvirt.Hosts, check.HasLen, 1)
+	c.Assert(cm.Libvirt.Hosts[0].Uri, check.Equals, "qemu+tcp://10.0.0.2/system")
+	c.Assert(cm.Libvirt.Hosts[0].Bridge, check.Equals, "br0")
+}
+
+func (s *S) TestNewConfig(c *check.C) {
+	cm := NewConfig()
+	c.Assert(cm.Libvirt.Enabled, check.Equals, false)
+	c.Assert(cm.toInterface(), check.DeepEquals, cm.Libvirt)
+}
@@ -0,0 +1,50 @@
+package libvirtd
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/vertice/meta"
+	"github.com/virtengine/vertice/provision/libvirt"
+	"github.com/virtengine/vertice/subd/consumer"
+)
+
+const TOPIC = "kvms"
+
+// Service consumes the requests of the boxes on the libvirt hosts.
+type Service struct {
+	err      chan error
+	Handler  *Handler
+	Consumer *consumer.Consumer
+	Meta     *meta.Config
+	Libvirtd *Config
+}
+
+// NewService returns a new instance of Service.
+func NewService(c *meta.Config, d *Config) *Service {
+	s := &Service{
+		err:      make(chan error),
+		Meta:     c,
+		Libvirtd: d,
+	}
+	s.Handler = NewHandler(s.Libvirtd)
+	s.Consumer = consumer.New(c, consumer.NewTopic(c, TOPIC, s.Handler.serveNSQ))
+	return s
+}
+
+// Open starts the service
+func (s *Service) Open() error {
+	if err := consumer.SetProvisioner(libvirt.Provider, s.Libvirtd.toInterface()); err != nil {
+		return err
+	}
+	log.Info("starting libvirtd service")
+	s.Consumer.Open(consumer.Journaled)
+	go consumer.Reconcile(libvirt.Provider)
+	return nil
+}
+
+// Close closes the underlying subscribe channel, and waits for the requests in flight.
+func (s *Service) Close() error {
+	return s.Consumer.Close()
+}
+
+// Err returns a channel for fatal errors that occur on the listener.
+func (s *Service) Err() <-chan error { return s.err }
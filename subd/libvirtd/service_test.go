@@ -0,0 +1,31 @@
+package libvirtd
+
+import (
+	"testing"
+
+	"github.com/virtengine/vertice/provision/libvirt"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct {
+	service *Service
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpSuite(c *check.C) {
+	srv := NewService(nil, NewConfig())
+	s.service = srv
+	c.Assert(srv, check.NotNil)
+}
+
+func (s *S) TestNewService(c *check.C) {
+	c.Assert(s.service.Handler.Provider, check.Equals, libvirt.Provider)
+	c.Assert(s.service.Consumer.Topics, check.HasLen, 1)
+	c.Assert(s.service.Consumer.Topics[0].Name, check.Equals, TOPIC)
+	c.Assert(s.service.Consumer.Topics[0].Ledger, check.NotNil)
+}
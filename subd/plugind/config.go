@@ -0,0 +1,66 @@
+package plugind
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/virtengine/libgo/cmd"
+	"github.com/virtengine/vertice/provision/plugin"
+)
+
+type Config struct {
+	Enabled bool            `json:"enabled" toml:"enabled"`
+	Plugins []plugin.Plugin `json:"plugin" toml:"plugin"`
+}
+
+func NewConfig() *Config {
+	return &Config{
+		Enabled: false,
+		Plugins: make([]plugin.Plugin, 0),
+	}
+}
+
+//topic is where the requests of the plugin come, its name unless set.
+func topic(p plugin.Plugin) string {
+	if p.Topic == "" {
+		return p.Name
+	}
+	return p.Topic
+}
+
+// Validate refuses the plugins with no name or endpoint, or a name taken twice.
+func (c Config) Validate() error {
+	seen := make(map[string]bool, len(c.Plugins))
+	for _, p := range c.Plugins {
+		switch {
+		case p.Name == "" || p.Endpoint == "":
+			return fmt.Errorf("plugin %q needs a name and an endpoint", p.Name)
+		case seen[p.Name]:
+			return fmt.Errorf("plugin %s is listed twice", p.Name)
+		}
+		seen[p.Name] = true
+	}
+	return nil
+}
+
+func (c Config) String() string {
+	w := new(tabwriter.Writer)
+	var b bytes.Buffer
+	w.Init(&b, 0, 8, 0, '\t', 0)
+	b.Write([]byte(cmd.Colorfy("\nConfig:", "white", "", "bold") + "\t" +
+		cmd.Colorfy("Plugind", "cyan", "", "") + "\n"))
+	b.Write([]byte("enabled      " + "\t" + strconv.FormatBool(c.Enabled) + "\n"))
+	for _, p := range c.Plugins {
+		b.Write([]byte("name         " + "\t" + p.Name + "\n"))
+		b.Write([]byte("endpoint     " + "\t" + p.Endpoint + "\n"))
+		b.Write([]byte("topic        " + "\t" + topic(p) + "\n"))
+		b.Write([]byte("timeout      " + "\t" + p.Timeout.String() + "\n"))
+		b.Write([]byte("---\n"))
+	}
+	fmt.Fprintln(w)
+	w.Flush()
+	return strings.TrimSpace(b.String())
+}
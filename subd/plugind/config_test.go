@@ -0,0 +1,47 @@
+package plugind
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+// Ensure the configuration can be parsed.
+func (s *S) TestPlugindConfig_Parse(c *check.C) {
+	var cm Config
+	if _, err := toml.Decode(`
+enabled = true
+  [[plugin]]
+    name = "proxmox"
+    endpoint = "http://localhost:7910"
+    timeout = "5m"
+  [[plugin]]
+    name = "kvm"
+    endpoint = "http://localhost:7911"
+    topic = "edge"
+`, &cm); err != nil {
+		c.Fatal(err)
+	}
+
+	c.Assert(cm.Enabled, check.Equals, true)
+	c.Assert(cm.Plugins, check.HasLen, 2)
+	c.Assert(time.Duration(cm.Plugins[0].Timeout), check.Equals, 5*time.Minute)
+	c.Assert(topic(cm.Plugins[0]), check.Equals, "proxmox")
+	c.Assert(topic(cm.Plugins[1]), check.Equals, "edge")
+	c.Assert(cm.Validate(), check.IsNil)
+
+	cm.Plugins[1].Name = "proxmox"
+	c.Assert(cm.Validate(), check.ErrorMatches, ".*listed twice")
+	cm.Plugins[1].Endpoint = ""
+	c.Assert(cm.Validate(), check.NotNil)
+}
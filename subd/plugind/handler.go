@@ -0,0 +1,31 @@
+package plugind
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/vertice/carton"
+)
+
+type Handler struct {
+	Provider string
+}
+
+// NewHandler returns a new instance of handler for the plugin named provider.
+func NewHandler(provider string) *Handler {
+	return &Handler{Provider: provider}
+}
+
+func (h *Handler) serveNSQ(r *carton.Requests) error {
+	p, err := carton.ParseRequestFor(r, h.Provider)
+	if err != nil {
+		return err
+	}
+
+	if rp := carton.NewReqOperator(r); rp != nil {
+		_, err = rp.Accept(&p)
+		if err != nil {
+			log.Errorf("Error Request : %s  -  %s  : %s", r.Category, r.Action, err)
+		}
+		return err
+	}
+	return nil
+}
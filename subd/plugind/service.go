@@ -0,0 +1,60 @@
+package plugind
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/vertice/meta"
+	"github.com/virtengine/vertice/provision/plugin"
+	"github.com/virtengine/vertice/subd/consumer"
+)
+
+// Service runs the requests of the plugin provisioners, each on its topic.
+type Service struct {
+	err      chan error
+	Consumer *consumer.Consumer
+	Meta     *meta.Config
+	Plugind  *Config
+}
+
+// NewService returns a new instance of Service.
+func NewService(c *meta.Config, d *Config) *Service {
+	s := &Service{
+		err:     make(chan error),
+		Meta:    c,
+		Plugind: d,
+	}
+	topics := make([]*consumer.Topic, 0, len(d.Plugins))
+	for _, p := range d.Plugins {
+		topics = append(topics, consumer.NewTopic(c, topic(p), NewHandler(p.Name).serveNSQ))
+	}
+	s.Consumer = consumer.New(c, topics...)
+	return s
+}
+
+// Open shakes hands with the plugins and starts listening to their topics.
+func (s *Service) Open() error {
+	if err := s.Plugind.Validate(); err != nil {
+		return err
+	}
+	for _, p := range s.Plugind.Plugins {
+		if err := s.setProvisioner(p); err != nil {
+			return err
+		}
+	}
+	log.Info("starting plugind service")
+	s.Consumer.Open(nil) //the plugins keep no journal.
+	return nil
+}
+
+// Close closes the underlying subscribe channel, and waits for the requests in flight.
+func (s *Service) Close() error {
+	return s.Consumer.Close()
+}
+
+// Err returns a channel for fatal errors that occur on the listener.
+func (s *Service) Err() <-chan error { return s.err }
+
+//registers the plugin as a provisioner and shakes hands with it.
+func (s *Service) setProvisioner(p plugin.Plugin) error {
+	plugin.Register(p)
+	return consumer.SetProvisioner(p.Name, p)
+}
@@ -0,0 +1,32 @@
+package plugind
+
+import (
+	"github.com/virtengine/vertice/carton"
+	"github.com/virtengine/vertice/meta"
+	"github.com/virtengine/vertice/provision"
+	"github.com/virtengine/vertice/provision/plugin"
+	"github.com/virtengine/vertice/provision/plugin/plugintest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestSetProvisioner(c *check.C) {
+	_, srv := plugintest.NewServer("edge", "deploy", "destroy", "start", "stop")
+	defer srv.Close()
+	defer delete(carton.ProvisionerMap, "edge")
+
+	svc := NewService(&meta.Config{}, &Config{Enabled: true, Plugins: []plugin.Plugin{{Name: "edge", Endpoint: srv.URL}}})
+	c.Assert(svc.setProvisioner(svc.Plugind.Plugins[0]), check.IsNil)
+	p, ok := carton.ProvisionerMap["edge"]
+	c.Assert(ok, check.Equals, true)
+	c.Assert(provision.Supports(p, provision.CapStop), check.Equals, true)
+	c.Assert(provision.Supports(p, provision.CapSnapshot), check.Equals, false)
+
+	//the requests it can't run are refused before they reach it.
+	_, err := carton.NewReqParser("ASM1").For("edge").ParseRequest(carton.SNAPSHOT, carton.SNAPCREATE)
+	c.Assert(err, check.FitsTypeOf, &carton.UnsupportedError{})
+}
+
+func (s *S) TestSetProvisionerUnreachable(c *check.C) {
+	svc := NewService(&meta.Config{}, &Config{Enabled: true, Plugins: []plugin.Plugin{{Name: "gone", Endpoint: "http://127.0.0.1:1"}}})
+	c.Assert(svc.setProvisioner(svc.Plugind.Plugins[0]), check.NotNil)
+}
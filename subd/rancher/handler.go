@@ -2,6 +2,7 @@ package rancher
 
 import (
 	log "github.com/Sirupsen/logrus"
+	constants "github.com/virtengine/libgo/utils"
 	"github.com/virtengine/vertice/carton"
 )
 
@@ -12,17 +13,17 @@ type Handler struct {
 
 // NewHandler returns a new instance of handler with routes.
 func NewHandler(c *Config) *Handler {
-	return &Handler{D: c}
+	return &Handler{D: c, Provider: constants.PROVIDER_RANCHER}
 }
 
 func (h *Handler) serveNSQ(r *carton.Requests) error {
-	p, err := carton.ParseRequest(r)
+	p, err := carton.ParseRequestFor(r, h.Provider)
 	if err != nil {
 		return err
 	}
 
 	if rp := carton.NewReqOperator(r); rp != nil {
-		err = rp.Accept(&p)
+		_, err = rp.Accept(&p)
 		if err != nil {
 			log.Errorf("Error Request : %s  -  %s  : %s", r.Category, r.Action, err)
 		}
@@ -0,0 +1,152 @@
+package retry
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	nsq "github.com/crackcomm/nsqueue/consumer"
+	nsqp "github.com/crackcomm/nsqueue/producer"
+	"github.com/virtengine/libgo/cmd"
+	"github.com/virtengine/vertice/carton"
+)
+
+const (
+	DefaultMaxAttempts = 5
+	DefaultBackoff     = 10 * time.Second
+	DefaultMaxBackoff  = 5 * time.Minute
+
+	//the dead letters of a topic go to <topic>_dead
+	DeadLetterSuffix = "_dead"
+
+	//nsqd gives up on a message after 60s by default, we touch it well before.
+	touchEvery = 30 * time.Second
+)
+
+// DeadLetter is published when a request failed for good.
+type DeadLetter struct {
+	Topic    string          `json:"topic"`
+	Payload  json.RawMessage `json:"payload"`
+	Reason   string          `json:"reason"`
+	Attempts uint16          `json:"attempts"`
+	FailedAt time.Time       `json:"failed_at"`
+}
+
+// Publisher sends the dead letters. The default one publishes to nsqd.
+type Publisher func(topic string, body []byte) error
+
+// Policy decides the fate of the messages of a topic. Transient failures are
+// requeued with an exponential backoff, the rest end up in the dead letter topic.
+type Policy struct {
+	Topic       string
+	NSQd        []string
+	MaxAttempts uint16
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	Publish     Publisher
+}
+
+func NewPolicy(topic string, nsqd []string) *Policy {
+	p := &Policy{
+		Topic:       topic,
+		NSQd:        nsqd,
+		MaxAttempts: DefaultMaxAttempts,
+		Backoff:     DefaultBackoff,
+		MaxBackoff:  DefaultMaxBackoff,
+	}
+	p.Publish = p.publish
+	return p
+}
+
+// Hold takes over the acknowledgement of the message, which is going to be
+// processed in the background. The returned func stops touching the message,
+// it may be called more than once.
+func (p *Policy) Hold(msg *nsq.Message) func() {
+	msg.DisableAutoResponse()
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(touchEvery)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				msg.Touch()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// Done acknowledges a held message. A failed message is requeued when the error is
+// transient and it has attempts left, otherwise it is dead lettered.
+// It returns true when the message was requeued.
+func (p *Policy) Done(msg *nsq.Message, err error) bool {
+	if err == nil {
+		msg.Finish()
+		return false
+	}
+	if p.ShouldRequeue(msg.Attempts, err) {
+		delay := p.delay(msg.Attempts)
+		log.Warnf("  %s requeue (attempt %d of %d) in %s : %s", p.Topic, msg.Attempts, p.MaxAttempts, delay, err)
+		msg.Requeue(delay)
+		return true
+	}
+	if derr := p.deadLetter(msg.Body, msg.Attempts, err); derr != nil {
+		log.Errorf("Unable to dead letter %s message : %s", p.Topic, derr)
+	}
+	msg.Finish()
+	return false
+}
+
+func (p *Policy) ShouldRequeue(attempts uint16, err error) bool {
+	return carton.IsTransient(err) && attempts < p.MaxAttempts
+}
+
+//backoff doubles on every attempt, nsq counts attempts from 1.
+func (p *Policy) delay(attempts uint16) time.Duration {
+	d := p.Backoff
+	for i := uint16(1); i < attempts; i++ {
+		d *= 2
+		if d >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	return d
+}
+
+func (p *Policy) deadLetter(body []byte, attempts uint16, reason error) error {
+	payload := json.RawMessage(body)
+	var js interface{}
+	if json.Unmarshal(body, &js) != nil { //keep the garbage readable.
+		payload, _ = json.Marshal(string(body))
+	}
+	dl, err := json.Marshal(DeadLetter{
+		Topic:    p.Topic,
+		Payload:  payload,
+		Reason:   reason.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	log.Errorf("%s %s", cmd.Colorfy("  dead letter", "red", "", "bold"), dl)
+	return p.Publish(p.Topic+DeadLetterSuffix, dl)
+}
+
+func (p *Policy) publish(topic string, body []byte) error {
+	if len(p.NSQd) == 0 {
+		return fmt.Errorf("no nsqd to publish %s", topic)
+	}
+	pons := nsqp.New()
+	if err := pons.Connect(p.NSQd[0]); err != nil {
+		return err
+	}
+	defer pons.Stop()
+	return pons.Publish(topic, body)
+}
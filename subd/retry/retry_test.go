@@ -0,0 +1,68 @@
+package retry
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/virtengine/vertice/carton"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func (s *S) TestShouldRequeue(c *check.C) {
+	p := NewPolicy("vms", nil)
+	c.Assert(p.ShouldRequeue(1, errors.New("dial tcp 10.0.0.2:2633: connection refused")), check.Equals, true)
+	c.Assert(p.ShouldRequeue(DefaultMaxAttempts, errors.New("read: connection reset by peer")), check.Equals, false)
+	c.Assert(p.ShouldRequeue(1, errors.New("[one] template not found")), check.Equals, false)
+	c.Assert(p.ShouldRequeue(1, carton.Permanent(errors.New("i/o timeout"))), check.Equals, false)
+}
+
+func (s *S) TestDelayBacksOff(c *check.C) {
+	p := NewPolicy("vms", nil)
+	p.Backoff = time.Second
+	p.MaxBackoff = 5 * time.Second
+	c.Assert(p.delay(1), check.Equals, time.Second)
+	c.Assert(p.delay(2), check.Equals, 2*time.Second)
+	c.Assert(p.delay(3), check.Equals, 4*time.Second)
+	c.Assert(p.delay(4), check.Equals, 5*time.Second)
+}
+
+func (s *S) TestDeadLetter(c *check.C) {
+	p := NewPolicy("vms", nil)
+	var topic string
+	var body []byte
+	p.Publish = func(t string, b []byte) error {
+		topic, body = t, b
+		return nil
+	}
+	err := p.deadLetter([]byte(`{"id":"RQT1"}`), 3, errors.New("no capacity"))
+	c.Assert(err, check.IsNil)
+	c.Assert(topic, check.Equals, "vms_dead")
+	var dl DeadLetter
+	c.Assert(json.Unmarshal(body, &dl), check.IsNil)
+	c.Assert(string(dl.Payload), check.Equals, `{"id":"RQT1"}`)
+	c.Assert(dl.Reason, check.Equals, "no capacity")
+	c.Assert(dl.Attempts, check.Equals, uint16(3))
+}
+
+func (s *S) TestDeadLetterKeepsGarbage(c *check.C) {
+	p := NewPolicy("vms", nil)
+	var body []byte
+	p.Publish = func(t string, b []byte) error {
+		body = b
+		return nil
+	}
+	c.Assert(p.deadLetter([]byte("not json"), 1, errors.New("bad payload")), check.IsNil)
+	var dl DeadLetter
+	c.Assert(json.Unmarshal(body, &dl), check.IsNil)
+	c.Assert(string(dl.Payload), check.Equals, `"not json"`)
+}
@@ -0,0 +1,53 @@
+package schedulerd
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/virtengine/libgo/cmd"
+	"github.com/virtengine/vertice/toml"
+)
+
+const (
+	DefaultTickInterval = time.Minute
+)
+
+type Config struct {
+	Enabled      bool          `json:"enabled" toml:"enabled"`
+	TickInterval toml.Duration `json:"tick_interval" toml:"tick_interval"`
+	//where the schedules are kept, defaults to <meta.dir>/schedules
+	Dir string `json:"dir" toml:"dir"`
+}
+
+func NewConfig() *Config {
+	return &Config{
+		Enabled:      false,
+		TickInterval: toml.Duration(DefaultTickInterval),
+	}
+}
+
+// Validate refuses a tick_interval that isn't positive, no tick would come.
+func (c Config) Validate() error {
+	if c.TickInterval <= 0 {
+		return fmt.Errorf("tick_interval must be positive, not %s", c.TickInterval)
+	}
+	return nil
+}
+
+func (c Config) String() string {
+	w := new(tabwriter.Writer)
+	var b bytes.Buffer
+	w.Init(&b, 0, 8, 0, '\t', 0)
+	b.Write([]byte(cmd.Colorfy("\nConfig:", "white", "", "bold") + "\t" +
+		cmd.Colorfy("Schedulerd", "cyan", "", "") + "\n"))
+	b.Write([]byte("enabled      " + "\t" + strconv.FormatBool(c.Enabled) + "\n"))
+	b.Write([]byte("tick_interval" + "\t" + c.TickInterval.String() + "\n"))
+	b.Write([]byte("dir          " + "\t" + c.Dir + "\n"))
+	fmt.Fprintln(w)
+	w.Flush()
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,45 @@
+package schedulerd
+
+import (
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func at(s string) time.Time {
+	t, _ := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+	return t
+}
+
+func (s *S) TestParseCronErrors(c *check.C) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "5-1 * * * *", "*/0 * * * *", "x * * * *"} {
+		_, err := ParseCron(spec)
+		c.Check(err, check.NotNil, check.Commentf("%q", spec))
+	}
+}
+
+func (s *S) TestCronNext(c *check.C) {
+	cases := []struct {
+		spec, from, next string
+	}{
+		{"0 20 * * mon-fri", "2017-03-03 19:59", "2017-03-03 20:00"}, //friday
+		{"0 20 * * mon-fri", "2017-03-03 20:00", "2017-03-06 20:00"}, //over the weekend
+		{"*/15 * * * *", "2017-03-03 10:07", "2017-03-03 10:15"},
+		{"@weekly", "2017-03-03 10:07", "2017-03-05 00:00"},
+		{"0 0 1 jan *", "2017-03-03 10:07", "2018-01-01 00:00"},
+		{"30 8 * * 7", "2017-03-03 10:07", "2017-03-05 08:30"},
+		{"0 0 13 * fri", "2017-03-03 10:07", "2017-03-10 00:00"}, //either day field
+		{"0 9,18 * * *", "2017-03-03 10:07", "2017-03-03 18:00"},
+	}
+	for _, t := range cases {
+		cr, err := ParseCron(t.spec)
+		c.Assert(err, check.IsNil)
+		c.Check(cr.Next(at(t.from)), check.Equals, at(t.next), check.Commentf("%s from %s", t.spec, t.from))
+	}
+}
+
+func (s *S) TestCronNextNever(c *check.C) {
+	cr, err := ParseCron("0 0 30 feb *")
+	c.Assert(err, check.IsNil)
+	c.Assert(cr.Next(at("2017-03-03 10:07")).IsZero(), check.Equals, true)
+}
@@ -0,0 +1,34 @@
+package schedulerd
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/libgo/events"
+	"github.com/virtengine/vertice/carton"
+)
+
+type Handler struct {
+}
+
+func NewHandler() *Handler {
+	return &Handler{}
+}
+
+//serve runs the request of a schedule the way deployd runs the ones of the queue.
+func (h *Handler) serve(r *carton.Requests) error {
+	p, err := carton.ParseRequest(r)
+	if err != nil {
+		return err
+	}
+	if rp := carton.NewReqOperator(r); rp != nil {
+		results, err := rp.Accept(&p)
+		if err != nil {
+			log.Errorf("Error Scheduled Request : %s  -  %s  : %s", r.Category, r.Action, err)
+		}
+		e := carton.OutcomeEvent(r, results, err)
+		if werr := events.NewMulti([]*events.Event{e}).Write(); werr != nil {
+			log.Errorf("Unable to publish the outcome of %s : %s", r.Id, werr)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package schedulerd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/virtengine/vertice/carton"
+)
+
+// Schedule is a carton operation run on an assembly every time the cron matches,
+// e.g. a "state stop" every weekday at "0 20 * * mon-fri".
+type Schedule struct {
+	Id        string    `json:"id"`
+	CatId     string    `json:"cat_id"`
+	AccountId string    `json:"account_id"`
+	Category  string    `json:"category"`
+	Action    string    `json:"action"`
+	Cron      string    `json:"cron"`
+	LastRun   time.Time `json:"last_run"`
+	NextRun   time.Time `json:"next_run"`
+	CreatedAt time.Time `json:"created_at"`
+	cron      *Cron
+}
+
+//an assembly has one schedule per operation, setting it again replaces it.
+func scheduleId(catId, category, action string) string {
+	return catId + "." + category + "." + action
+}
+
+// ValidateId sets the id of the schedule, it names its file: the cat_id,
+// category and action can't hold a path.
+func (s *Schedule) ValidateId() error {
+	s.Id = scheduleId(s.CatId, s.Category, s.Action)
+	if len(strings.TrimSpace(s.CatId)) == 0 {
+		return fmt.Errorf("schedule %s: cat_id is required", s.Id)
+	}
+	if strings.ContainsAny(s.Id, `/\`) || strings.Contains(s.Id, "..") {
+		return fmt.Errorf("schedule %q: cat_id, category and action can't hold a path", s.Id)
+	}
+	return nil
+}
+
+// Validate checks the cron and that the operation is one the carton can run.
+func (s *Schedule) Validate() error {
+	if err := s.ValidateId(); err != nil {
+		return err
+	}
+	if len(s.AccountId) == 0 {
+		return fmt.Errorf("schedule %s: cat_id and account_id are required", s.Id)
+	}
+	if s.Category == carton.STATE || s.Category == carton.DONE {
+		return fmt.Errorf("schedule %s: %s can't be scheduled", s.Id, s.Category)
+	}
+	c, err := ParseCron(s.Cron)
+	if err != nil {
+		return err
+	}
+	if _, err = carton.NewReqParser(s.CatId).ParseRequest(s.Category, s.Action); err != nil {
+		return fmt.Errorf("schedule %s: %s", s.Id, err)
+	}
+	s.cron = c
+	return nil
+}
+
+// Due tells if the schedule has to run at now. The runs missed while vertice
+// was down are folded into one.
+func (s *Schedule) Due(now time.Time) bool {
+	return !s.NextRun.IsZero() && !now.Before(s.NextRun)
+}
+
+// Plan sets the next run after t.
+func (s *Schedule) Plan(t time.Time) {
+	s.NextRun = s.cron.Next(t)
+}
+
+// Request is the carton request emitted by a run of the schedule.
+func (s *Schedule) Request(now time.Time) *carton.Requests {
+	return &carton.Requests{
+		Id:        fmt.Sprintf("%s.%d", s.Id, now.Unix()),
+		CatId:     s.CatId,
+		AccountId: s.AccountId,
+		Category:  s.Category,
+		Action:    s.Action,
+		CreatedAt: now,
+	}
+}
+
+// Store keeps the schedules.
+type Store interface {
+	List() ([]*Schedule, error)
+	Save(s *Schedule) error
+	Remove(id string) error
+}
+
+// FileStore keeps a schedule per file in a directory.
+type FileStore struct {
+	Dir string
+}
+
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{Dir: dir}
+}
+
+func (f *FileStore) path(id string) (string, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") || strings.Contains(id, "..") {
+		return "", fmt.Errorf("schedule id %q can't name a schedule file", id)
+	}
+	return filepath.Join(f.Dir, id+".json"), nil
+}
+
+func (f *FileStore) Save(s *Schedule) error {
+	path, err := f.path(s.Id)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(f.Dir, 0700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (f *FileStore) Remove(id string) error {
+	path, err := f.path(id)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List returns the valid schedules, the broken ones are logged and skipped.
+func (f *FileStore) List() ([]*Schedule, error) {
+	files, err := ioutil.ReadDir(f.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	list := make([]*Schedule, 0, len(files))
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".json") {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(f.Dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		s := &Schedule{}
+		if err = json.Unmarshal(b, s); err == nil {
+			err = s.Validate()
+		}
+		if err != nil {
+			log.Errorf("  schedule %s skipped: %s", fi.Name(), err)
+			continue
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
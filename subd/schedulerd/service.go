@@ -0,0 +1,208 @@
+package schedulerd
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	nsq "github.com/crackcomm/nsqueue/consumer"
+	"github.com/virtengine/libgo/cmd"
+	"github.com/virtengine/vertice/carton"
+	"github.com/virtengine/vertice/meta"
+	"github.com/virtengine/vertice/subd/drain"
+)
+
+const (
+	TOPIC       = "schedules"
+	maxInFlight = 10
+
+	SET    = "set"
+	REMOVE = "remove"
+)
+
+// Change sets or removes the schedule of an assembly, it is sent to the schedules topic:
+// {"op": "set", "cat_id": "ASM..", "account_id": "..", "category": "control", "action": "stop", "cron": "0 20 * * mon-fri"}
+type Change struct {
+	Op string `json:"op"`
+	Schedule
+}
+
+// Service runs the schedules that are due, every tick.
+type Service struct {
+	mu       sync.Mutex
+	inflight *drain.Tracker
+	err      chan error
+	stop     chan struct{}
+	Handler  *Handler
+	Consumer *nsq.Consumer
+	Store    Store
+	Meta     *meta.Config
+	Config   *Config
+	//Run operates a request of a schedule, it defaults to the handler.
+	Run func(r *carton.Requests) error
+}
+
+// NewService returns a new instance of Service.
+func NewService(c *meta.Config, config *Config) *Service {
+	s := &Service{
+		err:    make(chan error),
+		Meta:   c,
+		Config: config,
+	}
+	s.Handler = NewHandler()
+	s.Run = s.Handler.serve
+	s.inflight = drain.NewTracker()
+	return s
+}
+
+// Open starts the service
+func (s *Service) Open() error {
+	log.Info("starting schedulerd service")
+	if s.stop != nil {
+		return nil
+	}
+	if err := s.Config.Validate(); err != nil {
+		return err
+	}
+	if s.Store == nil {
+		s.Store = NewFileStore(s.dir())
+	}
+	go func() error {
+		if err := nsq.Register(TOPIC, "engine", maxInFlight, s.processNSQ); err != nil {
+			return err
+		}
+		if err := nsq.Connect(s.Meta.NSQd...); err != nil {
+			return err
+		}
+		s.Consumer = nsq.DefaultConsumer
+		nsq.Start(true)
+		return nil
+	}()
+	s.stop = make(chan struct{})
+	go s.backgroundLoop(s.stop)
+	return nil
+}
+
+func (s *Service) dir() string {
+	if s.Config.Dir != "" {
+		return s.Config.Dir
+	}
+	return filepath.Join(s.Meta.Dir, "schedules")
+}
+
+func (s *Service) backgroundLoop(stop chan struct{}) {
+	t := time.NewTicker(time.Duration(s.Config.TickInterval))
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			log.Info("schedulerd terminating")
+			return
+		case now := <-t.C:
+			s.tick(now)
+		}
+	}
+}
+
+// tick starts the schedules due at now. The next run is saved before the
+// operation starts, a crash doesn't run it twice.
+func (s *Service) tick(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.Store.List()
+	if err != nil {
+		log.Errorf("Unable to list the schedules : %s", err)
+		return
+	}
+	for _, sc := range list {
+		if !sc.Due(now) {
+			continue
+		}
+		sc.LastRun = now
+		sc.Plan(now)
+		if err = s.Store.Save(sc); err != nil {
+			log.Errorf("Unable to save the schedule %s : %s", sc.Id, err)
+			continue
+		}
+		s.fire(sc.Request(now))
+	}
+}
+
+func (s *Service) fire(r *carton.Requests) {
+	done, ok := s.inflight.Add(&drain.Job{
+		Id:   r.Id,
+		Desc: r.Category + " " + r.Action + " " + r.CatId,
+	})
+	if !ok {
+		return
+	}
+	log.Infof(cmd.Colorfy("  > [schedule] ", "blue", "", "bold")+"%s %s %s", r.Category, r.Action, r.CatId)
+	go func() {
+		defer done()
+		if err := s.Run(r); err != nil {
+			log.Errorf("Schedule %s failed : %s", r.Id, err)
+		}
+	}()
+}
+
+func (s *Service) processNSQ(msg *nsq.Message) {
+	log.Debugf(TOPIC + " queue received message  :" + string(msg.Body))
+	ch := &Change{}
+	if err := json.Unmarshal(msg.Body, ch); err != nil {
+		log.Errorf("%s", err)
+		return
+	}
+	if err := s.apply(ch, time.Now()); err != nil {
+		log.Errorf("%s", err)
+	}
+}
+
+func (s *Service) apply(ch *Change, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc := &ch.Schedule
+	switch ch.Op {
+	case SET:
+		if err := sc.Validate(); err != nil {
+			return err
+		}
+		if sc.CreatedAt.IsZero() {
+			sc.CreatedAt = now
+		}
+		sc.Plan(now)
+		if sc.NextRun.IsZero() {
+			return fmt.Errorf("schedule %s: %q never runs", sc.Id, sc.Cron)
+		}
+		log.Infof(cmd.Colorfy("  > [schedule] ", "blue", "", "bold")+"%s next run %s", sc.Id, sc.NextRun)
+		return s.Store.Save(sc)
+	case REMOVE:
+		if err := sc.ValidateId(); err != nil {
+			return err
+		}
+		return s.Store.Remove(sc.Id)
+	default:
+		return fmt.Errorf("schedule change %q unknown, expected %s or %s", ch.Op, SET, REMOVE)
+	}
+}
+
+// Close stops the ticks and waits for the scheduled operations in flight.
+func (s *Service) Close() error {
+	if s.Consumer != nil {
+		s.Consumer.Stop()
+	}
+	if s.stop == nil {
+		return nil
+	}
+	close(s.stop)
+	s.stop = nil
+	if left := s.inflight.Drain(drain.Timeout(s.Meta)); len(left) > 0 {
+		return fmt.Errorf("%d scheduled operations interrupted", len(left))
+	}
+	return nil
+}
+
+// Err returns a channel for fatal errors that occur on the listener.
+func (s *Service) Err() <-chan error { return s.err }
@@ -0,0 +1,105 @@
+package schedulerd
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/virtengine/vertice/carton"
+	"github.com/virtengine/vertice/meta"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct {
+	service *Service
+	mu      sync.Mutex
+	ran     []*carton.Requests
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpTest(c *check.C) {
+	s.ran = nil
+	s.service = NewService(&meta.Config{}, NewConfig())
+	s.service.Store = NewFileStore(c.MkDir())
+	s.service.Run = func(r *carton.Requests) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.ran = append(s.ran, r)
+		return nil
+	}
+}
+
+func (s *S) stop(asm string) *Change {
+	return &Change{Op: SET, Schedule: Schedule{CatId: asm, AccountId: "info@megam.io", Category: carton.CONTROL, Action: carton.STOP, Cron: "0 20 * * *"}}
+}
+
+func (s *S) TestApplyRejectsBadSchedules(c *check.C) {
+	ch := s.stop("ASM1")
+	ch.Cron = "0 25 * * *"
+	c.Assert(s.service.apply(ch, at("2017-03-03 10:00")), check.NotNil)
+	ch = s.stop("ASM1")
+	ch.Category, ch.Action = carton.STATE, carton.DESTROY
+	c.Assert(s.service.apply(ch, at("2017-03-03 10:00")), check.NotNil)
+	ch = s.stop("ASM1")
+	ch.Op = "pause"
+	c.Assert(s.service.apply(ch, at("2017-03-03 10:00")), check.NotNil)
+	list, err := s.service.Store.List()
+	c.Assert(err, check.IsNil)
+	c.Assert(list, check.HasLen, 0)
+}
+
+func (s *S) TestTickRunsTheDueSchedules(c *check.C) {
+	c.Assert(s.service.apply(s.stop("ASM1"), at("2017-03-03 10:00")), check.IsNil)
+	c.Assert(s.service.apply(s.stop("ASM1"), at("2017-03-03 10:00")), check.IsNil) //replaced
+	s.service.tick(at("2017-03-03 19:59"))
+	s.service.tick(at("2017-03-03 20:00"))
+	s.service.tick(at("2017-03-03 20:01"))
+	s.service.inflight.Drain(time.Second)
+
+	c.Assert(s.ran, check.HasLen, 1)
+	c.Assert(s.ran[0].CatId, check.Equals, "ASM1")
+	c.Assert(s.ran[0].Action, check.Equals, carton.STOP)
+	list, _ := s.service.Store.List()
+	c.Assert(list, check.HasLen, 1)
+	c.Assert(list[0].NextRun, check.Equals, at("2017-03-04 20:00"))
+}
+
+func (s *S) TestMissedRunsAreFolded(c *check.C) {
+	c.Assert(s.service.apply(s.stop("ASM1"), at("2017-03-03 10:00")), check.IsNil)
+	s.service.tick(at("2017-03-06 09:00")) //down over the weekend
+	s.service.inflight.Drain(time.Second)
+	c.Assert(s.ran, check.HasLen, 1)
+}
+
+func (s *S) TestRemove(c *check.C) {
+	c.Assert(s.service.apply(s.stop("ASM1"), at("2017-03-03 10:00")), check.IsNil)
+	ch := s.stop("ASM1")
+	ch.Op = REMOVE
+	c.Assert(s.service.apply(ch, at("2017-03-03 10:00")), check.IsNil)
+	s.service.tick(at("2017-03-03 20:00"))
+	c.Assert(s.ran, check.HasLen, 0)
+}
+
+func (s *S) TestOpenRejectsANonPositiveTick(c *check.C) {
+	s.service.Config.TickInterval = 0
+	c.Assert(s.service.Open(), check.ErrorMatches, "tick_interval must be positive, not .*")
+	c.Assert(s.service.stop, check.IsNil)
+}
+
+func (s *S) TestSchedulesCantLeaveTheirDir(c *check.C) {
+	dir := c.MkDir()
+	s.service.Store = NewFileStore(filepath.Join(dir, "schedules"))
+	ch := s.stop("../../ASM1")
+	c.Assert(s.service.apply(ch, at("2017-03-03 10:00")), check.ErrorMatches, ".*can't hold a path")
+	ch.Op = REMOVE
+	c.Assert(s.service.apply(ch, at("2017-03-03 10:00")), check.ErrorMatches, ".*can't hold a path")
+	c.Assert(s.service.Store.Remove("../ASM1"), check.ErrorMatches, ".*can't name a schedule file")
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	c.Assert(files, check.HasLen, 0)
+}